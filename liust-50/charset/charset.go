@@ -6,6 +6,7 @@ import (
 	"image"
 	_ "image/png"
 	"log"
+	"slices"
 )
 
 // Charsets are loosely based on CP 437 and JIS X 0201.
@@ -68,7 +69,7 @@ var runesInternational = [256]rune{
 	'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
 	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º',
 	'¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
-	'░', '▒', '▓' - 1, -1, -1, -1, -1,
+	'░', '▒', '▓', -1, -1, -1, -1, -1,
 	-1, -1, -1, -1, -1, -1, -1, -1,
 	-1, -1, -1, -1, -1, -1, -1, -1,
 	-1, -1, -1, -1, -1, -1, -1, -1,
@@ -138,7 +139,8 @@ func ResolveRune(r rune, charset uint8) (uint8, bool) {
 		}
 	}
 	for i, ch := range runesInternational {
-		if ch == r {
+		// Variants replace some characters, which are then unavailable.
+		if ch == r && !slices.Contains(internationalVariantsChars, uint8(i)) {
 			return uint8(i), true
 		}
 	}
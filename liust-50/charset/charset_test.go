@@ -0,0 +1,53 @@
+package charset
+
+import "testing"
+
+func TestResolveRune(t *testing.T) {
+	for _, test := range []struct {
+		r       rune
+		charset uint8
+		char    uint8
+		ok      bool
+	}{
+		{'A', 0, 0x41, true},
+		{'░', 0, 0xb0, true},
+		{'▓', 0, 0xb2, true},
+		{'█', 0, 0xdb, true},
+		{'▀', 0, 0xdf, true},
+		{'ä', 2, 0x7b, true},
+		{'{', 2, 0, false},
+		{'{', 0, 0x7b, true},
+		{'¥', 8, 0x5c, true},
+		{'\\', 8, 0, false},
+		{'A', 0x63, 0x41, true},
+		{'ｱ', 0x63, 0xb1, true},
+		{'█', 0x63, 0, false},
+		{'A', 13, 0, false},
+	} {
+		char, ok := ResolveRune(test.r, test.charset)
+		if ok != test.ok || char != test.char {
+			t.Errorf("%q in %#x: got %#x, %t, expected %#x, %t",
+				test.r, test.charset, char, ok, test.char, test.ok)
+		}
+	}
+}
+
+func TestResolveRoundTrip(t *testing.T) {
+	charsets := []uint8{0x63}
+	for i := range runesInternationalVariants {
+		charsets = append(charsets, uint8(i))
+	}
+	for _, charset := range charsets {
+		for char := 0; char <= 0xff; char++ {
+			r := ResolveCharToRune(uint8(char), charset)
+			if r < 0 {
+				continue
+			}
+			resolved, ok := ResolveRune(r, charset)
+			if !ok || ResolveCharToRune(resolved, charset) != r {
+				t.Errorf("%#x in %#x: %q resolves to %#x",
+					char, charset, r, resolved)
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/weather"
+)
+
+const airQualityURL = "https://air-quality-api.open-meteo.com/v1/air-quality"
+
+// airQualityProducer shows the air quality index, and the concentration
+// of fine particulate matter, such as "AQI 42 PM2.5 12", from Open-Meteo,
+// which combines CAMS forecasts for the whole world.
+// The index blinks when the air is unhealthy.
+type airQualityProducer struct {
+	// Index is either "european", or "us".
+	Index string `toml:"index"`
+	// PM adds PM2.5 concentration, in micrograms per cubic metre.
+	PM bool `toml:"pm"`
+	// Threshold is the index at which it starts blinking, and defaults
+	// to where the air is considered to be poor (60), or unhealthy (151).
+	Threshold float64       `toml:"threshold"`
+	Interval  time.Duration `toml:"interval"`
+
+	client   *http.Client
+	location LocationConfig
+	failures int
+}
+
+// airQualityBlinkInterval is how long the index stays on and off.
+const airQualityBlinkInterval = 500 * time.Millisecond
+
+func init() {
+	registerProducer("airquality", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		ap := &airQualityProducer{
+			Index:    "european",
+			PM:       true,
+			Interval: 30 * time.Minute,
+			client:   &http.Client{Timeout: 30 * time.Second},
+			location: config.Location,
+		}
+		if err := config.DecodeOptions(region, ap); err != nil {
+			return nil, err
+		}
+		switch ap.Index {
+		case "european":
+			if ap.Threshold == 0 {
+				ap.Threshold = 60
+			}
+		case "us":
+			if ap.Threshold == 0 {
+				ap.Threshold = 151
+			}
+		default:
+			return nil, fmt.Errorf("unsupported index: %q", ap.Index)
+		}
+		if ap.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return config.Location.unlessPending(ap), nil
+	})
+}
+
+// fetch returns the current index, and PM2.5 concentration.
+func (ap *airQualityProducer) fetch(ctx context.Context) (float64, float64, error) {
+	url := fmt.Sprintf("%s?latitude=%.4f&longitude=%.4f&current=%s_aqi,pm2_5",
+		airQualityURL, ap.location.Latitude, ap.location.Longitude, ap.Index)
+
+	var result struct {
+		Current struct {
+			EuropeanAQI *float64 `json:"european_aqi"`
+			USAQI       *float64 `json:"us_aqi"`
+			PM25        *float64 `json:"pm2_5"`
+		} `json:"current"`
+	}
+	if err := weather.FetchJSON(ctx, ap.client, url, &result); err != nil {
+		return 0, 0, err
+	}
+	aqi := result.Current.EuropeanAQI
+	if ap.Index == "us" {
+		aqi = result.Current.USAQI
+	}
+	if aqi == nil || result.Current.PM25 == nil {
+		return 0, 0, errors.New("no usable air quality data found")
+	}
+	return *aqi, *result.Current.PM25, nil
+}
+
+func (ap *airQualityProducer) format(aqi, pm float64, visible bool) string {
+	value := fmt.Sprintf("%d", int(math.Round(aqi)))
+	if !visible {
+		value = strings.Repeat(" ", len(value))
+	}
+	text := "AQI " + value
+	if ap.PM {
+		text += fmt.Sprintf(" PM2.5 %d", int(math.Round(pm)))
+	}
+	return text
+}
+
+func (ap *airQualityProducer) Run(ctx context.Context, out chan<- string) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	blinker := time.NewTicker(airQualityBlinkInterval)
+	defer blinker.Stop()
+
+	var (
+		aqi, pm float64
+		known   bool
+		visible = true
+	)
+	for {
+		var blinking <-chan time.Time
+		if known {
+			if aqi >= ap.Threshold {
+				blinking = blinker.C
+			} else {
+				visible = true
+			}
+			if !send(ctx, out, ap.format(aqi, pm, visible)) {
+				return
+			}
+		}
+
+		select {
+		case <-timer.C:
+			a, p, err := ap.fetch(ctx)
+			if err != nil {
+				slog.Warn("Air quality failed", "error", err)
+				ap.failures++
+				timer.Reset(weatherBackoff(ap.Interval, ap.failures))
+				continue
+			}
+			aqi, pm, known, ap.failures = a, p, true, 0
+			timer.Reset(ap.Interval)
+		case <-blinking:
+			visible = !visible
+		case <-ctx.Done():
+			return
+		}
+	}
+}
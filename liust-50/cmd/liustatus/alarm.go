@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The default duration of alarms taking over displays.
+const alarmDefaultDuration = time.Minute
+
+// alarm is either a daily alarm, or a one-shot countdown.
+type alarm struct {
+	text     string
+	command  string
+	duration time.Duration
+	// daily is the time of day of daily alarms, or negative for countdowns.
+	daily time.Duration
+	// next is when the alarm goes off.
+	next time.Time
+}
+
+// schedule finds when a daily alarm goes off next.
+func (a *alarm) schedule(now time.Time) {
+	if a.next = clockOn(now, a.daily); !a.next.After(now) {
+		a.next = clockOn(now.AddDate(0, 0, 1), a.daily)
+	}
+}
+
+// fire makes the alarm take over all displays, and runs its command.
+func (a *alarm) fire() {
+	text := a.text
+	if text == "" {
+		text = "Alarm"
+		if a.daily < 0 {
+			text = "Time is up"
+		}
+	}
+	slog.Info("Alarm", "text", text)
+	Takeover(Message{
+		Text:     text,
+		Priority: 2,
+		Duration: a.duration,
+		Line:     -1,
+		Blink:    true,
+	})
+	if a.command == "" {
+		return
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", a.command)
+	cmd.Stderr = stderrLogger("alarm", a.command)
+	if err := cmd.Start(); err != nil {
+		slog.Warn("Alarm command failed", "alarm", a.command, "error", err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			slog.Warn("Alarm command failed", "alarm", a.command, "error", err)
+		}
+	}()
+}
+
+// alarmScheduler keeps track of alarms, and lets others wait for changes.
+// Alarms either come from the configuration, or are added at runtime.
+type alarmScheduler struct {
+	mu         sync.Mutex
+	configured []*alarm
+	added      []*alarm
+	changed    chan struct{} // closed on change
+}
+
+var alarms = &alarmScheduler{changed: make(chan struct{})}
+
+// notify must be called with the mutex held.
+func (s *alarmScheduler) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Configure replaces alarms coming from the configuration.
+func (s *alarmScheduler) Configure(configs []AlarmConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.configured = nil
+	for _, ac := range configs {
+		a := &alarm{text: ac.Text, command: ac.Command,
+			duration: ac.Duration, daily: ac.at}
+		a.schedule(now)
+		s.configured = append(s.configured, a)
+	}
+	s.notify()
+}
+
+// AddDaily adds an alarm going off every day at the given time of day.
+func (s *alarmScheduler) AddDaily(at time.Duration, text, command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := &alarm{text: text, command: command,
+		duration: alarmDefaultDuration, daily: at}
+	a.schedule(time.Now())
+	s.added = append(s.added, a)
+	s.notify()
+}
+
+// AddCountdown adds an alarm going off once, after the given duration.
+func (s *alarmScheduler) AddCountdown(d time.Duration, text, command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.added = append(s.added, &alarm{text: text, command: command,
+		duration: alarmDefaultDuration, daily: -1, next: time.Now().Add(d)})
+	s.notify()
+}
+
+// Cancel removes all alarms that have been added at runtime.
+func (s *alarmScheduler) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.added = nil
+	s.notify()
+}
+
+// Next returns a copy of the alarm going off next, if any,
+// and a channel that gets closed once alarms change.
+func (s *alarmScheduler) Next() (*alarm, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next *alarm
+	for _, a := range slices.Concat(s.configured, s.added) {
+		if next == nil || a.next.Before(next.next) {
+			next = a
+		}
+	}
+	if next != nil {
+		copied := *next
+		next = &copied
+	}
+	return next, s.changed
+}
+
+// expire fires all alarms that are due, and reschedules daily ones.
+func (s *alarmScheduler) expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*alarm
+	keep := func(a *alarm) bool {
+		if a.next.After(now) {
+			return true
+		}
+		due = append(due, a)
+		if a.daily < 0 {
+			return false
+		}
+		a.schedule(now)
+		return true
+	}
+	s.configured = slices.DeleteFunc(s.configured,
+		func(a *alarm) bool { return !keep(a) })
+	s.added = slices.DeleteFunc(s.added,
+		func(a *alarm) bool { return !keep(a) })
+	if len(due) == 0 {
+		return
+	}
+
+	for _, a := range due {
+		a.fire()
+	}
+	s.notify()
+}
+
+// Run keeps firing alarms as they become due.
+func (s *alarmScheduler) Run(ctx context.Context) {
+	for {
+		wait := time.Hour
+		next, changed := s.Next()
+		if next != nil {
+			wait = min(wait, time.Until(next.next))
+		}
+
+		// Waking up regularly deals with system suspension and clock changes.
+		timer := time.NewTimer(min(wait, time.Minute))
+		select {
+		case <-timer.C:
+			s.expire(time.Now())
+		case <-changed:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+func init() {
+	registerProducer("alarm", func(*Config, *RegionConfig) (Producer, error) {
+		return ProducerFunc(alarmProducer), nil
+	})
+}
+
+// alarmProducer shows the alarm going off next, either with the time
+// remaining for countdowns, such as "Tea 2:59", or as "07:30 Wake up".
+func alarmProducer(ctx context.Context, out chan<- string) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		next, changed := alarms.Next()
+		var tick <-chan time.Time
+		content := ""
+		switch {
+		case next == nil:
+		case next.daily >= 0:
+			content = next.next.Format("15:04")
+			if next.text != "" {
+				content += " " + next.text
+			}
+		default:
+			tick = ticker.C
+			text, remaining := next.text, max(time.Until(next.next), 0)
+			if text == "" {
+				text = "Timer"
+			}
+			seconds := int((remaining + time.Second - 1) / time.Second)
+			if seconds >= 3600 {
+				content = fmt.Sprintf("%s %d:%02d:%02d",
+					text, seconds/3600, seconds/60%60, seconds%60)
+			} else {
+				content = fmt.Sprintf("%s %d:%02d", text, seconds/60, seconds%60)
+			}
+		}
+		if !send(ctx, out, content) {
+			return
+		}
+
+		select {
+		case <-tick:
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
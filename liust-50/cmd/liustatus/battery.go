@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// batteryProducer shows the charge of a battery, whether it is charging,
+// and the time remaining until it is either empty or full, such as "54%- 2:15".
+type batteryProducer struct {
+	// Battery is a name within /sys/class/power_supply,
+	// by default the first system battery.
+	Battery string `toml:"battery"`
+	// AlertPercent is the charge below which a discharging battery
+	// takes over the display once, or zero to disable that.
+	AlertPercent int           `toml:"alert_percent"`
+	Interval     time.Duration `toml:"interval"`
+
+	alerted bool
+}
+
+const powerSupplyPath = "/sys/class/power_supply"
+
+func init() {
+	registerProducer("battery", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		bp := &batteryProducer{AlertPercent: 10, Interval: 30 * time.Second}
+		if err := config.DecodeOptions(region, bp); err != nil {
+			return nil, err
+		}
+		if bp.AlertPercent < 0 || bp.AlertPercent > 100 {
+			return nil, errors.New("the alert percentage must be within 0..100")
+		}
+		if bp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: bp.Interval, produce: bp.produce}, nil
+	})
+}
+
+func readPowerSupply(name, attribute string) string {
+	b, _ := os.ReadFile(filepath.Join(powerSupplyPath, name, attribute))
+	return strings.TrimSpace(string(b))
+}
+
+func readPowerSupplyInt(name, attribute string) (int64, bool) {
+	n, err := strconv.ParseInt(readPowerSupply(name, attribute), 10, 64)
+	return n, err == nil
+}
+
+// findBattery returns the first battery powering the system,
+// as opposed to peripherals.
+func findBattery() string {
+	entries, _ := os.ReadDir(powerSupplyPath)
+	for _, entry := range entries {
+		name := entry.Name()
+		if readPowerSupply(name, "type") == "Battery" &&
+			readPowerSupply(name, "scope") != "Device" {
+			return name
+		}
+	}
+	return ""
+}
+
+// batteryRemaining estimates how long it will take for the battery
+// to either discharge, or fully charge.
+func batteryRemaining(name string, charging bool) (time.Duration, bool) {
+	// Batteries report either energy and power, or charge and current.
+	now, ok1 := readPowerSupplyInt(name, "energy_now")
+	full, ok2 := readPowerSupplyInt(name, "energy_full")
+	rate, ok3 := readPowerSupplyInt(name, "power_now")
+	if !ok1 || !ok2 || !ok3 {
+		now, ok1 = readPowerSupplyInt(name, "charge_now")
+		full, ok2 = readPowerSupplyInt(name, "charge_full")
+		rate, ok3 = readPowerSupplyInt(name, "current_now")
+	}
+	if !ok1 || !ok2 || !ok3 || rate == 0 {
+		return 0, false
+	}
+
+	// Some drivers report negative values while discharging.
+	rate = max(rate, -rate)
+	if charging {
+		now = max(full-now, 0)
+	}
+	return time.Duration(float64(now) / float64(rate) * float64(time.Hour)), true
+}
+
+func (bp *batteryProducer) produce() string {
+	name := bp.Battery
+	if name == "" {
+		name = findBattery()
+	}
+	capacity, ok := readPowerSupplyInt(name, "capacity")
+	if name == "" || !ok {
+		return "No battery"
+	}
+
+	status := readPowerSupply(name, "status")
+	text := fmt.Sprintf("%d%%", capacity)
+	switch status {
+	case "Charging":
+		text += "+"
+	case "Discharging":
+		text += "-"
+	default:
+		text += "="
+	}
+	if status == "Charging" || status == "Discharging" {
+		remaining, ok := batteryRemaining(name, status == "Charging")
+		if ok && remaining < 100*time.Hour {
+			minutes := int(remaining.Round(time.Minute).Minutes())
+			text += fmt.Sprintf(" %d:%02d", minutes/60, minutes%60)
+		}
+	}
+
+	// Only alert once per discharge.
+	low := status == "Discharging" && capacity < int64(bp.AlertPercent)
+	if low && !bp.alerted {
+		Takeover(Message{
+			Text:     "Battery low\n" + text,
+			Priority: 1,
+			Duration: 10 * time.Second,
+			Line:     -1,
+		})
+	}
+	bp.alerted = low
+	return text
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+)
+
+// bigClockProducer renders one row of a clock that takes up both lines,
+// with digits composed of block characters, which only international
+// charsets have, or of user-defined characters.
+// Typically, it is given a page of two regions.
+type bigClockProducer struct {
+	// Go time layout, see https://pkg.go.dev/time#pkg-constants,
+	// which may only produce digits, colons, and spaces.
+	Format string `toml:"format"`
+	// Row selects the upper (0) or lower (1) half of the digits,
+	// and defaults to the region's line.
+	Row int `toml:"row"`
+	// BlinkColon makes colons disappear every other second.
+	BlinkColon bool `toml:"blink_colon"`
+	// UserChars draws narrower digits with user-defined characters,
+	// which work in any charset.
+	UserChars bool `toml:"user_chars"`
+
+	width  int
+	digits map[rune][2]string
+}
+
+func init() {
+	registerProducer("bigclock", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		bp := &bigClockProducer{
+			Format: "15:04",
+			Row:    region.Line,
+			width:  region.Width,
+		}
+		if err := config.DecodeOptions(region, bp); err != nil {
+			return nil, err
+		}
+		bp.digits = encoder.BlockDigits
+		if bp.UserChars {
+			bp.digits = encoder.UserDigits
+		}
+		for _, halves := range bp.digits {
+			if !encoder.Encodable(halves[0]+halves[1], region.charset) {
+				return nil, fmt.Errorf(
+					"charset %#x cannot show the digits", region.charset)
+			}
+		}
+		if bp.Row < 0 || bp.Row > 1 {
+			return nil, fmt.Errorf("invalid row: %d", bp.Row)
+		}
+		for _, r := range time.Date(2000, 12, 31, 23, 59, 59, 0, time.UTC).
+			Format(bp.Format) {
+			if _, ok := bp.digits[r]; !ok {
+				return nil, errors.New("the format may only produce digits, " +
+					"colons, and spaces")
+			}
+		}
+		return &periodicProducer{interval: time.Second, produce: bp.produce}, nil
+	})
+}
+
+func (bp *bigClockProducer) produce() string {
+	now := time.Now()
+	var parts []string
+	for _, r := range now.Format(bp.Format) {
+		part := bp.digits[r][bp.Row]
+		if r == ':' && bp.BlinkColon && now.Second()%2 != 0 {
+			part = " "
+		}
+		parts = append(parts, part)
+	}
+
+	// Digits are centred, so that both rows line up.
+	line := strings.Join(parts, " ")
+	padding := max(bp.width-utf8.RuneCountInString(line), 0) / 2
+	return strings.Repeat(" ", padding) + line
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBigClockCharset(t *testing.T) {
+	for _, test := range []struct {
+		charset   uint8
+		userChars bool
+		ok        bool
+	}{
+		{0, false, true},
+		{0x63, false, false},
+		{0, true, true},
+		{0x63, true, true},
+	} {
+		config := loadTestConfig(t, fmt.Sprintf(`charset = %d
+[[page]]
+[[page.region]]
+producer = "bigclock"
+options = { user_chars = %t }
+`, test.charset, test.userChars))
+		_, err := newProducer(config, &config.Displays[0].Pages[0].Regions[0])
+		if (err == nil) != test.ok {
+			t.Errorf("charset %#x, user characters %t: unexpected result: %v",
+				test.charset, test.userChars, err)
+		}
+	}
+}
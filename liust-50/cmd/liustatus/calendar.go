@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// calendarProducer shows the next upcoming event of iCalendar files,
+// with a countdown, such as "Standup in 12m". Shortly before it starts,
+// the event takes over the display, blinking. All-day events are ignored.
+type calendarProducer struct {
+	Sources []calendarSource `toml:"sources"`
+	// Horizon limits how far ahead events are shown.
+	Horizon time.Duration `toml:"horizon"`
+	// Alert is how long before the start an event takes over the display,
+	// for AlertDuration, or zero to disable that.
+	Alert         time.Duration `toml:"alert"`
+	AlertDuration time.Duration `toml:"alert_duration"`
+	// Refresh is the period between reloading sources.
+	Refresh time.Duration `toml:"refresh"`
+
+	alerted map[string]bool
+}
+
+// calendarSource is either a local file, an iCalendar URL,
+// or a CalDAV calendar collection.
+type calendarSource struct {
+	Path     string `toml:"path"`
+	URL      string `toml:"url"`
+	CalDAV   bool   `toml:"caldav"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+func init() {
+	registerProducer("calendar", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		cp := &calendarProducer{
+			Horizon:       24 * time.Hour,
+			Alert:         5 * time.Minute,
+			AlertDuration: 30 * time.Second,
+			Refresh:       15 * time.Minute,
+			alerted:       make(map[string]bool),
+		}
+		if err := config.DecodeOptions(region, cp); err != nil {
+			return nil, err
+		}
+		if len(cp.Sources) == 0 {
+			return nil, errors.New("no sources specified")
+		}
+		for _, source := range cp.Sources {
+			if (source.Path == "") == (source.URL == "") {
+				return nil, errors.New("sources need either a path or a URL")
+			}
+		}
+		if cp.Horizon <= 0 || cp.Refresh <= 0 {
+			return nil, errors.New("intervals must be positive")
+		}
+		if cp.Alert < 0 || cp.AlertDuration <= 0 {
+			return nil, errors.New("invalid alert settings")
+		}
+		return cp, nil
+	})
+}
+
+// calendarQuery asks a CalDAV server for events within a time range,
+// see RFC 4791.
+const calendarQuery = `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+<D:prop><C:calendar-data/></D:prop>
+<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+<C:time-range start="%s" end="%s"/>
+</C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`
+
+// calendarDataFrom extracts calendar data from a CalDAV multistatus response.
+func calendarDataFrom(r io.Reader) ([]string, error) {
+	var data []string
+	decoder := xml.NewDecoder(r)
+	inside := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if inside = t.Name.Local == "calendar-data"; inside {
+				data = append(data, "")
+			}
+		case xml.CharData:
+			if inside {
+				data[len(data)-1] += string(t)
+			}
+		case xml.EndElement:
+			inside = false
+		}
+	}
+}
+
+func (cs *calendarSource) fetch(ctx context.Context, from, to time.Time) (
+	[]*icalEvent, error) {
+	if cs.Path != "" {
+		f, err := os.Open(cs.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return icalParse(f)
+	}
+
+	method, body := http.MethodGet, ""
+	if cs.CalDAV {
+		const layout = "20060102T150405Z"
+		method, body = "REPORT", fmt.Sprintf(calendarQuery,
+			from.UTC().Format(layout), to.UTC().Format(layout))
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, method, cs.URL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if cs.Username != "" {
+		req.SetBasicAuth(cs.Username, cs.Password)
+	}
+	if cs.CalDAV {
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+		req.Header.Set("Depth", "1")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", cs.URL, resp.Status)
+	}
+	if !cs.CalDAV {
+		return icalParse(resp.Body)
+	}
+
+	data, err := calendarDataFrom(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var events []*icalEvent
+	for _, calendar := range data {
+		parsed, err := icalParse(bytes.NewReader([]byte(calendar)))
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, parsed...)
+	}
+	return events, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// calendarFormatCountdown formats a duration compactly, such as "12m".
+func calendarFormatCountdown(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// upcoming finds the next event that hasn't ended yet.
+func (cp *calendarProducer) upcoming(events []*icalEvent, now time.Time) (
+	*icalEvent, time.Time) {
+	var best *icalEvent
+	var bestStart time.Time
+	for _, e := range events {
+		if e.allDay {
+			continue
+		}
+		start, ok := e.next(now)
+		if !ok || start.Sub(now) > cp.Horizon {
+			continue
+		}
+		if best == nil || start.Before(bestStart) {
+			best, bestStart = e, start
+		}
+	}
+	return best, bestStart
+}
+
+func (cp *calendarProducer) format(events []*icalEvent, now time.Time) string {
+	e, start := cp.upcoming(events, now)
+	if e == nil {
+		return ""
+	}
+	if !start.After(now) {
+		return e.summary + " now"
+	}
+
+	until := start.Sub(now)
+	text := e.summary + " in " + calendarFormatCountdown(until)
+
+	// Only alert once per occurrence.
+	key := e.uid + start.String()
+	if cp.Alert > 0 && until <= cp.Alert && !cp.alerted[key] {
+		cp.alerted[key] = true
+		Takeover(Message{
+			Text:     text,
+			Priority: 1,
+			Duration: cp.AlertDuration,
+			Line:     -1,
+			Blink:    true,
+		})
+	}
+	return text
+}
+
+func (cp *calendarProducer) load(ctx context.Context) []*icalEvent {
+	now := time.Now()
+	var events []*icalEvent
+	for _, source := range cp.Sources {
+		parsed, err := source.fetch(ctx, now, now.Add(cp.Horizon))
+		if err != nil {
+			slog.Warn("Calendar failed", "error", err)
+			continue
+		}
+		events = append(events, parsed...)
+	}
+	return events
+}
+
+func (cp *calendarProducer) Run(ctx context.Context, out chan<- string) {
+	refresh := time.NewTicker(cp.Refresh)
+	defer refresh.Stop()
+
+	// The countdown is in minutes, so it is updated on their boundaries.
+	events := cp.load(ctx)
+	for {
+		now := time.Now()
+		if !send(ctx, out, cp.format(events, now)) {
+			return
+		}
+
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-refresh.C:
+			events = cp.load(ctx)
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
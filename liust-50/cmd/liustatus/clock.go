@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// clockProducer shows the time in several time zones, either side by side,
+// such as "PRG 15:04 TYO 22:04", or rotating through them.
+type clockProducer struct {
+	Zones []TimezoneConfig `toml:"zones"`
+	// Go time layout, see https://pkg.go.dev/time#pkg-constants,
+	// with names in the status locale.
+	Format string `toml:"format"`
+	// Rotate is how long each zone is shown for,
+	// or zero to show all of them side by side.
+	Rotate time.Duration `toml:"rotate"`
+
+	locale *timeLocale
+}
+
+func init() {
+	registerProducer("clock", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		cp := &clockProducer{Format: "15:04", locale: config.Status.locale}
+		if err := config.DecodeOptions(region, cp); err != nil {
+			return nil, err
+		}
+		if len(cp.Zones) == 0 {
+			return nil, errors.New("no zones specified")
+		}
+		for i := range cp.Zones {
+			if err := cp.Zones[i].validate(); err != nil {
+				return nil, err
+			}
+		}
+		if cp.Rotate < 0 {
+			return nil, errors.New("the rotation period must not be negative")
+		}
+		return &periodicProducer{interval: time.Second, produce: cp.produce}, nil
+	})
+}
+
+func (cp *clockProducer) format(zone *TimezoneConfig, now time.Time) string {
+	return zone.Label + " " + cp.locale.Format(now.In(zone.location), cp.Format)
+}
+
+func (cp *clockProducer) produce() string {
+	now := time.Now()
+	if cp.Rotate > 0 {
+		slot := int(now.UnixNano()/int64(cp.Rotate)) % len(cp.Zones)
+		return cp.format(&cp.Zones[slot], now)
+	}
+
+	var fields []string
+	for i := range cp.Zones {
+		fields = append(fields, cp.format(&cp.Zones[i], now))
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,820 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/weather"
+)
+
+// Config contains all user-adjustable settings of liustatus.
+type Config struct {
+	// Output is an URI describing where display data should be sent to.
+	Output string `toml:"output"`
+	// Charset is the display's character set, as selected by ESC R.
+	Charset uint8 `toml:"charset"`
+	// Regions assign producers to parts of the display.
+	Regions []RegionConfig `toml:"region"`
+	// Pages may be used in place of Regions, to show more information
+	// than fits on the display, a screenful at a time.
+	Pages []PageConfig `toml:"page"`
+	// PageInterval is how often pages are rotated, zero disables rotation.
+	PageInterval time.Duration `toml:"page_interval"`
+	// Coalesce holds back display changes for a while, so that changes
+	// made in quick succession get written out together.
+	Coalesce time.Duration `toml:"coalesce"`
+	// FullRefresh clears the display on startup, rather than trusting it
+	// to still show what it has been left with.
+	FullRefresh bool `toml:"full_refresh"`
+
+	// Displays allow for driving multiple displays at once.
+	// When left empty, a single display is formed from the settings above,
+	// which otherwise serve as defaults.
+	Displays []DisplayConfig `toml:"display"`
+
+	Location LocationConfig `toml:"location"`
+	Status   StatusConfig   `toml:"status"`
+	Weather  WeatherConfig  `toml:"weather"`
+	Control  ControlConfig  `toml:"control"`
+	Shutdown ShutdownConfig `toml:"shutdown"`
+	Power    PowerConfig    `toml:"power"`
+	Dimming  DimmingConfig  `toml:"dimming"`
+	Idle     IdleConfig     `toml:"idle"`
+	Lock     LockConfig     `toml:"lock"`
+	// Notifications are desktop notifications shown as takeovers.
+	Notifications NotificationsConfig `toml:"notifications"`
+	// Alarms go off every day.
+	Alarms []AlarmConfig `toml:"alarm"`
+
+	// meta is needed to decode producer options.
+	meta toml.MetaData
+}
+
+// DisplayConfig describes a single display.
+type DisplayConfig struct {
+	Name         string          `toml:"name"`
+	Output       string          `toml:"output"`
+	Charset      *uint8          `toml:"charset"`
+	Regions      []RegionConfig  `toml:"region"`
+	Pages        []PageConfig    `toml:"page"`
+	PageInterval time.Duration   `toml:"page_interval"`
+	Coalesce     *time.Duration  `toml:"coalesce"`
+	FullRefresh  *bool           `toml:"full_refresh"`
+	Shutdown     *ShutdownConfig `toml:"shutdown"`
+	Power        *PowerConfig    `toml:"power"`
+	Dimming      *DimmingConfig  `toml:"dimming"`
+
+	idle *IdleConfig
+	lock *LockConfig
+}
+
+// PageConfig describes a screenful of content.
+type PageConfig struct {
+	Name    string         `toml:"name"`
+	Regions []RegionConfig `toml:"region"`
+}
+
+// RegionConfig places a producer on the display.
+type RegionConfig struct {
+	Producer string `toml:"producer"`
+	// Line and Column are counted from zero.
+	Line   int `toml:"line"`
+	Column int `toml:"column"`
+	// Width defaults to the rest of the line.
+	Width int `toml:"width"`
+	// Content that doesn't fit is scrolled, unless Truncate is set,
+	// by one character each ScrollInterval, separated by ScrollGap spaces.
+	Truncate       bool          `toml:"truncate"`
+	ScrollInterval time.Duration `toml:"scroll_interval"`
+	ScrollGap      *int          `toml:"scroll_gap"`
+	// MinInterval limits how often content gets updated, so that chatty
+	// producers don't saturate the link. Only the latest content is shown.
+	MinInterval time.Duration `toml:"min_interval"`
+	// Options are specific to the producer.
+	Options toml.Primitive `toml:"options"`
+
+	// charset is that of the display, for producers to pick glyphs by.
+	charset uint8
+}
+
+// LocationConfig specifies where the display is, for weather forecasts.
+type LocationConfig struct {
+	// Place is a name to look the coordinates up by, instead.
+	Place     string  `toml:"place" json:"-"`
+	Latitude  float64 `toml:"latitude" json:"latitude"`
+	Longitude float64 `toml:"longitude" json:"longitude"`
+	Altitude  int     `toml:"altitude" json:"altitude"`
+
+	// pending is set while Place is yet to be looked up.
+	pending bool
+}
+
+// StatusConfig configures the date, temperature, and time line.
+type StatusConfig struct {
+	DateFormat string        `toml:"date_format"`
+	TimeFormat string        `toml:"time_format"`
+	Interval   time.Duration `toml:"interval"`
+	// Locale selects the language of weekday and month names,
+	// such as "de", or "ja" for the Japan-2 charset.
+	Locale string `toml:"locale"`
+	// TwelveHour turns 24-hour time layouts into 12-hour ones with AM/PM.
+	TwelveHour bool `toml:"twelve_hour"`
+	// BlinkColon makes colons in the time disappear every other second.
+	BlinkColon bool `toml:"blink_colon"`
+	// Timezones are rotated through after local time, each shown
+	// for TimezoneInterval, with their label in place of the temperature.
+	Timezones        []TimezoneConfig `toml:"timezones"`
+	TimezoneInterval time.Duration    `toml:"timezone_interval"`
+	// Holidays and name days selected by Nameday take turns
+	// with the date, each shown for DateInterval.
+	Nameday      NamedayConfig `toml:"nameday"`
+	DateInterval time.Duration `toml:"date_interval"`
+
+	locale *timeLocale
+}
+
+// TimezoneConfig names a time zone to show the time in.
+type TimezoneConfig struct {
+	// Zone is an IANA time zone name, such as "Asia/Tokyo".
+	Zone string `toml:"zone"`
+	// Label identifies the zone on the display, such as "TYO".
+	Label string `toml:"label"`
+
+	location *time.Location
+}
+
+// formatTime formats the time part of the status line.
+func (s *StatusConfig) formatTime(t time.Time) string {
+	layout := s.TimeFormat
+	if s.TwelveHour && strings.Contains(layout, "15") {
+		// Go has no space-padded 12-hour layout element.
+		hour := "3"
+		if h := t.Hour() % 12; h != 0 && h < 10 {
+			hour = " 3"
+		}
+		layout = strings.Replace(layout, "15", hour, 1)
+		if !strings.Contains(layout, "PM") && !strings.Contains(layout, "pm") {
+			layout += "PM"
+		}
+	}
+
+	formatted := s.locale.Format(t, layout)
+	if s.BlinkColon && t.Second()%2 != 0 {
+		formatted = strings.ReplaceAll(formatted, ":", " ")
+	}
+	return formatted
+}
+
+// equal compares settings, disregarding loaded time zone data.
+func (s *StatusConfig) equal(o *StatusConfig) bool {
+	return s.DateFormat == o.DateFormat && s.TimeFormat == o.TimeFormat &&
+		s.Interval == o.Interval && s.Locale == o.Locale &&
+		s.TwelveHour == o.TwelveHour && s.BlinkColon == o.BlinkColon &&
+		s.TimezoneInterval == o.TimezoneInterval &&
+		s.Nameday == o.Nameday && s.DateInterval == o.DateInterval &&
+		slices.EqualFunc(s.Timezones, o.Timezones,
+			func(a, b TimezoneConfig) bool {
+				return a.Zone == b.Zone && a.Label == b.Label
+			})
+}
+
+func (t *TimezoneConfig) validate() error {
+	var err error
+	if t.location, err = time.LoadLocation(t.Zone); err != nil {
+		return fmt.Errorf("invalid time zone: %q", t.Zone)
+	}
+	if t.Label == "" {
+		return fmt.Errorf("time zone %s needs a label", t.Zone)
+	}
+	return nil
+}
+
+// WeatherConfig configures the weather fetcher.
+type WeatherConfig struct {
+	Enabled  bool          `toml:"enabled"`
+	Interval time.Duration `toml:"interval"`
+	// Provider is one of "metno", "openmeteo", "openweathermap", or "wttr".
+	Provider string `toml:"provider"`
+	// APIKey is required by OpenWeatherMap.
+	APIKey string `toml:"api_key"`
+	// StaleAfter is how long it takes for conditions that failed to update
+	// to be marked with an asterisk in place of the degree sign.
+	StaleAfter time.Duration `toml:"stale_after"`
+	// Locations are rotated through after the main one in the status line,
+	// each shown for LocationInterval. Label identifies the main location.
+	Label            string                  `toml:"label"`
+	Locations        []WeatherLocationConfig `toml:"locations"`
+	LocationInterval time.Duration           `toml:"location_interval"`
+	// Icons precede temperatures with glyphs standing for the conditions,
+	// which may be overridden by IconGlyphs, keyed by symbol names,
+	// such as "clear", "cloudy", "rain", or "snow".
+	Icons      bool              `toml:"icons"`
+	IconGlyphs map[string]string `toml:"icon_glyphs"`
+	// Range makes the weather producer show today's lowest and highest
+	// temperatures, where the provider forecasts them.
+	Range bool `toml:"range"`
+	// Precipitation expected within the next hour is shown by the weather
+	// producer, where the provider forecasts it.
+	Precipitation bool `toml:"precipitation"`
+	// Wind speed and direction are shown by the weather producer,
+	// the direction either as a compass point, or with WindArrows,
+	// as an arrow, which only the Japanese charset has.
+	Wind       bool `toml:"wind"`
+	WindArrows bool `toml:"wind_arrows"`
+	// Units are either "metric" or "imperial", and may be further refined
+	// with TemperatureUnit ("C" or "F"), WindUnit ("m/s", "km/h",
+	// "mph", or "kn"), and PrecipitationUnit ("mm" or "in").
+	Units             string `toml:"units"`
+	TemperatureUnit   string `toml:"temperature_unit"`
+	WindUnit          string `toml:"wind_unit"`
+	PrecipitationUnit string `toml:"precipitation_unit"`
+
+	icons map[string]string
+}
+
+// WeatherLocationConfig is another place to show the weather of.
+type WeatherLocationConfig struct {
+	LocationConfig
+	// Label identifies the location on the display, such as "B" for "B12ﾟ",
+	// and needs to be short, so that the temperature still fits.
+	Label string `toml:"label"`
+}
+
+func (w *WeatherConfig) equal(o *WeatherConfig) bool {
+	return w.Enabled == o.Enabled && w.Interval == o.Interval &&
+		w.Provider == o.Provider && w.APIKey == o.APIKey &&
+		w.StaleAfter == o.StaleAfter && w.Label == o.Label &&
+		slices.Equal(w.Locations, o.Locations) &&
+		w.LocationInterval == o.LocationInterval &&
+		w.Icons == o.Icons && maps.Equal(w.IconGlyphs, o.IconGlyphs) &&
+		w.Range == o.Range && w.Precipitation == o.Precipitation &&
+		w.Wind == o.Wind && w.WindArrows == o.WindArrows && w.Units == o.Units &&
+		w.TemperatureUnit == o.TemperatureUnit && w.WindUnit == o.WindUnit &&
+		w.PrecipitationUnit == o.PrecipitationUnit
+}
+
+func (w *WeatherConfig) validate() error {
+	if _, ok := weather.Providers[w.Provider]; !ok {
+		return fmt.Errorf("unsupported weather provider: %q", w.Provider)
+	}
+	if w.Provider == "openweathermap" && w.APIKey == "" {
+		return errors.New("OpenWeatherMap needs an API key")
+	}
+	if w.StaleAfter <= 0 {
+		return errors.New("the weather staleness period must be positive")
+	}
+	if w.LocationInterval <= 0 {
+		return errors.New("the weather location interval must be positive")
+	}
+	for _, l := range w.Locations {
+		if l.Label == "" {
+			return errors.New("weather locations need labels")
+		}
+	}
+	w.icons = maps.Clone(weatherIcons)
+	for symbol, glyph := range w.IconGlyphs {
+		if _, ok := weatherIcons[symbol]; !ok {
+			return fmt.Errorf("unknown weather symbol: %q", symbol)
+		}
+		w.icons[symbol] = glyph
+	}
+
+	temperature, wind, precipitation := "C", "m/s", "mm"
+	switch w.Units {
+	case "metric":
+	case "imperial":
+		temperature, wind, precipitation = "F", "mph", "in"
+	default:
+		return fmt.Errorf("unsupported units: %q", w.Units)
+	}
+	if w.TemperatureUnit == "" {
+		w.TemperatureUnit = temperature
+	}
+	if w.WindUnit == "" {
+		w.WindUnit = wind
+	}
+	if w.PrecipitationUnit == "" {
+		w.PrecipitationUnit = precipitation
+	}
+	if _, ok := temperatureUnits[w.TemperatureUnit]; !ok {
+		return fmt.Errorf("unsupported temperature unit: %q", w.TemperatureUnit)
+	}
+	if _, ok := windUnits[w.WindUnit]; !ok {
+		return fmt.Errorf("unsupported wind unit: %q", w.WindUnit)
+	}
+	if _, ok := precipitationUnits[w.PrecipitationUnit]; !ok {
+		return fmt.Errorf("unsupported precipitation unit: %q",
+			w.PrecipitationUnit)
+	}
+	return nil
+}
+
+// ControlConfig configures the control interfaces.
+type ControlConfig struct {
+	// Socket is the path of a Unix socket to accept commands on,
+	// the interface is disabled when it is empty.
+	Socket string `toml:"socket"`
+	// HTTP is an address to accept pushed messages on, such as ":5080".
+	// As there is no authentication, it should be firewalled appropriately.
+	HTTP string `toml:"http"`
+}
+
+// NotificationsConfig configures the desktop notification bridge.
+type NotificationsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Apps limit which applications' notifications are shown, if set.
+	Apps []string `toml:"apps"`
+	// IgnoreApps lists applications whose notifications are never shown.
+	IgnoreApps []string `toml:"ignore_apps"`
+	// Low, Normal, and Critical are how long notifications of the given
+	// urgency take over the display, zero disables them.
+	Low      time.Duration `toml:"low"`
+	Normal   time.Duration `toml:"normal"`
+	Critical time.Duration `toml:"critical"`
+}
+
+// ShutdownConfig determines what displays are left with upon exit.
+type ShutdownConfig struct {
+	// Message is shown on the otherwise cleared display, if not empty.
+	Message string `toml:"message"`
+	// Brightness is in percent, lowered to spare the display.
+	Brightness int `toml:"brightness"`
+}
+
+// PowerConfig configures power saving.
+type PowerConfig struct {
+	// Idle is for how long content may stay the same before the display
+	// goes to sleep. Blank content does so immediately. Zero disables this.
+	Idle time.Duration `toml:"idle"`
+	// Brightness is in percent, zero blanks the display while asleep.
+	Brightness int `toml:"brightness"`
+}
+
+// DimmingConfig lowers the brightness of displays at night.
+type DimmingConfig struct {
+	// Brightness is in percent.
+	Brightness int `toml:"brightness"`
+	// From and To delimit the night in local time, as in "22:00".
+	From string `toml:"from"`
+	To   string `toml:"to"`
+	// Sun makes the night last from sunset to sunrise instead,
+	// shortened by SunOffset on both ends, or lengthened if it is negative.
+	Sun       bool          `toml:"sun"`
+	SunOffset time.Duration `toml:"sun_offset"`
+
+	from, to time.Duration // since midnight
+	location LocationConfig
+}
+
+// IdleConfig configures the sleep screen, shown while the user is idle.
+type IdleConfig struct {
+	// Timeout is how long it takes for the user to become idle,
+	// zero disables idle detection.
+	Timeout time.Duration `toml:"timeout"`
+	// Brightness is in percent.
+	Brightness int `toml:"brightness"`
+	// Page is optionally switched to while the user is idle.
+	Page string `toml:"page"`
+}
+
+// LockConfig configures the lock screen, shown while the session is locked,
+// so that displays don't give away anything private.
+type LockConfig struct {
+	// Enabled watches logind for the session being locked.
+	Enabled bool `toml:"enabled"`
+	// Brightness is in percent.
+	Brightness int `toml:"brightness"`
+	// Page is optionally switched to while locked,
+	// otherwise just the time and the date are shown.
+	Page string `toml:"page"`
+	// Blank clears displays instead.
+	Blank bool `toml:"blank"`
+
+	status *StatusConfig
+}
+
+// AlarmConfig describes an alarm going off every day.
+type AlarmConfig struct {
+	// Time is in local time, as in "07:30".
+	Time string `toml:"time"`
+	Text string `toml:"text"`
+	// Command is run through the shell when the alarm goes off.
+	Command string `toml:"command"`
+	// Duration is for how long the alarm takes over displays.
+	Duration time.Duration `toml:"duration"`
+
+	at time.Duration // since midnight
+}
+
+// NewConfig returns the default configuration.
+func NewConfig() *Config {
+	return &Config{
+		Output:   "-",
+		Charset:  0x63,
+		Coalesce: 20 * time.Millisecond,
+		Regions: []RegionConfig{
+			{Producer: "kaomoji", Line: 0},
+			{Producer: "status", Line: 1},
+		},
+		Location: LocationConfig{
+			// Prague coordinates.
+			Latitude:  50.08804,
+			Longitude: 14.42076,
+			Altitude:  202,
+		},
+		Status: StatusConfig{
+			DateFormat: "Mon _2 Jan",
+			TimeFormat: "15:04",
+			Interval:   1 * time.Second,
+
+			TimezoneInterval: 5 * time.Second,
+			DateInterval:     5 * time.Second,
+		},
+		Weather: WeatherConfig{
+			Enabled:    true,
+			Interval:   5 * time.Minute,
+			Provider:   "metno",
+			StaleAfter: 15 * time.Minute,
+			Units:      "metric",
+
+			LocationInterval: 5 * time.Second,
+		},
+		Shutdown: ShutdownConfig{
+			Brightness: 25,
+		},
+		Dimming: DimmingConfig{
+			Brightness: 25,
+		},
+		Idle: IdleConfig{
+			Brightness: 25,
+		},
+		Lock: LockConfig{
+			Brightness: 25,
+		},
+		Notifications: NotificationsConfig{
+			Low:      3 * time.Second,
+			Normal:   5 * time.Second,
+			Critical: 15 * time.Second,
+		},
+	}
+}
+
+// defaultConfigPath returns the path of the configuration file
+// that is used when none is specified explicitly.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "liustatus", "liustatus.toml")
+}
+
+// LoadConfig reads the configuration file at path on top of the defaults.
+// A missing file is only an error if it has been asked for explicitly.
+// The result still needs to be validated.
+func LoadConfig(path string, explicit bool) (*Config, error) {
+	config := NewConfig()
+	if path == "" {
+		return config, nil
+	}
+
+	md, err := toml.DecodeFile(path, config)
+	if !explicit && errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	config.meta = md
+	return config, nil
+}
+
+// DecodeOptions decodes a region's producer-specific options into v.
+func (c *Config) DecodeOptions(region *RegionConfig, v any) error {
+	return c.meta.PrimitiveDecode(region.Options, v)
+}
+
+// markOptionsUsed marks a region's options as decoded without checking them,
+// for regions whose producer has already accepted them.
+func (c *Config) markOptionsUsed(region *RegionConfig) error {
+	return c.markUsed(region.Options)
+}
+
+// markUsed marks all keys within a value as decoded, recursively,
+// as tables and arrays of them get split into further primitives.
+func (c *Config) markUsed(value toml.Primitive) error {
+	var v any
+	if err := c.meta.PrimitiveDecode(value, &v); err != nil {
+		return err
+	}
+
+	var values []toml.Primitive
+	switch v.(type) {
+	case map[string]any:
+		var table map[string]toml.Primitive
+		if err := c.meta.PrimitiveDecode(value, &table); err != nil {
+			return err
+		}
+		for _, value := range table {
+			values = append(values, value)
+		}
+	case []map[string]any, []any:
+		if err := c.meta.PrimitiveDecode(value, &values); err != nil {
+			return err
+		}
+	}
+	for _, value := range values {
+		if err := c.markUsed(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUndecoded reports unknown keys in the configuration file.
+// It must only be called after all producers have decoded their options.
+func (c *Config) checkUndecoded() error {
+	if undecoded := c.meta.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown configuration key: %s", undecoded[0])
+	}
+	return nil
+}
+
+// validate checks the configuration, and fills in implied values.
+func (c *Config) validate() error {
+	if len(c.Displays) != 0 {
+		if c.meta.IsDefined("region") || len(c.Pages) != 0 {
+			return errors.New("regions must be specified within displays")
+		}
+	} else if len(c.Pages) == 0 {
+		c.Displays = []DisplayConfig{{Regions: c.Regions}}
+	} else if c.meta.IsDefined("region") {
+		return errors.New("regions must be specified within pages")
+	} else {
+		c.Displays = []DisplayConfig{{
+			Pages:        c.Pages,
+			PageInterval: c.PageInterval,
+		}}
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Displays {
+		d := &c.Displays[i]
+		if d.Output == "" {
+			d.Output = c.Output
+		}
+		if d.Charset == nil {
+			d.Charset = &c.Charset
+		}
+		if d.Coalesce == nil {
+			d.Coalesce = &c.Coalesce
+		}
+		if d.FullRefresh == nil {
+			d.FullRefresh = &c.FullRefresh
+		}
+		if d.Shutdown == nil {
+			d.Shutdown = &c.Shutdown
+		}
+		if d.Power == nil {
+			d.Power = &c.Power
+		}
+		if d.Dimming == nil {
+			d.Dimming = &c.Dimming
+		}
+		d.Dimming.location = c.Location
+		d.idle = &c.Idle
+		d.lock = &c.Lock
+		if names[d.Name] {
+			return fmt.Errorf("duplicate display name: %q", d.Name)
+		}
+		names[d.Name] = true
+		if err := d.validate(); err != nil {
+			if d.Name != "" {
+				return fmt.Errorf("display %s: %w", d.Name, err)
+			}
+			return err
+		}
+	}
+	if c.Idle.Timeout < 0 || c.Idle.Brightness < 0 || c.Idle.Brightness > 100 {
+		return errors.New("invalid idle settings")
+	}
+	if c.Lock.Brightness < 0 || c.Lock.Brightness > 100 {
+		return errors.New("invalid lock settings")
+	}
+	c.Lock.status = &c.Status
+	if c.Notifications.Low < 0 || c.Notifications.Normal < 0 ||
+		c.Notifications.Critical < 0 {
+		return errors.New("notification durations must not be negative")
+	}
+	if c.Status.Interval <= 0 || c.Weather.Interval <= 0 ||
+		c.Status.TimezoneInterval <= 0 || c.Status.DateInterval <= 0 {
+		return errors.New("refresh intervals must be positive")
+	}
+	if err := c.Weather.validate(); err != nil {
+		return err
+	}
+	var err error
+	if c.Status.locale, err = lookupTimeLocale(c.Status.Locale); err != nil {
+		return err
+	}
+	for i := range c.Status.Timezones {
+		if err := c.Status.Timezones[i].validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Status.Nameday.validate(); err != nil {
+		return err
+	}
+	for i := range c.Alarms {
+		a := &c.Alarms[i]
+		if a.at, err = parseClock(a.Time); err != nil {
+			return fmt.Errorf("invalid alarm time: %q", a.Time)
+		}
+		if a.Duration < 0 {
+			return errors.New("alarm durations must not be negative")
+		}
+		if a.Duration == 0 {
+			a.Duration = alarmDefaultDuration
+		}
+	}
+	return nil
+}
+
+func (d *DisplayConfig) validate() error {
+	if _, ok := charset.ResolveRune(' ', *d.Charset); !ok {
+		return fmt.Errorf("unsupported charset: %#x", *d.Charset)
+	}
+	if _, err := output.Parse(d.Output); err != nil {
+		return err
+	}
+	if d.PageInterval < 0 {
+		return errors.New("the page interval must not be negative")
+	}
+	if *d.Coalesce < 0 {
+		return errors.New("the coalescing delay must not be negative")
+	}
+	if d.Shutdown.Brightness < 0 || d.Shutdown.Brightness > 100 {
+		return fmt.Errorf("invalid shutdown brightness: %d",
+			d.Shutdown.Brightness)
+	}
+	if d.Power.Idle < 0 ||
+		d.Power.Brightness < 0 || d.Power.Brightness > 100 {
+		return errors.New("invalid power saving settings")
+	}
+	if err := d.Dimming.validate(); err != nil {
+		return err
+	}
+	if len(d.Pages) == 0 {
+		d.Pages = []PageConfig{{Regions: d.Regions}}
+	} else if len(d.Regions) != 0 {
+		return errors.New("regions must be specified within pages")
+	}
+	d.Regions = nil
+
+	names := make(map[string]bool)
+	for i := range d.Pages {
+		p := &d.Pages[i]
+		if names[p.Name] {
+			return fmt.Errorf("duplicate page name: %q", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.validate(*d.Charset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PageConfig) validate(charsetID uint8) error {
+	for i := range p.Regions {
+		r := &p.Regions[i]
+		r.charset = charsetID
+		if _, ok := producerFactories[r.Producer]; !ok {
+			return fmt.Errorf("unknown producer: %q", r.Producer)
+		}
+		if r.Line < 0 || r.Line >= displayHeight ||
+			r.Column < 0 || r.Column >= displayWidth ||
+			r.Width < 0 || r.Column+r.Width > displayWidth {
+			return fmt.Errorf("region for %s does not fit the display",
+				r.Producer)
+		}
+		if r.Width == 0 {
+			r.Width = displayWidth - r.Column
+		}
+		if r.ScrollInterval < 0 || r.ScrollGap != nil && *r.ScrollGap < 0 {
+			return fmt.Errorf("invalid scrolling settings for %s", r.Producer)
+		}
+		if r.MinInterval < 0 {
+			return fmt.Errorf("invalid update interval for %s", r.Producer)
+		}
+		if r.ScrollInterval == 0 {
+			r.ScrollInterval = 300 * time.Millisecond
+		}
+		if r.ScrollGap == nil {
+			gap := 3
+			r.ScrollGap = &gap
+		}
+	}
+	return nil
+}
+
+func (d *DimmingConfig) validate() error {
+	if d.Brightness < 0 || d.Brightness > 100 {
+		return fmt.Errorf("invalid dimming brightness: %d", d.Brightness)
+	}
+	if (d.From == "") != (d.To == "") {
+		return errors.New("dimming needs both a start and an end")
+	}
+	if d.From != "" && d.Sun {
+		return errors.New("dimming can follow either a schedule or the sun")
+	}
+	if d.SunOffset.Abs() > 6*time.Hour {
+		return errors.New("the sun offset must be within six hours")
+	}
+	if d.From == "" {
+		return nil
+	}
+
+	for _, x := range []struct {
+		text   string
+		result *time.Duration
+	}{
+		{d.From, &d.from},
+		{d.To, &d.to},
+	} {
+		var err error
+		if *x.result, err = parseClock(x.text); err != nil {
+			return fmt.Errorf("invalid dimming time: %q", x.text)
+		}
+	}
+	return nil
+}
+
+// parseClock parses a time of day, as in "22:00", into time since midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute, nil
+}
+
+// clockOn returns the given time of day on the day of day.
+func clockOn(day time.Time, since time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(),
+		int(since/time.Hour), int(since%time.Hour/time.Minute), 0, 0,
+		day.Location())
+}
+
+// Night tells whether the display should be dimmed, and until when.
+func (d *DimmingConfig) Night(now time.Time) (bool, time.Time) {
+	tomorrow := clockOn(now.AddDate(0, 0, 1), 0)
+
+	switch {
+	case d.Sun && d.location.pending:
+		return false, tomorrow
+	case d.Sun:
+		rise, set, up := sunTimes(now, d.location)
+		if !rise.Equal(set) {
+			rise, set = rise.Add(-d.SunOffset), set.Add(d.SunOffset)
+		}
+		switch {
+		case rise.Equal(set):
+			return !up, tomorrow
+		case now.Before(rise):
+			return true, rise
+		case now.Before(set):
+			return false, set
+		default:
+			return true, tomorrow
+		}
+	case d.From != "":
+		from, to := clockOn(now, d.from), clockOn(now, d.to)
+		if !now.Before(from) {
+			from = clockOn(tomorrow, d.from)
+		}
+		if !now.Before(to) {
+			to = clockOn(tomorrow, d.to)
+		}
+
+		// It is night if it ends sooner than it starts.
+		if to.Before(from) {
+			return true, to
+		}
+		return false, from
+	default:
+		return false, tomorrow
+	}
+}
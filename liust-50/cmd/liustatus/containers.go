@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// containersProducer shows how many Docker or Podman containers are running,
+// and how many have exited, such as "3 up 1 exited", followed by states
+// of watched containers, such as "web running". Watched containers
+// that stop running take over the display.
+type containersProducer struct {
+	// Socket is the path to the Docker API socket. Podman provides
+	// a compatible one, which is tried if Docker's doesn't exist.
+	Socket string `toml:"socket"`
+	// Watch lists names of containers to show the state of.
+	Watch    []string      `toml:"watch"`
+	Interval time.Duration `toml:"interval"`
+	// Alert takes over the display when a watched container stops running.
+	Alert bool `toml:"alert"`
+
+	client *http.Client
+	states map[string]string
+}
+
+func init() {
+	registerProducer("containers", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		cp := &containersProducer{
+			Interval: 10 * time.Second,
+			Alert:    true,
+			states:   make(map[string]string),
+		}
+		if err := config.DecodeOptions(region, cp); err != nil {
+			return nil, err
+		}
+		if cp.Socket == "" {
+			cp.Socket = containersSocket()
+		}
+		if cp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+
+		cp.client = &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (
+					net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", cp.Socket)
+				},
+			},
+		}
+		return &periodicProducer{interval: cp.Interval, produce: cp.produce}, nil
+	})
+}
+
+// containersSocket finds the Docker socket, or a rootless Podman one.
+func containersSocket() string {
+	const docker = "/var/run/docker.sock"
+	if _, err := os.Stat(docker); err == nil {
+		return docker
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		podman := filepath.Join(dir, "podman", "podman.sock")
+		if _, err := os.Stat(podman); err == nil {
+			return podman
+		}
+	}
+	return docker
+}
+
+// dockerContainer is an entry of the result of listing containers.
+type dockerContainer struct {
+	Names []string `json:"Names"`
+	// State is such as "created", "running", "paused", or "exited".
+	State string `json:"State"`
+}
+
+func (cp *containersProducer) list() ([]dockerContainer, error) {
+	// The host is irrelevant, since the transport always dials the socket.
+	resp, err := cp.client.Get("http://localhost/containers/json?all=true")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var containers []dockerContainer
+	err = json.NewDecoder(resp.Body).Decode(&containers)
+	return containers, err
+}
+
+func (cp *containersProducer) produce() string {
+	containers, err := cp.list()
+	if err != nil {
+		slog.Warn("Containers failed", "error", err)
+		return ""
+	}
+
+	running, exited := 0, 0
+	states := make(map[string]string)
+	for _, c := range containers {
+		switch c.State {
+		case "running":
+			running++
+		case "exited", "dead":
+			exited++
+		}
+		for _, name := range c.Names {
+			states[strings.TrimPrefix(name, "/")] = c.State
+		}
+	}
+
+	fields := []string{fmt.Sprintf("%d up", running)}
+	if exited > 0 {
+		fields = append(fields, fmt.Sprintf("%d exited", exited))
+	}
+	for _, name := range cp.Watch {
+		state, ok := states[name]
+		if !ok {
+			state = "gone"
+		}
+		fields = append(fields, name+" "+state)
+
+		// Only changes from running are reported, so as to avoid alerting
+		// about containers that haven't been started at all.
+		if cp.Alert && cp.states[name] == "running" && state != "running" {
+			slog.Info("Container stopped", "container", name, "state", state)
+			Takeover(Message{
+				Text:     "Container " + name + " " + state,
+				Priority: 1,
+				Duration: 10 * time.Second,
+				Line:     -1,
+				Blink:    true,
+			})
+		}
+		cp.states[name] = state
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+// The control interface accepts commands, one per line, and replies to each
+// with either "ok", or "error: " followed by a description:
+//
+//	show [-priority N] [-line N] [-blink] [-tag TAG] [-display NAME] DURATION TEXT...
+//	clear [-display NAME]
+//	page [-display NAME] [PAGE]
+//	brightness [-display NAME] PERCENT
+//	power [-display NAME] on|off|auto
+//	kaomoji pause|resume|disable|enable|pet|feed
+//	kaomoji say TEXT...
+//	alarm [-command COMMAND] HH:MM [TEXT...]
+//	timer [-command COMMAND] DURATION [TEXT...]
+//	cancel
+//
+// Durations are in seconds, unless they have a unit, as in "1m30s".
+// Messages take over the whole display, unless a line is given.
+// A queued message is replaced by a new one of the same tag.
+// Commands apply to all displays, unless a display is given.
+// Arguments containing spaces may be enclosed in double quotes,
+// within which backslashes escape characters, and \n stands for a newline.
+// Alarms go off daily, timers once. Those added here are lost on exit,
+// or removed by cancel.
+type controlServer struct {
+	displays *displaySet
+}
+
+// listenControl creates the control socket, replacing any stale one.
+func listenControl(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: already in use", path)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// Serve accepts connections until ctx is cancelled.
+func (cs *controlServer) Serve(ctx context.Context, l net.Listener) {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Control socket failed", "error", err)
+			}
+			return
+		}
+		go cs.handle(ctx, conn)
+	}
+}
+
+// splitCommand splits a command line into words.
+func splitCommand(line string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		quoted  bool
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped && r == 'n':
+			word.WriteRune('\n')
+			escaped = false
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted, inWord = !quoted, true
+		case !quoted && unicode.IsSpace(r):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+			}
+			inWord = false
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quotes")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+func (cs *controlServer) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		args, err := splitCommand(scanner.Text())
+		if err == nil && len(args) == 0 {
+			continue
+		}
+		if err == nil {
+			err = cs.execute(ctx, args[0], args[1:])
+		}
+		if err != nil {
+			_, err = fmt.Fprintf(conn, "error: %v\n", err)
+		} else {
+			_, err = fmt.Fprintln(conn, "ok")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// targets returns the drivers of the named display, or all of them.
+func (cs *controlServer) targets(display string) ([]*displayDriver, error) {
+	drivers := cs.displays.Drivers()
+	if display == "" {
+		return drivers, nil
+	}
+	for _, dd := range drivers {
+		if dd.name == display {
+			return []*displayDriver{dd}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown display: %q", display)
+}
+
+func (cs *controlServer) execute(
+	ctx context.Context, command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	display := flags.String("display", "", "target display")
+
+	var m Message
+	var run *string
+	switch command {
+	case "show":
+		flags.IntVar(&m.Priority, "priority", 0, "message priority")
+		flags.IntVar(&m.Line, "line", -1, "line to take over")
+		flags.BoolVar(&m.Blink, "blink", false, "flash the message")
+		flags.StringVar(&m.Tag, "tag", "", "replace messages of this tag")
+	case "clear", "page", "brightness", "power":
+	case "alarm", "timer":
+		run = flags.String("command", "", "shell command to run")
+	case "cancel":
+		alarms.Cancel()
+		return nil
+	case "kaomoji":
+		if len(args) < 1 || (len(args) > 1) != (args[0] == "say") {
+			return errors.New("usage: kaomoji " +
+				"pause|resume|disable|enable|pet|feed|say TEXT...")
+		}
+		switch args[0] {
+		case "pause":
+			kaomojiPaused.Set(true)
+		case "resume":
+			kaomojiPaused.Set(false)
+		case "disable":
+			kaomojiDisabled.Set(true)
+		case "enable":
+			kaomojiDisabled.Set(false)
+		case "pet":
+			kaomojiPet()
+		case "feed":
+			kaomojiFeed()
+		case "say":
+			kaomojiSpoken.Say(strings.Join(args[1:], " "))
+		default:
+			return fmt.Errorf("unknown kaomoji command: %q", args[0])
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command: %q", command)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	drivers, err := cs.targets(*display)
+	if err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	switch command {
+	case "show":
+		if len(args) < 2 {
+			return errors.New("usage: show DURATION TEXT...")
+		}
+		if m.Duration, err = takeover.ParseDuration(args[0]); err != nil {
+			return err
+		}
+		m.Text = strings.Join(args[1:], " ")
+		if err := m.Validate(); err != nil {
+			return err
+		}
+		m.Display = *display
+		Takeover(m)
+	case "clear":
+		for _, dd := range drivers {
+			if err := dd.ClearMessages(ctx); err != nil {
+				return err
+			}
+		}
+	case "page":
+		if len(args) > 1 {
+			return errors.New("usage: page [PAGE]")
+		}
+		name := strings.Join(args, "")
+
+		// With multiple displays, it suffices that any has the page.
+		switched := 0
+		for _, dd := range drivers {
+			if err = dd.SwitchPage(ctx, name); err == nil {
+				switched++
+			}
+		}
+		if switched == 0 {
+			return err
+		}
+	case "brightness":
+		if len(args) != 1 {
+			return errors.New("usage: brightness PERCENT")
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(args[0], "%"))
+		if err != nil {
+			return fmt.Errorf("invalid brightness: %q", args[0])
+		}
+		for _, dd := range drivers {
+			if err := dd.SetBrightness(ctx, percent); err != nil {
+				return err
+			}
+		}
+	case "power":
+		if len(args) != 1 {
+			return errors.New("usage: power on|off|auto")
+		}
+		for _, dd := range drivers {
+			if err := dd.SetPower(ctx, args[0]); err != nil {
+				return err
+			}
+		}
+	case "alarm":
+		if len(args) < 1 {
+			return errors.New("usage: alarm HH:MM [TEXT...]")
+		}
+		at, err := parseClock(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid time: %q", args[0])
+		}
+		alarms.AddDaily(at, strings.Join(args[1:], " "), *run)
+	case "timer":
+		if len(args) < 1 {
+			return errors.New("usage: timer DURATION [TEXT...]")
+		}
+		d, err := takeover.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return errors.New("the duration must be positive")
+		}
+		alarms.AddCountdown(d, strings.Join(args[1:], " "), *run)
+	}
+	return nil
+}
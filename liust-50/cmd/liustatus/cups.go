@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// cupsProducer shows the progress of active print jobs, such as
+// "Laser 45% report.pdf +2", and printer problems, such as
+// "Laser out of paper", which also take over the display as they appear.
+// It talks to CUPS over IPP.
+type cupsProducer struct {
+	// URL is the CUPS server's, such as "http://localhost:631".
+	URL string `toml:"url"`
+	// Printers limits what is shown to the given printers.
+	Printers []string      `toml:"printers"`
+	Interval time.Duration `toml:"interval"`
+	// Alert takes over the display when a printer runs into a problem.
+	Alert bool `toml:"alert"`
+
+	client   *http.Client
+	problems map[string]bool
+}
+
+func init() {
+	registerProducer("cups", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		cp := &cupsProducer{
+			URL:      "http://localhost:631",
+			Interval: 5 * time.Second,
+			Alert:    true,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}
+		if err := config.DecodeOptions(region, cp); err != nil {
+			return nil, err
+		}
+		if _, err := url.Parse(cp.URL); err != nil {
+			return nil, err
+		}
+		if cp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: cp.Interval, produce: cp.produce}, nil
+	})
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// IPP operations, delimiter tags, and value tags, see RFC 8010 and RFC 8011.
+const (
+	ippGetJobs     = 0x000a
+	ippGetPrinters = 0x4002 // CUPS-Get-Printers
+
+	ippTagOperation = 0x01
+	ippTagJob       = 0x02
+	ippTagEnd       = 0x03
+	ippTagPrinter   = 0x04
+
+	ippTagInteger  = 0x21
+	ippTagBoolean  = 0x22
+	ippTagEnum     = 0x23
+	ippTagKeyword  = 0x44
+	ippTagURI      = 0x45
+	ippTagCharset  = 0x47
+	ippTagLanguage = 0x48
+)
+
+// ippAttributes are attributes of a single group. Integers and enums
+// are decoded as int, booleans as bool, and everything else as string.
+type ippAttributes map[string][]any
+
+func (a ippAttributes) string(name string) string {
+	if values := a[name]; len(values) > 0 {
+		s, _ := values[0].(string)
+		return s
+	}
+	return ""
+}
+
+func (a ippAttributes) int(name string) (int, bool) {
+	if values := a[name]; len(values) > 0 {
+		n, ok := values[0].(int)
+		return n, ok
+	}
+	return 0, false
+}
+
+type ippRequest struct {
+	b bytes.Buffer
+}
+
+func newIPPRequest(operation uint16, printerURI string) *ippRequest {
+	r := &ippRequest{}
+	r.b.Write([]byte{2, 0})
+	binary.Write(&r.b, binary.BigEndian, operation)
+	binary.Write(&r.b, binary.BigEndian, uint32(1))
+	r.b.WriteByte(ippTagOperation)
+	r.add(ippTagCharset, "attributes-charset", "utf-8")
+	r.add(ippTagLanguage, "attributes-natural-language", "en")
+	r.add(ippTagURI, "printer-uri", printerURI)
+	return r
+}
+
+// add appends an attribute with string values.
+func (r *ippRequest) add(tag byte, name string, values ...string) {
+	for i, value := range values {
+		r.b.WriteByte(tag)
+		if i > 0 {
+			name = ""
+		}
+		binary.Write(&r.b, binary.BigEndian, uint16(len(name)))
+		r.b.WriteString(name)
+		binary.Write(&r.b, binary.BigEndian, uint16(len(value)))
+		r.b.WriteString(value)
+	}
+}
+
+func (r *ippRequest) bytes() []byte {
+	return append(r.b.Bytes(), ippTagEnd)
+}
+
+// ippParseResponse returns attribute groups of the given kind.
+func ippParseResponse(data []byte, groupTag byte) ([]ippAttributes, error) {
+	if len(data) < 8 {
+		return nil, errors.New("IPP response too short")
+	}
+	if status := binary.BigEndian.Uint16(data[2:]); status >= 0x100 {
+		return nil, fmt.Errorf("IPP status 0x%04x", status)
+	}
+
+	var (
+		groups  []ippAttributes
+		current ippAttributes
+		name    string
+	)
+	for data = data[8:]; len(data) > 0; {
+		tag := data[0]
+		data = data[1:]
+		if tag == ippTagEnd {
+			return groups, nil
+		}
+		if tag < 0x10 {
+			current = nil
+			if tag == groupTag {
+				current = make(ippAttributes)
+				groups = append(groups, current)
+			}
+			continue
+		}
+
+		if len(data) < 2 {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n+2 {
+			break
+		}
+		if n > 0 {
+			name = string(data[2 : 2+n])
+		}
+		data = data[2+n:]
+		m := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+m {
+			break
+		}
+		raw := data[2 : 2+m]
+		data = data[2+m:]
+
+		var value any = string(raw)
+		switch {
+		case (tag == ippTagInteger || tag == ippTagEnum) && m == 4:
+			value = int(int32(binary.BigEndian.Uint32(raw)))
+		case tag == ippTagBoolean && m == 1:
+			value = raw[0] != 0
+		}
+		if current != nil {
+			current[name] = append(current[name], value)
+		}
+	}
+	return nil, errors.New("malformed IPP response")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// cupsProblems are shortened descriptions of common printer-state-reasons.
+var cupsProblems = map[string]string{
+	"media-empty":         "out of paper",
+	"media-needed":        "out of paper",
+	"media-jam":           "paper jam",
+	"toner-empty":         "out of toner",
+	"marker-supply-empty": "out of ink",
+	"door-open":           "door open",
+	"cover-open":          "cover open",
+	"input-tray-missing":  "tray missing",
+	"offline":             "offline",
+	"shutdown":            "offline",
+	"paused":              "paused",
+}
+
+// cupsProblem describes a printer-state-reason, if it is of interest.
+func cupsProblem(reason string) string {
+	if reason == "none" || strings.HasSuffix(reason, "-report") ||
+		strings.HasSuffix(reason, "-warning") {
+		return ""
+	}
+	reason = strings.TrimSuffix(reason, "-error")
+	if problem, ok := cupsProblems[reason]; ok {
+		return problem
+	}
+	// Reasons added by CUPS are too obscure to show.
+	if strings.HasPrefix(reason, "cups-") ||
+		strings.HasPrefix(reason, "com.apple.") {
+		return ""
+	}
+	return strings.ReplaceAll(reason, "-", " ")
+}
+
+func (cp *cupsProducer) query(operation uint16, groupTag byte,
+	attributes ...string) ([]ippAttributes, error) {
+	u, _ := url.Parse(cp.URL)
+	u.Scheme = "ipp"
+	r := newIPPRequest(operation, u.String()+"/")
+	r.add(ippTagKeyword, "requested-attributes", attributes...)
+	if operation == ippGetJobs {
+		r.add(ippTagKeyword, "which-jobs", "not-completed")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cp.URL,
+		bytes.NewReader(r.bytes()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ipp")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := cp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ippParseResponse(data, groupTag)
+}
+
+func (cp *cupsProducer) wanted(printer string) bool {
+	return len(cp.Printers) == 0 || slices.Contains(cp.Printers, printer)
+}
+
+func (cp *cupsProducer) produce() string {
+	printers, err := cp.query(ippGetPrinters, ippTagPrinter,
+		"printer-name", "printer-state-reasons")
+	if err != nil {
+		slog.Warn("CUPS failed", "error", err)
+		return "CUPS ?"
+	}
+	jobs, err := cp.query(ippGetJobs, ippTagJob,
+		"job-name", "job-state", "job-printer-uri", "job-media-progress")
+	if err != nil {
+		slog.Warn("CUPS failed", "error", err)
+		return "CUPS ?"
+	}
+
+	var fields []string
+	var processing ippAttributes
+	pending := 0
+	for _, job := range jobs {
+		if !cp.wanted(path.Base(job.string("job-printer-uri"))) {
+			continue
+		}
+		const jobProcessing = 5
+		if state, _ := job.int("job-state"); state == jobProcessing &&
+			processing == nil {
+			processing = job
+		} else {
+			pending++
+		}
+	}
+	if processing != nil {
+		field := path.Base(processing.string("job-printer-uri"))
+		if progress, ok := processing.int("job-media-progress"); ok {
+			field += fmt.Sprintf(" %d%%", progress)
+		}
+		if name := processing.string("job-name"); name != "" {
+			field += " " + name
+		}
+		fields = append(fields, field)
+	}
+	if pending > 0 && processing != nil {
+		fields = append(fields, fmt.Sprintf("+%d", pending))
+	} else if pending > 0 {
+		fields = append(fields, fmt.Sprintf("%d queued", pending))
+	}
+
+	problems := make(map[string]bool)
+	for _, printer := range printers {
+		name := printer.string("printer-name")
+		if !cp.wanted(name) {
+			continue
+		}
+		var descriptions []string
+		for _, reason := range printer["printer-state-reasons"] {
+			reason, _ := reason.(string)
+			description := cupsProblem(reason)
+			if description == "" || slices.Contains(descriptions, description) {
+				continue
+			}
+			descriptions = append(descriptions, description)
+
+			key := name + " " + description
+			problems[key] = true
+			if cp.Alert && cp.problems != nil && !cp.problems[key] {
+				slog.Info("Printer problem", "printer", name, "reason", reason)
+				Takeover(Message{
+					Text:     "Printer " + key,
+					Priority: 1,
+					Duration: 10 * time.Second,
+					Line:     -1,
+					Blink:    true,
+				})
+			}
+		}
+		if len(descriptions) > 0 {
+			fields = append(fields, name+" "+strings.Join(descriptions, ", "))
+		}
+	}
+	cp.problems = problems
+	return strings.Join(fields, " ")
+}
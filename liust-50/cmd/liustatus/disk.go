@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskProducer shows free space on filesystems, such as "/ 12G /home1.2T",
+// and optionally the rate of reading and writing disks.
+// Filesystems that are nearly full blink.
+type diskProducer struct {
+	// Mounts are mount points, or any paths within filesystems.
+	Mounts []string `toml:"mounts"`
+	// FullPercent is how much space must be used for a filesystem to blink.
+	FullPercent int `toml:"full_percent"`
+	// IO adds reading and writing rates, such as "r 12M w1.0M".
+	IO bool `toml:"io"`
+	// Devices default to all disks, except for virtual ones.
+	Devices  []string      `toml:"devices"`
+	Interval time.Duration `toml:"interval"`
+
+	last     [2]uint64
+	lastTime time.Time
+}
+
+// diskBlinkInterval is how long nearly full filesystems stay on and off.
+const diskBlinkInterval = 500 * time.Millisecond
+
+func init() {
+	registerProducer("disk", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		dp := &diskProducer{
+			Mounts:      []string{"/"},
+			FullPercent: 90,
+			Interval:    10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, dp); err != nil {
+			return nil, err
+		}
+		if dp.FullPercent < 0 || dp.FullPercent > 100 {
+			return nil, errors.New("the full percentage must be within 0..100")
+		}
+		if dp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return dp, nil
+	})
+}
+
+// diskDevices returns names of block devices that aren't virtual,
+// so that their statistics don't get counted twice.
+func diskDevices() []string {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		for _, prefix := range []string{"loop", "ram", "zram", "dm-", "md"} {
+			if strings.HasPrefix(name, prefix) {
+				name = ""
+				break
+			}
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// readDiskstats returns the total amount of bytes read from and written to
+// the given devices.
+func readDiskstats(devices []string) ([2]uint64, error) {
+	f, err := os.Open("/proc/diskstats")
+	if err != nil {
+		return [2]uint64{}, err
+	}
+	defer f.Close()
+
+	wanted := make(map[string]bool)
+	for _, device := range devices {
+		wanted[filepath.Base(device)] = true
+	}
+
+	var total [2]uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !wanted[fields[2]] {
+			continue
+		}
+
+		// Sectors are always 512 bytes long here, see the kernel's
+		// Documentation/admin-guide/iostats.rst.
+		read, err1 := strconv.ParseUint(fields[5], 10, 64)
+		written, err2 := strconv.ParseUint(fields[9], 10, 64)
+		if err1 == nil && err2 == nil {
+			total[0] += read * 512
+			total[1] += written * 512
+		}
+	}
+	return total, scanner.Err()
+}
+
+// diskField is a piece of the producer's output.
+type diskField struct {
+	text string
+	full bool
+}
+
+func (dp *diskProducer) sample() (fields []diskField) {
+	for _, mount := range dp.Mounts {
+		var st unix.Statfs_t
+		if err := unix.Statfs(mount, &st); err != nil {
+			fields = append(fields, diskField{text: mount + "   ?"})
+			continue
+		}
+
+		// Space reserved for the superuser counts as used.
+		fields = append(fields, diskField{
+			text: mount + formatSize(float64(st.Bavail*uint64(st.Bsize))),
+			full: st.Blocks != 0 && dp.FullPercent > 0 &&
+				(st.Blocks-st.Bavail)*100 >= st.Blocks*uint64(dp.FullPercent),
+		})
+	}
+	if !dp.IO {
+		return fields
+	}
+
+	devices := dp.Devices
+	if devices == nil {
+		devices = diskDevices()
+	}
+
+	now := time.Now()
+	total, err := readDiskstats(devices)
+	elapsed := now.Sub(dp.lastTime).Seconds()
+	rate := func(i int) string {
+		if err != nil || dp.lastTime.IsZero() || total[i] < dp.last[i] ||
+			elapsed <= 0 {
+			return "   -"
+		}
+		return formatSize(float64(total[i]-dp.last[i]) / elapsed)
+	}
+	fields = append(fields, diskField{text: "r" + rate(0) + " w" + rate(1)})
+	dp.last, dp.lastTime = total, now
+	return fields
+}
+
+func (dp *diskProducer) Run(ctx context.Context, out chan<- string) {
+	ticker := time.NewTicker(dp.Interval)
+	defer ticker.Stop()
+	blinker := time.NewTicker(diskBlinkInterval)
+	defer blinker.Stop()
+
+	fields, visible := dp.sample(), true
+	for {
+		var texts []string
+		var blinking <-chan time.Time
+		for _, field := range fields {
+			if !field.full {
+				texts = append(texts, field.text)
+				continue
+			}
+			blinking = blinker.C
+			if visible {
+				texts = append(texts, field.text)
+			} else {
+				texts = append(texts,
+					strings.Repeat(" ", len([]rune(field.text))))
+			}
+		}
+		if !send(ctx, out, strings.Join(texts, " ")) {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+			fields = dp.sample()
+		case <-blinking:
+			visible = !visible
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,888 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+const (
+	displayWidth  = takeover.Width
+	displayHeight = takeover.Height
+)
+
+type DisplayState struct {
+	Display [displayHeight][displayWidth]uint8
+}
+
+// NewDisplayState returns a blank screen.
+func NewDisplayState() DisplayState {
+	var s DisplayState
+	for y := 0; y < displayHeight; y++ {
+		for x := 0; x < displayWidth; x++ {
+			s.Display[y][x] = ' '
+		}
+	}
+	return s
+}
+
+type Display struct {
+	Current, Last DisplayState
+	Charset       uint8
+	Brightness    int // in percent
+	Output        io.Writer
+}
+
+func NewDisplay(output io.Writer, charset uint8) *Display {
+	return &Display{
+		Current:    NewDisplayState(),
+		Last:       NewDisplayState(),
+		Charset:    charset,
+		Brightness: 100,
+		Output:     output,
+	}
+}
+
+func (t *Display) SetRegion(row, column, width int, content string) {
+	t.Current.SetRegion(t.Charset, row, column, width, content)
+}
+
+func (s *DisplayState) SetRegion(
+	charsetID uint8, row, column, width int, content string) {
+	if row < 0 || row >= displayHeight {
+		return
+	}
+
+	chars := encoder.Text(content, charsetID)
+	for x := 0; x < width && column+x < displayWidth; x++ {
+		cell := &s.Display[row][column+x]
+		if x < len(chars) {
+			*cell = chars[x]
+		} else {
+			*cell = ' '
+		}
+	}
+}
+
+func (t *Display) HasChanges() bool {
+	for y := 0; y < displayHeight; y++ {
+		for x := 0; x < displayWidth; x++ {
+			if t.Current.Display[y][x] != t.Last.Display[y][x] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reset initializes the device, and clears it.
+func (t *Display) Reset() error {
+	return t.initialize(encoder.Clear(), NewDisplayState())
+}
+
+// Resume initializes the device without clearing it, trusting it to still
+// show the given state, so that only what differs needs to be redrawn.
+func (t *Display) Resume(shown DisplayState) error {
+	return t.initialize(nil, shown)
+}
+
+func (t *Display) initialize(clear []byte, shown DisplayState) error {
+	if _, err := t.Output.Write(slices.Concat(encoder.SelectCharset(t.Charset),
+		encoder.DefineUserChars(t.Charset), clear)); err != nil {
+		return err
+	}
+	t.Last = shown
+	if err := t.SetCursorMode(encoder.CursorOff); err != nil {
+		return err
+	}
+	if t.Brightness != 100 {
+		return t.SetBrightness(t.Brightness)
+	}
+	return nil
+}
+
+// SetBrightness changes the dimming level of the display. The device
+// only has four levels, so the percentage is rounded up to a quarter.
+// The setting is remembered even if writing fails, to survive a Reset.
+func (t *Display) SetBrightness(percent int) error {
+	t.Brightness = percent
+	_, err := t.Output.Write(
+		encoder.SetBrightness(encoder.BrightnessLevel(percent)))
+	return err
+}
+
+// SetCursorMode changes how the cursor is shown.
+func (t *Display) SetCursorMode(mode int) error {
+	_, err := t.Output.Write(encoder.SetCursorMode(mode))
+	return err
+}
+
+func (t *Display) Update() error {
+	var b bytes.Buffer
+	for y := 0; y < displayHeight; y++ {
+		start := -1
+		for x := 0; x < displayWidth; x++ {
+			if t.Current.Display[y][x] != t.Last.Display[y][x] {
+				start = x
+				break
+			}
+		}
+		if start >= 0 {
+			b.Write(encoder.Locate(y, start))
+			b.Write(t.Current.Display[y][start:])
+		}
+	}
+	if _, err := t.Output.Write(b.Bytes()); err != nil {
+		return err
+	}
+	t.Last = t.Current
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// displayDriver feeds a single display with content from its producers.
+type displayDriver struct {
+	name     string
+	config   *DisplayConfig
+	output   *output.Output
+	terminal *Display
+	initial  *displayReload // the configuration to start Run with
+	state    string         // where to remember the display's content
+	resume   *DisplayState  // what the display is assumed to show initially
+	failure  error          // why the output has failed for good
+
+	slots    [][]*regionSlot     // regions of each page
+	frames   []DisplayState      // contents of each page
+	page     int                 // index of the page being shown
+	messages takeover.Queue      // takeover messages
+	updates  chan regionUpdate   // content from producers
+	controls chan func()         // requests to be run from within Run
+	reloads  chan *displayReload // new configurations
+
+	brightness int          // brightness while awake, in percent
+	power      string       // power mode
+	asleep     bool         // whether the display is power-saving
+	shown      DisplayState // content, disregarding power saving
+	changed    time.Time    // when the content has last changed
+	userIdle   bool         // whether the sleep screen is shown
+	locked     bool         // whether the lock screen is shown
+	busyPage   int          // page to return to from the sleep screen
+
+	stalled atomic.Int64 // when a blocking output operation has started
+}
+
+// regionSlot is a region of the display, together with its running producer.
+type regionSlot struct {
+	page    int
+	region  *RegionConfig // nil once the producer has been stopped
+	content string
+	cancel  context.CancelFunc
+}
+
+type regionUpdate struct {
+	slot    *regionSlot
+	content string
+}
+
+func newDisplayDriver(config *Config, dc *DisplayConfig) (*displayDriver, error) {
+	out, err := output.Parse(dc.Output)
+	if err != nil {
+		return nil, err
+	}
+	initial, err := prepareReload(config, dc, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &displayDriver{
+		name:     dc.Name,
+		config:   dc,
+		output:   out,
+		terminal: NewDisplay(nil, *dc.Charset),
+		initial:  initial,
+		state:    displayStatePath(out),
+
+		brightness: 100,
+		power:      powerAuto,
+		changed:    time.Now(),
+
+		updates:  make(chan regionUpdate),
+		controls: make(chan func()),
+		reloads:  make(chan *displayReload),
+	}, nil
+}
+
+func (dd *displayDriver) publish(name string, args map[string]string) {
+	if args == nil {
+		args = make(map[string]string)
+	}
+	args["display"] = dd.name
+	args["output"] = dd.output.String()
+	events.Publish(name, args)
+}
+
+// SwitchPage requests the named page to be shown,
+// or the following one if the name is empty.
+func (dd *displayDriver) SwitchPage(ctx context.Context, name string) error {
+	var err error
+	if doErr := dd.do(ctx, func() {
+		if name == "" {
+			dd.showPage((dd.page + 1) % len(dd.frames))
+			return
+		}
+		for i := range dd.config.Pages {
+			if dd.config.Pages[i].Name == name {
+				dd.showPage(i)
+				return
+			}
+		}
+		err = fmt.Errorf("unknown page: %q", name)
+	}); doErr != nil {
+		return doErr
+	}
+	return err
+}
+
+// Reload makes the driver switch to a new configuration.
+func (dd *displayDriver) Reload(ctx context.Context, r *displayReload) error {
+	select {
+	case dd.reloads <- r:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do runs f from within Run, so that it may access the driver's state.
+func (dd *displayDriver) do(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	select {
+	case dd.controls <- func() { f(); close(done) }:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-done
+	return nil
+}
+
+// ClearMessages removes all takeover messages, whether shown or queued.
+func (dd *displayDriver) ClearMessages(ctx context.Context) error {
+	return dd.do(ctx, dd.messages.Clear)
+}
+
+// SetBrightness changes the display's brightness, given in percent.
+// It may be further lowered by dimming, or power saving.
+func (dd *displayDriver) SetBrightness(ctx context.Context, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid brightness: %d", percent)
+	}
+
+	return dd.do(ctx, func() { dd.brightness = percent })
+}
+
+// Power modes, "auto" leaving it to the power saving configuration.
+const (
+	powerAuto = "auto"
+	powerOn   = "on"
+	powerOff  = "off"
+)
+
+// SetPower forces the display to stay awake, or asleep,
+// or returns it to automatic power management.
+func (dd *displayDriver) SetPower(ctx context.Context, mode string) error {
+	switch mode {
+	case powerAuto, powerOn, powerOff:
+	default:
+		return fmt.Errorf("unknown power mode: %q", mode)
+	}
+	return dd.do(ctx, func() { dd.power = mode })
+}
+
+// stallWriter records when a write has started, until it finishes,
+// so that writes stuck on an unresponsive device can be detected.
+type stallWriter struct {
+	io.WriteCloser
+	since *atomic.Int64
+}
+
+func (w stallWriter) Write(p []byte) (int, error) {
+	w.since.Store(time.Now().UnixNano())
+	defer w.since.Store(0)
+	return w.WriteCloser.Write(p)
+}
+
+// Stalled tells whether the output has been blocked for at least d.
+// Unlike other methods, it may be called from any goroutine.
+func (dd *displayDriver) Stalled(now time.Time, d time.Duration) bool {
+	since := dd.stalled.Load()
+	return since != 0 && now.Sub(time.Unix(0, since)) >= d
+}
+
+// connect opens the output, retrying until it succeeds,
+// and initializes the display. Outputs that cannot be reopened
+// fail for good, and leave the error in dd.failure.
+func (dd *displayDriver) connect(ctx context.Context) bool {
+	for {
+		dd.stalled.Store(time.Now().UnixNano())
+		w, err := dd.output.Open()
+		dd.stalled.Store(0)
+		if err == nil {
+			dd.terminal.Output = stallWriter{w, &dd.stalled}
+			if dd.resume != nil {
+				err = dd.terminal.Resume(*dd.resume)
+				dd.resume = nil
+			} else {
+				err = dd.terminal.Reset()
+			}
+			if err == nil {
+				slog.Debug("Display connected", "output", dd.output.String())
+				dd.publish("connect", nil)
+				return true
+			}
+			w.Close()
+		}
+		if !dd.output.Reconnectable() {
+			dd.failure = fmt.Errorf("%s: %w", dd.output, err)
+			return false
+		}
+
+		slog.Warn("Display error", "output", dd.output.String(), "error", err)
+		if !sleep(ctx, 5*time.Second) {
+			return false
+		}
+	}
+}
+
+// flush sends any changes to the display, reconnecting as necessary.
+func (dd *displayDriver) flush(ctx context.Context) bool {
+	if !dd.terminal.HasChanges() {
+		return true
+	}
+	if err := dd.terminal.Update(); err != nil {
+		dd.publish("disconnect", nil)
+		if !dd.output.Reconnectable() {
+			dd.failure = fmt.Errorf("%s: %w", dd.output, err)
+			return false
+		}
+		slog.Warn("Display error", "output", dd.output.String(), "error", err)
+
+		dd.terminal.Output.(io.Closer).Close()
+		if !dd.connect(ctx) {
+			return false
+		}
+		return dd.flush(ctx)
+	}
+	return true
+}
+
+// throttle forwards content from in to out at most once per interval,
+// only keeping the latest content of what arrives in the meantime.
+func throttle(ctx context.Context, in <-chan string, out chan<- string,
+	interval time.Duration) {
+	timer := time.NewTimer(interval)
+	timer.Stop()
+	defer timer.Stop()
+
+	var (
+		content string
+		pending bool
+		wait    <-chan time.Time
+	)
+	for {
+		select {
+		case content = <-in:
+			pending = true
+		case <-wait:
+			wait = nil
+		case <-ctx.Done():
+			return
+		}
+		if !pending || wait != nil {
+			continue
+		}
+		if !send(ctx, out, content) {
+			return
+		}
+		pending = false
+		timer.Reset(interval)
+		wait = timer.C
+	}
+}
+
+// start runs a producer for the given region.
+func (dd *displayDriver) start(
+	ctx context.Context, p Producer, region *RegionConfig) *regionSlot {
+	ctx, cancel := context.WithCancel(ctx)
+	slot := &regionSlot{region: region, cancel: cancel}
+
+	out := make(chan string, 1)
+	go p.Run(ctx, out)
+	if region.MinInterval > 0 {
+		in := out
+		out = make(chan string, 1)
+		go throttle(ctx, in, out, region.MinInterval)
+	}
+	if !region.Truncate {
+		in := out
+		out = make(chan string, 1)
+		go marquee(ctx, in, out, region.Width,
+			region.ScrollInterval, *region.ScrollGap)
+	}
+	go func() {
+		for {
+			select {
+			case content := <-out:
+				select {
+				case dd.updates <- regionUpdate{slot: slot, content: content}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return slot
+}
+
+// reconfigure switches to a new configuration, keeping the producers
+// of unchanged regions running, and their content shown.
+func (dd *displayDriver) reconfigure(ctx context.Context, r *displayReload) {
+	old, stopped := dd.slots, make([][]*regionSlot, len(dd.slots))
+	for i := range old {
+		stopped[i] = slices.Clone(old[i])
+	}
+	oldPage := ""
+	if dd.page < len(dd.config.Pages) {
+		oldPage = dd.config.Pages[dd.page].Name
+	}
+
+	dd.config = r.config
+	dd.slots = make([][]*regionSlot, len(r.config.Pages))
+	dd.frames = make([]DisplayState, len(r.config.Pages))
+	for i := range r.config.Pages {
+		page := &r.config.Pages[i]
+		dd.slots[i] = make([]*regionSlot, len(page.Regions))
+		dd.frames[i] = NewDisplayState()
+		for j := range page.Regions {
+			region := &page.Regions[j]
+
+			var slot *regionSlot
+			if k, ok := r.reused[[2]int{i, j}]; ok {
+				slot, stopped[k[0]][k[1]] = old[k[0]][k[1]], nil
+				slot.region = region
+			} else {
+				slot = dd.start(ctx, r.producers[i][j], region)
+
+				// Avoid blanking out replaced regions until they update.
+				if i < len(old) && j < len(old[i]) {
+					if replaced := old[i][j]; replaced.region.Line ==
+						region.Line && replaced.region.Column == region.Column {
+						slot.content = replaced.content
+					}
+				}
+			}
+			slot.page = i
+			dd.slots[i][j] = slot
+			dd.frames[i].SetRegion(*r.config.Charset,
+				region.Line, region.Column, region.Width, slot.content)
+		}
+	}
+	for _, page := range stopped {
+		for _, slot := range page {
+			if slot != nil {
+				slot.cancel()
+				slot.region = nil
+			}
+		}
+	}
+
+	// Stay on the same page, if possible.
+	page := 0
+	for i := range r.config.Pages {
+		if r.config.Pages[i].Name == oldPage {
+			page = i
+		}
+	}
+	dd.page = -1
+	dd.showPage(page)
+
+	if *r.config.Charset != dd.terminal.Charset {
+		dd.terminal.Charset = *r.config.Charset
+		if dd.terminal.Output != nil {
+			if err := dd.terminal.Reset(); err != nil {
+				slog.Warn("Display error",
+					"output", dd.output.String(), "error", err)
+			}
+		}
+	}
+}
+
+// sessionPage returns the index of the page to be shown
+// in the session's current state, or -1 if there is none.
+func (dd *displayDriver) sessionPage() int {
+	name := ""
+	if dd.locked {
+		name = dd.config.lock.Page
+	} else if dd.userIdle {
+		name = dd.config.idle.Page
+	}
+	for i := range dd.config.Pages {
+		if name != "" && dd.config.Pages[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// setSessionState switches to or from the sleep screen, or the lock screen.
+func (dd *displayDriver) setSessionState(idle, locked bool) {
+	before := dd.sessionPage()
+	dd.userIdle, dd.locked = idle, locked
+	after := dd.sessionPage()
+	if after == before {
+		return
+	}
+
+	if before < 0 {
+		dd.busyPage = dd.page
+	}
+	if after >= 0 {
+		dd.showPage(after)
+	} else if dd.busyPage < len(dd.frames) {
+		dd.showPage(dd.busyPage)
+	}
+}
+
+// showPage switches to the page of the given index.
+func (dd *displayDriver) showPage(page int) {
+	if page == dd.page {
+		return
+	}
+	dd.page = page
+	dd.publish("page", map[string]string{
+		"page": dd.config.Pages[page].Name,
+	})
+}
+
+// Run starts all producers, and keeps the display updated with their content.
+// Producers of all pages keep running, so that switching is instantaneous.
+// It returns an error if the output fails, and cannot be reopened.
+func (dd *displayDriver) Run(ctx context.Context) error {
+	dd.reconfigure(ctx, dd.initial)
+	dd.initial = nil
+	if !*dd.config.FullRefresh {
+		dd.resume = dd.loadState()
+	}
+	if !dd.connect(ctx) {
+		return dd.failure
+	}
+
+	var (
+		ticker   *time.Ticker
+		rotation <-chan time.Time
+	)
+	resetRotation := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, rotation = nil, nil
+		}
+		if dd.config.PageInterval > 0 && len(dd.frames) > 1 {
+			ticker = time.NewTicker(dd.config.PageInterval)
+			rotation = ticker.C
+		}
+	}
+	resetRotation()
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	messages, unsubscribe := takeovers.Subscribe()
+	defer unsubscribe()
+
+	idle, idleChanged := userIdle.Get()
+	locked, lockChanged := sessionLocked.Get()
+	dd.setSessionState(idle, locked)
+
+	// This timer handles takeover message expiry and scrolling.
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	// Changes are held back until this deadline, so that the serial link
+	// doesn't get to see every intermediate state.
+	var coalesced time.Time
+
+	for {
+		select {
+		case m := <-messages:
+			if m.Display == "" || m.Display == dd.name {
+				dd.messages.Push(m, time.Now())
+			}
+		case <-timer.C:
+			dd.messages.Expire(time.Now())
+		case update := <-dd.updates:
+			slot := update.slot
+			if r := slot.region; r != nil {
+				slot.content = update.content
+				dd.frames[slot.page].SetRegion(
+					*dd.config.Charset, r.Line, r.Column, r.Width, slot.content)
+			}
+		case <-rotation:
+			if !dd.locked {
+				dd.showPage((dd.page + 1) % len(dd.frames))
+			}
+		case f := <-dd.controls:
+			f()
+		case <-idleChanged:
+			idle, idleChanged = userIdle.Get()
+			dd.setSessionState(idle, locked)
+		case <-lockChanged:
+			locked, lockChanged = sessionLocked.Get()
+			dd.setSessionState(idle, locked)
+		case r := <-dd.reloads:
+			dd.reconfigure(ctx, r)
+			resetRotation()
+		case <-ctx.Done():
+			dd.shutdown()
+			return nil
+		}
+
+		now := time.Now()
+		wake := min(dd.compose(now), dd.managePower(now))
+		if dd.terminal.HasChanges() && coalesced.IsZero() {
+			coalesced = now.Add(*dd.config.Coalesce)
+		}
+		if now.Before(coalesced) {
+			timer.Reset(min(wake, coalesced.Sub(now)))
+			continue
+		}
+		coalesced = time.Time{}
+		timer.Reset(wake)
+		if !dd.flush(ctx) {
+			return dd.failure
+		}
+	}
+}
+
+// lockScreen shows just the time and the date, unless it should be blank.
+// It returns when it needs to be called again.
+func (dd *displayDriver) lockScreen(now time.Time) (DisplayState, time.Duration) {
+	state, lc := NewDisplayState(), dd.config.lock
+	if lc.Blank {
+		return state, time.Hour
+	}
+
+	sc := lc.status
+	lines := []string{sc.formatTime(now), sc.locale.Format(now, sc.DateFormat)}
+	for row, line := range lines {
+		column := max(displayWidth-utf8.RuneCountInString(line), 0) / 2
+		state.SetRegion(*dd.config.Charset, row, column, displayWidth, line)
+	}
+	return state, now.Truncate(time.Second).Add(time.Second).Sub(now)
+}
+
+// shutdown leaves the display in a calm state, and closes the output.
+func (dd *displayDriver) shutdown() {
+	defer dd.terminal.Output.(io.Closer).Close()
+
+	sc := dd.config.Shutdown
+	dd.terminal.Current = NewDisplayState()
+	m := Message{Text: sc.Message, Line: -1}
+	for row, line := range m.Lines() {
+		dd.terminal.SetRegion(row, 0, displayWidth, line)
+	}
+
+	// The cursor is restored to what the display starts up with.
+	err := dd.terminal.Reset()
+	if err == nil {
+		err = dd.terminal.Update()
+	}
+	if err == nil {
+		err = dd.terminal.SetCursorMode(encoder.CursorBlink)
+	}
+	if err == nil {
+		err = dd.terminal.SetBrightness(sc.Brightness)
+	}
+	if err != nil {
+		slog.Warn("Display error", "output", dd.output.String(), "error", err)
+	} else if err := dd.saveState(); err != nil {
+		slog.Warn("Display state not saved", "path", dd.state, "error", err)
+	}
+}
+
+// displayStatePath returns where to remember what an output has been left
+// showing, or an empty string if there is no suitable place.
+func displayStatePath(out *output.Output) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(out.String()))
+	return filepath.Join(dir, "liustatus", fmt.Sprintf("display-%08x", h.Sum32()))
+}
+
+// saveState remembers what the display has been left showing,
+// as the charset selection followed by the contents of each line.
+func (dd *displayDriver) saveState() error {
+	if dd.state == "" {
+		return nil
+	}
+	b := []byte{dd.terminal.Charset}
+	for y := range dd.terminal.Last.Display {
+		b = append(b, dd.terminal.Last.Display[y][:]...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dd.state), 0755); err != nil {
+		return err
+	}
+	temporary := dd.state + ".new"
+	if err := os.WriteFile(temporary, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, dd.state)
+}
+
+// loadState returns what the display has been left showing, if known.
+// The state is consumed, so that it is never trusted after a crash.
+func (dd *displayDriver) loadState() *DisplayState {
+	if dd.state == "" {
+		return nil
+	}
+	b, err := os.ReadFile(dd.state)
+	if err != nil {
+		return nil
+	}
+	os.Remove(dd.state)
+	if len(b) != 1+displayHeight*displayWidth || b[0] != dd.terminal.Charset {
+		return nil
+	}
+
+	var state DisplayState
+	for y := range state.Display {
+		copy(state.Display[y][:], b[1+y*displayWidth:])
+	}
+	return &state
+}
+
+// managePower puts the display to sleep when it has shown nothing new
+// for a while, or nothing at all, and wakes it up once there is new content.
+// It also dims it at night. It returns when it needs to be called again.
+func (dd *displayDriver) managePower(now time.Time) time.Duration {
+	pc := dd.config.Power
+	if dd.terminal.Current != dd.shown {
+		dd.shown, dd.changed = dd.terminal.Current, now
+	}
+
+	idle, wake := now.Sub(dd.changed), time.Hour
+	asleep := dd.power == powerOff
+	if dd.power == powerAuto && pc.Idle > 0 {
+		asleep = idle >= pc.Idle || dd.shown == NewDisplayState()
+		if !asleep {
+			wake = pc.Idle - idle
+		}
+	}
+	if asleep != dd.asleep {
+		if dd.asleep = asleep; asleep {
+			dd.publish("sleep", nil)
+		} else {
+			dd.publish("wake", nil)
+		}
+	}
+	if asleep && pc.Brightness == 0 {
+		dd.terminal.Current = NewDisplayState()
+	}
+
+	brightness := dd.brightness
+	night, until := dd.config.Dimming.Night(now)
+	if night {
+		brightness = min(brightness, dd.config.Dimming.Brightness)
+	}
+	if dd.userIdle {
+		brightness = min(brightness, dd.config.idle.Brightness)
+	}
+	if dd.locked {
+		brightness = min(brightness, dd.config.lock.Brightness)
+	}
+	if asleep {
+		brightness = min(brightness, pc.Brightness)
+	}
+	if brightness != dd.terminal.Brightness {
+		// Failures will be noticed, and handled, when flushing.
+		_ = dd.terminal.SetBrightness(brightness)
+	}
+	return min(wake, until.Sub(now))
+}
+
+// The scrolling speed of takeover messages, and how long blinking ones
+// stay on and off.
+const (
+	takeoverScrollInterval = 300 * time.Millisecond
+	takeoverBlinkInterval  = 500 * time.Millisecond
+)
+
+// compose puts together what should be shown on the display,
+// and returns when it is going to change on its own.
+func (dd *displayDriver) compose(now time.Time) time.Duration {
+	dd.terminal.Current = dd.frames[dd.page]
+	wake := time.Hour
+	if dd.locked && dd.sessionPage() < 0 {
+		dd.terminal.Current, wake = dd.lockScreen(now)
+	}
+
+	// Only the most important messages, such as alarms, may disclose
+	// anything while the session is locked.
+	m := dd.messages.Active()
+	if m == nil || dd.locked && m.Priority < 2 {
+		return wake
+	}
+
+	deadline, _ := dd.messages.Deadline()
+	wake = min(wake, deadline.Sub(now))
+
+	rows, lines := []int{m.Line}, m.Lines()
+	if m.Line < 0 {
+		rows = rows[:0]
+		for row := range displayHeight {
+			rows = append(rows, row)
+		}
+	}
+
+	elapsed := dd.messages.Elapsed(now)
+	if m.Blink {
+		phase := elapsed / takeoverBlinkInterval
+		if phase%2 == 1 {
+			lines = nil
+		}
+		wake = min(wake, takeoverBlinkInterval*(phase+1)-elapsed)
+	}
+	for i, row := range rows {
+		line := ""
+		if i < len(lines) {
+			line = lines[i]
+		}
+		if utf8.RuneCountInString(line) > displayWidth {
+			step := int(elapsed / takeoverScrollInterval)
+			line = marqueeWindow(marqueeCycle(line, 3), displayWidth, step)
+			wake = min(wake,
+				takeoverScrollInterval*time.Duration(step+1)-elapsed)
+		}
+		dd.terminal.SetRegion(row, 0, displayWidth, line)
+	}
+	return max(wake, 0)
+}
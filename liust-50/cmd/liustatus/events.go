@@ -0,0 +1,51 @@
+package main
+
+import "sync"
+
+// Event notifies about changes within liustatus, such as page switches,
+// or the display being connected or disconnected.
+type Event struct {
+	Name string            `json:"event"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// EventBus distributes events to all interested parties.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// events is the process-wide event bus.
+var events = NewEventBus()
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving all future events,
+// and a function to end the subscription with.
+func (b *EventBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, ch)
+	}
+}
+
+// Publish sends an event to all subscribers. Slow subscribers lose events,
+// rather than stalling everyone else.
+func (b *EventBus) Publish(name string, args map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- Event{Name: name, Args: args}:
+		default:
+		}
+	}
+}
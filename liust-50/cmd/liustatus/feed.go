@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// How long to remember seen items, which should outlast their presence
+// in feeds, but not grow the state file indefinitely.
+const feedSeenExpiry = 90 * 24 * time.Hour
+
+// feedProducer scrolls headlines of RSS or Atom feeds, each of them once.
+// Items that have been shown are remembered across restarts.
+type feedProducer struct {
+	Feeds []string `toml:"feeds"`
+	// Interval is the period between fetching feeds.
+	Interval time.Duration `toml:"interval"`
+	// MaxItems limits how many of the newest items per feed are considered.
+	MaxItems int `toml:"max_items"`
+	// MinDuration is how long headlines that need no scrolling are shown for.
+	MinDuration time.Duration `toml:"min_duration"`
+	// State is where seen items are stored, and defaults to a cache file.
+	State string `toml:"state"`
+
+	region *RegionConfig
+	client *http.Client
+	seen   map[string]time.Time
+	queue  []feedItem
+}
+
+// feedItem is a headline, identified by a key that should be stable.
+type feedItem struct {
+	key, title string
+}
+
+func init() {
+	registerProducer("feed", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		fp := &feedProducer{
+			Interval:    15 * time.Minute,
+			MaxItems:    5,
+			MinDuration: 10 * time.Second,
+			region:      region,
+			client:      &http.Client{Timeout: 30 * time.Second},
+			seen:        make(map[string]time.Time),
+		}
+		if err := config.DecodeOptions(region, fp); err != nil {
+			return nil, err
+		}
+		if len(fp.Feeds) == 0 {
+			return nil, errors.New("no feeds specified")
+		}
+		if fp.Interval <= 0 || fp.MinDuration <= 0 {
+			return nil, errors.New("intervals must be positive")
+		}
+		if fp.MaxItems <= 0 {
+			return nil, errors.New("the item limit must be positive")
+		}
+		if fp.State == "" {
+			// Regions with different feeds mustn't overwrite each other's state.
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return nil, err
+			}
+			h := fnv.New32a()
+			h.Write([]byte(strings.Join(fp.Feeds, "\n")))
+			fp.State = filepath.Join(dir, "liustatus",
+				fmt.Sprintf("feed-%08x", h.Sum32()))
+		}
+		return fp, nil
+	})
+}
+
+// feedDocument covers RSS 2.0, RSS 1.0, and Atom, whose elements
+// are matched regardless of namespaces.
+type feedDocument struct {
+	Channel struct {
+		Items []feedEntry `xml:"item"`
+	} `xml:"channel"`
+	Items   []feedEntry `xml:"item"`
+	Entries []feedEntry `xml:"entry"`
+}
+
+type feedEntry struct {
+	Title string `xml:"title"`
+	GUID  string `xml:"guid"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		URL  string `xml:",chardata"`
+	} `xml:"link"`
+}
+
+func (e *feedEntry) item() feedItem {
+	// Titles may be spread over several lines.
+	item := feedItem{key: e.GUID}
+	item.title = strings.Join(strings.Fields(e.Title), " ")
+	if item.key == "" {
+		item.key = e.ID
+	}
+	if item.key == "" && len(e.Links) != 0 {
+		item.key = strings.TrimSpace(e.Links[0].Href + e.Links[0].URL)
+	}
+	if item.key == "" {
+		item.key = item.title
+	}
+	return item
+}
+
+func (fp *feedProducer) fetchFeed(ctx context.Context, url string) (
+	[]feedItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := fp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var doc feedDocument
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+
+	var items []feedItem
+	for _, entries := range [][]feedEntry{
+		doc.Channel.Items, doc.Items, doc.Entries} {
+		for _, e := range entries[:min(len(entries), fp.MaxItems)] {
+			if item := e.item(); item.title != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// fetch queues up items that haven't been seen yet.
+func (fp *feedProducer) fetch(ctx context.Context) {
+	queued := make(map[string]bool)
+	for _, item := range fp.queue {
+		queued[item.key] = true
+	}
+	for _, url := range fp.Feeds {
+		items, err := fp.fetchFeed(ctx, url)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Feed failed", "error", err)
+			}
+			continue
+		}
+		for _, item := range items {
+			if _, ok := fp.seen[item.key]; !ok && !queued[item.key] {
+				fp.queue = append(fp.queue, item)
+				queued[item.key] = true
+			}
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// load reads the state file, consisting of lines of Unix times
+// and item keys, separated by a tab.
+func (fp *feedProducer) load() {
+	f, err := os.Open(fp.State)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		slog.Warn("Feed state unreadable", "error", err)
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		when, key, ok := strings.Cut(scanner.Text(), "\t")
+		if unix, err := strconv.ParseInt(when, 10, 64); ok && err == nil {
+			fp.seen[key] = time.Unix(unix, 0)
+		}
+	}
+}
+
+func (fp *feedProducer) save() error {
+	var b strings.Builder
+	for key, when := range fp.seen {
+		if time.Since(when) > feedSeenExpiry {
+			delete(fp.seen, key)
+		} else {
+			fmt.Fprintf(&b, "%d\t%s\n", when.Unix(), key)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fp.State), 0755); err != nil {
+		return err
+	}
+	temporary := fp.State + ".new"
+	if err := os.WriteFile(temporary, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, fp.State)
+}
+
+// duration returns how long it takes to scroll a headline through once.
+func (fp *feedProducer) duration(title string) time.Duration {
+	length := utf8.RuneCountInString(title)
+	if length <= fp.region.Width || fp.region.Truncate {
+		return fp.MinDuration
+	}
+	return max(fp.MinDuration, time.Duration(length+*fp.region.ScrollGap)*
+		fp.region.ScrollInterval)
+}
+
+func (fp *feedProducer) Run(ctx context.Context, out chan<- string) {
+	refresh := time.NewTicker(fp.Interval)
+	defer refresh.Stop()
+
+	fp.load()
+	fp.fetch(ctx)
+	for {
+		var (
+			timer   *time.Timer
+			shown   <-chan time.Time
+			content string
+		)
+		if len(fp.queue) != 0 {
+			content = fp.queue[0].title
+			timer = time.NewTimer(fp.duration(content))
+			shown = timer.C
+		}
+		if !send(ctx, out, content) {
+			return
+		}
+
+	Wait:
+		for {
+			select {
+			case <-refresh.C:
+				fp.fetch(ctx)
+				if shown == nil && len(fp.queue) != 0 {
+					break Wait
+				}
+			case <-shown:
+				fp.seen[fp.queue[0].key] = time.Now()
+				fp.queue = fp.queue[1:]
+				if err := fp.save(); err != nil {
+					slog.Warn("Feed state not saved", "error", err)
+				}
+				break Wait
+			case <-ctx.Done():
+				return
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// fortuneProducer shows short fortunes, or word-of-the-day entries,
+// on a single line, which is scrolled as necessary.
+type fortuneProducer struct {
+	// File is a fortune file, with entries separated by lines of "%",
+	// or, lacking those, a plain list with one entry per line.
+	File string `toml:"file"`
+	// Command prints an entry, and is only used without a file.
+	Command string `toml:"command"`
+	// Daily picks a single entry from the file for each day,
+	// as with a word of the day.
+	Daily    bool          `toml:"daily"`
+	Interval time.Duration `toml:"interval"`
+}
+
+func init() {
+	registerProducer("fortune", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		fp := &fortuneProducer{
+			Command:  "fortune -s",
+			Interval: 10 * time.Minute,
+		}
+		if err := config.DecodeOptions(region, fp); err != nil {
+			return nil, err
+		}
+		if fp.File == "" && fp.Command == "" {
+			return nil, errors.New("no file or command specified")
+		}
+		if fp.Daily && fp.File == "" {
+			return nil, errors.New("daily entries need a file")
+		}
+		if fp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: fp.Interval, produce: fp.produce}, nil
+	})
+}
+
+// parseFortunes splits a fortune file into entries, each on a single line.
+func parseFortunes(data string) []string {
+	isSeparator := func(line string) bool {
+		return strings.TrimSpace(line) == "%"
+	}
+	lines := strings.Split(data, "\n")
+	separated := slices.ContainsFunc(lines, isSeparator)
+
+	var entries, entry []string
+	flush := func(text string) {
+		if text = strings.Join(strings.Fields(text), " "); text != "" {
+			entries = append(entries, text)
+		}
+	}
+	for _, line := range lines {
+		switch {
+		case !separated:
+			flush(line)
+		case isSeparator(line):
+			flush(strings.Join(entry, " "))
+			entry = nil
+		default:
+			entry = append(entry, line)
+		}
+	}
+	flush(strings.Join(entry, " "))
+	return entries
+}
+
+func (fp *fortuneProducer) fromFile() (string, error) {
+	data, err := os.ReadFile(fp.File)
+	if err != nil {
+		return "", err
+	}
+	entries := parseFortunes(string(data))
+	if len(entries) == 0 {
+		return "", errors.New("no entries found")
+	}
+	if !fp.Daily {
+		return entries[rand.Intn(len(entries))], nil
+	}
+
+	// The order is shuffled, yet stays the same across restarts.
+	h := fnv.New32a()
+	h.Write([]byte(time.Now().Format(time.DateOnly)))
+	return entries[h.Sum32()%uint32(len(entries))], nil
+}
+
+func (fp *fortuneProducer) fromCommand() (string, error) {
+	cmd := exec.Command("/bin/sh", "-c", fp.Command)
+	cmd.Stderr = stderrLogger("fortune", fp.Command)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(out)), " "), nil
+}
+
+func (fp *fortuneProducer) produce() string {
+	var (
+		fortune string
+		err     error
+	)
+	if fp.File != "" {
+		fortune, err = fp.fromFile()
+	} else {
+		fortune, err = fp.fromCommand()
+	}
+	if err != nil {
+		slog.Warn("Fortune failed", "error", err)
+	}
+	return fortune
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/weather"
+)
+
+const geocodingURL = "https://geocoding-api.open-meteo.com/v1/search"
+
+// geocodingTimeout keeps lookups from holding up startup, or reloads.
+const geocodingTimeout = 10 * time.Second
+
+// geocodingCachePath returns where to remember the coordinates of places,
+// or an empty string if there is no suitable place.
+func geocodingCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "liustatus", "geocoding.json")
+}
+
+// geocodingCache maps place names to their coordinates.
+type geocodingCache map[string]LocationConfig
+
+func loadGeocodingCache(path string) geocodingCache {
+	cache := make(geocodingCache)
+	if b, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(b, &cache)
+	}
+	return cache
+}
+
+// saveJSON atomically replaces a file with the JSON encoding of a value,
+// creating any missing parent directories.
+func saveJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temporary := path + ".new"
+	if err := os.WriteFile(temporary, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+// geocode looks up the coordinates of the most prominent place of a name,
+// using Open-Meteo's geocoding API, which is based on GeoNames.
+func geocode(ctx context.Context, place string) (LocationConfig, error) {
+	query := url.Values{"name": {place}, "count": {"1"}, "format": {"json"}}
+	var result struct {
+		Results []struct {
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+			Elevation float64 `json:"elevation"`
+		} `json:"results"`
+	}
+	ctx, cancel := context.WithTimeout(ctx, geocodingTimeout)
+	defer cancel()
+
+	client := &http.Client{}
+	if err := weather.FetchJSON(ctx, client,
+		geocodingURL+"?"+query.Encode(), &result); err != nil {
+		return LocationConfig{}, err
+	}
+	if len(result.Results) == 0 {
+		return LocationConfig{}, errors.New("no such place found")
+	}
+	r := result.Results[0]
+	return LocationConfig{
+		Latitude:  r.Latitude,
+		Longitude: r.Longitude,
+		Altitude:  int(r.Elevation),
+	}, nil
+}
+
+// resolve fills in the coordinates of the named place, if any.
+// Places are only looked up once, as their coordinates are kept on disk.
+func (l *LocationConfig) resolve(ctx context.Context) error {
+	if l.Place == "" {
+		return nil
+	}
+
+	path := geocodingCachePath()
+	cache := loadGeocodingCache(path)
+	resolved, ok := cache[l.Place]
+	if !ok {
+		var err error
+		if resolved, err = geocode(ctx, l.Place); err != nil {
+			return fmt.Errorf("place %q: %w", l.Place, err)
+		}
+		slog.Info("Place resolved", "place", l.Place,
+			"latitude", resolved.Latitude, "longitude", resolved.Longitude)
+
+		cache[l.Place] = resolved
+		if path != "" {
+			if err := saveJSON(path, cache); err != nil {
+				slog.Warn("Geocoding cache not saved", "path", path, "error", err)
+			}
+		}
+	}
+	l.Latitude, l.Longitude, l.Altitude =
+		resolved.Latitude, resolved.Longitude, resolved.Altitude
+	return nil
+}
+
+// places returns all locations in the configuration.
+func (c *Config) places() []*LocationConfig {
+	places := []*LocationConfig{&c.Location}
+	for i := range c.Weather.Locations {
+		places = append(places, &c.Weather.Locations[i].LocationConfig)
+	}
+	return places
+}
+
+// resolvePlaces resolves all locations in the configuration. This needs to
+// happen before validation, which copies the main one to where it is used.
+// Places that cannot be looked up are left pending, rather than failing
+// the whole configuration, and it tells whether there are any.
+func (c *Config) resolvePlaces(ctx context.Context) (pending bool) {
+	for _, l := range c.places() {
+		if err := l.resolve(ctx); err != nil {
+			slog.Warn("Place not resolved", "place", l.Place, "error", err)
+			l.pending, pending = true, true
+		}
+	}
+	return pending
+}
+
+// awaitPlaces keeps looking up pending places in the background,
+// backing off, and calls resolved once they are all known. They are kept
+// in the cache by then, for the configuration to be loaded again.
+func (c *Config) awaitPlaces(ctx context.Context, resolved func()) {
+	var pending []LocationConfig
+	for _, l := range c.places() {
+		if l.pending {
+			pending = append(pending, *l)
+		}
+	}
+	for delay := time.Minute; len(pending) > 0; delay = min(delay*2, time.Hour) {
+		if !sleep(ctx, delay) {
+			return
+		}
+		for len(pending) > 0 {
+			if err := pending[0].resolve(ctx); err != nil {
+				slog.Debug("Place not resolved",
+					"place", pending[0].Place, "error", err)
+				break
+			}
+			pending = pending[1:]
+		}
+		if len(pending) == 0 {
+			resolved()
+		}
+	}
+}
+
+// unlessPending returns the producer, or while the place is yet
+// to be looked up, one that leaves its region blank.
+func (l *LocationConfig) unlessPending(p Producer) Producer {
+	if l.pending {
+		return idleProducer
+	}
+	return p
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolvePlacesBeforeValidation(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	resolved := LocationConfig{Latitude: 35.6895, Longitude: 139.69171}
+	if err := saveJSON(geocodingCachePath(),
+		geocodingCache{"Tokyo": resolved}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "liustatus.toml")
+	if err := os.WriteFile(path, []byte(
+		"[location]\nplace = \"Tokyo\"\n[dimming]\nsun = true\n"),
+		0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.resolvePlaces(context.Background()) {
+		t.Fatal("place left pending")
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := config.Displays[0].Dimming.location
+	if got.Latitude != resolved.Latitude || got.Longitude != resolved.Longitude {
+		t.Errorf("dimming follows %g, %g, expected %g, %g",
+			got.Latitude, got.Longitude, resolved.Latitude, resolved.Longitude)
+	}
+}
+
+func TestResolvePlacesPending(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "liustatus.toml")
+	if err := os.WriteFile(path, []byte(
+		"[location]\nplace = \"Tokyo\"\n[dimming]\nsun = true\n"+
+			"[[region]]\nproducer = \"sun\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lookups fail right away without a context to run in.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if !config.resolvePlaces(ctx) {
+		t.Fatal("unresolvable place not reported")
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newProducer(config, &config.Displays[0].Pages[0].Regions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(ProducerFunc); !ok {
+		t.Errorf("sun producer runs without a location")
+	}
+	if night, _ := config.Displays[0].Dimming.Night(time.Now()); night {
+		t.Errorf("display dimmed without a location")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// githubProducer shows the number of unread GitHub notifications,
+// and how the latest workflow runs of repositories have fared,
+// such as "GH 3 liust ok desk FAIL". Newly failing runs take over the display.
+type githubProducer struct {
+	// Token is a personal access token, or else the first line of output
+	// of TokenCommand, which is interpreted by the shell. Notifications
+	// need one, public repositories can do without.
+	Token        string `toml:"token"`
+	TokenCommand string `toml:"token_command"`
+	// URL overrides the API endpoint, such as for GitHub Enterprise Server.
+	URL   string       `toml:"url"`
+	Repos []githubRepo `toml:"repos"`
+	// NotificationsLabel precedes the notification count.
+	NotificationsLabel string `toml:"notifications_label"`
+	// Pass, Fail, and Pending indicate workflow run results.
+	Pass    string `toml:"pass"`
+	Fail    string `toml:"fail"`
+	Pending string `toml:"pending"`
+	// Alert takes over the display when a repository's run fails.
+	Alert    bool          `toml:"alert"`
+	Interval time.Duration `toml:"interval"`
+
+	client  *http.Client
+	results map[string]string
+}
+
+type githubRepo struct {
+	// Repo is the repository's owner and name, such as "pjanx/desktop-tools".
+	Repo string `toml:"repo"`
+	// Branch optionally limits which workflow runs are considered.
+	Branch string `toml:"branch"`
+	// Label defaults to the repository's name.
+	Label string `toml:"label"`
+}
+
+func init() {
+	registerProducer("github", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		gp := &githubProducer{
+			URL:                "https://api.github.com",
+			NotificationsLabel: "GH ",
+			Pass:               "ok",
+			Fail:               "FAIL",
+			Pending:            "..",
+			Alert:              true,
+			Interval:           5 * time.Minute,
+			client:             &http.Client{Timeout: 30 * time.Second},
+			results:            make(map[string]string),
+		}
+		if err := config.DecodeOptions(region, gp); err != nil {
+			return nil, err
+		}
+		for i := range gp.Repos {
+			r := &gp.Repos[i]
+			owner, name, ok := strings.Cut(r.Repo, "/")
+			if !ok || owner == "" || name == "" {
+				return nil, fmt.Errorf("invalid repository: %q", r.Repo)
+			}
+			if r.Label == "" {
+				r.Label = name
+			}
+		}
+		if gp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: gp.Interval, produce: gp.produce}, nil
+	})
+}
+
+func (gp *githubProducer) token() (string, error) {
+	if gp.TokenCommand == "" {
+		return gp.Token, nil
+	}
+	out, err := exec.Command("/bin/sh", "-c", gp.TokenCommand).Output()
+	if err != nil {
+		return "", fmt.Errorf("token command: %w", err)
+	}
+	token, _, _ := strings.Cut(string(out), "\n")
+	return token, nil
+}
+
+func (gp *githubProducer) get(token, path string, v any) error {
+	req, err := http.NewRequest(http.MethodGet,
+		strings.TrimSuffix(gp.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := gp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// notifications returns the number of unread notifications,
+// capped at a page's worth.
+func (gp *githubProducer) notifications(token string) (string, error) {
+	const perPage = 50
+	var threads []json.RawMessage
+	if err := gp.get(token,
+		fmt.Sprintf("/notifications?per_page=%d", perPage), &threads); err != nil {
+		return "", err
+	}
+	if len(threads) >= perPage {
+		return fmt.Sprintf("%d+", perPage), nil
+	}
+	return fmt.Sprint(len(threads)), nil
+}
+
+// latestRun returns the result of the latest workflow run,
+// as an indicator, or an empty string if there's none.
+func (gp *githubProducer) latestRun(token string, r *githubRepo) (
+	string, error) {
+	query := url.Values{"per_page": {"1"}}
+	if r.Branch != "" {
+		query.Set("branch", r.Branch)
+	}
+
+	var runs struct {
+		WorkflowRuns []struct {
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"workflow_runs"`
+	}
+	if err := gp.get(token,
+		"/repos/"+r.Repo+"/actions/runs?"+query.Encode(), &runs); err != nil {
+		return "", err
+	}
+	if len(runs.WorkflowRuns) == 0 {
+		return "", nil
+	}
+
+	run := runs.WorkflowRuns[0]
+	switch {
+	case run.Status != "completed":
+		return gp.Pending, nil
+	case run.Conclusion == "success" || run.Conclusion == "skipped" ||
+		run.Conclusion == "neutral":
+		return gp.Pass, nil
+	default:
+		return gp.Fail, nil
+	}
+}
+
+func (gp *githubProducer) produce() string {
+	token, err := gp.token()
+	if err != nil {
+		slog.Warn("GitHub failed", "error", err)
+		return ""
+	}
+
+	var fields []string
+	if token != "" {
+		if count, err := gp.notifications(token); err != nil {
+			slog.Warn("GitHub failed", "error", err)
+		} else if count != "0" {
+			fields = append(fields, gp.NotificationsLabel+count)
+		}
+	}
+	for i := range gp.Repos {
+		r := &gp.Repos[i]
+		result, err := gp.latestRun(token, r)
+		if err != nil {
+			slog.Warn("GitHub failed", "repo", r.Repo, "error", err)
+			result = "?"
+		}
+		if result == "" {
+			continue
+		}
+		fields = append(fields, r.Label+" "+result)
+
+		if gp.Alert && result == gp.Fail && gp.results[r.Repo] != gp.Fail {
+			Takeover(Message{
+				Text:     r.Label + " build failed",
+				Priority: 1,
+				Duration: 10 * time.Second,
+				Line:     -1,
+				Blink:    true,
+			})
+		}
+		if err == nil {
+			gp.results[r.Repo] = result
+		}
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// homeAssistantProducer shows states of Home Assistant entities,
+// such as "Living 21.5°C Door off", as they change. Calls to a notify
+// service of a given name take over the display with their messages.
+type homeAssistantProducer struct {
+	// URL is the server's, such as "http://homeassistant.local:8123".
+	URL string `toml:"url"`
+	// Token is a long-lived access token.
+	Token    string                `toml:"token"`
+	Entities []homeAssistantEntity `toml:"entities"`
+	// NotifyService is the name of a notify service, such as one
+	// of the command_line platform doing nothing, calls to which
+	// are shown, or nothing, to ignore them.
+	NotifyService string `toml:"notify_service"`
+	// NotifyDuration is how long notifications take over the display.
+	NotifyDuration time.Duration `toml:"notify_duration"`
+	// Retry is the delay before reconnecting.
+	Retry time.Duration `toml:"retry"`
+}
+
+type homeAssistantEntity struct {
+	// Entity is an entity ID, such as "climate.living_room".
+	Entity string `toml:"entity"`
+	// Attribute is used instead of the state, if set,
+	// such as "current_temperature".
+	Attribute string `toml:"attribute"`
+	// Label precedes the state.
+	Label string `toml:"label"`
+	// Unit follows the state, and defaults to its unit of measurement.
+	Unit *string `toml:"unit"`
+}
+
+func init() {
+	registerProducer("homeassistant", func(config *Config,
+		region *RegionConfig) (Producer, error) {
+		hp := &homeAssistantProducer{
+			URL:            "http://localhost:8123",
+			NotifyService:  "liustatus",
+			NotifyDuration: 10 * time.Second,
+			Retry:          10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, hp); err != nil {
+			return nil, err
+		}
+		if hp.Token == "" {
+			return nil, errors.New("no access token specified")
+		}
+		if _, err := hp.websocketURL(); err != nil {
+			return nil, err
+		}
+		for _, e := range hp.Entities {
+			if e.Entity == "" {
+				return nil, errors.New("entities must be named")
+			}
+		}
+		if hp.NotifyDuration <= 0 || hp.Retry <= 0 {
+			return nil, errors.New("intervals must be positive")
+		}
+		return hp, nil
+	})
+}
+
+func (hp *homeAssistantProducer) websocketURL() (string, error) {
+	u, err := url.Parse(hp.URL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported URL: %s", hp.URL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/websocket"
+	return u.String(), nil
+}
+
+// homeAssistantState is an entity's state object.
+type homeAssistantState struct {
+	EntityID   string         `json:"entity_id"`
+	State      string         `json:"state"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// homeAssistantMessage covers all messages of the WebSocket API
+// that are of interest, see https://developers.home-assistant.io/docs/api/websocket
+type homeAssistantMessage struct {
+	ID      int    `json:"id"`
+	Type    string `json:"type"`
+	Success bool   `json:"success"`
+	Error   struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Result []homeAssistantState `json:"result"`
+	Event  struct {
+		EventType string `json:"event_type"`
+		Data      struct {
+			// Of state_changed.
+			EntityID string              `json:"entity_id"`
+			NewState *homeAssistantState `json:"new_state"`
+			// Of call_service.
+			Domain      string         `json:"domain"`
+			Service     string         `json:"service"`
+			ServiceData map[string]any `json:"service_data"`
+		} `json:"data"`
+	} `json:"event"`
+}
+
+func (hp *homeAssistantProducer) format(states map[string]*homeAssistantState) string {
+	var fields []string
+	for _, e := range hp.Entities {
+		s := states[e.Entity]
+		if s == nil {
+			continue
+		}
+
+		value := s.State
+		if e.Attribute != "" {
+			value = fmt.Sprint(s.Attributes[e.Attribute])
+		}
+		if e.Unit != nil {
+			value += *e.Unit
+		} else if unit, ok := s.Attributes["unit_of_measurement"].(string); ok {
+			value += unit
+		}
+		if e.Label != "" {
+			value = e.Label + " " + value
+		}
+		fields = append(fields, value)
+	}
+	return strings.Join(fields, " ")
+}
+
+func (hp *homeAssistantProducer) notify(data map[string]any) {
+	message, _ := data["message"].(string)
+	if title, _ := data["title"].(string); title != "" {
+		message = title + "\n" + message
+	}
+	if message == "" {
+		return
+	}
+	Takeover(Message{
+		Text:     message,
+		Priority: 1,
+		Duration: hp.NotifyDuration,
+		Line:     -1,
+	})
+}
+
+func (hp *homeAssistantProducer) watch(ctx context.Context,
+	out chan<- string) error {
+	address, _ := hp.websocketURL()
+	wsConfig, err := websocket.NewConfig(address, hp.URL)
+	if err != nil {
+		return err
+	}
+	conn, err := wsConfig.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var m homeAssistantMessage
+	if err := websocket.JSON.Receive(conn, &m); err != nil {
+		return err
+	}
+	if err := websocket.JSON.Send(conn, map[string]any{
+		"type": "auth", "access_token": hp.Token}); err != nil {
+		return err
+	}
+	if err := websocket.JSON.Receive(conn, &m); err != nil {
+		return err
+	}
+	if m.Type != "auth_ok" {
+		return errors.New("authentication failed")
+	}
+
+	const (
+		idStates = iota + 1
+		idStateChanged
+		idCallService
+	)
+	requests := []map[string]any{
+		{"id": idStates, "type": "get_states"},
+		{"id": idStateChanged, "type": "subscribe_events",
+			"event_type": "state_changed"},
+	}
+	if hp.NotifyService != "" {
+		requests = append(requests, map[string]any{"id": idCallService,
+			"type": "subscribe_events", "event_type": "call_service"})
+	}
+	for _, request := range requests {
+		if err := websocket.JSON.Send(conn, request); err != nil {
+			return err
+		}
+	}
+
+	states := make(map[string]*homeAssistantState)
+	for {
+		m = homeAssistantMessage{}
+		if err := websocket.JSON.Receive(conn, &m); err != nil {
+			return err
+		}
+
+		switch {
+		case m.Type == "result" && !m.Success:
+			return fmt.Errorf("request failed: %s", m.Error.Message)
+		case m.Type == "result" && m.ID == idStates:
+			for i := range m.Result {
+				states[m.Result[i].EntityID] = &m.Result[i]
+			}
+		case m.Type == "event" && m.Event.EventType == "state_changed":
+			data := m.Event.Data
+			if data.NewState == nil {
+				delete(states, data.EntityID)
+			} else {
+				states[data.EntityID] = data.NewState
+			}
+		case m.Type == "event" && m.Event.EventType == "call_service":
+			data := m.Event.Data
+			if data.Domain == "notify" && data.Service == hp.NotifyService {
+				hp.notify(data.ServiceData)
+			}
+			continue
+		default:
+			continue
+		}
+		if !send(ctx, out, hp.format(states)) {
+			return nil
+		}
+	}
+}
+
+func (hp *homeAssistantProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := hp.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("Home Assistant failed", "error", err)
+		}
+		sleep(ctx, hp.Retry)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+// The default duration of messages pushed over HTTP.
+const pushDefaultDuration = 10 * time.Second
+
+// pushRequest is the JSON form of a POST /message request.
+// Form-encoded requests use the same field names.
+type pushRequest struct {
+	Text     string `json:"text"`
+	Priority int    `json:"priority"`
+	// Duration is either in seconds, or a Go duration string.
+	Duration json.RawMessage `json:"duration"`
+	Line     *int            `json:"line"`
+	Display  string          `json:"display"`
+	Blink    bool            `json:"blink"`
+}
+
+func (pr *pushRequest) message() (Message, error) {
+	m := Message{
+		Text:     pr.Text,
+		Priority: pr.Priority,
+		Duration: pushDefaultDuration,
+		Line:     -1,
+		Display:  pr.Display,
+		Blink:    pr.Blink,
+	}
+	if pr.Line != nil {
+		m.Line = *pr.Line
+	}
+	if len(pr.Duration) != 0 {
+		var s string
+		if err := json.Unmarshal(pr.Duration, &s); err != nil {
+			s = string(pr.Duration)
+		}
+
+		var err error
+		if m.Duration, err = takeover.ParseDuration(s); err != nil {
+			return m, err
+		}
+	}
+	return m, m.Validate()
+}
+
+func parsePushForm(r *http.Request) (*pushRequest, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	pr := &pushRequest{Text: r.PostFormValue("text"),
+		Display: r.PostFormValue("display")}
+	if v := r.PostFormValue("priority"); v != "" {
+		var err error
+		if pr.Priority, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid priority: %q", v)
+		}
+	}
+	if v := r.PostFormValue("line"); v != "" {
+		line, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line: %q", v)
+		}
+		pr.Line = &line
+	}
+	if v := r.PostFormValue("blink"); v != "" {
+		var err error
+		if pr.Blink, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid blink: %q", v)
+		}
+	}
+	if v := r.PostFormValue("duration"); v != "" {
+		pr.Duration = json.RawMessage(strconv.Quote(v))
+	}
+	return pr, nil
+}
+
+func (cs *controlServer) handlePush(w http.ResponseWriter, r *http.Request) {
+	var (
+		pr  *pushRequest
+		err error
+	)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		pr = &pushRequest{}
+		err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(pr)
+	} else {
+		pr, err = parsePushForm(r)
+	}
+
+	var m Message
+	if err == nil {
+		m, err = pr.message()
+	}
+	if err == nil {
+		_, err = cs.targets(m.Display)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	Takeover(m)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServePush runs an HTTP server on l, until ctx is cancelled,
+// which accepts messages as POST /message requests.
+func (cs *controlServer) ServePush(ctx context.Context, l net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /message", cs.handlePush)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	stop := context.AfterFunc(ctx, func() { server.Close() })
+	defer stop()
+
+	if err := server.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP server failed", "error", err)
+	}
+}
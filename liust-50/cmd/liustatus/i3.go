@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// i3Producer shows i3 or sway workspaces, and the focused window's title,
+// such as "1 [2] 3! Terminal", where the focused workspace is in brackets,
+// and urgent ones are marked by an exclamation mark.
+type i3Producer struct {
+	// Socket defaults to that of the running window manager.
+	Socket     string `toml:"socket"`
+	Workspaces bool   `toml:"workspaces"`
+	Title      bool   `toml:"title"`
+	// Retry is the delay before reconnecting.
+	Retry time.Duration `toml:"retry"`
+}
+
+func init() {
+	registerProducer("i3", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		ip := &i3Producer{
+			Workspaces: true,
+			Title:      true,
+			Retry:      10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, ip); err != nil {
+			return nil, err
+		}
+		if ip.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return ip, nil
+	})
+}
+
+// i3 IPC message and event types, see https://i3wm.org/docs/ipc.html
+const (
+	i3GetWorkspaces = 1
+	i3Subscribe     = 2
+	i3GetTree       = 4
+	i3GetInputs     = 100 // sway only
+
+	i3EventFlag = 1 << 31
+)
+
+const i3Magic = "i3-ipc"
+
+func (ip *i3Producer) socketPath() (string, error) {
+	if ip.Socket != "" {
+		return ip.Socket, nil
+	}
+	for _, name := range []string{"SWAYSOCK", "I3SOCK"} {
+		if path := os.Getenv(name); path != "" {
+			return path, nil
+		}
+	}
+	out, err := exec.Command("i3", "--get-socketpath").Output()
+	if err != nil {
+		return "", errors.New("no window manager socket found")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// i3Conn is an IPC connection. The protocol uses native byte order,
+// which is assumed to be little endian.
+type i3Conn struct {
+	conn net.Conn
+}
+
+func (c *i3Conn) send(kind uint32, payload []byte) error {
+	header := []byte(i3Magic)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(payload)))
+	header = binary.LittleEndian.AppendUint32(header, kind)
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+func (c *i3Conn) receive() (uint32, []byte, error) {
+	header := make([]byte, len(i3Magic)+8)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[:len(i3Magic)]) != i3Magic {
+		return 0, nil, errors.New("not an i3 IPC socket")
+	}
+
+	length := binary.LittleEndian.Uint32(header[len(i3Magic):])
+	kind := binary.LittleEndian.Uint32(header[len(i3Magic)+4:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return 0, nil, err
+	}
+	return kind, payload, nil
+}
+
+func i3Dial(path string) (*i3Conn, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &i3Conn{conn: conn}, nil
+}
+
+// query sends a message, and decodes its reply.
+func (c *i3Conn) query(kind uint32, payload []byte, v any) error {
+	if err := c.send(kind, payload); err != nil {
+		return err
+	}
+	for {
+		replyKind, reply, err := c.receive()
+		if err != nil {
+			return err
+		}
+		// Events may arrive before the reply.
+		if replyKind == kind {
+			return json.Unmarshal(reply, v)
+		}
+	}
+}
+
+// subscribe subscribes to the given kinds of events.
+func (c *i3Conn) subscribe(events ...string) error {
+	payload, _ := json.Marshal(events)
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := c.query(i3Subscribe, payload, &result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return errors.New("subscription failed")
+	}
+	return nil
+}
+
+func (c *i3Conn) Close() error {
+	return c.conn.Close()
+}
+
+type i3Workspace struct {
+	Name    string `json:"name"`
+	Focused bool   `json:"focused"`
+	Urgent  bool   `json:"urgent"`
+}
+
+type i3Node struct {
+	Name          *string  `json:"name"`
+	Type          string   `json:"type"`
+	Focused       bool     `json:"focused"`
+	Nodes         []i3Node `json:"nodes"`
+	FloatingNodes []i3Node `json:"floating_nodes"`
+}
+
+// focusedTitle finds the title of the focused window, if any.
+func (n *i3Node) focusedTitle() (string, bool) {
+	if n.Focused {
+		// Workspaces may get focused, too, when they're empty.
+		if n.Type == "workspace" || n.Name == nil {
+			return "", true
+		}
+		return *n.Name, true
+	}
+	for _, nodes := range [][]i3Node{n.Nodes, n.FloatingNodes} {
+		for i := range nodes {
+			if title, ok := nodes[i].focusedTitle(); ok {
+				return title, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (ip *i3Producer) format(c *i3Conn) (string, error) {
+	var fields []string
+	if ip.Workspaces {
+		var workspaces []i3Workspace
+		if err := c.query(i3GetWorkspaces, nil, &workspaces); err != nil {
+			return "", err
+		}
+		for _, w := range workspaces {
+			name := w.Name
+			if w.Focused {
+				name = "[" + name + "]"
+			}
+			if w.Urgent {
+				name += "!"
+			}
+			fields = append(fields, name)
+		}
+	}
+	if ip.Title {
+		var tree i3Node
+		if err := c.query(i3GetTree, nil, &tree); err != nil {
+			return "", err
+		}
+		if title, _ := tree.focusedTitle(); title != "" {
+			fields = append(fields, title)
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
+
+func (ip *i3Producer) watch(ctx context.Context, out chan<- string) error {
+	path, err := ip.socketPath()
+	if err != nil {
+		return err
+	}
+
+	// Events are received on their own connection,
+	// so that they don't mix with replies to queries.
+	events, err := i3Dial(path)
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	queries, err := i3Dial(path)
+	if err != nil {
+		return err
+	}
+	defer queries.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		events.Close()
+		queries.Close()
+	})
+	defer stop()
+
+	if err := events.subscribe("workspace", "window"); err != nil {
+		return err
+	}
+
+	for {
+		text, err := ip.format(queries)
+		if err != nil {
+			return err
+		}
+		if !send(ctx, out, text) {
+			return nil
+		}
+
+		// The contents of events don't matter, just that something changed.
+		kind, _, err := events.receive()
+		if err != nil {
+			return err
+		}
+		if kind&i3EventFlag == 0 {
+			return fmt.Errorf("unexpected message type: %d", kind)
+		}
+	}
+}
+
+func (ip *i3Producer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := ip.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("i3 failed", "error", err)
+		}
+		sleep(ctx, ip.Retry)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icalEvent is a VEVENT of an iCalendar file, see RFC 5545.
+// Only a subset of recurrence rules is supported: any frequency
+// with INTERVAL, COUNT, and UNTIL, and BYDAY for weekly events.
+type icalEvent struct {
+	uid      string
+	summary  string
+	start    time.Time
+	allDay   bool
+	duration time.Duration
+	rrule    map[string]string
+	exdates  []time.Time
+	// recurrenceID marks an event overriding an occurrence of another.
+	recurrenceID time.Time
+}
+
+// icalProperty is a content line, with its parameters.
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// icalUnfold joins folded content lines.
+func icalUnfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") ||
+			strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func icalParseProperty(line string) icalProperty {
+	// The value is separated by the first colon outside of quotes.
+	quoted, colon := false, len(line)
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+
+	p := icalProperty{params: make(map[string]string)}
+	if colon < len(line) {
+		p.value = line[colon+1:]
+	}
+	fields := strings.Split(line[:colon], ";")
+	p.name = strings.ToUpper(fields[0])
+	for _, field := range fields[1:] {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return p
+}
+
+func icalUnescape(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ",
+		`\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// icalParseTime parses DATE or DATE-TIME values, in the time zone given
+// by the TZID parameter, or in local time for floating ones.
+func icalParseTime(p icalProperty) (t time.Time, allDay bool, err error) {
+	value, _, _ := strings.Cut(p.value, ",")
+	if len(value) == 8 || p.params["VALUE"] == "DATE" {
+		t, err = time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	location := time.Local
+	if tzid := p.params["TZID"]; tzid != "" {
+		// Unknown time zones, such as Windows ones, are taken as local.
+		if l, err := time.LoadLocation(tzid); err == nil {
+			location = l
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
+
+var icalDurationRE = regexp.MustCompile(
+	`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+func icalParseDuration(s string) (time.Duration, error) {
+	m := icalDurationRE.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+
+	var d time.Duration
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour,
+		time.Hour, time.Minute, time.Second}
+	for i, unit := range units {
+		n, _ := strconv.Atoi(m[i+2])
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// icalParse returns all events within an iCalendar stream.
+func icalParse(r io.Reader) ([]*icalEvent, error) {
+	lines, err := icalUnfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*icalEvent
+	var event *icalEvent
+	var end time.Time
+	nested, cancelled := 0, false
+	for _, line := range lines {
+		p := icalParseProperty(line)
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			event, end, cancelled = &icalEvent{}, time.Time{}, false
+			continue
+		case event == nil:
+			continue
+		case p.name == "BEGIN":
+			// Such as VALARM, whose properties must not be mistaken.
+			nested++
+		case p.name == "END" && nested > 0:
+			nested--
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			if !event.start.IsZero() && !cancelled {
+				if !end.IsZero() && event.duration == 0 {
+					event.duration = end.Sub(event.start)
+				}
+				events = append(events, event)
+			}
+			event = nil
+		}
+		if nested > 0 || event == nil {
+			continue
+		}
+
+		switch p.name {
+		case "UID":
+			event.uid = p.value
+		case "SUMMARY":
+			event.summary = icalUnescape(p.value)
+		case "DTSTART":
+			if event.start, event.allDay, err = icalParseTime(p); err != nil {
+				return nil, err
+			}
+		case "DTEND":
+			if end, _, err = icalParseTime(p); err != nil {
+				return nil, err
+			}
+		case "DURATION":
+			if event.duration, err = icalParseDuration(p.value); err != nil {
+				return nil, err
+			}
+		case "RRULE":
+			event.rrule = make(map[string]string)
+			for _, part := range strings.Split(p.value, ";") {
+				key, value, _ := strings.Cut(part, "=")
+				event.rrule[strings.ToUpper(key)] = strings.ToUpper(value)
+			}
+		case "EXDATE":
+			for _, value := range strings.Split(p.value, ",") {
+				p.value = value
+				if t, _, err := icalParseTime(p); err == nil {
+					event.exdates = append(event.exdates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			if event.recurrenceID, _, err = icalParseTime(p); err != nil {
+				return nil, err
+			}
+		case "STATUS":
+			cancelled = strings.EqualFold(p.value, "CANCELLED")
+		}
+	}
+
+	// Overridden occurrences are excluded from their recurring events.
+	for _, e := range events {
+		if e.recurrenceID.IsZero() {
+			continue
+		}
+		for _, master := range events {
+			if master.uid == e.uid && master.rrule != nil {
+				master.exdates = append(master.exdates, e.recurrenceID)
+			}
+		}
+	}
+	return events, nil
+}
+
+var icalWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday,
+	"WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// next returns the start of the first occurrence that hasn't ended by t.
+func (e *icalEvent) next(t time.Time) (time.Time, bool) {
+	if e.rrule == nil {
+		return e.start, !e.start.Add(e.duration).Before(t)
+	}
+
+	interval, _ := strconv.Atoi(e.rrule["INTERVAL"])
+	interval = max(interval, 1)
+	count, _ := strconv.Atoi(e.rrule["COUNT"])
+	var until time.Time
+	if v := e.rrule["UNTIL"]; v != "" {
+		until, _, _ = icalParseTime(icalProperty{value: v})
+	}
+
+	var weekdays []time.Weekday
+	for _, day := range strings.Split(e.rrule["BYDAY"], ",") {
+		if weekday, ok := icalWeekdays[day]; ok {
+			weekdays = append(weekdays, weekday)
+		}
+	}
+
+	// Periods are stepped through using calendar arithmetic,
+	// so that occurrences keep their wall clock time over DST changes.
+	_, m, d := e.start.Date()
+	n := 0
+	for i := 0; i < 100000; i++ {
+		var candidates []time.Time
+		switch e.rrule["FREQ"] {
+		case "DAILY":
+			candidates = append(candidates, e.start.AddDate(0, 0, i*interval))
+		case "WEEKLY":
+			period := e.start.AddDate(0, 0, 7*i*interval)
+			if weekdays == nil {
+				candidates = append(candidates, period)
+				break
+			}
+			// Weeks start on Monday.
+			monday := period.AddDate(0, 0, -(int(period.Weekday())+6)%7)
+			for _, weekday := range weekdays {
+				candidates = append(candidates,
+					monday.AddDate(0, 0, (int(weekday)+6)%7))
+			}
+			slices.SortFunc(candidates, time.Time.Compare)
+		case "MONTHLY":
+			// Months lacking the day are skipped.
+			if c := e.start.AddDate(0, i*interval, 0); c.Day() == d {
+				candidates = append(candidates, c)
+			}
+		case "YEARLY":
+			if c := e.start.AddDate(i*interval, 0, 0); c.Day() == d &&
+				c.Month() == m {
+				candidates = append(candidates, c)
+			}
+		default:
+			return e.start, !e.start.Add(e.duration).Before(t)
+		}
+
+		for _, c := range candidates {
+			if c.Before(e.start) {
+				continue
+			}
+			if count > 0 && n >= count || !until.IsZero() && c.After(until) {
+				return time.Time{}, false
+			}
+			n++
+			if !c.Add(e.duration).Before(t) && !slices.ContainsFunc(
+				e.exdates, func(x time.Time) bool { return x.Equal(c) }) {
+				return c, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// flagState tracks a boolean state of the user session, such as idleness,
+// and lets others wait for changes. Changes are published as events.
+type flagState struct {
+	mu      sync.Mutex
+	value   bool
+	changed chan struct{} // closed on change
+	on, off string        // event names
+}
+
+func newFlagState(on, off string) *flagState {
+	return &flagState{changed: make(chan struct{}), on: on, off: off}
+}
+
+var userIdle = newFlagState("idle", "active")
+
+// Get returns the current value,
+// and a channel that gets closed once that changes.
+func (s *flagState) Get() (bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value, s.changed
+}
+
+func (s *flagState) Set(value bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value == value {
+		return
+	}
+
+	event := s.off
+	if value {
+		event = s.on
+	}
+	slog.Debug("Session state changed", "event", event)
+	s.value = value
+	close(s.changed)
+	s.changed = make(chan struct{})
+	events.Publish(event, nil)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// watchIdleWayland relies on the ext-idle-notify-v1 protocol.
+func watchIdleWayland(ctx context.Context, timeout time.Duration,
+	set func(idle bool)) error {
+	c, err := waylandDial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+	return c.watchIdle(timeout, set)
+}
+
+// watchIdleX11 polls the MIT-SCREEN-SAVER extension. As there is no way
+// of being notified about activity, it polls more often while idle.
+func watchIdleX11(ctx context.Context, timeout time.Duration,
+	set func(idle bool)) error {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return errors.New("neither Wayland nor X11 seem to be available")
+	}
+	c, err := x11Dial(display)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	opcode, _, err := c.queryExtension("MIT-SCREEN-SAVER")
+	if err != nil {
+		return err
+	}
+	for {
+		idleTime, err := c.idleTime(opcode)
+		if err != nil {
+			return err
+		}
+
+		idle, wait := idleTime >= timeout, timeout-idleTime
+		set(idle)
+		if idle {
+			wait = 250 * time.Millisecond
+		}
+		if !sleep(ctx, wait) {
+			return ctx.Err()
+		}
+	}
+}
+
+// watchIdle keeps userIdle updated, retrying after failures.
+func watchIdle(ctx context.Context, timeout time.Duration) {
+	watchInput(ctx, timeout, userIdle.Set)
+}
+
+// watchInput reports whether there has been no user input for the timeout,
+// retrying after failures, until which the user is assumed to be active.
+func watchInput(ctx context.Context, timeout time.Duration,
+	set func(idle bool)) {
+	for ctx.Err() == nil {
+		var err error
+		if waylandAvailable() {
+			err = watchIdleWayland(ctx, timeout, set)
+		} else {
+			err = watchIdleX11(ctx, timeout, set)
+		}
+		set(false)
+		if ctx.Err() == nil {
+			slog.Warn("Idle detection failed", "error", err)
+		}
+		sleep(ctx, time.Minute)
+	}
+}
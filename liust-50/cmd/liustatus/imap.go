@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapProducer shows unread message counts of IMAP mailboxes,
+// such as "Mail 3 Work 1", and briefly takes over the display
+// with the sender and subject of newly arrived messages.
+type imapProducer struct {
+	Accounts []imapAccount `toml:"accounts"`
+	// Interval is the period between checks on servers without IDLE support.
+	Interval time.Duration `toml:"interval"`
+	// Notify enables takeovers about new messages.
+	Notify bool `toml:"notify"`
+	// Retry is the delay before reconnecting.
+	Retry time.Duration `toml:"retry"`
+}
+
+type imapAccount struct {
+	// Label precedes the count, and defaults to "Mail".
+	Label string `toml:"label"`
+	Host  string `toml:"host"`
+	// Port defaults to 993, or to 143 for plain connections.
+	Port int `toml:"port"`
+	// Plain disables TLS, which should only be used locally.
+	Plain    bool   `toml:"plain"`
+	Username string `toml:"username"`
+	// Password may be retrieved from the first line of the output
+	// of PasswordCommand instead, which is interpreted by the shell.
+	Password        string `toml:"password"`
+	PasswordCommand string `toml:"password_command"`
+	// Mailbox defaults to INBOX.
+	Mailbox string `toml:"mailbox"`
+}
+
+func init() {
+	registerProducer("imap", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		ip := &imapProducer{
+			Interval: 5 * time.Minute,
+			Notify:   true,
+			Retry:    time.Minute,
+		}
+		if err := config.DecodeOptions(region, ip); err != nil {
+			return nil, err
+		}
+		if len(ip.Accounts) == 0 {
+			return nil, errors.New("no accounts specified")
+		}
+		for i := range ip.Accounts {
+			a := &ip.Accounts[i]
+			if a.Host == "" || a.Username == "" {
+				return nil, errors.New("accounts need a host and a username")
+			}
+			if a.Label == "" {
+				a.Label = "Mail"
+			}
+			if a.Port == 0 && a.Plain {
+				a.Port = 143
+			} else if a.Port == 0 {
+				a.Port = 993
+			}
+			if a.Mailbox == "" {
+				a.Mailbox = "INBOX"
+			}
+		}
+		if ip.Interval <= 0 || ip.Retry <= 0 {
+			return nil, errors.New("intervals must be positive")
+		}
+		return ip, nil
+	})
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// imapConn is a minimal IMAP4rev1 client connection, see RFC 3501.
+type imapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+	// capabilities are those announced by the server.
+	capabilities map[string]bool
+}
+
+// imapLine is a response line, with any literals taken out of it.
+type imapLine struct {
+	text     string
+	literals [][]byte
+}
+
+// imapTimeout bounds how long the server may take to respond to commands.
+const imapTimeout = time.Minute
+
+var imapLiteralRE = regexp.MustCompile(`\{(\d+)\}$`)
+
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func imapDial(a *imapAccount) (*imapConn, error) {
+	address := net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+	dialer := &net.Dialer{Timeout: imapTimeout}
+
+	var conn net.Conn
+	var err error
+	if a.Plain {
+		conn, err = dialer.Dial("tcp", address)
+	} else {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address,
+			&tls.Config{ServerName: a.Host})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &imapConn{conn: conn, reader: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(imapTimeout))
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP server refused: %s", greeting.text)
+	}
+	return c, nil
+}
+
+// readLine reads a response line, including any literals it contains.
+func (c *imapConn) readLine() (*imapLine, error) {
+	line := &imapLine{}
+	for {
+		s, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		s = strings.TrimRight(s, "\r\n")
+
+		m := imapLiteralRE.FindStringSubmatch(s)
+		if m == nil {
+			line.text += s
+			return line, nil
+		}
+		line.text += s[:len(s)-len(m[0])]
+
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.reader, literal); err != nil {
+			return nil, err
+		}
+		line.literals = append(line.literals, literal)
+	}
+}
+
+// command sends a command, and returns the untagged responses to it.
+func (c *imapConn) command(command string) ([]*imapLine, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+
+	var untagged []*imapLine
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line.text, "* ") {
+			untagged = append(untagged, line)
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line.text, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				return nil, fmt.Errorf("IMAP: %s", rest)
+			}
+			return untagged, nil
+		}
+		// Continuation requests are unexpected here.
+	}
+}
+
+func (c *imapConn) login(a *imapAccount) error {
+	password := a.Password
+	if a.PasswordCommand != "" {
+		out, err := exec.Command("/bin/sh", "-c", a.PasswordCommand).Output()
+		if err != nil {
+			return fmt.Errorf("password command: %w", err)
+		}
+		password, _, _ = strings.Cut(string(out), "\n")
+	}
+
+	untagged, err := c.command("LOGIN " +
+		imapQuote(a.Username) + " " + imapQuote(password))
+	if err != nil {
+		return err
+	}
+	if untagged, err = c.command("CAPABILITY"); err != nil {
+		return err
+	}
+
+	c.capabilities = make(map[string]bool)
+	for _, line := range untagged {
+		if rest, ok := strings.CutPrefix(line.text, "* CAPABILITY "); ok {
+			for _, capability := range strings.Fields(rest) {
+				c.capabilities[strings.ToUpper(capability)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// unseen counts unread messages in the selected mailbox.
+func (c *imapConn) unseen() (int, error) {
+	untagged, err := c.command("SEARCH UNSEEN")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, line := range untagged {
+		if rest, ok := strings.CutPrefix(line.text, "* SEARCH"); ok {
+			count += len(strings.Fields(rest))
+		}
+	}
+	return count, nil
+}
+
+var imapUIDRE = regexp.MustCompile(`\bUID (\d+)`)
+
+// fetchNew returns headers of unread messages with UIDs of at least uid,
+// and the UID that the next new message will have at least.
+func (c *imapConn) fetchNew(uid uint64) ([]mail.Header, uint64, error) {
+	untagged, err := c.command(fmt.Sprintf(
+		"UID FETCH %d:* (UID FLAGS BODY.PEEK[HEADER.FIELDS (FROM SUBJECT)])",
+		uid))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var headers []mail.Header
+	next := uid
+	for _, line := range untagged {
+		m := imapUIDRE.FindStringSubmatch(line.text)
+		if m == nil || len(line.literals) == 0 {
+			continue
+		}
+		// The range always includes the last message, even if it is older.
+		n, _ := strconv.ParseUint(m[1], 10, 64)
+		if n < uid {
+			continue
+		}
+		next = max(next, n+1)
+		if strings.Contains(line.text, `\Seen`) {
+			continue
+		}
+
+		msg, err := mail.ReadMessage(strings.NewReader(
+			string(line.literals[0]) + "\r\n"))
+		if err == nil {
+			headers = append(headers, msg.Header)
+		}
+	}
+	return headers, next, nil
+}
+
+// idle waits for the selected mailbox to change, see RFC 2177.
+func (c *imapConn) idle(ctx context.Context) error {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s IDLE\r\n", tag); err != nil {
+		return err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line.text, "+") {
+		return fmt.Errorf("IMAP: %s", line.text)
+	}
+
+	// Servers may drop clients that stay idle for 30 minutes.
+	c.conn.SetDeadline(time.Now().Add(25 * time.Minute))
+	stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+	defer stop()
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				return err
+			}
+			break
+		}
+		if strings.HasSuffix(line.text, " EXISTS") ||
+			strings.HasSuffix(line.text, " EXPUNGE") ||
+			strings.Contains(line.text, " FETCH ") {
+			break
+		}
+	}
+
+	c.conn.SetDeadline(time.Now().Add(imapTimeout))
+	if _, err := io.WriteString(c.conn, "DONE\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if rest, ok := strings.CutPrefix(line.text, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				return fmt.Errorf("IMAP: %s", rest)
+			}
+			return nil
+		}
+	}
+}
+
+func (c *imapConn) Close() error {
+	return c.conn.Close()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// imapCount is an update of an account's unread message count,
+// negative when unknown.
+type imapCount struct {
+	account int
+	count   int
+}
+
+var imapUIDNextRE = regexp.MustCompile(`\[UIDNEXT (\d+)\]`)
+
+func (ip *imapProducer) notify(header mail.Header) {
+	decoder := &mime.WordDecoder{}
+	from := header.Get("From")
+	if address, err := mail.ParseAddress(from); err == nil {
+		from = address.Address
+		if address.Name != "" {
+			from = address.Name
+		}
+	} else if decoded, err := decoder.DecodeHeader(from); err == nil {
+		from = decoded
+	}
+	subject, err := decoder.DecodeHeader(header.Get("Subject"))
+	if err != nil {
+		subject = header.Get("Subject")
+	}
+
+	Takeover(Message{
+		Text:     from + "\n" + subject,
+		Duration: 10 * time.Second,
+		Line:     -1,
+	})
+}
+
+// watch keeps reporting the unread count of an account until it fails.
+func (ip *imapProducer) watch(ctx context.Context, a *imapAccount,
+	report func(count int) bool) error {
+	c, err := imapDial(a)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	if err := c.login(a); err != nil {
+		return err
+	}
+	untagged, err := c.command("EXAMINE " + imapQuote(a.Mailbox))
+	if err != nil {
+		return err
+	}
+
+	// Only messages arriving while running are announced.
+	var uidNext uint64
+	for _, line := range untagged {
+		if m := imapUIDNextRE.FindStringSubmatch(line.text); m != nil {
+			uidNext, _ = strconv.ParseUint(m[1], 10, 64)
+		}
+	}
+
+	for {
+		count, err := c.unseen()
+		if err != nil {
+			return err
+		}
+		if !report(count) {
+			return nil
+		}
+
+		if ip.Notify && uidNext != 0 {
+			var headers []mail.Header
+			headers, uidNext, err = c.fetchNew(uidNext)
+			if err != nil {
+				return err
+			}
+			for _, header := range headers {
+				ip.notify(header)
+			}
+		}
+
+		if c.capabilities["IDLE"] {
+			if err := c.idle(ctx); err != nil {
+				return err
+			}
+		} else if !sleep(ctx, ip.Interval) {
+			return nil
+		} else if _, err := c.command("NOOP"); err != nil {
+			return err
+		}
+	}
+}
+
+func (ip *imapProducer) Run(ctx context.Context, out chan<- string) {
+	counts := make(chan imapCount)
+	for i := range ip.Accounts {
+		a := &ip.Accounts[i]
+		report := func(count int) bool {
+			select {
+			case counts <- imapCount{account: i, count: count}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		go func() {
+			for ctx.Err() == nil {
+				if err := ip.watch(ctx, a, report); err != nil &&
+					ctx.Err() == nil {
+					slog.Warn("IMAP failed", "host", a.Host, "error", err)
+					report(-1)
+				}
+				sleep(ctx, ip.Retry)
+			}
+		}()
+	}
+
+	current := make([]int, len(ip.Accounts))
+	for i := range current {
+		current[i] = -1
+	}
+	for {
+		var fields []string
+		for i, count := range current {
+			if count < 0 {
+				fields = append(fields, ip.Accounts[i].Label+" ?")
+			} else {
+				fields = append(fields,
+					fmt.Sprintf("%s %d", ip.Accounts[i].Label, count))
+			}
+		}
+		if !send(ctx, out, strings.Join(fields, " ")) {
+			return
+		}
+
+		select {
+		case update := <-counts:
+			current[update.account] = update.count
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,242 +1,1351 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"math/rand"
+	"os"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
-)
 
-type kaomojiKind int
-
-const (
-	kaomojiKindAwake kaomojiKind = iota
-	kaomojiKindBlink
-	kaomojiKindFace
-	kaomojiKindChase
-	kaomojiKindHappy
-	kaomojiKindSleep
-	kaomojiKindSnore
-	kaomojiKindPeek
+	"janouch.name/desktop-tools/liust-50/weather"
 )
 
+// kaomojiMessageColumn is where messages start, to the right of faces.
+const kaomojiMessageColumn = 14
+
 type kaomojiState struct {
-	kind    kaomojiKind
-	face    string
-	message string
-	delay   int
+	name      string
+	animation string
+	face      string
+	message   string
+	delay     time.Duration
+}
+
+// faceX returns where the face starts, when centred.
+func (ks *kaomojiState) faceX() int {
+	return max((displayWidth-len([]rune(ks.face))+1)/2, 0)
 }
 
 func (ks *kaomojiState) Format() string {
 	line := []rune(strings.Repeat(" ", displayWidth))
-
-	face := []rune(ks.face)
-	if x := (len(line) - len(face) + 1) / 2; x < 0 {
-		copy(line, face)
-	} else {
-		copy(line[x:], face)
-	}
+	copy(line[ks.faceX():], []rune(ks.face))
 
 	if ks.message != "" {
-		copy(line[14:], []rune(ks.message))
+		copy(line[kaomojiMessageColumn:], []rune(ks.message))
 	}
 	return string(line)
 }
 
 func (ks *kaomojiState) Duration() time.Duration {
-	return time.Millisecond * time.Duration(ks.delay)
+	return ks.delay
+}
+
+// frames returns the lines to show in the state, possibly animated.
+func (ks *kaomojiState) frames() []string {
+	if animate, ok := kaomojiAnimations[ks.animation]; ok {
+		return animate(*ks)
+	}
+	return []string{ks.Format()}
+}
+
+// kaomojiDumpFrame writes a line as shown, along with how long it is shown.
+func kaomojiDumpFrame(w io.Writer, delay time.Duration, line string) error {
+	_, err := fmt.Fprintf(w, "%s\t%q\n", delay, line)
+	return err
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 
-func kaomojiNewAwake() kaomojiState {
-	return kaomojiState{
-		kind:    kaomojiKindAwake,
-		face:    "(o_o)",
-		message: "",
-		delay:   2_000 + rand.Intn(4_000),
+// kaomojiFace is one of the ways that the kaomoji may look in a state.
+type kaomojiFace struct {
+	Face string `toml:"face"`
+	// Message goes to the right of the face, and is best kept to katakana.
+	Message string `toml:"message"`
+	// Delay is how long the face is shown, or a frame of an animation lasts,
+	// and Jitter extends it at random.
+	Delay  time.Duration `toml:"delay"`
+	Jitter time.Duration `toml:"jitter"`
+	// Weight is how likely the face is picked, relative to others,
+	// and defaults to 1.
+	Weight float64 `toml:"weight"`
+}
+
+// kaomojiTransition leads to another state.
+type kaomojiTransition struct {
+	State string `toml:"state"`
+	// Weight is how likely the transition is taken, relative to others,
+	// and defaults to 1.
+	Weight float64 `toml:"weight"`
+	// When limits the transition to when the user is "active", or "idle",
+	// "typing", or to when the kaomoji has been "petted" recently,
+	// when "music" is playing, or the machine is "busy", or "hot",
+	// or to weather with "rain", or "freezing" temperatures,
+	// or to holidays: "christmas", "newyear", "halloween", or a "birthday".
+	// In Tamagotchi mode, it may also be "hungry", "sad", or "content".
+	When string `toml:"when"`
+}
+
+func (kt *kaomojiTransition) weight() float64 {
+	if kt.Weight == 0 {
+		return 1
 	}
+	return kt.Weight
 }
 
-func kaomojiNewBlink() kaomojiState {
-	return kaomojiState{
-		kind:    kaomojiKindBlink,
-		face:    "(-_-)",
-		message: "",
-		delay:   100 + rand.Intn(50),
+// kaomojiCircumstances are what transitions may depend on.
+type kaomojiCircumstances struct {
+	idle, petted, typing, music bool
+	busy, hot                   bool
+	rain, freezing              bool
+	// occasion is one of kaomojiHolidays, or "birthday", if any.
+	occasion string
+	// stats are only set in Tamagotchi mode.
+	stats *tamagotchiStats
+}
+
+// kaomojiConditions implement the supported values of kaomojiTransition.When.
+var kaomojiConditions = map[string]func(c *kaomojiCircumstances) bool{
+	"":         func(c *kaomojiCircumstances) bool { return true },
+	"active":   func(c *kaomojiCircumstances) bool { return !c.idle },
+	"idle":     func(c *kaomojiCircumstances) bool { return c.idle },
+	"petted":   func(c *kaomojiCircumstances) bool { return c.petted },
+	"typing":   func(c *kaomojiCircumstances) bool { return c.typing },
+	"music":    func(c *kaomojiCircumstances) bool { return c.music },
+	"busy":     func(c *kaomojiCircumstances) bool { return c.busy },
+	"hot":      func(c *kaomojiCircumstances) bool { return c.hot },
+	"rain":     func(c *kaomojiCircumstances) bool { return c.rain },
+	"freezing": func(c *kaomojiCircumstances) bool { return c.freezing },
+	"christmas": func(c *kaomojiCircumstances) bool {
+		return c.occasion == "christmas"
+	},
+	"newyear": func(c *kaomojiCircumstances) bool {
+		return c.occasion == "newyear"
+	},
+	"halloween": func(c *kaomojiCircumstances) bool {
+		return c.occasion == "halloween"
+	},
+	"birthday": func(c *kaomojiCircumstances) bool {
+		return c.occasion == "birthday"
+	},
+	"hungry": func(c *kaomojiCircumstances) bool {
+		return c.stats != nil && c.stats.Hunger >= tamagotchiHungry
+	},
+	"sad": func(c *kaomojiCircumstances) bool {
+		return c.stats != nil && c.stats.Mood <= tamagotchiSad
+	},
+	"content": func(c *kaomojiCircumstances) bool {
+		return c.stats != nil && c.stats.Mood >= tamagotchiContent
+	},
+}
+
+// kaomojiStateConfig describes a state of the kaomoji. States without
+// any transitions that may be taken keep repeating themselves.
+type kaomojiStateConfig struct {
+	Faces []kaomojiFace `toml:"faces"`
+	// Animation is either empty, or one of kaomojiAnimations.
+	Animation string              `toml:"animation"`
+	Next      []kaomojiTransition `toml:"next"`
+}
+
+// kaomojiStates are the built-in states, leading from one to another.
+var kaomojiStates = map[string]kaomojiStateConfig{
+	"awake": {
+		Faces: []kaomojiFace{
+			{Face: "(o_o)", Delay: 2 * time.Second, Jitter: 4 * time.Second},
+		},
+		Next: []kaomojiTransition{
+			{State: "face", Weight: 0.025},
+			{State: "chase", Weight: 0.025},
+			{State: "happy", Weight: 0.025},
+			{State: "sleep", Weight: 0.025},
+			{State: "wave", Weight: 0.01},
+			{State: "roam", Weight: 0.01},
+			{State: "cat", Weight: 0.01},
+			{State: "dance", Weight: 0.1, When: "music"},
+			// It feels the machine's stress.
+			{State: "exhausted", Weight: 0.1, When: "busy"},
+			{State: "sweat", Weight: 0.1, When: "hot"},
+			// And it dresses up for the weather.
+			{State: "umbrella", Weight: 0.05, When: "rain"},
+			{State: "shiver", Weight: 0.05, When: "freezing"},
+			// Special days are to be celebrated.
+			{State: "christmas", Weight: 0.1, When: "christmas"},
+			{State: "newyear", Weight: 0.1, When: "newyear"},
+			{State: "halloween", Weight: 0.1, When: "halloween"},
+			{State: "birthday", Weight: 0.1, When: "birthday"},
+			{State: "blink", Weight: 0.9},
+			// Being petted makes it happier for a while.
+			{State: "happy", Weight: 0.05, When: "petted"},
+			{State: "love", Weight: 0.05, When: "petted"},
+			// A virtual pet lets its needs be known.
+			{State: "hungry", Weight: 0.05, When: "hungry"},
+			{State: "sulk", Weight: 0.05, When: "sad"},
+			{State: "happy", Weight: 0.025, When: "content"},
+		},
+	},
+	"blink": {
+		Faces: []kaomojiFace{
+			{Face: "(-_-)", Delay: 100 * time.Millisecond,
+				Jitter: 50 * time.Millisecond},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"face": {
+		Faces: []kaomojiFace{
+			{Face: "(x_x)", Message: "ｽﾞｷｽﾞｷ", Delay: 10 * time.Second},
+			{Face: "(T_T)", Message: "ｽﾞｰﾝ", Delay: 10 * time.Second},
+			{Face: "=^.^=", Message: "ﾆｬｰ", Delay: 10 * time.Second},
+			{Face: "(>_<)", Message: "ｹﾞｯﾌﾟ", Delay: 10 * time.Second},
+			{Face: "(O_O)", Message: "ｼﾞｰ", Delay: 10 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"chase": {
+		Faces: []kaomojiFace{
+			{Face: "(ﾟﾛﾟ)", Delay: 125 * time.Millisecond},
+			{Face: "(ﾟ∩ﾟ)", Delay: 125 * time.Millisecond},
+		},
+		Animation: "chase",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"happy": {
+		Faces: []kaomojiFace{
+			{Face: "(^_^)", Delay: 500 * time.Millisecond},
+		},
+		Animation: "bounce",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"wave": {
+		Faces: []kaomojiFace{
+			{Face: "(^_^)", Delay: 300 * time.Millisecond},
+		},
+		Animation: "wave",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"roam": {
+		Faces: []kaomojiFace{
+			{Face: "(o_o)", Delay: 150 * time.Millisecond},
+		},
+		Animation: "across",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"cat": {
+		Faces: []kaomojiFace{
+			{Face: "(o_o)", Delay: 200 * time.Millisecond},
+		},
+		Animation: "cat",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"love": {
+		Faces: []kaomojiFace{
+			{Face: "(^_^)", Delay: 400 * time.Millisecond},
+		},
+		Animation: "heart",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"typing": {
+		Faces: []kaomojiFace{
+			{Face: "(o_o)", Message: "ｶﾀｶﾀ", Delay: 150 * time.Millisecond},
+		},
+		Animation: "typing",
+		Next: []kaomojiTransition{
+			{State: "typing", Weight: 9, When: "typing"},
+			{State: "awake"},
+		},
+	},
+	"speak": {
+		Faces: []kaomojiFace{
+			{Face: "(o_o)", Delay: 150 * time.Millisecond},
+		},
+		Animation: "speech",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"dance": {
+		Faces: []kaomojiFace{
+			{Face: "(^o^)", Delay: 500 * time.Millisecond},
+			{Face: "(^_^)", Delay: 500 * time.Millisecond},
+		},
+		Animation: "dance",
+		Next: []kaomojiTransition{
+			{State: "dance", Weight: 9, When: "music"},
+			{State: "awake"},
+		},
+	},
+	"exhausted": {
+		Faces: []kaomojiFace{
+			{Face: "(x_x)", Message: "ﾍﾄﾍﾄ", Delay: 5 * time.Second},
+			{Face: "(@_@)", Message: "ﾌﾗﾌﾗ", Delay: 5 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"sweat": {
+		Faces: []kaomojiFace{
+			{Face: "(^_^;)", Message: "ｱｾｱｾ", Delay: 5 * time.Second},
+			{Face: "(-_-;)", Message: "ｱﾂｲ", Delay: 5 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"umbrella": {
+		Faces: []kaomojiFace{
+			{Face: "(o_o)Γ", Message: "ｻﾞｰｻﾞｰ", Delay: 5 * time.Second},
+			{Face: "(-_-)Γ", Message: "ﾎﾟﾂﾎﾟﾂ", Delay: 5 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"shiver": {
+		Faces: []kaomojiFace{
+			{Face: "(>_<)", Message: "ｻﾑｲ", Delay: 100 * time.Millisecond},
+		},
+		Animation: "shiver",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"christmas": {
+		Faces: []kaomojiFace{
+			{Face: "★(^_^)", Message: "ﾒﾘｸﾘ", Delay: 5 * time.Second},
+			{Face: "(^o^)★", Message: "ﾎｰﾎｰ", Delay: 5 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"newyear": {
+		Faces: []kaomojiFace{
+			{Face: "(^o^)", Message: "ｱｹｵﾒ", Delay: 500 * time.Millisecond},
+			{Face: "(^_^)", Message: "ｺﾄﾖﾛ", Delay: 500 * time.Millisecond},
+		},
+		Animation: "bounce",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"halloween": {
+		Faces: []kaomojiFace{
+			{Face: "(O_O)", Message: "ｵﾊﾞｹ", Delay: 5 * time.Second},
+			{Face: "(ﾟｰﾟ)", Message: "ﾄﾘｯｸ", Delay: 5 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"birthday": {
+		Faces: []kaomojiFace{
+			{Face: "(^o^)", Message: "ｵﾒﾃﾞﾄ", Delay: 500 * time.Millisecond},
+		},
+		Animation: "bounce",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"petted": {
+		Faces: []kaomojiFace{
+			{Face: "(^_^)", Message: "ｽﾘｽﾘ", Delay: 500 * time.Millisecond},
+		},
+		Animation: "bounce",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"fed": {
+		Faces: []kaomojiFace{
+			{Face: "(^q^)", Message: "ﾓｸﾞﾓｸﾞ", Delay: 500 * time.Millisecond},
+		},
+		Animation: "bounce",
+		Next:      []kaomojiTransition{{State: "awake"}},
+	},
+	"hungry": {
+		Faces: []kaomojiFace{
+			{Face: "(>_<)", Message: "ﾊﾗﾍｯﾀ", Delay: 5 * time.Second},
+			{Face: "(._.)", Message: "ｸﾞｰ", Delay: 5 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"sulk": {
+		Faces: []kaomojiFace{
+			{Face: "(T_T)", Message: "ｼｮﾎﾞﾝ", Delay: 5 * time.Second},
+			{Face: "(-.-)", Message: "ﾌﾝ", Delay: 5 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "awake"}},
+	},
+	"sleep": {
+		Faces: []kaomojiFace{
+			{Face: "(-_-)", Delay: 10 * time.Second},
+		},
+		Next: []kaomojiTransition{
+			{State: "awake", Weight: 0.1, When: "active"},
+			{State: "peek", Weight: 0.1},
+			{State: "catnap", Weight: 0.02},
+			{State: "snore", Weight: 0.4},
+			{State: "sleep", Weight: 0.4},
+		},
+	},
+	"snore": {
+		Faces: []kaomojiFace{
+			{Face: "(-_-)", Message: "ｸﾞｰｸﾞｰ", Delay: 10 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "sleep"}},
+	},
+	"catnap": {
+		Faces: []kaomojiFace{
+			{Face: "(-_-)", Delay: 300 * time.Millisecond},
+		},
+		Animation: "catnap",
+		Next:      []kaomojiTransition{{State: "sleep"}},
+	},
+	"peek": {
+		Faces: []kaomojiFace{
+			{Face: "(o_-)", Delay: 3 * time.Second},
+			{Face: "(-_o)", Delay: 3 * time.Second},
+		},
+		Next: []kaomojiTransition{{State: "sleep"}},
+	},
+}
+
+func (kf *kaomojiFace) weight() float64 {
+	if kf.Weight == 0 {
+		return 1
 	}
+	return kf.Weight
 }
 
-func kaomojiNewFace() kaomojiState {
-	faces := []struct {
-		face, message string
-	}{
-		{"(x_x)", "ｽﾞｷｽﾞｷ"},
-		{"(T_T)", "ｽﾞｰﾝ"},
-		{"=^.^=", "ﾆｬｰ"},
-		{"(>_<)", "ｹﾞｯﾌﾟ"},
-		{"(O_O)", "ｼﾞｰ"},
+// kaomojiPick picks one of the faces at random, by their weights.
+func kaomojiPick(rng *rand.Rand, faces []kaomojiFace) *kaomojiFace {
+	total := 0.
+	for i := range faces {
+		total += faces[i].weight()
+	}
+	f := rng.Float64() * total
+	for i := range faces {
+		if f -= faces[i].weight(); f < 0 {
+			return &faces[i]
+		}
 	}
+	return &faces[len(faces)-1]
+}
 
-	x := faces[rand.Intn(len(faces))]
+// enter enters a state, in one of its faces.
+func (kp *kaomojiProducer) enter(name string) kaomojiState {
+	config := kp.states[name]
+	face := kaomojiPick(kp.rand, config.Faces)
+	delay := face.Delay
+	if face.Jitter > 0 {
+		delay += time.Duration(kp.rand.Int63n(int64(face.Jitter)))
+	}
 	return kaomojiState{
-		kind:    kaomojiKindFace,
-		face:    x.face,
-		message: x.message,
-		delay:   10_000,
+		name:      name,
+		animation: config.Animation,
+		face:      face.Face,
+		message:   face.Message,
+		delay:     delay,
 	}
 }
 
-func kaomojiNewChase() kaomojiState {
-	faces := []string{"(ﾟﾛﾟ)", "(ﾟ∩ﾟ)"}
-	return kaomojiState{
-		kind:    kaomojiKindChase,
-		face:    faces[rand.Intn(len(faces))],
-		message: "",
-		delay:   125,
+// next picks the state to follow the given one, at random, by weights.
+func (kp *kaomojiProducer) next(name string, c *kaomojiCircumstances) string {
+	var candidates []*kaomojiTransition
+	total := 0.
+	for i, transition := range kp.states[name].Next {
+		if !kaomojiConditions[transition.When](c) {
+			continue
+		}
+		candidates = append(candidates, &kp.states[name].Next[i])
+		total += transition.weight()
 	}
+
+	f := kp.rand.Float64() * total
+	for _, transition := range candidates {
+		if f -= transition.weight(); f < 0 {
+			return transition.State
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[len(candidates)-1].State
+	}
+	return name
 }
 
-func kaomojiNewHappy() kaomojiState {
-	return kaomojiState{
-		kind:    kaomojiKindHappy,
-		face:    "(^_^)",
-		message: "",
-		delay:   500,
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// kaomojiAnimations generate the frames of animations from a state,
+// each of which is shown for the state's delay.
+var kaomojiAnimations = map[string]func(state kaomojiState) []string{
+	"bounce": kaomojiAnimateBounce,
+	"chase":  kaomojiAnimateChase,
+	"across": kaomojiAnimateAcross,
+	"wave":   kaomojiAnimateWave,
+	"heart":  kaomojiAnimateHeart,
+	"typing": kaomojiAnimateTyping,
+	"speech": kaomojiAnimateSpeech,
+	"dance":  kaomojiAnimateDance,
+	"shiver": kaomojiAnimateShiver,
+	"cat":    kaomojiAnimateCat,
+	"catnap": kaomojiAnimateCatnap,
+}
+
+// kaomojiAnimateBounce makes the face jump around a bit.
+func kaomojiAnimateBounce(state kaomojiState) (lines []string) {
+	face := state.face
+	for _, state.face = range []string{
+		face, "  " + face, face, face + "  ", face} {
+		lines = append(lines, state.Format())
 	}
+	return
 }
 
-func kaomojiNewSleep() kaomojiState {
-	return kaomojiState{
-		kind:    kaomojiKindSleep,
-		face:    "(-_-)",
-		message: "",
-		delay:   10_000,
+// kaomojiAnimateAcross makes the face bounce off both ends of the line,
+// and return to the centre.
+func kaomojiAnimateAcross(state kaomojiState) (lines []string) {
+	var (
+		face   = []rune(state.face)
+		centre = state.faceX()
+		right  = max(displayWidth-len(face), 0)
+	)
+	frame := func(x int) {
+		line := []rune(strings.Repeat(" ", max(displayWidth, x+len(face))))
+		copy(line[x:], face)
+		lines = append(lines, string(line[:displayWidth]))
+	}
+	for x := centre; x < right; x++ {
+		frame(x)
+	}
+	for x := right; x > 0; x-- {
+		frame(x)
+	}
+	for x := 0; x <= centre; x++ {
+		frame(x)
 	}
+	return
 }
 
-func kaomojiNewSnore() kaomojiState {
-	return kaomojiState{
-		kind:    kaomojiKindSnore,
-		face:    "(-_-)",
-		message: "ｸﾞｰｸﾞｰ",
-		delay:   10_000,
+// kaomojiAnimateWave makes the face wave its hand, next to it.
+func kaomojiAnimateWave(state kaomojiState) (lines []string) {
+	x := state.faceX() + len([]rune(state.face))
+	for i := 0; i < 6; i++ {
+		line := []rune(state.Format())
+		if x < len(line) {
+			line[x] = []rune("ﾉ/")[i%2]
+		}
+		lines = append(lines, string(line))
 	}
+	return append(lines, state.Format())
 }
 
-func kaomojiNewPeek() kaomojiState {
-	faces := []string{"(o_-)", "(-_o)"}
-	return kaomojiState{
-		kind:    kaomojiKindPeek,
-		face:    faces[rand.Intn(len(faces))],
-		message: "",
-		delay:   3_000,
+// kaomojiAnimateHeart makes a heart appear next to the face,
+// and float away, in place of the message.
+func kaomojiAnimateHeart(state kaomojiState) (lines []string) {
+	state.message = ""
+	start := state.faceX() + len([]rune(state.face)) + 1
+	frame := func(x int, heart string) {
+		line := []rune(state.Format() + "  ")
+		copy(line[x:], []rune(heart))
+		lines = append(lines, string(line[:displayWidth]))
+	}
+	for _, heart := range []string{"･", "o", "<3", "<3"} {
+		frame(start, heart)
 	}
+	for x := start + 1; x+2 <= displayWidth; x++ {
+		frame(x, "<3")
+	}
+	return append(lines, state.Format())
 }
 
-// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// kaomojiAnimateTyping makes the face type out its message.
+func kaomojiAnimateTyping(state kaomojiState) (lines []string) {
+	message := []rune(state.message)
+	for i := range len(message) + 1 {
+		state.message = string(message[:i])
+		lines = append(lines, state.Format())
+	}
+	return
+}
 
-func kaomojiAnimateChase(state kaomojiState) (lines []string) {
+// kaomojiAnimateSpeech makes the face type out its message, scrolling it
+// through the space there is, and then keep it there for a while.
+func kaomojiAnimateSpeech(state kaomojiState) (lines []string) {
+	var (
+		message = []rune(state.message)
+		width   = max(displayWidth-kaomojiMessageColumn, 1)
+	)
+	for i := range len(message) + 1 {
+		state.message = string(message[max(i-width, 0):i])
+		lines = append(lines, state.Format())
+	}
+	for range 20 {
+		lines = append(lines, state.Format())
+	}
+	return
+}
+
+// kaomojiAnimateDance makes the face sway from side to side,
+// raising either hand, a frame per beat while music is playing.
+func kaomojiAnimateDance(state kaomojiState) (lines []string) {
+	face := state.face
+	for i := range 8 {
+		if i%2 == 0 {
+			state.face = "ﾍ" + face + " "
+		} else {
+			state.face = " " + face + "ﾉ"
+		}
+		lines = append(lines, state.Format())
+	}
+	return
+}
+
+// kaomojiAnimateShiver makes the face shake from the cold.
+func kaomojiAnimateShiver(state kaomojiState) (lines []string) {
+	face := state.face
+	for i := range 20 {
+		if i%2 == 0 {
+			state.face = face + " "
+		} else {
+			state.face = " " + face
+		}
+		lines = append(lines, state.Format())
+	}
+	state.face = face
+	return append(lines, state.Format())
+}
+
+// kaomojiActor is a character in an animation, placed at a column,
+// which may be past either end of the line.
+type kaomojiActor struct {
+	face string
+	x    int
+}
+
+func (ka *kaomojiActor) width() int {
+	return len([]rune(ka.face))
+}
+
+// kaomojiStage renders actors onto a line, the latter ones on top,
+// cutting off whatever doesn't fit.
+func kaomojiStage(actors ...*kaomojiActor) string {
+	line := []rune(strings.Repeat(" ", displayWidth))
+	for _, actor := range actors {
+		for i, r := range []rune(actor.face) {
+			if x := actor.x + i; x >= 0 && x < displayWidth {
+				line[x] = r
+			}
+		}
+	}
+	return string(line)
+}
+
+// kaomojiScene scripts animations of several actors, frame by frame.
+type kaomojiScene struct {
+	actors []*kaomojiActor
+	lines  []string
+}
+
+// shoot adds frames of the actors as they are.
+func (ks *kaomojiScene) shoot(frames int) {
+	for range frames {
+		ks.lines = append(ks.lines, kaomojiStage(ks.actors...))
+	}
+}
+
+// walk moves an actor to the given column, a frame per step.
+func (ks *kaomojiScene) walk(actor *kaomojiActor, x int) {
+	for actor.x != x {
+		if actor.x < x {
+			actor.x++
+		} else {
+			actor.x--
+		}
+		ks.shoot(1)
+	}
+}
+
+// act changes the faces of the actors, and holds them for some frames.
+func (ks *kaomojiScene) act(frames int, faces ...string) {
+	for i, face := range faces {
+		ks.actors[i].face = face
+	}
+	ks.shoot(frames)
+}
+
+func kaomojiAnimateChase(state kaomojiState) []string {
 	// The main character is fixed and of fixed width.
 	var (
-		normal    = []rune("(o_o)")
-		alert     = []rune("(O_O)")
-		centre    = (displayWidth - 4) / 2
-		chaserLen = len([]rune(state.face))
+		centre = (displayWidth - 4) / 2
+		chased = &kaomojiActor{face: "(o_o)", x: centre}
+		chaser = &kaomojiActor{face: state.face, x: displayWidth}
+		scene  = kaomojiScene{actors: []*kaomojiActor{chased, chaser}}
 	)
 
 	// For simplicity, let the animation run off-screen.
-	for chaserX := chaserLen + displayWidth; chaserX >= 0; chaserX-- {
-		line := []rune(strings.Repeat(" ", chaserLen+displayWidth))
+	for ; chaser.x >= -chaser.width(); chaser.x-- {
+		if chased.x > chaser.x-7 {
+			chased.face, chased.x = "(O_O)", chaser.x-7
+		}
+		scene.shoot(1)
+	}
+
+	// Return our main character back.
+	chased.face, chased.x = "(o_o)", displayWidth
+	scene.shoot(1)
+	scene.walk(chased, centre)
+	return scene.lines
+}
+
+// kaomojiCat is the main character's companion.
+const kaomojiCat = "=^.^="
+
+// kaomojiAnimateCat makes a cat wander in from the right,
+// and make friends with the face, before leaving again.
+func kaomojiAnimateCat(state kaomojiState) []string {
+	var (
+		face  = &kaomojiActor{face: state.face, x: state.faceX()}
+		cat   = &kaomojiActor{face: kaomojiCat, x: displayWidth}
+		scene = kaomojiScene{actors: []*kaomojiActor{face, cat}}
+	)
+	scene.walk(cat, face.x+face.width()+1)
+	scene.act(3, state.face, kaomojiCat)
+	scene.act(3, "(^_^)", kaomojiCat)
+	scene.act(6, "(^_^)", "=^_^=")
+	scene.act(3, state.face, kaomojiCat)
+	scene.walk(cat, displayWidth)
+	return scene.lines
+}
+
+// kaomojiAnimateCatnap makes a cat come in from the left,
+// and take a nap next to the face, before leaving again.
+func kaomojiAnimateCatnap(state kaomojiState) []string {
+	var (
+		face  = &kaomojiActor{face: state.face, x: state.faceX()}
+		cat   = &kaomojiActor{face: kaomojiCat, x: -len([]rune(kaomojiCat))}
+		scene = kaomojiScene{actors: []*kaomojiActor{face, cat}}
+	)
+	scene.walk(cat, face.x-cat.width()-1)
+	scene.act(3, state.face, kaomojiCat)
+	scene.act(20, state.face, "=-.-=")
+	scene.act(3, state.face, kaomojiCat)
+	scene.walk(cat, -cat.width())
+	return scene.lines
+}
+
+// kaomojiDisabled makes kaomoji give up their regions, such as on request.
+var kaomojiDisabled = newFlagState("kaomoji-disabled", "kaomoji-enabled")
 
-		chased, chasedX := normal, chaserLen+centre
-		if chasedX > chaserX-7 {
-			chased, chasedX = alert, chaserX-7
+// kaomojiPause can freeze all kaomoji in place, such as on request.
+type kaomojiPause struct {
+	mu      sync.Mutex
+	resumed chan struct{} // nil unless paused
+}
+
+var kaomojiPaused kaomojiPause
+
+func (kp *kaomojiPause) Set(paused bool) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if paused && kp.resumed == nil {
+		kp.resumed = make(chan struct{})
+	} else if !paused && kp.resumed != nil {
+		close(kp.resumed)
+		kp.resumed = nil
+	}
+}
+
+// Wait blocks for as long as kaomoji are paused.
+func (kp *kaomojiPause) Wait(ctx context.Context) bool {
+	kp.mu.Lock()
+	resumed := kp.resumed
+	kp.mu.Unlock()
+	if resumed == nil {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// kaomojiSignal lets kaomoji know that the user has done something to them,
+// such as petting them.
+type kaomojiSignal struct {
+	mu    sync.Mutex
+	last  time.Time     // when it last happened, if ever
+	fired chan struct{} // closed when it happens
+}
+
+var (
+	kaomojiPets  = kaomojiSignal{fired: make(chan struct{})}
+	kaomojiFeeds = kaomojiSignal{fired: make(chan struct{})}
+)
+
+func (ks *kaomojiSignal) Fire() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.last = time.Now()
+	close(ks.fired)
+	ks.fired = make(chan struct{})
+}
+
+// Get returns when it last happened,
+// and a channel that gets closed once it happens again.
+func (ks *kaomojiSignal) Get() (time.Time, <-chan struct{}) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.last, ks.fired
+}
+
+// kaomojiPet pets all kaomoji.
+func kaomojiPet() {
+	tamagotchi.Pet()
+	kaomojiPets.Fire()
+}
+
+// kaomojiFeed feeds all kaomoji.
+func kaomojiFeed() {
+	tamagotchi.Feed()
+	kaomojiFeeds.Fire()
+}
+
+// kaomojiMusicState tracks whether any player is playing, and at what tempo,
+// as reported by producers watching players.
+type kaomojiMusicState struct {
+	mu      sync.Mutex
+	players map[any]float64 // tempo in beats per minute, or 0 if unknown
+	changed chan struct{}   // closed when the music starts or stops
+}
+
+var kaomojiMusic = kaomojiMusicState{
+	players: make(map[any]float64),
+	changed: make(chan struct{}),
+}
+
+// kaomojiDefaultTempo is assumed when players don't know the tempo.
+const kaomojiDefaultTempo = 120
+
+// Set updates whether the player identified by the key is playing,
+// and the tempo of what it is playing, if known.
+func (km *kaomojiMusicState) Set(key any, playing bool, bpm float64) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	wasPlaying := len(km.players) > 0
+	if playing {
+		km.players[key] = bpm
+	} else {
+		delete(km.players, key)
+	}
+	if (len(km.players) > 0) != wasPlaying {
+		close(km.changed)
+		km.changed = make(chan struct{})
+	}
+}
+
+// Get returns whether music is playing, the duration of a beat,
+// and a channel that gets closed once the music starts or stops.
+func (km *kaomojiMusicState) Get() (bool, time.Duration, <-chan struct{}) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	bpm := 0.
+	for _, tempo := range km.players {
+		bpm = max(bpm, tempo)
+	}
+	if bpm <= 0 {
+		bpm = kaomojiDefaultTempo
+	}
+	// Unreasonably quick tempos are danced to at half the speed.
+	for bpm > 240 {
+		bpm /= 2
+	}
+	return len(km.players) > 0,
+		time.Duration(float64(time.Minute) / bpm), km.changed
+}
+
+// kaomojiStressState collects readings of how stressed the machine is,
+// as reported by the system and temperature producers.
+type kaomojiStressState struct {
+	mu       sync.Mutex
+	readings map[string]kaomojiReading
+}
+
+type kaomojiReading struct {
+	value float64
+	taken time.Time
+}
+
+var kaomojiStress = kaomojiStressState{
+	readings: make(map[string]kaomojiReading),
+}
+
+// kaomojiStressMaxAge limits how old readings may be,
+// as their producers may go away.
+const kaomojiStressMaxAge = time.Minute
+
+// Report updates a reading: "cpu" usage in percent, "load" average
+// per logical CPU, or the highest "temperature" in degrees Celsius.
+func (ks *kaomojiStressState) Report(kind string, value float64) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.readings[kind] = kaomojiReading{value: value, taken: time.Now()}
+}
+
+// Exceeds tells whether a recent reading has reached the threshold.
+func (ks *kaomojiStressState) Exceeds(kind string, threshold float64) bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	reading, ok := ks.readings[kind]
+	return ok && threshold > 0 && reading.value >= threshold &&
+		time.Since(reading.taken) < kaomojiStressMaxAge
+}
+
+// kaomojiWeatherMaxAge limits how old weather conditions may be
+// for the kaomoji to react to them.
+const kaomojiWeatherMaxAge = 3 * time.Hour
+
+// kaomojiRainy tells whether the conditions call for an umbrella.
+func kaomojiRainy(c *weather.Conditions) bool {
+	return c.Symbol == "rain" || c.Symbol == "sleet" || c.Symbol == "thunder" ||
+		c.Precipitation != nil && *c.Precipitation > 0
+}
+
+// kaomojiHolidays are the dates of holidays, in the "MM-DD" format.
+var kaomojiHolidays = map[string][]string{
+	"christmas": {"12-24", "12-25", "12-26"},
+	"newyear":   {"12-31", "01-01"},
+	"halloween": {"10-31"},
+}
+
+// occasion returns what is celebrated on the given day, if anything.
+func (kp *kaomojiProducer) occasion(t time.Time) string {
+	date := t.Format("01-02")
+	if slices.Contains(kp.Birthdays, date) {
+		return "birthday"
+	}
+	for name, dates := range kaomojiHolidays {
+		if slices.Contains(dates, date) {
+			return name
+		}
+	}
+	return ""
+}
+
+// kaomojiSpeech holds what kaomoji have been asked to say,
+// for each of them to catch up with.
+type kaomojiSpeech struct {
+	mu     sync.Mutex
+	said   []string      // the most recent texts
+	count  int           // how many texts have been said in total
+	posted chan struct{} // closed when another text is said
+}
+
+var kaomojiSpoken = kaomojiSpeech{posted: make(chan struct{})}
+
+// kaomojiSpeechBacklog limits how many texts kaomoji may fall behind.
+const kaomojiSpeechBacklog = 10
+
+func (ks *kaomojiSpeech) Say(text string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.said = append(ks.said, text)
+	if len(ks.said) > kaomojiSpeechBacklog {
+		ks.said = ks.said[1:]
+	}
+	ks.count++
+	close(ks.posted)
+	ks.posted = make(chan struct{})
+}
+
+// Get returns the texts said after the given count of them,
+// the current count, and a channel that gets closed once more are said.
+func (ks *kaomojiSpeech) Get(heard int) ([]string, int, <-chan struct{}) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	missed := min(ks.count-heard, len(ks.said))
+	return ks.said[len(ks.said)-missed:], ks.count, ks.posted
+}
+
+// kaomojiListen makes kaomoji say every line written to a named pipe,
+// creating it as needed.
+func kaomojiListen(ctx context.Context, path string) {
+	if err := syscall.Mkfifo(path, 0600); err != nil &&
+		!errors.Is(err, os.ErrExist) {
+		slog.Warn("Kaomoji pipe failed", "path", path, "error", err)
+		return
+	}
+
+	// Opening the pipe for writing as well keeps it from ever hitting EOF.
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		slog.Warn("Kaomoji pipe failed", "path", path, "error", err)
+		return
+	}
+	stop := context.AfterFunc(ctx, func() { f.Close() })
+	defer stop()
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if text := strings.TrimSpace(scanner.Text()); text != "" {
+			kaomojiSpoken.Say(text)
+		}
+	}
+}
+
+// userTyping is set while the user keeps providing input, such as by typing.
+var userTyping = newFlagState("typing", "typing-stopped")
+
+// kaomojiTypingTimeout is how soon after the last input typing stops.
+const kaomojiTypingTimeout = 2 * time.Second
+
+// kaomojiProducer shows a little face that lives its own life,
+// and falls asleep while the user is away.
+type kaomojiProducer struct {
+	// Initial is the state to start in, Idle is entered when the user leaves,
+	// Active when they return, Petted when they pet the kaomoji,
+	// and Fed when they feed it.
+	Initial string `toml:"initial"`
+	Idle    string `toml:"idle"`
+	Active  string `toml:"active"`
+	Petted  string `toml:"petted"`
+	Fed     string `toml:"fed"`
+	// Mood is how long the kaomoji stays petted, for the sake of transitions.
+	Mood time.Duration `toml:"mood"`
+	// Typing, if set, is entered whenever the user starts providing input.
+	Typing string `toml:"typing"`
+	// Dance, if set, is entered whenever music starts playing.
+	Dance string `toml:"dance"`
+	// Speak is entered to say texts, which replace the message.
+	Speak string `toml:"speak"`
+	// Pipe is a named pipe to read texts to say from, one per line.
+	Pipe string `toml:"pipe"`
+	// CPU usage in percent, Load average per logical CPU, and Temperature
+	// in degrees Celsius, are the thresholds at which the machine is
+	// considered to be stressed. Zero disables them.
+	CPU         float64 `toml:"cpu"`
+	Load        float64 `toml:"load"`
+	Temperature float64 `toml:"temperature"`
+	// Birthdays are dates to celebrate, in the "MM-DD" format.
+	Birthdays []string `toml:"birthdays"`
+	// Instead is a producer, with its options, to take over the region
+	// while kaomoji are disabled, which otherwise leaves it empty.
+	Instead *RegionConfig `toml:"instead"`
+	// Seed makes random choices repeatable, unless it is zero.
+	Seed int64 `toml:"seed"`
+	// Dump is a file to append each frame to, along with its delay.
+	Dump string `toml:"dump"`
+	// States replace the built-in ones of the same name, or add new ones.
+	States map[string]kaomojiStateConfig `toml:"states"`
+	// Faces replace just the faces of the named states.
+	Faces map[string][]kaomojiFace `toml:"faces"`
+	// Tamagotchi makes the kaomoji a virtual pet, which gets hungry,
+	// and sad when neglected, keeping its stats across restarts.
+	Tamagotchi bool `toml:"tamagotchi"`
+
+	states     map[string]kaomojiStateConfig
+	weatherKey string   // of conditions at the configured location
+	instead    Producer // nil unless Instead is set
+	rand       *rand.Rand
+	dump       io.Writer // nil unless Dump is set
+}
+
+func init() {
+	registerProducer("kaomoji", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		kp := &kaomojiProducer{
+			Initial: "awake",
+			Idle:    "sleep",
+			Active:  "awake",
+			Petted:  "petted",
+			Fed:     "fed",
+			Dance:   "dance",
+			Speak:   "speak",
+			Mood:    10 * time.Minute,
+
+			CPU:         90,
+			Load:        1.5,
+			Temperature: 80,
+
+			weatherKey: weatherCacheKey(config.Weather.Provider,
+				config.Location.weatherLocation()),
+		}
+		if err := config.DecodeOptions(region, kp); err != nil {
+			return nil, err
 		}
-		if chasedX >= 0 {
-			copy(line[chasedX:], chased)
+		if err := kp.validate(); err != nil {
+			return nil, err
 		}
+		seed := kp.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		kp.rand = rand.New(rand.NewSource(seed))
+		if kp.Instead != nil {
+			kp.Instead.charset = region.charset
+			var err error
+			if kp.instead, err = newProducer(config, kp.Instead); err != nil {
+				return nil, fmt.Errorf("instead: %w", err)
+			}
+		}
+		if kp.Tamagotchi {
+			path, err := tamagotchiPath()
+			if err != nil {
+				return nil, err
+			}
+			tamagotchi.Adopt(path)
+		}
+		return kp, nil
+	})
+}
 
-		copy(line[chaserX:], []rune(state.face))
-		lines = append(lines, string(line[chaserLen:]))
+// validate merges the configured states with the built-in ones,
+// and checks the resulting state machine.
+func (kp *kaomojiProducer) validate() error {
+	states := maps.Clone(kaomojiStates)
+	maps.Copy(states, kp.States)
+	for name, faces := range kp.Faces {
+		state, ok := states[name]
+		if !ok {
+			return fmt.Errorf("unknown kaomoji state: %q", name)
+		}
+		state.Faces = faces
+		states[name] = state
 	}
+	kp.states = states
 
-	// Return our main character back.
-	for chasedX := displayWidth; chasedX >= centre; chasedX-- {
-		line := []rune(strings.Repeat(" ", displayWidth))
-		copy(line[chasedX:], normal)
-		lines = append(lines, string(line))
+	for _, name := range []string{
+		kp.Initial, kp.Idle, kp.Active, kp.Petted, kp.Fed, kp.Speak} {
+		if _, ok := states[name]; !ok {
+			return fmt.Errorf("unknown kaomoji state: %q", name)
+		}
 	}
-	return
+	for _, date := range kp.Birthdays {
+		if _, err := time.Parse("01-02", date); err != nil {
+			return fmt.Errorf("invalid birthday: %q", date)
+		}
+	}
+	for _, name := range []string{kp.Typing, kp.Dance} {
+		if _, ok := states[name]; !ok && name != "" {
+			return fmt.Errorf("unknown kaomoji state: %q", name)
+		}
+	}
+	for name, state := range states {
+		if len(state.Faces) == 0 {
+			return fmt.Errorf("kaomoji state %q has no faces", name)
+		}
+		for _, face := range state.Faces {
+			if face.Weight < 0 || face.Delay < 0 || face.Jitter < 0 {
+				return fmt.Errorf("kaomoji state %q: "+
+					"weights and delays must not be negative", name)
+			}
+		}
+		if _, ok := kaomojiAnimations[state.Animation]; !ok &&
+			state.Animation != "" {
+			return fmt.Errorf("kaomoji state %q: unknown animation: %q",
+				name, state.Animation)
+		}
+		for _, transition := range state.Next {
+			if _, ok := states[transition.State]; !ok {
+				return fmt.Errorf("kaomoji state %q: unknown next state: %q",
+					name, transition.State)
+			}
+			if transition.Weight < 0 {
+				return fmt.Errorf("kaomoji state %q: "+
+					"weights must not be negative", name)
+			}
+			if _, ok := kaomojiConditions[transition.When]; !ok {
+				return fmt.Errorf("kaomoji state %q: unknown condition: %q",
+					name, transition.When)
+			}
+		}
+	}
+	return nil
 }
 
-func kaomojiProducer(lines chan<- string) {
-	state := kaomojiNewAwake()
-	execute := func() {
-		lines <- state.Format()
-		time.Sleep(state.Duration())
-	}
-
-	for {
-		switch state.kind {
-		case kaomojiKindAwake:
-			execute()
-			switch f := rand.Float32(); {
-			case f < 0.025:
-				state = kaomojiNewFace()
-			case f < 0.050:
-				state = kaomojiNewChase()
-			case f < 0.075:
-				state = kaomojiNewHappy()
-			case f < 0.100:
-				state = kaomojiNewSleep()
-			default:
-				state = kaomojiNewBlink()
+func (kp *kaomojiProducer) Run(ctx context.Context, lines chan<- string) {
+	if kp.Typing != "" {
+		go watchInput(ctx, kaomojiTypingTimeout,
+			func(idle bool) { userTyping.Set(!idle) })
+	}
+
+	if kp.Pipe != "" {
+		go kaomojiListen(ctx, kp.Pipe)
+	}
+	if kp.Dump != "" {
+		f, err := os.OpenFile(kp.Dump,
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			slog.Warn("Kaomoji dump failed", "path", kp.Dump, "error", err)
+		} else {
+			defer f.Close()
+			kp.dump = f
+		}
+	}
+
+	for ctx.Err() == nil {
+		disabled, changed := kaomojiDisabled.Get()
+		runCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-changed:
+				cancel()
+			case <-runCtx.Done():
 			}
+		}()
 
-		case kaomojiKindBlink, kaomojiKindFace:
-			execute()
-			state = kaomojiNewAwake()
-
-		case kaomojiKindHappy:
-			face := state.face
-			execute()
-			state.face = "  " + face
-			execute()
-			state.face = face
-			execute()
-			state.face = face + "  "
-			execute()
-			state.face = face
-			execute()
-			state = kaomojiNewAwake()
-
-		case kaomojiKindChase:
-			for _, line := range kaomojiAnimateChase(state) {
-				lines <- line
-				time.Sleep(state.Duration())
+		if !disabled {
+			kp.live(runCtx, lines)
+		} else if kp.instead != nil {
+			kp.instead.Run(runCtx, lines)
+		} else if send(runCtx, lines, "") {
+			<-runCtx.Done()
+		}
+		cancel()
+	}
+}
+
+// replay writes the frames of the given number of states, with their delays,
+// without waiting, and under unchanging circumstances. Along with a seed,
+// this makes for repeatable results.
+func (kp *kaomojiProducer) replay(
+	w io.Writer, states int, c *kaomojiCircumstances) error {
+	state := kp.enter(kp.Initial)
+	for range states {
+		for _, frame := range state.frames() {
+			if err := kaomojiDumpFrame(w, state.Duration(), frame); err != nil {
+				return err
 			}
-			state = kaomojiNewAwake()
-
-		case kaomojiKindSleep:
-			execute()
-			switch f := rand.Float32(); {
-			case f < 0.10:
-				state = kaomojiNewAwake()
-			case f < 0.20:
-				state = kaomojiNewPeek()
-			case f < 0.60:
-				state = kaomojiNewSnore()
-			default:
-				state = kaomojiNewSleep()
+		}
+		state = kp.enter(kp.next(state.name, c))
+	}
+	return nil
+}
+
+// kaomojiReplaySeed is used by replays of regions that don't configure a seed,
+// so that they are repeatable all the same.
+const kaomojiReplaySeed = 1
+
+// kaomojiReplay replays the first kaomoji region of the configuration,
+// seeded by the given seed, or unless it is zero, by the configured one.
+func kaomojiReplay(config *Config, w io.Writer, states int, seed int64) error {
+	for _, display := range config.Displays {
+		for _, page := range display.Pages {
+			for i := range page.Regions {
+				if page.Regions[i].Producer != "kaomoji" {
+					continue
+				}
+				p, err := newProducer(config, &page.Regions[i])
+				if err != nil {
+					return err
+				}
+				kp := p.(*kaomojiProducer)
+				if seed == 0 {
+					seed = cmp.Or(kp.Seed, kaomojiReplaySeed)
+				}
+				kp.rand = rand.New(rand.NewSource(seed))
+				return kp.replay(w, states, &kaomojiCircumstances{})
 			}
+		}
+	}
+	return errors.New("no kaomoji region found")
+}
+
+// live runs the state machine, for as long as the context allows.
+func (kp *kaomojiProducer) live(ctx context.Context, lines chan<- string) {
+	state := kp.enter(kp.Initial)
+	idle, idleChanged := userIdle.Get()
+	lastPetted, petted := kaomojiPets.Get()
+	lastFed, fed := kaomojiFeeds.Get()
+	typing, _ := userTyping.Get()
+	music, beat, musicChanged := kaomojiMusic.Get()
+	_, heard, spoken := kaomojiSpoken.Get(0)
+	execute := func(line string) bool {
+		if !kaomojiPaused.Wait(ctx) || !send(ctx, lines, line) {
+			return false
+		}
+		if kp.dump != nil {
+			kaomojiDumpFrame(kp.dump, state.Duration(), line)
+		}
+
+		// The user coming, going, petting, or feeding,
+		// as well as music starting or stopping,
+		// interrupts whatever is going on.
+		timer := time.NewTimer(state.Duration())
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-idleChanged:
+		case <-petted:
+		case <-fed:
+		case <-musicChanged:
+		case <-spoken:
+		case <-ctx.Done():
+		}
+		return false
+	}
+
+	for ctx.Err() == nil {
+		wasIdle := idle
+		if idle, idleChanged = userIdle.Get(); idle && !wasIdle {
+			state = kp.enter(kp.Idle)
+		} else if !idle && wasIdle {
+			state = kp.enter(kp.Active)
+		}
+		wasTyping := typing
+		if typing, _ = userTyping.Get(); typing && !wasTyping && kp.Typing != "" {
+			state = kp.enter(kp.Typing)
+		}
+		wasMusic := music
+		if music, beat, musicChanged = kaomojiMusic.Get(); music && !wasMusic &&
+			kp.Dance != "" {
+			state = kp.enter(kp.Dance)
+		} else if !music && wasMusic && state.animation == "dance" {
+			state = kp.enter(kp.Active)
+		}
+		wasPetted := lastPetted
+		if lastPetted, petted = kaomojiPets.Get(); lastPetted != wasPetted {
+			state = kp.enter(kp.Petted)
+		}
+		wasFed := lastFed
+		if lastFed, fed = kaomojiFeeds.Get(); lastFed != wasFed {
+			state = kp.enter(kp.Fed)
+		}
+		// Speech takes turns, without interrupting itself.
+		var texts []string
+		if texts, heard, spoken = kaomojiSpoken.Get(heard); len(texts) > 0 {
+			state = kp.enter(kp.Speak)
+			state.message = texts[0]
+			heard -= len(texts) - 1
+		}
+		if state.name == kp.Speak {
+			spoken = nil
+		}
 
-		case kaomojiKindSnore:
-			execute()
-			state = kaomojiNewSleep()
+		// Dancing follows the beat.
+		if state.animation == "dance" && music {
+			state.delay = beat
+		}
+		for _, frame := range state.frames() {
+			if !execute(frame) {
+				break
+			}
+		}
+		circumstances := kaomojiCircumstances{
+			idle:   idle,
+			petted: !lastPetted.IsZero() && time.Since(lastPetted) < kp.Mood,
+			typing: typing,
+			music:  music,
+			busy: kaomojiStress.Exceeds("cpu", kp.CPU) ||
+				kaomojiStress.Exceeds("load", kp.Load),
+			hot: kaomojiStress.Exceeds("temperature", kp.Temperature),
 
-		case kaomojiKindPeek:
-			execute()
-			state = kaomojiNewSleep()
+			occasion: kp.occasion(time.Now()),
+		}
+		c := weatherLatest.Get(kp.weatherKey, kaomojiWeatherMaxAge)
+		if c != nil {
+			circumstances.rain = kaomojiRainy(c)
+			circumstances.freezing = c.Temperature < 0
+		}
+		if kp.Tamagotchi {
+			if stats, ok := tamagotchi.Get(); ok {
+				circumstances.stats = &stats
+			}
 		}
+		state = kp.enter(kp.next(state.name, &circumstances))
 	}
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const kaomojiTestConfig = `
+[[page]]
+[[page.region]]
+producer = "kaomoji"
+[page.region.options]
+initial = "a"
+[page.region.options.states.a]
+faces = [{ face = "(a)", delay = "1s" }]
+next = [{ state = "b" }]
+[page.region.options.states.b]
+faces = [{ face = "(b)", delay = "2s", message = "ハイ" }]
+next = [{ state = "a" }]
+`
+
+func kaomojiTestReplay(t *testing.T, text string, states int, seed int64) string {
+	t.Helper()
+	config := loadTestConfig(t, text)
+	var b strings.Builder
+	if err := kaomojiReplay(config, &b, states, seed); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestKaomojiReplay(t *testing.T) {
+	expected := "1s\t\"         (a)        \"\n" +
+		"2s\t\"         (b)  ハイ    \"\n" +
+		"1s\t\"         (a)        \"\n"
+	if out := kaomojiTestReplay(t, kaomojiTestConfig, 3, 0); out != expected {
+		t.Errorf("unexpected replay:\n%s", out)
+	}
+	if err := kaomojiReplay(&Config{}, &strings.Builder{}, 1, 0); err == nil {
+		t.Error("replay without a kaomoji region succeeded")
+	}
+}
+
+func TestKaomojiReplaySeed(t *testing.T) {
+	// The built-in states pick faces, delays, and transitions at random.
+	text := "[[page]]\n[[page.region]]\nproducer = \"kaomoji\"\n"
+	first := kaomojiTestReplay(t, text, 50, 0)
+	if out := kaomojiTestReplay(t, text, 50, 0); out != first {
+		t.Error("replays without a seed differ")
+	}
+	if out := kaomojiTestReplay(t, text, 50, kaomojiReplaySeed); out != first {
+		t.Error("replays without a seed don't use the fixed one")
+	}
+
+	seeded := kaomojiTestReplay(t, text, 50, 42)
+	if out := kaomojiTestReplay(t, text, 50, 42); out != seeded {
+		t.Error("replays with the same seed differ")
+	}
+	if seeded == first {
+		t.Error("replays with different seeds are the same")
+	}
+	configured := strings.Replace(text,
+		`"kaomoji"`, "\"kaomoji\"\noptions = { seed = 42 }", 1)
+	if out := kaomojiTestReplay(t, configured, 50, 0); out != seeded {
+		t.Error("replays don't use the configured seed")
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// layoutProducer shows the active keyboard layout, such as "CZ",
+// and whenever it changes, briefly takes over a line with it.
+// It either follows the XKB group of an X11 server, or sway's inputs.
+type layoutProducer struct {
+	// Source is "x11" or "sway", and defaults to whichever seems available.
+	Source string `toml:"source"`
+	// Labels map layouts to what is shown, such as { us = "EN" }.
+	// Layouts are XKB layout codes with X11, and layout names with sway.
+	// By default, codes are shown uppercased, and names abbreviated.
+	Labels map[string]string `toml:"labels"`
+	// PopupLine is the line to take over, or -1 for the whole display.
+	PopupLine     int           `toml:"popup_line"`
+	PopupDuration time.Duration `toml:"popup_duration"`
+	// Retry is the delay before reconnecting.
+	Retry time.Duration `toml:"retry"`
+}
+
+func init() {
+	registerProducer("layout", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		lp := &layoutProducer{
+			PopupLine:     1,
+			PopupDuration: time.Second,
+			Retry:         10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, lp); err != nil {
+			return nil, err
+		}
+		switch lp.Source {
+		case "", "x11", "sway":
+		default:
+			return nil, fmt.Errorf("unsupported source: %s", lp.Source)
+		}
+		if lp.PopupLine < -1 || lp.PopupLine >= displayHeight {
+			return nil, fmt.Errorf("invalid popup line: %d", lp.PopupLine)
+		}
+		if lp.PopupDuration < 0 {
+			return nil, errors.New("the popup duration must not be negative")
+		}
+		if lp.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return lp, nil
+	})
+}
+
+func (lp *layoutProducer) label(layout string, abbreviate bool) string {
+	if label, ok := lp.Labels[layout]; ok {
+		return label
+	}
+	if abbreviate {
+		if runes := []rune(layout); len(runes) > 2 {
+			layout = string(runes[:2])
+		}
+	}
+	return strings.ToUpper(layout)
+}
+
+// layoutReporter sends layout changes, popping them up after the first one.
+type layoutReporter struct {
+	lp      *layoutProducer
+	out     chan<- string
+	last    string
+	started bool
+}
+
+func (r *layoutReporter) report(ctx context.Context, label string) bool {
+	if r.started && label == r.last {
+		return true
+	}
+	if r.started && label != "" && r.lp.PopupDuration > 0 {
+		Takeover(Message{
+			Text:     label,
+			Duration: r.lp.PopupDuration,
+			Line:     r.lp.PopupLine,
+			Tag:      "layout",
+		})
+	}
+	r.last, r.started = label, true
+	return send(ctx, r.out, label)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// XKB requests and events, see the X Keyboard Extension protocol.
+const (
+	xkbUseExtension = 0
+	xkbSelectEvents = 1
+	xkbGetState     = 4
+
+	xkbStateNotify     = 2
+	xkbStateNotifyMask = 1 << xkbStateNotify
+	xkbUseCoreKbd      = 0x100
+)
+
+// xkbLayouts returns layout codes for each group, as set by setxkbmap.
+func xkbLayouts(c *x11Conn, rulesNames uint32) ([]string, error) {
+	value, err := c.getProperty(c.root, rulesNames)
+	if err != nil {
+		return nil, err
+	}
+	// Rules, model, layouts, variants, and options.
+	fields := strings.Split(string(value), "\x00")
+	if len(fields) < 3 {
+		return nil, errors.New("XKB layouts are unknown")
+	}
+	return strings.Split(fields[2], ","), nil
+}
+
+func (lp *layoutProducer) watchX11(ctx context.Context, r *layoutReporter) error {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return errors.New("X11 doesn't seem to be available")
+	}
+	c, err := x11Dial(display)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	opcode, firstEvent, err := c.queryExtension("XKEYBOARD")
+	if err != nil {
+		return err
+	}
+
+	le := binary.LittleEndian
+	req := []byte{opcode, xkbUseExtension}
+	req = le.AppendUint16(req, 2)
+	req = le.AppendUint16(req, 1)
+	req = le.AppendUint16(req, 0)
+	reply, _, err := c.request(req)
+	if err != nil {
+		return err
+	}
+	if reply[1] == 0 {
+		return errors.New("XKB version not supported")
+	}
+
+	// Selecting all details means that none need to be listed.
+	req = []byte{opcode, xkbSelectEvents}
+	req = le.AppendUint16(req, 4)
+	req = le.AppendUint16(req, xkbUseCoreKbd)
+	req = le.AppendUint16(req, xkbStateNotifyMask)
+	req = le.AppendUint16(req, 0)
+	req = le.AppendUint16(req, xkbStateNotifyMask)
+	req = le.AppendUint16(req, 0)
+	req = le.AppendUint16(req, 0)
+	if err := c.send(req); err != nil {
+		return err
+	}
+
+	// Layouts may be reconfigured while running.
+	rulesNames, err := c.internAtom("_XKB_RULES_NAMES")
+	if err != nil {
+		return err
+	}
+	if err := c.selectEvents(c.root, x11PropertyChangeMask); err != nil {
+		return err
+	}
+	layouts, err := xkbLayouts(c, rulesNames)
+	if err != nil {
+		return err
+	}
+
+	req = []byte{opcode, xkbGetState}
+	req = le.AppendUint16(req, 2)
+	req = le.AppendUint16(req, xkbUseCoreKbd)
+	req = le.AppendUint16(req, 0)
+	if reply, _, err = c.request(req); err != nil {
+		return err
+	}
+
+	group := int(reply[12])
+	for {
+		label := ""
+		if group < len(layouts) {
+			label = lp.label(layouts[group], false)
+		}
+		if !r.report(ctx, label) {
+			return nil
+		}
+
+		event, err := c.nextEvent()
+		if err != nil {
+			return err
+		}
+		switch {
+		case event[0] == firstEvent && event[1] == xkbStateNotify:
+			group = int(event[13])
+		case event[0] == x11PropertyNotify &&
+			le.Uint32(event[4:]) == c.root && le.Uint32(event[8:]) == rulesNames:
+			if layouts, err = xkbLayouts(c, rulesNames); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// swayLayout returns the active layout name of the first keyboard.
+func swayLayout(c *i3Conn) (string, error) {
+	var inputs []struct {
+		Type                string  `json:"type"`
+		XkbActiveLayoutName *string `json:"xkb_active_layout_name"`
+	}
+	if err := c.query(i3GetInputs, nil, &inputs); err != nil {
+		return "", err
+	}
+	for _, input := range inputs {
+		if input.Type == "keyboard" && input.XkbActiveLayoutName != nil {
+			return *input.XkbActiveLayoutName, nil
+		}
+	}
+	return "", nil
+}
+
+func (lp *layoutProducer) watchSway(ctx context.Context, r *layoutReporter) error {
+	path := os.Getenv("SWAYSOCK")
+	if path == "" {
+		return errors.New("sway doesn't seem to be running")
+	}
+
+	events, err := i3Dial(path)
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	queries, err := i3Dial(path)
+	if err != nil {
+		return err
+	}
+	defer queries.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		events.Close()
+		queries.Close()
+	})
+	defer stop()
+
+	if err := events.subscribe("input"); err != nil {
+		return err
+	}
+
+	for {
+		layout, err := swayLayout(queries)
+		if err != nil {
+			return err
+		}
+		label := ""
+		if layout != "" {
+			label = lp.label(layout, true)
+		}
+		if !r.report(ctx, label) {
+			return nil
+		}
+
+		if _, _, err := events.receive(); err != nil {
+			return err
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+func (lp *layoutProducer) Run(ctx context.Context, out chan<- string) {
+	// Only show popups for changes made while running.
+	r := &layoutReporter{lp: lp, out: out}
+	for ctx.Err() == nil {
+		var err error
+		if lp.Source == "sway" || lp.Source == "" && os.Getenv("SWAYSOCK") != "" {
+			err = lp.watchSway(ctx, r)
+		} else {
+			err = lp.watchX11(ctx, r)
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Keyboard layout failed", "error", err)
+		}
+		sleep(ctx, lp.Retry)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeLocale names weekdays and months, where Go time layouts
+// would use English ones. Names only use characters found in display charsets.
+type timeLocale struct {
+	weekdays      [7]string // starting with Sunday
+	shortWeekdays [7]string
+	months        [12]string
+	shortMonths   [12]string
+}
+
+var timeLocales = map[string]*timeLocale{
+	"en": nil,
+	"de": {
+		weekdays: [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch",
+			"Donnerstag", "Freitag", "Samstag"},
+		shortWeekdays: [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		months: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni",
+			"Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun",
+			"Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+	},
+	"es": {
+		weekdays: [7]string{"domingo", "lunes", "martes", "miércoles",
+			"jueves", "viernes", "sábado"},
+		shortWeekdays: [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio",
+			"julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun",
+			"jul", "ago", "sep", "oct", "nov", "dic"},
+	},
+	"fr": {
+		weekdays: [7]string{"dimanche", "lundi", "mardi", "mercredi",
+			"jeudi", "vendredi", "samedi"},
+		shortWeekdays: [7]string{"dim", "lun", "mar", "mer", "jeu", "ven", "sam"},
+		months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin",
+			"juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"jan", "fév", "mar", "avr", "mai", "jun",
+			"jul", "aoû", "sep", "oct", "nov", "déc"},
+	},
+	"it": {
+		weekdays: [7]string{"domenica", "lunedì", "martedì", "mercoledì",
+			"giovedì", "venerdì", "sabato"},
+		shortWeekdays: [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		months: [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio",
+			"giugno", "luglio", "agosto", "settembre", "ottobre", "novembre",
+			"dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu",
+			"lug", "ago", "set", "ott", "nov", "dic"},
+	},
+	"sv": {
+		weekdays: [7]string{"söndag", "måndag", "tisdag", "onsdag",
+			"torsdag", "fredag", "lördag"},
+		shortWeekdays: [7]string{"sön", "mån", "tis", "ons", "tor", "fre", "lör"},
+		months: [12]string{"januari", "februari", "mars", "april", "maj", "juni",
+			"juli", "augusti", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mar", "apr", "maj", "jun",
+			"jul", "aug", "sep", "okt", "nov", "dec"},
+	},
+	// The Japan-2 charset lacks most kanji, so readings are in katakana.
+	// Months are numbered, and their 月 suffix is left out.
+	"ja": {
+		weekdays: [7]string{"ﾆﾁﾖｳﾋﾞ", "ｹﾞﾂﾖｳﾋﾞ", "ｶﾖｳﾋﾞ", "ｽｲﾖｳﾋﾞ",
+			"ﾓｸﾖｳﾋﾞ", "ｷﾝﾖｳﾋﾞ", "ﾄﾞﾖｳﾋﾞ"},
+		shortWeekdays: [7]string{"ﾆﾁ", "ｹﾞﾂ", "ｶ", "ｽｲ", "ﾓｸ", "ｷﾝ", "ﾄﾞ"},
+		months: [12]string{"1", "2", "3", "4", "5", "6",
+			"7", "8", "9", "10", "11", "12"},
+		shortMonths: [12]string{"1", "2", "3", "4", "5", "6",
+			"7", "8", "9", "10", "11", "12"},
+	},
+}
+
+// lookupTimeLocale returns nil for English, which Go uses natively.
+func lookupTimeLocale(name string) (*timeLocale, error) {
+	l, ok := timeLocales[name]
+	if !ok && name != "" {
+		return nil, fmt.Errorf("unknown locale: %q", name)
+	}
+	return l, nil
+}
+
+// Format is like time.Time.Format, but with localized names.
+// Layout elements are recognized the same way Go does it.
+func (l *timeLocale) Format(t time.Time, layout string) string {
+	if l == nil {
+		return t.Format(layout)
+	}
+
+	isLower := func(s string) bool {
+		return s != "" && 'a' <= s[0] && s[0] <= 'z'
+	}
+
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(layout); {
+		var name string
+		var n int
+		switch rest := layout[i:]; {
+		case strings.HasPrefix(rest, "January"):
+			name, n = l.months[t.Month()-1], len("January")
+		case strings.HasPrefix(rest, "Jan") && !isLower(rest[3:]):
+			name, n = l.shortMonths[t.Month()-1], len("Jan")
+		case strings.HasPrefix(rest, "Monday"):
+			name, n = l.weekdays[t.Weekday()], len("Monday")
+		case strings.HasPrefix(rest, "Mon") && !isLower(rest[3:]):
+			name, n = l.shortWeekdays[t.Weekday()], len("Mon")
+		default:
+			i++
+			continue
+		}
+
+		b.WriteString(t.Format(layout[start:i]))
+		b.WriteString(name)
+		i += n
+		start = i
+	}
+	b.WriteString(t.Format(layout[start:]))
+	return b.String()
+}
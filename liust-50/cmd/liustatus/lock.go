@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	logindName      = "org.freedesktop.login1"
+	logindPath      = "/org/freedesktop/login1"
+	logindManager   = logindName + ".Manager"
+	logindSessionIf = logindName + ".Session"
+)
+
+var sessionLocked = newFlagState("lock", "unlock")
+
+// logindSession finds the session to watch. Services of the user's service
+// manager don't belong to any, so they settle for the user's graphical one.
+func logindSession(conn *dbus.Conn) (dbus.ObjectPath, error) {
+	manager := conn.Object(logindName, logindPath)
+	var path dbus.ObjectPath
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		err := manager.Call(logindManager+".GetSession", 0, id).Store(&path)
+		return path, err
+	}
+
+	if err := manager.Call(logindManager+".GetUser", 0,
+		uint32(os.Getuid())).Store(&path); err != nil {
+		return "", err
+	}
+	v, err := conn.Object(logindName, path).GetProperty(
+		logindName + ".User.Display")
+	if err != nil {
+		return "", err
+	}
+	var display struct {
+		ID   string
+		Path dbus.ObjectPath
+	}
+	if err := v.Store(&display); err != nil {
+		return "", err
+	}
+	if display.ID == "" {
+		return "", errors.New("no graphical session found")
+	}
+	return display.Path, nil
+}
+
+// watchLockLogind follows logind's lock requests, and the locked hint
+// that screen lockers maintain.
+func watchLockLogind(ctx context.Context) error {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	path, err := logindSession(conn)
+	if err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchSender(logindName),
+		dbus.WithMatchObjectPath(path),
+	); err != nil {
+		return err
+	}
+
+	v, err := conn.Object(logindName, path).GetProperty(
+		logindSessionIf + ".LockedHint")
+	if err != nil {
+		return err
+	}
+	locked, _ := v.Value().(bool)
+	sessionLocked.Set(locked)
+
+	for signal := range signals {
+		switch signal.Name {
+		case logindSessionIf + ".Lock":
+			sessionLocked.Set(true)
+		case logindSessionIf + ".Unlock":
+			sessionLocked.Set(false)
+		case "org.freedesktop.DBus.Properties.PropertiesChanged":
+			var (
+				iface       string
+				changed     map[string]dbus.Variant
+				invalidated []string
+			)
+			if dbus.Store(signal.Body,
+				&iface, &changed, &invalidated) != nil ||
+				iface != logindSessionIf {
+				continue
+			}
+			if hint, ok := changed["LockedHint"].Value().(bool); ok {
+				sessionLocked.Set(hint)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("disconnected from the bus")
+}
+
+// watchLock keeps sessionLocked updated, retrying after failures.
+func watchLock(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := watchLockLogind(ctx)
+		sessionLocked.Set(false)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Lock detection failed", "error", err)
+		}
+		sleep(ctx, time.Minute)
+	}
+}
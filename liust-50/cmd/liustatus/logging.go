@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// journalHandler formats records for the systemd journal, see sd-daemon(3).
+// The journal adds timestamps by itself, and takes levels as prefixes.
+type journalHandler struct {
+	inner slog.Handler
+	w     io.Writer
+
+	mu  *sync.Mutex
+	buf *bytes.Buffer // the output of inner
+}
+
+func newJournalHandler(w io.Writer, level slog.Leveler) *journalHandler {
+	buf := &bytes.Buffer{}
+	return &journalHandler{
+		inner: slog.NewTextHandler(buf, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 &&
+					(a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+		w:   w,
+		mu:  &sync.Mutex{},
+		buf: buf,
+	}
+}
+
+func (h *journalHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *journalHandler) Handle(ctx context.Context, r slog.Record) error {
+	priority := 7 // LOG_DEBUG
+	switch {
+	case r.Level >= slog.LevelError:
+		priority = 3 // LOG_ERR
+	case r.Level >= slog.LevelWarn:
+		priority = 4 // LOG_WARNING
+	case r.Level >= slog.LevelInfo:
+		priority = 6 // LOG_INFO
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.inner.Handle(ctx, r); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(h.w, "<%d>%s", priority, h.buf.Bytes())
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithAttrs(attrs)
+	return &clone
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithGroup(name)
+	return &clone
+}
+
+// stderrIsJournal tells whether standard error is connected to the journal.
+func stderrIsJournal() bool {
+	var dev, ino uint64
+	if _, err := fmt.Sscanf(os.Getenv("JOURNAL_STREAM"), "%d:%d",
+		&dev, &ino); err != nil {
+		return false
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(os.Stderr.Fd()), &st); err != nil {
+		return false
+	}
+	return uint64(st.Dev) == dev && uint64(st.Ino) == ino
+}
+
+// setupLogging makes slog log to standard error in the given format,
+// which is one of "text", "json", "journal", or "auto".
+func setupLogging(format string, verbose bool) error {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	if format == "auto" {
+		format = "text"
+		if stderrIsJournal() {
+			format = "journal"
+		}
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, options)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, options)))
+	case "journal":
+		slog.SetDefault(slog.New(newJournalHandler(os.Stderr, level)))
+	default:
+		return fmt.Errorf("unknown log format: %q", format)
+	}
+	return nil
+}
+
+// fatal logs an error, and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// stderrLogger returns a writer that logs child process error output
+// line by line, attributed to the given kind of child and its command.
+func stderrLogger(kind, command string) io.Writer {
+	return slog.NewLogLogger(
+		slog.Default().With(kind, command).Handler(), slog.LevelWarn).Writer()
+}
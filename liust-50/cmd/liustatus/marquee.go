@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// marquee forwards content from in to out, scrolling it horizontally
+// whenever it doesn't fit within the given width. Neither repeated content,
+// nor content of the same length, such as with a counter being updated,
+// restarts the animation, so periodic producers can be scrolled, too.
+func marquee(ctx context.Context, in <-chan string, out chan<- string,
+	width int, interval time.Duration, gap int) {
+	var (
+		ticker  *time.Ticker
+		tick    <-chan time.Time
+		content string
+		cycle   []rune
+		offset  int
+	)
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case s := <-in:
+			if s == content {
+				continue
+			}
+
+			length := len(cycle)
+			content = s
+			if utf8.RuneCountInString(s) <= width {
+				cycle = nil
+			} else {
+				cycle = marqueeCycle(s, gap)
+			}
+			if len(cycle) != length {
+				offset = 0
+			}
+
+			if cycle == nil && ticker != nil {
+				ticker.Stop()
+				ticker, tick = nil, nil
+			} else if cycle != nil && ticker == nil {
+				ticker = time.NewTicker(interval)
+				tick = ticker.C
+			}
+		case <-tick:
+			offset = (offset + 1) % len(cycle)
+		case <-ctx.Done():
+			return
+		}
+
+		if cycle == nil {
+			if !send(ctx, out, content) {
+				return
+			}
+			continue
+		}
+
+		if !send(ctx, out, marqueeWindow(cycle, width, offset)) {
+			return
+		}
+	}
+}
+
+// marqueeCycle returns what is being rotated when text needs scrolling.
+func marqueeCycle(text string, gap int) []rune {
+	return append([]rune(text), []rune(strings.Repeat(" ", gap))...)
+}
+
+// marqueeWindow returns the visible part of a scrolled text.
+func marqueeWindow(cycle []rune, width, offset int) string {
+	window := make([]rune, width)
+	for i := range window {
+		window[i] = cycle[(offset+i)%len(cycle)]
+	}
+	return string(window)
+}
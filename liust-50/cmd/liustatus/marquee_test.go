@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMarqueeWindow(t *testing.T) {
+	cycle := marqueeCycle("ｺﾝﾆﾁﾊ world", 2)
+	for _, test := range []struct {
+		width, offset int
+		window        string
+	}{
+		{5, 0, "ｺﾝﾆﾁﾊ"},
+		{5, 3, "ﾁﾊ wo"},
+		{5, 10, "d  ｺﾝ"},
+		{5, 14, "ﾝﾆﾁﾊ "},
+		{15, 0, "ｺﾝﾆﾁﾊ world  ｺﾝ"},
+	} {
+		if window := marqueeWindow(cycle, test.width, test.offset); window !=
+			test.window {
+			t.Errorf("%d at %d: got %q, expected %q",
+				test.width, test.offset, window, test.window)
+		}
+	}
+}
+
+func TestMarquee(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in, out := make(chan string), make(chan string)
+	go marquee(ctx, in, out, 4, time.Millisecond, 1)
+
+	in <- "abc"
+	if s := <-out; s != "abc" {
+		t.Errorf("content that fits was changed to %q", s)
+	}
+
+	// Each tick scrolls the text by a character, wrapping around.
+	in <- "abcdef"
+	for _, expected := range []string{
+		"abcd", "bcde", "cdef", "def ", "ef a", "f ab", " abc", "abcd"} {
+		if s := <-out; s != expected {
+			t.Errorf("got %q, expected %q", s, expected)
+		}
+	}
+}
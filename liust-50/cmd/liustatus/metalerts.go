@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/weather"
+)
+
+const metAlertsURL = "https://api.met.no/weatherapi/metalerts/2.0/current.json"
+
+// metAlertsProducer shows weather warnings for the configured location,
+// such as "Yellow Wind", as issued by the Norwegian Meteorological Institute
+// for Norway, and its waters. New warnings take over the display.
+type metAlertsProducer struct {
+	// Language is either "en", or "no".
+	Language string        `toml:"language"`
+	Interval time.Duration `toml:"interval"`
+	// Alert takes over the display for AlertDuration, blinking,
+	// whenever a warning is issued, though never past its expiry.
+	Alert         bool          `toml:"alert"`
+	AlertDuration time.Duration `toml:"alert_duration"`
+
+	client   *http.Client
+	location LocationConfig
+	seen     map[string]bool
+}
+
+// metAlert is what is needed of a warning.
+type metAlert struct {
+	ID      string
+	Summary string
+	Expires time.Time
+}
+
+func init() {
+	registerProducer("metalerts", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		mp := &metAlertsProducer{
+			Language:      "en",
+			Interval:      10 * time.Minute,
+			Alert:         true,
+			AlertDuration: 30 * time.Second,
+			client:        &http.Client{Timeout: 30 * time.Second},
+			location:      config.Location,
+		}
+		if err := config.DecodeOptions(region, mp); err != nil {
+			return nil, err
+		}
+		if mp.Language != "en" && mp.Language != "no" {
+			return nil, fmt.Errorf("unsupported language: %q", mp.Language)
+		}
+		if mp.Interval <= 0 || mp.AlertDuration <= 0 {
+			return nil, errors.New("intervals must be positive")
+		}
+		return config.Location.unlessPending(
+			&periodicProducer{interval: mp.Interval, produce: mp.produce}), nil
+	})
+}
+
+func (mp *metAlertsProducer) fetch() ([]metAlert, error) {
+	query := url.Values{
+		"lat":  {fmt.Sprintf("%.4f", mp.location.Latitude)},
+		"lon":  {fmt.Sprintf("%.4f", mp.location.Longitude)},
+		"lang": {mp.Language},
+	}
+
+	var result struct {
+		Features []struct {
+			Properties struct {
+				ID                 string `json:"id"`
+				Event              string `json:"event"`
+				EventAwarenessName string `json:"eventAwarenessName"`
+				// Such as "2; yellow; Moderate".
+				AwarenessLevel string `json:"awareness_level"`
+			} `json:"properties"`
+			When struct {
+				Interval []time.Time `json:"interval"`
+			} `json:"when"`
+		} `json:"features"`
+	}
+	if err := weather.FetchJSON(context.Background(), mp.client,
+		metAlertsURL+"?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+
+	var alerts []metAlert
+	for _, f := range result.Features {
+		p := &f.Properties
+		name := p.EventAwarenessName
+		if name == "" {
+			name = p.Event
+		}
+		level := ""
+		if fields := strings.Split(p.AwarenessLevel, ";"); len(fields) >= 2 {
+			level = weather.Capitalize(strings.TrimSpace(fields[1]))
+		}
+
+		alert := metAlert{
+			ID:      p.ID,
+			Summary: strings.TrimSpace(level + " " + name),
+		}
+		if n := len(f.When.Interval); n != 0 {
+			alert.Expires = f.When.Interval[n-1]
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+func (mp *metAlertsProducer) produce() string {
+	alerts, err := mp.fetch()
+	if err != nil {
+		slog.Warn("Weather warnings failed", "error", err)
+		return ""
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	var summaries []string
+	for _, alert := range alerts {
+		if !alert.Expires.IsZero() && !alert.Expires.After(now) {
+			continue
+		}
+		summaries = append(summaries, alert.Summary)
+		if seen[alert.ID] = true; mp.seen[alert.ID] || !mp.Alert {
+			continue
+		}
+
+		duration := mp.AlertDuration
+		if !alert.Expires.IsZero() {
+			duration = min(duration, alert.Expires.Sub(now))
+		}
+		slog.Info("Weather warning issued", "summary", alert.Summary)
+		Takeover(Message{
+			Text:     "Weather warning\n" + alert.Summary,
+			Priority: 2,
+			Duration: duration,
+			Line:     -1,
+			Blink:    true,
+		})
+	}
+	mp.seen = seen
+	return strings.Join(summaries, "; ")
+}
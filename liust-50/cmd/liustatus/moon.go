@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// moonProducer shows the phase of the moon, such as "D 78%",
+// computed locally, and mirrored for the southern hemisphere.
+type moonProducer struct {
+	// Glyphs depict the eight phases, starting with the new moon,
+	// such as "·)▐D█C▌(" for international charsets.
+	Glyphs string `toml:"glyphs"`
+	// Percent adds how much of the moon is illuminated.
+	Percent bool `toml:"percent"`
+
+	southern bool
+}
+
+func init() {
+	registerProducer("moon", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		mp := &moonProducer{
+			Glyphs:   ".)]DOC[(",
+			Percent:  true,
+			southern: config.Location.Latitude < 0,
+		}
+		if err := config.DecodeOptions(region, mp); err != nil {
+			return nil, err
+		}
+		if n := utf8.RuneCountInString(mp.Glyphs); n != 8 {
+			return nil, fmt.Errorf("expected 8 glyphs, got %d", n)
+		}
+		return &periodicProducer{interval: time.Hour, produce: mp.produce}, nil
+	})
+}
+
+// moonPhase approximates the fraction of the synodic month that has passed
+// since the last new moon, and the illuminated fraction of the disc.
+func moonPhase(t time.Time) (phase, illumination float64) {
+	const synodicMonth = 29.530588853
+	reference := time.Date(2000, 1, 6, 18, 14, 0, 0, time.UTC)
+
+	days := t.Sub(reference).Hours() / 24
+	phase = math.Mod(days/synodicMonth, 1)
+	if phase < 0 {
+		phase++
+	}
+	return phase, (1 - math.Cos(2*math.Pi*phase)) / 2
+}
+
+func (mp *moonProducer) produce() string {
+	phase, illumination := moonPhase(time.Now())
+	index := int(math.Round(phase*8)) % 8
+	if mp.southern {
+		index = (8 - index) % 8
+	}
+
+	glyph := string([]rune(mp.Glyphs)[index])
+	if !mp.Percent {
+		return glyph
+	}
+	return fmt.Sprintf("%s %d%%", glyph, int(math.Round(illumination*100)))
+}
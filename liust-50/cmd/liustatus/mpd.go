@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mpdProducer shows what the Music Player Daemon is playing,
+// such as "> Artist - Title 1:23/4:56".
+type mpdProducer struct {
+	// Host is either a hostname, or an absolute path to a Unix socket.
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Password string `toml:"password"`
+	// Time adds elapsed and total time.
+	Time bool `toml:"time"`
+	// PlayingPrefix and PausedPrefix indicate the playback state.
+	PlayingPrefix string `toml:"playing_prefix"`
+	PausedPrefix  string `toml:"paused_prefix"`
+	// Retry is the delay before reconnecting.
+	Retry time.Duration `toml:"retry"`
+}
+
+func init() {
+	registerProducer("mpd", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		mp := &mpdProducer{
+			Host:          "localhost",
+			Port:          6600,
+			Time:          true,
+			PlayingPrefix: "> ",
+			PausedPrefix:  "|| ",
+			Retry:         10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, mp); err != nil {
+			return nil, err
+		}
+		if mp.Port <= 0 || mp.Port > 65535 {
+			return nil, fmt.Errorf("invalid port: %d", mp.Port)
+		}
+		if mp.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return mp, nil
+	})
+}
+
+// mpdConn is a client connection speaking the MPD protocol,
+// see https://mpd.readthedocs.io/en/latest/protocol.html
+type mpdConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func mpdDial(host string, port int) (*mpdConn, error) {
+	var conn net.Conn
+	var err error
+	if strings.HasPrefix(host, "/") {
+		conn, err = net.Dial("unix", host)
+	} else {
+		conn, err = net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mpdConn{conn: conn, reader: bufio.NewReader(conn)}
+	greeting, err := c.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		conn.Close()
+		return nil, errors.New("not an MPD server")
+	}
+	return c, nil
+}
+
+// mpdQuote quotes a command argument.
+func mpdQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// command sends a command, and returns the key-value pairs of the response.
+// Where keys repeat, the first value is kept.
+func (c *mpdConn) command(command string) (map[string]string, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", command); err != nil {
+		return nil, err
+	}
+
+	response := make(map[string]string)
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "OK" {
+			return response, nil
+		}
+		if strings.HasPrefix(line, "ACK ") {
+			return nil, fmt.Errorf("MPD: %s", strings.TrimPrefix(line, "ACK "))
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if _, seen := response[key]; ok && !seen {
+			response[key] = value
+		}
+	}
+}
+
+func (c *mpdConn) Close() error {
+	return c.conn.Close()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// mpdState is a snapshot of the player's state.
+type mpdState struct {
+	state    string // play, pause, or stop
+	song     string
+	elapsed  time.Duration
+	duration time.Duration
+	since    time.Time // when elapsed was current
+}
+
+func mpdParseSeconds(s string) time.Duration {
+	seconds, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (c *mpdConn) query() (*mpdState, error) {
+	status, err := c.command("status")
+	if err != nil {
+		return nil, err
+	}
+	song, err := c.command("currentsong")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mpdState{
+		state:    status["state"],
+		elapsed:  mpdParseSeconds(status["elapsed"]),
+		duration: mpdParseSeconds(status["duration"]),
+		since:    time.Now(),
+	}
+	switch {
+	case song["Title"] != "" && song["Artist"] != "":
+		s.song = song["Artist"] + " - " + song["Title"]
+	case song["Title"] != "":
+		s.song = song["Title"]
+	case song["Name"] != "":
+		s.song = song["Name"]
+	default:
+		s.song = path.Base(song["file"])
+	}
+	return s, nil
+}
+
+func mpdFormatTime(d time.Duration) string {
+	seconds := int(d / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d",
+			seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func (mp *mpdProducer) format(s *mpdState, now time.Time) string {
+	var prefix string
+	switch s.state {
+	case "play":
+		prefix = mp.PlayingPrefix
+	case "pause":
+		prefix = mp.PausedPrefix
+	default:
+		return ""
+	}
+
+	text := prefix + s.song
+	if mp.Time {
+		elapsed := s.elapsed
+		if s.state == "play" {
+			elapsed += now.Sub(s.since)
+		}
+		if s.duration > 0 {
+			elapsed = min(elapsed, s.duration)
+			text += " " + mpdFormatTime(elapsed) + "/" + mpdFormatTime(s.duration)
+		} else {
+			text += " " + mpdFormatTime(elapsed)
+		}
+	}
+	return text
+}
+
+func (mp *mpdProducer) watch(ctx context.Context, out chan<- string) error {
+	c, err := mpdDial(mp.Host, mp.Port)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	if mp.Password != "" {
+		if _, err := c.command("password " + mpdQuote(mp.Password)); err != nil {
+			return err
+		}
+	}
+
+	// MPD doesn't know about tempo, so the kaomoji just keeps a beat.
+	defer kaomojiMusic.Set(mp, false, 0)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		s, err := c.query()
+		if err != nil {
+			return err
+		}
+		kaomojiMusic.Set(mp, s.state == "play", 0)
+
+		// While idling, MPD doesn't accept any other commands.
+		idle := make(chan error, 1)
+		go func() {
+			_, err := c.command("idle player")
+			idle <- err
+		}()
+
+		var tick <-chan time.Time
+		if s.state == "play" && mp.Time {
+			tick = ticker.C
+		}
+	Idle:
+		for {
+			if !send(ctx, out, mp.format(s, time.Now())) {
+				return nil
+			}
+			select {
+			case <-tick:
+			case err := <-idle:
+				if err != nil {
+					return err
+				}
+				break Idle
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+func (mp *mpdProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := mp.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("MPD failed", "error", err)
+		}
+		sleep(ctx, mp.Retry)
+	}
+}
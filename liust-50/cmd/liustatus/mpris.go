@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// mprisProducer shows what MPRIS media players on the session bus
+// are playing, such as "> Artist - Title". The player that has most recently
+// started playing is preferred, then the one most recently paused.
+type mprisProducer struct {
+	// Players limit which players are considered, by their bus names
+	// without the org.mpris.MediaPlayer2 prefix, such as "mpv" or "spotify".
+	Players []string `toml:"players"`
+	// PlayingPrefix and PausedPrefix indicate the playback state.
+	PlayingPrefix string `toml:"playing_prefix"`
+	PausedPrefix  string `toml:"paused_prefix"`
+	// Retry is the delay before reconnecting to the bus.
+	Retry time.Duration `toml:"retry"`
+}
+
+const (
+	mprisPrefix = "org.mpris.MediaPlayer2."
+	mprisPath   = "/org/mpris/MediaPlayer2"
+	mprisPlayer = "org.mpris.MediaPlayer2.Player"
+)
+
+func init() {
+	registerProducer("mpris", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		mp := &mprisProducer{
+			PlayingPrefix: "> ",
+			PausedPrefix:  "|| ",
+			Retry:         10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, mp); err != nil {
+			return nil, err
+		}
+		if mp.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return mp, nil
+	})
+}
+
+// mprisState is what is known about a player.
+type mprisState struct {
+	status string // Playing, Paused, or Stopped
+	artist string
+	title  string
+	bpm    float64   // the tempo, if known
+	since  time.Time // of the last status change
+}
+
+// wanted tells whether a player's bus name passes the filter.
+func (mp *mprisProducer) wanted(name string) bool {
+	if !strings.HasPrefix(name, mprisPrefix) {
+		return false
+	}
+	if mp.Players == nil {
+		return true
+	}
+
+	// Players may append an instance suffix, such as ".instance1234".
+	player, _, _ := strings.Cut(strings.TrimPrefix(name, mprisPrefix), ".")
+	return slices.Contains(mp.Players, player)
+}
+
+// mprisFetch retrieves the state of a player.
+func mprisFetch(conn *dbus.Conn, owner string, old *mprisState) (
+	*mprisState, error) {
+	var props map[string]dbus.Variant
+	if err := conn.Object(owner, mprisPath).Call(
+		"org.freedesktop.DBus.Properties.GetAll", 0, mprisPlayer).
+		Store(&props); err != nil {
+		return nil, err
+	}
+
+	state := &mprisState{since: time.Now()}
+	state.status, _ = props["PlaybackStatus"].Value().(string)
+	if old != nil && old.status == state.status {
+		state.since = old.since
+	}
+
+	metadata, _ := props["Metadata"].Value().(map[string]dbus.Variant)
+	state.title, _ = metadata["xesam:title"].Value().(string)
+	artists, _ := metadata["xesam:artist"].Value().([]string)
+	state.artist = strings.Join(artists, ", ")
+	switch bpm := metadata["xesam:audioBPM"].Value().(type) {
+	case int32:
+		state.bpm = float64(bpm)
+	case int64:
+		state.bpm = float64(bpm)
+	case float64:
+		state.bpm = bpm
+	}
+	return state, nil
+}
+
+// best returns the most relevant player, if any.
+func (mp *mprisProducer) best(players map[string]*mprisState) *mprisState {
+	better := func(a, b *mprisState) bool {
+		if (a.status == "Playing") != (b.status == "Playing") {
+			return a.status == "Playing"
+		}
+		return a.since.After(b.since)
+	}
+
+	var best *mprisState
+	for _, state := range players {
+		if state.status != "Playing" && state.status != "Paused" {
+			continue
+		}
+		if best == nil || better(state, best) {
+			best = state
+		}
+	}
+	return best
+}
+
+// format describes the most relevant player.
+func (mp *mprisProducer) format(players map[string]*mprisState) string {
+	best := mp.best(players)
+	if best == nil {
+		return ""
+	}
+
+	text := best.title
+	if best.artist != "" {
+		text = best.artist + " - " + text
+	}
+	if best.status == "Playing" {
+		return mp.PlayingPrefix + text
+	}
+	return mp.PausedPrefix + text
+}
+
+func (mp *mprisProducer) watch(ctx context.Context, out chan<- string) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(mprisPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	); err != nil {
+		return err
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchSender("org.freedesktop.DBus"),
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg0Namespace(strings.TrimSuffix(mprisPrefix, ".")),
+	); err != nil {
+		return err
+	}
+
+	// Players are tracked by their unique names, which signals come from.
+	// They might not be ready yet when they appear on the bus.
+	owners := make(map[string]bool)
+	players := make(map[string]*mprisState)
+	update := func(owner string) {
+		owners[owner] = true
+		state, err := mprisFetch(conn, owner, players[owner])
+		if err != nil {
+			slog.Debug("MPRIS player unavailable", "owner", owner, "error", err)
+			delete(players, owner)
+		} else {
+			players[owner] = state
+		}
+	}
+
+	var names []string
+	if err := conn.BusObject().Call(
+		"org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !mp.wanted(name) {
+			continue
+		}
+		var owner string
+		if err := conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner",
+			0, name).Store(&owner); err == nil {
+			update(owner)
+		}
+	}
+
+	// Let the kaomoji dance to whatever is playing.
+	defer kaomojiMusic.Set(mp, false, 0)
+	dance := func() {
+		best := mp.best(players)
+		if best != nil && best.status == "Playing" {
+			kaomojiMusic.Set(mp, true, best.bpm)
+		} else {
+			kaomojiMusic.Set(mp, false, 0)
+		}
+	}
+
+	dance()
+	last := mp.format(players)
+	if !send(ctx, out, last) {
+		return nil
+	}
+	for signal := range signals {
+		switch signal.Name {
+		case "org.freedesktop.DBus.NameOwnerChanged":
+			var name, oldOwner, newOwner string
+			if dbus.Store(signal.Body,
+				&name, &oldOwner, &newOwner) != nil || !mp.wanted(name) {
+				continue
+			}
+			delete(owners, oldOwner)
+			delete(players, oldOwner)
+			if newOwner != "" {
+				update(newOwner)
+			}
+		case "org.freedesktop.DBus.Properties.PropertiesChanged":
+			if owners[signal.Sender] {
+				update(signal.Sender)
+			}
+		}
+
+		dance()
+		if text := mp.format(players); text != last {
+			if last = text; !send(ctx, out, text) {
+				return nil
+			}
+		}
+	}
+	return errors.New("disconnected from the session bus")
+}
+
+func (mp *mprisProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := mp.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("MPRIS failed", "error", err)
+		}
+		sleep(ctx, mp.Retry)
+	}
+}
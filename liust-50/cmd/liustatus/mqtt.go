@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// mqttProducer shows messages of subscribed MQTT topics, rendered through
+// templates, and announces its availability through a retained topic,
+// so that home automation systems may both feed and watch the display.
+type mqttProducer struct {
+	Host string `toml:"host"`
+	// Port defaults to 1883, or to 8883 with TLS.
+	Port     int    `toml:"port"`
+	TLS      bool   `toml:"tls"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// ClientID defaults to one derived from the hostname.
+	ClientID      string             `toml:"client_id"`
+	Subscriptions []mqttSubscription `toml:"subscriptions"`
+	// AvailabilityTopic receives "online", or "offline" once disconnected,
+	// or nothing if it is empty.
+	AvailabilityTopic string `toml:"availability_topic"`
+	// Retry is the delay before reconnecting.
+	Retry time.Duration `toml:"retry"`
+}
+
+type mqttSubscription struct {
+	// Topic is a topic filter, which may contain the + and # wildcards.
+	Topic string `toml:"topic"`
+	// Template is a Go text/template, given the Topic, the Payload,
+	// and the payload decoded as JSON, if possible, such as
+	// "{{printf \"%.1f\" .JSON.temperature}}C". It defaults to the payload.
+	Template string `toml:"template"`
+
+	template *template.Template
+}
+
+// mqttMessage is what subscription templates are executed with.
+type mqttMessage struct {
+	Topic   string
+	Payload string
+	JSON    any
+}
+
+func init() {
+	registerProducer("mqtt", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		hostname, _ := os.Hostname()
+		mp := &mqttProducer{
+			Host:              "localhost",
+			ClientID:          "liustatus-" + hostname,
+			AvailabilityTopic: "liustatus/" + hostname + "/availability",
+			Retry:             10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, mp); err != nil {
+			return nil, err
+		}
+		if mp.Port == 0 && mp.TLS {
+			mp.Port = 8883
+		} else if mp.Port == 0 {
+			mp.Port = 1883
+		}
+		if len(mp.Subscriptions) == 0 {
+			return nil, errors.New("no subscriptions specified")
+		}
+		for i := range mp.Subscriptions {
+			s := &mp.Subscriptions[i]
+			if s.Topic == "" {
+				return nil, errors.New("subscriptions need a topic")
+			}
+			if s.Template == "" {
+				s.Template = "{{.Payload}}"
+			}
+			var err error
+			if s.template, err = template.New(s.Topic).Parse(s.Template); err != nil {
+				return nil, err
+			}
+		}
+		if mp.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return mp, nil
+	})
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// MQTT 3.1.1 control packet types, see
+// https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/mqtt-v3.1.1.html
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+// mqttKeepAlive is how often the server expects to hear from clients.
+const mqttKeepAlive = time.Minute
+
+// mqttConn is a minimal MQTT 3.1.1 client connection,
+// only ever subscribing and publishing with QoS 0.
+type mqttConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex // serializes writes
+}
+
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func (c *mqttConn) write(kind, flags byte, body []byte) error {
+	packet := []byte{kind<<4 | flags}
+	for n := len(body); ; {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+func (c *mqttConn) read() (kind, flags byte, body []byte, err error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	length := 0
+	for shift := 0; ; shift += 7 {
+		if shift > 21 {
+			return 0, 0, nil, errors.New("malformed packet length")
+		}
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0xf, body, nil
+}
+
+func mqttDial(mp *mqttProducer) (*mqttConn, error) {
+	address := net.JoinHostPort(mp.Host, strconv.Itoa(mp.Port))
+	dialer := &net.Dialer{Timeout: mqttKeepAlive}
+
+	var conn net.Conn
+	var err error
+	if mp.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address,
+			&tls.Config{ServerName: mp.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mqttConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.connect(mp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mqttConn) connect(mp *mqttProducer) error {
+	const cleanSession = 0x02
+	flags := byte(cleanSession)
+	payload := mqttString(mp.ClientID)
+	if mp.AvailabilityTopic != "" {
+		const willFlag, willRetain = 0x04, 0x20
+		flags |= willFlag | willRetain
+		payload = append(payload, mqttString(mp.AvailabilityTopic)...)
+		payload = append(payload, mqttString("offline")...)
+	}
+	if mp.Username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(mp.Username)...)
+	}
+	if mp.Password != "" {
+		flags |= 0x40
+		payload = append(payload, mqttString(mp.Password)...)
+	}
+
+	const protocolLevel = 4
+	body := append(mqttString("MQTT"), protocolLevel, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	body = append(body, payload...)
+
+	c.conn.SetDeadline(time.Now().Add(mqttKeepAlive))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.write(mqttConnect, 0, body); err != nil {
+		return err
+	}
+	kind, _, reply, err := c.read()
+	if err != nil {
+		return err
+	}
+	if kind != mqttConnack || len(reply) != 2 {
+		return errors.New("unexpected reply to CONNECT")
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("connection refused with code %d", reply[1])
+	}
+	return nil
+}
+
+func (c *mqttConn) subscribe(topics []string) error {
+	body := binary.BigEndian.AppendUint16(nil, 1)
+	for _, topic := range topics {
+		body = append(append(body, mqttString(topic)...), 0)
+	}
+	// SUBSCRIBE has reserved flags that must be set this way.
+	return c.write(mqttSubscribe, 0x2, body)
+}
+
+func (c *mqttConn) publish(topic, payload string, retain bool) error {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	return c.write(mqttPublish, flags, append(mqttString(topic), payload...))
+}
+
+func (c *mqttConn) Close() error {
+	return c.conn.Close()
+}
+
+// mqttParsePublish extracts the topic and the payload of a PUBLISH packet.
+func mqttParsePublish(flags byte, body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, errors.New("malformed PUBLISH")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil, errors.New("malformed PUBLISH")
+	}
+	topic, payload := string(body[2:2+n]), body[2+n:]
+	if qos := flags >> 1 & 3; qos > 0 {
+		// Servers shouldn't exceed the QoS subscribed with, but skip
+		// the packet identifier anyway.
+		if len(payload) < 2 {
+			return "", nil, errors.New("malformed PUBLISH")
+		}
+		payload = payload[2:]
+	}
+	return topic, payload, nil
+}
+
+// mqttMatch tells whether a topic matches a topic filter.
+func mqttMatch(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(topicLevels):
+			return false
+		case level != "+" && level != topicLevels[i]:
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+func (mp *mqttProducer) render(s *mqttSubscription, topic string,
+	payload []byte) string {
+	m := mqttMessage{Topic: topic, Payload: string(payload)}
+	_ = json.Unmarshal(payload, &m.JSON)
+
+	var b strings.Builder
+	if err := s.template.Execute(&b, m); err != nil {
+		slog.Warn("MQTT template failed", "topic", topic, "error", err)
+		return ""
+	}
+	return b.String()
+}
+
+func (mp *mqttProducer) watch(ctx context.Context, out chan<- string) error {
+	c, err := mqttDial(mp)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		// Disconnecting cleanly discards the will, so it is done manually.
+		if mp.AvailabilityTopic != "" {
+			c.publish(mp.AvailabilityTopic, "offline", true)
+		}
+		c.write(mqttDisconnect, 0, nil)
+		c.Close()
+	})
+	defer stop()
+
+	var topics []string
+	for _, s := range mp.Subscriptions {
+		topics = append(topics, s.Topic)
+	}
+	if err := c.subscribe(topics); err != nil {
+		return err
+	}
+	if mp.AvailabilityTopic != "" {
+		if err := c.publish(mp.AvailabilityTopic, "online", true); err != nil {
+			return err
+		}
+	}
+
+	pingCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(mqttKeepAlive / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.write(mqttPingreq, 0, nil)
+			case <-pingCtx.Done():
+				return
+			}
+		}
+	}()
+
+	values := make([]string, len(mp.Subscriptions))
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(mqttKeepAlive))
+		kind, flags, body, err := c.read()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case mqttSuback:
+			for _, code := range body[min(len(body), 2):] {
+				if code == 0x80 {
+					return errors.New("subscription refused")
+				}
+			}
+			continue
+		case mqttPublish:
+		default:
+			continue
+		}
+
+		topic, payload, err := mqttParsePublish(flags, body)
+		if err != nil {
+			return err
+		}
+		for i := range mp.Subscriptions {
+			s := &mp.Subscriptions[i]
+			if mqttMatch(s.Topic, topic) {
+				values[i] = mp.render(s, topic, payload)
+			}
+		}
+
+		var fields []string
+		for _, value := range values {
+			if value != "" {
+				fields = append(fields, value)
+			}
+		}
+		if !send(ctx, out, strings.Join(fields, " ")) {
+			return nil
+		}
+	}
+}
+
+func (mp *mqttProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := mp.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("MQTT failed", "error", err)
+		}
+		sleep(ctx, mp.Retry)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestMQTTMatch(t *testing.T) {
+	for _, test := range []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"home/kitchen/temp", "home/kitchen/temp", true},
+		{"home/kitchen/temp", "home/kitchen/humidity", false},
+		{"home/+/temp", "home/kitchen/temp", true},
+		{"home/+/temp", "home/kitchen/fridge/temp", false},
+		{"home/+", "home", false},
+		{"home/#", "home/kitchen/temp", true},
+		{"home/#", "home", true},
+		{"#", "home/kitchen", true},
+		{"home/kitchen", "home/kitchen/temp", false},
+		{"home/kitchen/temp", "home/kitchen", false},
+		{"+/+", "/home", true},
+		{"home/+", "home/", true},
+	} {
+		if match := mqttMatch(test.filter, test.topic); match != test.match {
+			t.Errorf("%q against %q: got %t, expected %t",
+				test.topic, test.filter, match, test.match)
+		}
+	}
+}
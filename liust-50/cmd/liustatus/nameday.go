@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// NamedayConfig selects which yearly occasions to show for each day.
+type NamedayConfig struct {
+	// Country selects embedded public holidays, such as "cz".
+	Country string `toml:"country"`
+	// Names is a file, or an http(s) URL, with lines such as "01-02 Karina",
+	// listing name days, or any other yearly occasions.
+	Names string `toml:"names"`
+}
+
+func (n *NamedayConfig) enabled() bool {
+	return n.Country != "" || n.Names != ""
+}
+
+func (n *NamedayConfig) validate() error {
+	if _, ok := holidayCalendars[n.Country]; n.Country != "" && !ok {
+		return fmt.Errorf("unsupported holiday country: %q", n.Country)
+	}
+	return nil
+}
+
+// namedayProducer shows today's public holidays and name days,
+// such as "Easter Monday, Hugo".
+type namedayProducer struct {
+	NamedayConfig
+}
+
+func init() {
+	registerProducer("nameday", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		np := &namedayProducer{}
+		if err := config.DecodeOptions(region, np); err != nil {
+			return nil, err
+		}
+		if !np.enabled() {
+			return nil, errors.New("no country or names specified")
+		}
+		if err := np.validate(); err != nil {
+			return nil, err
+		}
+		return np, nil
+	})
+}
+
+func (np *namedayProducer) Run(ctx context.Context, out chan<- string) {
+	watchNamedays(ctx, &np.NamedayConfig, out)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// holiday is a public holiday, either on a fixed date,
+// or a number of days after Easter Sunday, if Month is zero.
+type holiday struct {
+	Month time.Month
+	Day   int
+	Name  string
+}
+
+// holidayCalendars list nationwide public holidays. Names are in English,
+// as display charsets lack most letters that local names would need.
+var holidayCalendars = map[string][]holiday{
+	"cz": {
+		{1, 1, "New Year's Day"}, {0, -2, "Good Friday"},
+		{0, 1, "Easter Monday"}, {5, 1, "Labour Day"},
+		{5, 8, "Liberation Day"}, {7, 5, "Cyril and Methodius"},
+		{7, 6, "Jan Hus Day"}, {9, 28, "Statehood Day"},
+		{10, 28, "Independence Day"}, {11, 17, "Freedom Day"},
+		{12, 24, "Christmas Eve"}, {12, 25, "Christmas Day"},
+		{12, 26, "St. Stephen's Day"},
+	},
+	"sk": {
+		{1, 1, "Republic Day"}, {1, 6, "Epiphany"},
+		{0, -2, "Good Friday"}, {0, 1, "Easter Monday"},
+		{5, 1, "Labour Day"}, {5, 8, "Victory Day"},
+		{7, 5, "Cyril and Methodius"}, {8, 29, "Uprising Day"},
+		{9, 15, "Our Lady of Sorrows"}, {11, 1, "All Saints' Day"},
+		{11, 17, "Freedom Day"}, {12, 24, "Christmas Eve"},
+		{12, 25, "Christmas Day"}, {12, 26, "St. Stephen's Day"},
+	},
+	"de": {
+		{1, 1, "New Year's Day"}, {0, -2, "Good Friday"},
+		{0, 1, "Easter Monday"}, {5, 1, "Labour Day"},
+		{0, 39, "Ascension Day"}, {0, 50, "Whit Monday"},
+		{10, 3, "Unity Day"}, {12, 25, "Christmas Day"},
+		{12, 26, "St. Stephen's Day"},
+	},
+	"at": {
+		{1, 1, "New Year's Day"}, {1, 6, "Epiphany"},
+		{0, 1, "Easter Monday"}, {5, 1, "Labour Day"},
+		{0, 39, "Ascension Day"}, {0, 50, "Whit Monday"},
+		{0, 60, "Corpus Christi"}, {8, 15, "Assumption Day"},
+		{10, 26, "National Day"}, {11, 1, "All Saints' Day"},
+		{12, 8, "Immaculate Conception"}, {12, 25, "Christmas Day"},
+		{12, 26, "St. Stephen's Day"},
+	},
+	"pl": {
+		{1, 1, "New Year's Day"}, {1, 6, "Epiphany"},
+		{0, 0, "Easter Sunday"}, {0, 1, "Easter Monday"},
+		{5, 1, "Labour Day"}, {5, 3, "Constitution Day"},
+		{0, 49, "Pentecost"}, {0, 60, "Corpus Christi"},
+		{8, 15, "Assumption Day"}, {11, 1, "All Saints' Day"},
+		{11, 11, "Independence Day"}, {12, 24, "Christmas Eve"},
+		{12, 25, "Christmas Day"}, {12, 26, "St. Stephen's Day"},
+	},
+}
+
+// easter returns the date of Easter Sunday in the Gregorian calendar,
+// using the anonymous algorithm.
+func easter(year int) time.Time {
+	a, b, c := year%19, year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// holidays returns names of the country's holidays on the given day.
+func holidays(country string, year int, month time.Month, day int) []string {
+	var names []string
+	sunday := easter(year)
+	for _, h := range holidayCalendars[country] {
+		if h.Month == 0 {
+			date := sunday.AddDate(0, 0, h.Day)
+			if date.Month() == month && date.Day() == day {
+				names = append(names, h.Name)
+			}
+		} else if h.Month == month && h.Day == day {
+			names = append(names, h.Name)
+		}
+	}
+	return names
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// parseNamedays reads lines in the "MM-DD text" format,
+// ignoring empty ones, and comments starting with #.
+func parseNamedays(r io.Reader) (map[string][]string, error) {
+	names := make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		date, text, _ := strings.Cut(line, " ")
+		if _, err := time.Parse("01-02", date); err != nil {
+			return nil, fmt.Errorf("invalid name day line: %q", line)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			names[date] = append(names[date], text)
+		}
+	}
+	return names, scanner.Err()
+}
+
+// loadNamedays retrieves name days from a file or an http(s) URL.
+func loadNamedays(ctx context.Context, source string) (
+	map[string][]string, error) {
+	if !strings.HasPrefix(source, "http://") &&
+		!strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseNamedays(f)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return parseNamedays(resp.Body)
+}
+
+// watchNamedays sends today's occasions, separated by commas,
+// and then again each time the day changes.
+// Name days are reloaded daily, so that their source may be edited.
+func watchNamedays(ctx context.Context, nc *NamedayConfig, out chan<- string) {
+	for {
+		now := time.Now()
+		year, month, day := now.Date()
+		entries := holidays(nc.Country, year, month, day)
+		if nc.Names != "" {
+			names, err := loadNamedays(ctx, nc.Names)
+			if err != nil {
+				slog.Warn("Name days failed", "source", nc.Names, "error", err)
+			}
+			entries = append(entries, names[now.Format("01-02")]...)
+		}
+		if !send(ctx, out, strings.Join(entries, ", ")) {
+			return
+		}
+
+		midnight := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+		if !sleep(ctx, midnight.Sub(now)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+)
+
+// networkProducer shows receive and transmit rates of network interfaces,
+// such as "eth0↓1.2M↑ 34K", in bytes per second.
+type networkProducer struct {
+	// Interfaces default to all but the loopback, in the kernel's order.
+	Interfaces []string      `toml:"interfaces"`
+	Interval   time.Duration `toml:"interval"`
+	// RXLabel and TXLabel precede the rates. They default to arrows,
+	// or to "v" and "^" where the display's character set lacks them.
+	RXLabel string `toml:"rx_label"`
+	TXLabel string `toml:"tx_label"`
+
+	last     map[string][2]uint64
+	lastTime time.Time
+}
+
+func init() {
+	registerProducer("network", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		np := &networkProducer{Interval: 2 * time.Second}
+		np.RXLabel, np.TXLabel = networkLabels(region.charset)
+		if err := config.DecodeOptions(region, np); err != nil {
+			return nil, err
+		}
+		if np.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: np.Interval, produce: np.produce}, nil
+	})
+}
+
+// networkLabels returns default labels that the charset has.
+func networkLabels(charsetID uint8) (rx, tx string) {
+	_, hasDown := charset.ResolveRune('↓', charsetID)
+	_, hasUp := charset.ResolveRune('↑', charsetID)
+	if hasDown && hasUp {
+		return "↓", "↑"
+	}
+	return "v", "^"
+}
+
+// formatSize formats an amount of bytes into four characters,
+// using decimal units, such as " 999", "1.2K", " 34K", or "120M".
+func formatSize(n float64) string {
+	units := []string{"", "K", "M", "G", "T", "P"}
+	for _, unit := range units[:len(units)-1] {
+		switch {
+		case unit == "" && n < 999.5:
+			return fmt.Sprintf("%4.0f", n)
+		case unit != "" && n < 9.95:
+			return fmt.Sprintf("%3.1f%s", n, unit)
+		case unit != "" && n < 999.5:
+			return fmt.Sprintf("%3.0f%s", n, unit)
+		}
+		n /= 1000
+	}
+	return fmt.Sprintf("%3.0f%s", min(n, 999), units[len(units)-1])
+}
+
+// readNetDev returns received and transmitted bytes of all interfaces,
+// and their names, in order.
+func readNetDev() (map[string][2]uint64, []string, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	counters := make(map[string][2]uint64)
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, values, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(values)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err1 := strconv.ParseUint(fields[0], 10, 64)
+		tx, err2 := strconv.ParseUint(fields[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		name = strings.TrimSpace(name)
+		counters[name] = [2]uint64{rx, tx}
+		names = append(names, name)
+	}
+	return counters, names, scanner.Err()
+}
+
+func (np *networkProducer) produce() string {
+	now := time.Now()
+	counters, names, err := readNetDev()
+	if err != nil {
+		return "?"
+	}
+	defer func() { np.last, np.lastTime = counters, now }()
+
+	if np.Interfaces != nil {
+		names = np.Interfaces
+	} else {
+		names = slices.DeleteFunc(names, func(name string) bool {
+			return name == "lo"
+		})
+	}
+
+	elapsed := now.Sub(np.lastTime).Seconds()
+	rate := func(current, last uint64) string {
+		if np.last == nil || current < last || elapsed <= 0 {
+			return "   -"
+		}
+		return formatSize(float64(current-last) / elapsed)
+	}
+
+	var fields []string
+	for _, name := range names {
+		c, ok := counters[name]
+		if !ok {
+			fields = append(fields, name+" -")
+			continue
+		}
+		l, ok := np.last[name]
+		if !ok {
+			l = c
+		}
+		fields = append(fields, name+np.RXLabel+rate(c[0], l[0])+
+			np.TXLabel+rate(c[1], l[1]))
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestNetworkLabels(t *testing.T) {
+	for _, test := range []struct {
+		charset uint8
+		rx, tx  string
+	}{
+		{0x63, "↓", "↑"},
+		{0, "v", "^"},
+		{2, "v", "^"},
+	} {
+		if rx, tx := networkLabels(test.charset); rx != test.rx || tx != test.tx {
+			t.Errorf("charset %#x: got %q %q, expected %q %q",
+				test.charset, rx, tx, test.rx, test.tx)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for _, test := range []struct {
+		n        float64
+		expected string
+	}{
+		{0, "   0"},
+		{999, " 999"},
+		{999.5, "1.0K"},
+		{1234, "1.2K"},
+		{34_000, " 34K"},
+		{120e6, "120M"},
+		{5e18, "999P"},
+	} {
+		if s := formatSize(test.n); s != test.expected {
+			t.Errorf("%g: got %q, expected %q", test.n, s, test.expected)
+		}
+	}
+}
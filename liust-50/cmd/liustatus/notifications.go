@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsName = "org.freedesktop.Notifications"
+	notificationsPath = "/org/freedesktop/Notifications"
+)
+
+// notificationBridge shows desktop notifications as takeovers,
+// see the Desktop Notifications Specification. It either becomes
+// the notification server, or when another one is already running,
+// monitors calls made to it.
+type notificationBridge struct {
+	mu     sync.Mutex
+	config NotificationsConfig
+	cancel context.CancelFunc
+}
+
+var notifications = &notificationBridge{}
+
+// Configure starts or stops the bridge, as needed.
+// Other settings take effect immediately.
+func (nb *notificationBridge) Configure(ctx context.Context,
+	config NotificationsConfig) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+
+	nb.config = config
+	if !config.Enabled && nb.cancel != nil {
+		nb.cancel()
+		nb.cancel = nil
+	} else if config.Enabled && nb.cancel == nil {
+		var bridgeCtx context.Context
+		bridgeCtx, nb.cancel = context.WithCancel(ctx)
+		go nb.run(bridgeCtx)
+	}
+}
+
+var notificationTagRE = regexp.MustCompile(`<[^>]*>`)
+
+// show takes over the display, returning for how long, or zero if it didn't.
+func (nb *notificationBridge) show(app, summary, body string,
+	urgency byte) time.Duration {
+	nb.mu.Lock()
+	config := nb.config
+	nb.mu.Unlock()
+
+	if config.Apps != nil && !slices.Contains(config.Apps, app) ||
+		slices.Contains(config.IgnoreApps, app) {
+		return 0
+	}
+
+	duration, blink := config.Normal, false
+	switch urgency {
+	case 0:
+		duration = config.Low
+	case 2:
+		duration, blink = config.Critical, true
+	}
+	if duration <= 0 {
+		return 0
+	}
+
+	// Monitored notifications may contain markup.
+	text := summary
+	if body = html.UnescapeString(
+		notificationTagRE.ReplaceAllString(body, "")); body != "" {
+		text += "\n" + body
+	}
+	message := Message{
+		Text:     text,
+		Priority: int(urgency),
+		Duration: duration,
+		Line:     -1,
+		Blink:    blink,
+		Tag:      "notification:" + app,
+	}
+	if message.Validate() != nil {
+		return 0
+	}
+	slog.Debug("Notification", "app", app, "summary", summary)
+	Takeover(message)
+	return duration
+}
+
+func (nb *notificationBridge) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := nb.serve(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Notifications failed", "error", err)
+		}
+		sleep(ctx, 10*time.Second)
+	}
+}
+
+func (nb *notificationBridge) serve(ctx context.Context) error {
+	conn, err := dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reply, err := conn.RequestName(notificationsName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return nb.monitor(ctx, conn)
+	}
+
+	server := &notificationServer{bridge: nb, conn: conn}
+	if err := conn.Export(server, notificationsPath,
+		notificationsName); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-conn.Context().Done():
+		return errors.New("disconnected from the bus")
+	}
+}
+
+// monitor eavesdrops on calls made to another notification server.
+func (nb *notificationBridge) monitor(ctx context.Context,
+	conn *dbus.Conn) error {
+	messages := make(chan *dbus.Message, 16)
+	conn.Eavesdrop(messages)
+
+	// The reply would only end up being eavesdropped on.
+	rule := "type='method_call',interface='" + notificationsName +
+		"',member='Notify'"
+	conn.BusObject().Go("org.freedesktop.DBus.Monitoring.BecomeMonitor",
+		dbus.FlagNoReplyExpected, nil, []string{rule}, uint32(0))
+
+	for {
+		var msg *dbus.Message
+		select {
+		case msg = <-messages:
+		case <-ctx.Done():
+			return nil
+		}
+		if msg == nil {
+			return errors.New("disconnected from the bus")
+		}
+
+		switch {
+		case msg.Type == dbus.TypeError:
+			var text string
+			if len(msg.Body) > 0 {
+				text, _ = msg.Body[0].(string)
+			}
+			return errors.New("cannot monitor the bus: " + text)
+		case msg.Type != dbus.TypeMethodCall:
+			continue
+		}
+
+		var (
+			app, icon, summary, body string
+			replaces                 uint32
+			actions                  []string
+			hints                    map[string]dbus.Variant
+			timeout                  int32
+		)
+		if dbus.Store(msg.Body, &app, &replaces, &icon, &summary, &body,
+			&actions, &hints, &timeout) == nil {
+			nb.show(app, summary, body, notificationUrgency(hints))
+		}
+	}
+}
+
+func notificationUrgency(hints map[string]dbus.Variant) byte {
+	if urgency, ok := hints["urgency"].Value().(byte); ok {
+		return urgency
+	}
+	return 1
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// notificationServer implements the org.freedesktop.Notifications interface.
+type notificationServer struct {
+	bridge *notificationBridge
+	conn   *dbus.Conn
+
+	mu     sync.Mutex
+	lastID uint32
+}
+
+func (ns *notificationServer) Notify(app string, replaces uint32, icon string,
+	summary string, body string, actions []string,
+	hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	ns.mu.Lock()
+	id := replaces
+	if id == 0 {
+		ns.lastID++
+		id = ns.lastID
+	}
+	ns.mu.Unlock()
+
+	// Notifications that haven't been shown are closed right away.
+	duration := ns.bridge.show(app, summary, body, notificationUrgency(hints))
+	time.AfterFunc(duration, func() {
+		const reasonExpired = 1
+		ns.conn.Emit(notificationsPath, notificationsName+".NotificationClosed",
+			id, uint32(reasonExpired))
+	})
+	return id, nil
+}
+
+func (ns *notificationServer) CloseNotification(id uint32) *dbus.Error {
+	const reasonClosed = 3
+	ns.conn.Emit(notificationsPath, notificationsName+".NotificationClosed",
+		id, uint32(reasonClosed))
+	return nil
+}
+
+func (ns *notificationServer) GetCapabilities() ([]string, *dbus.Error) {
+	return []string{"body"}, nil
+}
+
+func (ns *notificationServer) GetServerInformation() (
+	name, vendor, version, specVersion string, err *dbus.Error) {
+	return "liustatus", "janouch.name", "1.0", "1.2", nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hosts are considered down after this many unanswered pings in a row,
+// so that a single lost packet doesn't raise an alarm.
+const pingDownAfter = 3
+
+// pingProducer shows round-trip times of hosts, such as "nas 0.4ms gw DOWN",
+// and alerts when any of them becomes unreachable. It relies on ping(8),
+// which unlike raw sockets doesn't need privileges.
+type pingProducer struct {
+	Hosts []pingHost `toml:"hosts"`
+	// Timeout limits how long to wait for each reply.
+	Timeout  time.Duration `toml:"timeout"`
+	Interval time.Duration `toml:"interval"`
+	// DownLabel replaces the round-trip time of unreachable hosts.
+	DownLabel string `toml:"down_label"`
+	// Alert takes over the display when a host goes down.
+	Alert bool `toml:"alert"`
+	SparklineOptions
+
+	failures map[string]int
+}
+
+type pingHost struct {
+	Host string `toml:"host"`
+	// Label defaults to the host.
+	Label string `toml:"label"`
+}
+
+func init() {
+	registerProducer("ping", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		pp := &pingProducer{
+			Timeout:          2 * time.Second,
+			Interval:         10 * time.Second,
+			DownLabel:        "DOWN",
+			Alert:            true,
+			SparklineOptions: newSparklineOptions(region),
+			failures:         make(map[string]int),
+		}
+		if err := config.DecodeOptions(region, pp); err != nil {
+			return nil, err
+		}
+		if len(pp.Hosts) == 0 {
+			return nil, errors.New("no hosts specified")
+		}
+		for i := range pp.Hosts {
+			if pp.Hosts[i].Host == "" {
+				return nil, errors.New("hosts must be named")
+			}
+			if pp.Hosts[i].Label == "" {
+				pp.Hosts[i].Label = pp.Hosts[i].Host
+			}
+		}
+		if pp.Timeout < time.Second || pp.Interval <= pp.Timeout {
+			return nil, errors.New(
+				"the timeout must be at least a second, and the interval longer")
+		}
+		if err := pp.validate(); err != nil {
+			return nil, err
+		}
+		return &periodicProducer{interval: pp.Interval, produce: pp.produce}, nil
+	})
+}
+
+var pingTimeRE = regexp.MustCompile(`time[=<]([0-9.]+) ?ms`)
+
+// ping returns the round-trip time to a host, or false if it doesn't answer.
+func (pp *pingProducer) ping(host string) (time.Duration, bool) {
+	output, err := exec.Command("ping", "-n", "-c", "1",
+		"-W", strconv.Itoa(int(pp.Timeout/time.Second)), "--", host).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			slog.Warn("Ping failed", "error", err)
+		}
+		return 0, false
+	}
+
+	m := pingTimeRE.FindSubmatch(output)
+	if m == nil {
+		return 0, false
+	}
+	ms, _ := strconv.ParseFloat(string(m[1]), 64)
+	return time.Duration(ms * float64(time.Millisecond)), true
+}
+
+func formatLatency(d time.Duration) string {
+	ms := float64(d) / float64(time.Millisecond)
+	if ms < 10 {
+		return fmt.Sprintf("%.1fms", ms)
+	}
+	return fmt.Sprintf("%.0fms", ms)
+}
+
+func (pp *pingProducer) produce() string {
+	type result struct {
+		rtt time.Duration
+		ok  bool
+	}
+
+	results := make([]result, len(pp.Hosts))
+	var wg sync.WaitGroup
+	for i, host := range pp.Hosts {
+		wg.Go(func() {
+			results[i].rtt, results[i].ok = pp.ping(host.Host)
+		})
+	}
+	wg.Wait()
+
+	var fields []string
+	for i, host := range pp.Hosts {
+		r := results[i]
+		text, ms := "?", math.NaN()
+		if r.ok {
+			pp.failures[host.Host] = 0
+			text, ms = formatLatency(r.rtt), float64(r.rtt)/float64(time.Millisecond)
+		} else if pp.failures[host.Host]++; pp.failures[host.Host] >= pingDownAfter {
+			text = pp.DownLabel
+		}
+		if pp.failures[host.Host] == pingDownAfter && pp.Alert {
+			slog.Info("Host down", "host", host.Host)
+			Takeover(Message{
+				Text:     host.Label + " is down",
+				Priority: 1,
+				Duration: 10 * time.Second,
+				Line:     -1,
+				Blink:    true,
+			})
+		}
+		if pp.Sparkline {
+			text = pp.sparkline(host.Host, ms, 0, math.NaN())
+		}
+		fields = append(fields, host.Label+" "+text)
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// The plugin protocol consists of JSON objects, one per line.
+// Plugins send pluginMessage objects, and receive Event objects,
+// the first of which is always a "hello" event, which informs them
+// about the protocol version, and the width of their region.
+const pluginProtocolVersion = 1
+
+type pluginMessage struct {
+	Text string `json:"text"`
+}
+
+// pluginProducer talks to long-running out-of-process plugins,
+// either spawned as child processes communicating through standard streams,
+// or listening on a Unix socket.
+type pluginProducer struct {
+	Command string `toml:"command"`
+	Socket  string `toml:"socket"`
+	// Retry is the delay before restarting or reconnecting.
+	Retry time.Duration `toml:"retry"`
+
+	width  int
+	events <-chan Event
+}
+
+func init() {
+	registerProducer("plugin", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		pp := &pluginProducer{Retry: 10 * time.Second, width: region.Width}
+		if err := config.DecodeOptions(region, pp); err != nil {
+			return nil, err
+		}
+		if (pp.Command == "") == (pp.Socket == "") {
+			return nil, errors.New("specify either a command or a socket")
+		}
+		if pp.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return pp, nil
+	})
+}
+
+func (pp *pluginProducer) serve(
+	ctx context.Context, r io.Reader, w io.Writer, out chan<- string) error {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(Event{Name: "hello", Args: map[string]string{
+		"version": strconv.Itoa(pluginProtocolVersion),
+		"width":   strconv.Itoa(pp.width),
+	}}); err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			var msg pluginMessage
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				slog.Warn("Invalid plugin message", "error", err)
+			} else if !send(ctx, out, msg.Text) {
+				break
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			errc <- err
+		} else {
+			errc <- io.EOF
+		}
+	}()
+
+	for {
+		select {
+		case event := <-pp.events:
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (pp *pluginProducer) runCommand(
+	ctx context.Context, out chan<- string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", pp.Command)
+	cmd.Stderr = stderrLogger("plugin", pp.Command)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	err = pp.serve(ctx, stdout, stdin, out)
+	cancel()
+	if waitErr := cmd.Wait(); err == io.EOF {
+		err = waitErr
+	}
+	return err
+}
+
+func (pp *pluginProducer) runSocket(
+	ctx context.Context, out chan<- string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", pp.Socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Closing the connection unblocks the reader.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	return pp.serve(ctx, conn, conn, out)
+}
+
+func (pp *pluginProducer) Run(ctx context.Context, out chan<- string) {
+	name := pp.Command
+	if name == "" {
+		name = pp.Socket
+	}
+
+	// Subscribe early, so that no event gets lost while starting up.
+	var unsubscribe func()
+	pp.events, unsubscribe = events.Subscribe()
+	defer unsubscribe()
+
+	for ctx.Err() == nil {
+		var err error
+		if pp.Command != "" {
+			err = pp.runCommand(ctx, out)
+		} else {
+			err = pp.runSocket(ctx, out)
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Plugin failed", "plugin", name, "error", err)
+		}
+		sleep(ctx, pp.Retry)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/weather"
+)
+
+// PollenProvider retrieves pollen levels from a particular service.
+type PollenProvider interface {
+	// Fetch returns current pollen levels at the given location,
+	// by lower-case English plant names, such as "birch", or "grass".
+	Fetch(ctx context.Context, location LocationConfig) (map[string]float64, error)
+}
+
+// pollenProviders create providers by the name used in the configuration.
+// As each uses its own scale, they also come with a default threshold,
+// at which levels start to bother people with allergies.
+var pollenProviders = map[string]struct {
+	threshold float64
+	new       func(client *http.Client, apiKey string) PollenProvider
+}{
+	"openmeteo": {50, func(client *http.Client, apiKey string) PollenProvider {
+		return &openMeteoPollenProvider{client: client}
+	}},
+	"google": {3, func(client *http.Client, apiKey string) PollenProvider {
+		return &googlePollenProvider{client: client, apiKey: apiKey}
+	}},
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// openMeteoPollenPlants are what Open-Meteo forecasts, from CAMS.
+var openMeteoPollenPlants = []string{
+	"alder", "birch", "grass", "mugwort", "olive", "ragweed"}
+
+// openMeteoPollenProvider uses Open-Meteo, which only covers Europe,
+// in grains per cubic metre.
+type openMeteoPollenProvider struct {
+	client *http.Client
+}
+
+func (o *openMeteoPollenProvider) Fetch(ctx context.Context,
+	location LocationConfig) (map[string]float64, error) {
+	var current []string
+	for _, plant := range openMeteoPollenPlants {
+		current = append(current, plant+"_pollen")
+	}
+	query := url.Values{
+		"latitude":  {fmt.Sprintf("%.4f", location.Latitude)},
+		"longitude": {fmt.Sprintf("%.4f", location.Longitude)},
+		"current":   {strings.Join(current, ",")},
+	}
+
+	var result struct {
+		Current map[string]any `json:"current"`
+	}
+	if err := weather.FetchJSON(ctx, o.client,
+		airQualityURL+"?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+
+	levels := make(map[string]float64)
+	for _, plant := range openMeteoPollenPlants {
+		if value, ok := result.Current[plant+"_pollen"].(float64); ok {
+			levels[plant] = value
+		}
+	}
+	if len(levels) == 0 {
+		return nil, errors.New("no pollen data found for the location")
+	}
+	return levels, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+const googlePollenURL = "https://pollen.googleapis.com/v1/forecast:lookup"
+
+// googlePollenProvider uses the Google Pollen API, which needs an API key,
+// and expresses levels in the Universal Pollen Index, from 0 to 5.
+type googlePollenProvider struct {
+	client *http.Client
+	apiKey string
+}
+
+func (g *googlePollenProvider) Fetch(ctx context.Context,
+	location LocationConfig) (map[string]float64, error) {
+	query := url.Values{
+		"key":                {g.apiKey},
+		"location.latitude":  {fmt.Sprintf("%.4f", location.Latitude)},
+		"location.longitude": {fmt.Sprintf("%.4f", location.Longitude)},
+		"days":               {"1"},
+		"plantsDescription":  {"false"},
+		"languageCode":       {"en"},
+	}
+
+	var result struct {
+		DailyInfo []struct {
+			PlantInfo []struct {
+				Code      string `json:"code"`
+				IndexInfo *struct {
+					Value float64 `json:"value"`
+				} `json:"indexInfo"`
+			} `json:"plantInfo"`
+		} `json:"dailyInfo"`
+	}
+	if err := weather.FetchJSON(ctx, g.client,
+		googlePollenURL+"?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if len(result.DailyInfo) == 0 {
+		return nil, errors.New("no pollen data found for the location")
+	}
+
+	levels := make(map[string]float64)
+	for _, info := range result.DailyInfo[0].PlantInfo {
+		// Plants out of season come without an index.
+		if info.IndexInfo == nil {
+			continue
+		}
+		plant := strings.ToLower(info.Code)
+		if plant == "graminales" {
+			plant = "grass"
+		}
+		levels[strings.ReplaceAll(plant, "_", " ")] = info.IndexInfo.Value
+	}
+	return levels, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// pollenProducer shows pollen levels, such as "Birch 120 Grass 60",
+// highest first, but only for plants at or above the threshold,
+// so that it stays empty for most of the year.
+type pollenProducer struct {
+	// Provider is either "openmeteo", or "google".
+	Provider string `toml:"provider"`
+	// APIKey is required by Google.
+	APIKey string `toml:"api_key"`
+	// Plants limits which plants are of interest, all of them by default.
+	Plants []string `toml:"plants"`
+	// Threshold defaults to a moderate level, as the provider measures it.
+	Threshold float64       `toml:"threshold"`
+	Interval  time.Duration `toml:"interval"`
+
+	provider PollenProvider
+	location LocationConfig
+}
+
+func init() {
+	registerProducer("pollen", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		pp := &pollenProducer{
+			Provider: "openmeteo",
+			Interval: time.Hour,
+			location: config.Location,
+		}
+		if err := config.DecodeOptions(region, pp); err != nil {
+			return nil, err
+		}
+		provider, ok := pollenProviders[pp.Provider]
+		if !ok {
+			return nil, fmt.Errorf("unsupported provider: %q", pp.Provider)
+		}
+		if pp.Provider == "google" && pp.APIKey == "" {
+			return nil, errors.New("the google provider requires an API key")
+		}
+		if pp.Threshold == 0 {
+			pp.Threshold = provider.threshold
+		}
+		if pp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		for i := range pp.Plants {
+			pp.Plants[i] = strings.ToLower(pp.Plants[i])
+		}
+
+		pp.provider = provider.new(
+			&http.Client{Timeout: 30 * time.Second}, pp.APIKey)
+		return config.Location.unlessPending(
+			&periodicProducer{interval: pp.Interval, produce: pp.produce}), nil
+	})
+}
+
+func (pp *pollenProducer) produce() string {
+	levels, err := pp.provider.Fetch(context.Background(), pp.location)
+	if err != nil {
+		slog.Warn("Pollen failed", "provider", pp.Provider, "error", err)
+		return ""
+	}
+
+	var plants []string
+	for plant, level := range levels {
+		if level >= pp.Threshold &&
+			(len(pp.Plants) == 0 || slices.Contains(pp.Plants, plant)) {
+			plants = append(plants, plant)
+		}
+	}
+	slices.SortFunc(plants, func(a, b string) int {
+		return cmp.Or(cmp.Compare(levels[b], levels[a]), cmp.Compare(a, b))
+	})
+
+	var parts []string
+	for _, plant := range plants {
+		parts = append(parts, fmt.Sprintf("%s %d",
+			weather.Capitalize(plant), int(math.Round(levels[plant]))))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Producer is a source of content for a region of the display.
+type Producer interface {
+	// Run keeps sending updated content to out, until ctx is cancelled.
+	Run(ctx context.Context, out chan<- string)
+}
+
+// ProducerFunc adapts an ordinary function to the Producer interface.
+type ProducerFunc func(ctx context.Context, out chan<- string)
+
+func (f ProducerFunc) Run(ctx context.Context, out chan<- string) {
+	f(ctx, out)
+}
+
+type producerFactory func(config *Config, region *RegionConfig) (Producer, error)
+
+var producerFactories = map[string]producerFactory{}
+
+// registerProducer makes a producer available to the configuration
+// under the given name. It is meant to be called from init functions.
+func registerProducer(name string, factory producerFactory) {
+	if _, ok := producerFactories[name]; ok {
+		panic("producer registered twice: " + name)
+	}
+	producerFactories[name] = factory
+}
+
+// newProducer instantiates the producer assigned to a region.
+func newProducer(config *Config, region *RegionConfig) (Producer, error) {
+	factory, ok := producerFactories[region.Producer]
+	if !ok {
+		return nil, fmt.Errorf("unknown producer: %q", region.Producer)
+	}
+	p, err := factory(config, region)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", region.Producer, err)
+	}
+	return p, nil
+}
+
+// idleProducer leaves its region blank.
+var idleProducer = ProducerFunc(func(ctx context.Context, out chan<- string) {
+	<-ctx.Done()
+})
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// send delivers content, unless the context gets cancelled first.
+func send(ctx context.Context, out chan<- string, content string) bool {
+	select {
+	case out <- content:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sleep waits for the given duration, unless the context gets cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// periodicProducer calls a function at regular intervals,
+// which suffices for most simple information sources.
+type periodicProducer struct {
+	interval time.Duration
+	produce  func() string
+}
+
+func (p *periodicProducer) Run(ctx context.Context, out chan<- string) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for send(ctx, out, p.produce()) {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
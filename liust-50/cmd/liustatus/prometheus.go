@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prometheusProducer evaluates PromQL instant queries, and shows their
+// results, such as "load 0.52 up 12". Queries returning several series
+// produce a field for each of them.
+type prometheusProducer struct {
+	// URL is the Prometheus server's, such as "http://localhost:9090".
+	URL      string            `toml:"url"`
+	Queries  []prometheusQuery `toml:"queries"`
+	Username string            `toml:"username"`
+	Password string            `toml:"password"`
+	Interval time.Duration     `toml:"interval"`
+
+	client *http.Client
+}
+
+type prometheusQuery struct {
+	Query string `toml:"query"`
+	// Label precedes values, and may refer to series labels,
+	// such as "{instance}".
+	Label string `toml:"label"`
+	// Format is a Go format string for the value, such as "%.1f%%".
+	Format string `toml:"format"`
+}
+
+func init() {
+	registerProducer("prometheus", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		pp := &prometheusProducer{
+			URL:      "http://localhost:9090",
+			Interval: 30 * time.Second,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}
+		if err := config.DecodeOptions(region, pp); err != nil {
+			return nil, err
+		}
+		if len(pp.Queries) == 0 {
+			return nil, errors.New("no queries specified")
+		}
+		for i := range pp.Queries {
+			q := &pp.Queries[i]
+			if q.Query == "" {
+				return nil, errors.New("queries must not be empty")
+			}
+			if q.Format == "" {
+				q.Format = "%.4g"
+			}
+		}
+		if pp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: pp.Interval, produce: pp.produce}, nil
+	})
+}
+
+// prometheusSample is a vector element, or a scalar, with the value
+// being a pair of a timestamp and a string.
+type prometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  [2]any            `json:"value"`
+}
+
+func (s *prometheusSample) float() (float64, error) {
+	value, ok := s.Value[1].(string)
+	if !ok {
+		return 0, errors.New("unexpected value format")
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func (pp *prometheusProducer) query(query string) ([]prometheusSample, error) {
+	req, err := http.NewRequest(http.MethodGet,
+		strings.TrimSuffix(pp.URL, "/")+"/api/v1/query?"+
+			url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if pp.Username != "" {
+		req.SetBasicAuth(pp.Username, pp.Password)
+	}
+
+	resp, err := pp.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Failed queries still come with a JSON body, describing the error.
+	var response struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("%s: %s", resp.Status, response.Error)
+	}
+
+	var samples []prometheusSample
+	switch response.Data.ResultType {
+	case "vector":
+		err = json.Unmarshal(response.Data.Result, &samples)
+	case "scalar":
+		samples = make([]prometheusSample, 1)
+		err = json.Unmarshal(response.Data.Result, &samples[0].Value)
+	default:
+		err = fmt.Errorf("unsupported result type: %s", response.Data.ResultType)
+	}
+	return samples, err
+}
+
+var prometheusLabelRE = regexp.MustCompile(`{([a-zA-Z_][a-zA-Z0-9_]*)}`)
+
+func (pp *prometheusProducer) format(q *prometheusQuery,
+	s *prometheusSample) (string, error) {
+	value, err := s.float()
+	if err != nil {
+		return "", err
+	}
+
+	text := fmt.Sprintf(q.Format, value)
+	if label := prometheusLabelRE.ReplaceAllStringFunc(q.Label,
+		func(m string) string {
+			return s.Metric[m[1:len(m)-1]]
+		}); label != "" {
+		text = label + " " + text
+	}
+	return text, nil
+}
+
+func (pp *prometheusProducer) produce() string {
+	var fields []string
+	for i := range pp.Queries {
+		q := &pp.Queries[i]
+		samples, err := pp.query(q.Query)
+		if err != nil {
+			slog.Warn("Prometheus failed", "query", q.Query, "error", err)
+			continue
+		}
+		for j := range samples {
+			text, err := pp.format(q, &samples[j])
+			if err != nil {
+				slog.Warn("Prometheus failed", "query", q.Query, "error", err)
+				continue
+			}
+			fields = append(fields, text)
+		}
+	}
+	return strings.Join(fields, " ")
+}
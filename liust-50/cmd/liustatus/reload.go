@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// displayReload carries a new configuration to a display driver.
+type displayReload struct {
+	config *DisplayConfig
+	// producers are nil for regions that reuse a running producer.
+	producers [][]Producer
+	// reused maps page and region indexes to those of the old configuration.
+	reused map[[2]int][2]int
+}
+
+// prepareReload instantiates producers for a display's configuration,
+// reusing those of equal regions in the old one, if given.
+func prepareReload(config *Config, dc, old *DisplayConfig) (
+	*displayReload, error) {
+	r := &displayReload{
+		config:    dc,
+		producers: make([][]Producer, len(dc.Pages)),
+		reused:    make(map[[2]int][2]int),
+	}
+
+	used := make(map[[2]int]bool)
+	for i := range dc.Pages {
+		page := &dc.Pages[i]
+		r.producers[i] = make([]Producer, len(page.Regions))
+		for j := range page.Regions {
+			region := &page.Regions[j]
+			if k, ok := findRegion(old, region, used); ok {
+				used[k] = true
+				r.reused[[2]int{i, j}] = k
+
+				// The running producer has already accepted these options.
+				if err := config.markOptionsUsed(region); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			var err error
+			if r.producers[i][j], err = newProducer(config, region); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// findRegion looks for an unused region of equal configuration.
+func findRegion(dc *DisplayConfig, region *RegionConfig, used map[[2]int]bool) (
+	[2]int, bool) {
+	if dc == nil {
+		return [2]int{}, false
+	}
+	for i := range dc.Pages {
+		for j := range dc.Pages[i].Regions {
+			k := [2]int{i, j}
+			if !used[k] && reflect.DeepEqual(&dc.Pages[i].Regions[j], region) {
+				return k, true
+			}
+		}
+	}
+	return [2]int{}, false
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+type runningDisplay struct {
+	config *DisplayConfig
+	driver *displayDriver
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// displaySet runs a driver for each configured display,
+// and applies configuration changes to them.
+type displaySet struct {
+	mu      sync.Mutex
+	config  *Config
+	running map[string]*runningDisplay
+	wg      sync.WaitGroup
+
+	// stop cancels the context that all drivers run in. It is called
+	// when any of them fails for good, so that the others get to clean up.
+	stop     context.CancelFunc
+	failOnce sync.Once
+	failure  error
+}
+
+func newDisplaySet(stop context.CancelFunc) *displaySet {
+	return &displaySet{running: make(map[string]*runningDisplay), stop: stop}
+}
+
+// Drivers returns all running display drivers.
+func (ds *displaySet) Drivers() []*displayDriver {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var drivers []*displayDriver
+	for i := range ds.config.Displays {
+		drivers = append(drivers, ds.running[ds.config.Displays[i].Name].driver)
+	}
+	return drivers
+}
+
+// Apply starts, reconfigures, or stops display drivers, as needed
+// to match the configuration. Drivers only get restarted when their output
+// changes, and producers only when their settings do.
+// Should any part of the configuration fail, nothing changes.
+func (ds *displaySet) Apply(ctx context.Context, config *Config) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	// Producers may access any of these settings.
+	reuse := ds.config != nil &&
+		ds.config.Location == config.Location &&
+		ds.config.Status.equal(&config.Status) &&
+		ds.config.Weather.equal(&config.Weather)
+
+	var (
+		started  []*displayDriver
+		reloaded = make(map[string]*displayReload)
+	)
+	for i := range config.Displays {
+		dc := &config.Displays[i]
+		rd := ds.running[dc.Name]
+		if rd == nil || rd.config.Output != dc.Output {
+			dd, err := newDisplayDriver(config, dc)
+			if err != nil {
+				return err
+			}
+			started = append(started, dd)
+			continue
+		}
+
+		var old *DisplayConfig
+		if reuse {
+			old = rd.config
+		}
+		r, err := prepareReload(config, dc, old)
+		if err != nil {
+			return err
+		}
+		reloaded[dc.Name] = r
+	}
+	if err := config.checkUndecoded(); err != nil {
+		return err
+	}
+
+	// Keep the wait group from reaching zero in the middle of this.
+	ds.wg.Add(len(started))
+	for name, rd := range ds.running {
+		if r, ok := reloaded[name]; ok {
+			rd.config = r.config
+			rd.driver.Reload(ctx, r)
+			continue
+		}
+
+		// The output needs to be closed before it is reopened.
+		rd.cancel()
+		<-rd.done
+		delete(ds.running, name)
+	}
+	for _, dd := range started {
+		ctx, cancel := context.WithCancel(ctx)
+		rd := &runningDisplay{config: dd.config, driver: dd,
+			cancel: cancel, done: make(chan struct{})}
+		ds.running[dd.name] = rd
+		go func() {
+			defer ds.wg.Done()
+			defer close(rd.done)
+			if err := dd.Run(ctx); err != nil {
+				ds.failOnce.Do(func() { ds.failure = err })
+				ds.stop()
+			}
+		}()
+	}
+	ds.config = config
+	return nil
+}
+
+// Stalled tells whether any display has been stuck on output for at least d.
+func (ds *displaySet) Stalled(now time.Time, d time.Duration) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for _, rd := range ds.running {
+		if rd.driver.Stalled(now, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait waits for all drivers to finish, and returns the error
+// of the first one to have failed, if any.
+func (ds *displaySet) Wait() error {
+	ds.wg.Wait()
+	return ds.failure
+}
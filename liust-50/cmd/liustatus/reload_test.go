@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const reloadTestConfig = `
+[[page]]
+[[page.region]]
+producer = "clock"
+options = { zones = [{ zone = "UTC", label = "UTC" }] }
+
+[[page.region]]
+producer = "kaomoji"
+line = 1
+[[page.region.options.faces.face]]
+face = "(x_x)"
+delay = "10s"
+[page.region.options.states.awake]
+faces = [{ face = "(o_o)", delay = "2s" }]
+next = [{ state = "awake", weight = 1 }]
+`
+
+func loadTestConfig(t *testing.T, text string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "liustatus.toml")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestPrepareReload(t *testing.T) {
+	old := loadTestConfig(t, reloadTestConfig)
+	if _, err := prepareReload(old, &old.Displays[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.checkUndecoded(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Producers of reused regions must not be constructed at all.
+	kaomoji := producerFactories["kaomoji"]
+	defer func() { producerFactories["kaomoji"] = kaomoji }()
+	constructed := 0
+	producerFactories["kaomoji"] = func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		constructed++
+		return kaomoji(config, region)
+	}
+
+	for _, test := range []struct {
+		name     string
+		text     string
+		reused   int
+		unknown  bool
+		producer [2]int // a region that needs to be instantiated anew
+	}{
+		{"unchanged", reloadTestConfig, 2, false, [2]int{-1, -1}},
+		{"changed", strings.Replace(reloadTestConfig,
+			`"UTC" }`, `"UTC", extra = 1 }`, 1), 1, true, [2]int{0, 0}},
+		{"moved", strings.Replace(reloadTestConfig,
+			"line = 1", "line = 0\ncolumn = 10", 1), 1, false, [2]int{0, 1}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := loadTestConfig(t, test.text)
+			constructed = 0
+			r, err := prepareReload(config, &config.Displays[0], &old.Displays[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := r.reused[[2]int{0, 1}]; ok && constructed != 0 {
+				t.Errorf("reused kaomoji producer constructed")
+			}
+			if len(r.reused) != test.reused {
+				t.Errorf("%d regions reused, expected %d",
+					len(r.reused), test.reused)
+			}
+			if p := test.producer; p[0] >= 0 && r.producers[p[0]][p[1]] == nil {
+				t.Errorf("region %v not instantiated", p)
+			}
+			if err := config.checkUndecoded(); (err != nil) != test.unknown {
+				t.Errorf("unexpected undecoded keys result: %v", err)
+			}
+		})
+	}
+}
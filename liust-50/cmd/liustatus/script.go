@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"time"
+)
+
+// scriptProducer runs external commands, in the manner of i3blocks.
+type scriptProducer struct {
+	// Command is interpreted by the shell.
+	Command string `toml:"command"`
+	// Persistent commands are kept running, and each line they print
+	// is taken as an update. Others are run repeatedly, and only the first
+	// line of their output is used.
+	Persistent bool `toml:"persistent"`
+	// Interval is the period between runs, or the delay before restarting
+	// a persistent command that has terminated.
+	Interval time.Duration `toml:"interval"`
+}
+
+func init() {
+	registerProducer("script", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		sp := &scriptProducer{Interval: 10 * time.Second}
+		if err := config.DecodeOptions(region, sp); err != nil {
+			return nil, err
+		}
+		if sp.Command == "" {
+			return nil, errors.New("no command specified")
+		}
+		if sp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return sp, nil
+	})
+}
+
+func (sp *scriptProducer) command(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", sp.Command)
+	cmd.Stderr = stderrLogger("script", sp.Command)
+	return cmd
+}
+
+// runOnce returns the first line of the command's output.
+func (sp *scriptProducer) runOnce(ctx context.Context) (string, error) {
+	out, err := sp.command(ctx).Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := bytes.Cut(out, []byte("\n"))
+	return string(line), nil
+}
+
+// runPersistent forwards all lines of the command's output.
+func (sp *scriptProducer) runPersistent(
+	ctx context.Context, out chan<- string) error {
+	cmd := sp.command(ctx)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if !send(ctx, out, scanner.Text()) {
+			break
+		}
+	}
+	return cmd.Wait()
+}
+
+func (sp *scriptProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		var err error
+		if sp.Persistent {
+			err = sp.runPersistent(ctx, out)
+		} else {
+			var line string
+			if line, err = sp.runOnce(ctx); err == nil && !send(ctx, out, line) {
+				return
+			}
+		}
+
+		// Commands get killed when they are no longer needed,
+		// which is not worth a warning.
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("Script failed", "script", sp.Command, "error", err)
+		}
+		sleep(ctx, sp.Interval)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestScriptCancel(t *testing.T) {
+	var logged bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logged, nil)))
+
+	for _, persistent := range []bool{false, true} {
+		sp := &scriptProducer{Command: "echo started; exec sleep 10",
+			Persistent: persistent, Interval: time.Hour}
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan string)
+		done := make(chan struct{})
+		go func() {
+			sp.Run(ctx, out)
+			close(done)
+		}()
+
+		if persistent {
+			if line := <-out; line != "started" {
+				t.Errorf("unexpected output: %q", line)
+			}
+		}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the producer keeps running")
+		}
+	}
+	if logged.Len() != 0 {
+		t.Errorf("cancellation has been logged: %s", logged.String())
+	}
+}
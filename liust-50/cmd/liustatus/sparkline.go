@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+)
+
+// SparklineOptions let numeric producers show a short history of each value
+// as a sparkline, in place of the value itself. Display charsets have no
+// proper graphics, so heights are approximated by a few glyphs.
+type SparklineOptions struct {
+	Sparkline bool `toml:"sparkline"`
+	// SparklineLength is how many values are kept, one character each.
+	SparklineLength int `toml:"sparkline_length"`
+	// SparklineMin and SparklineMax fix the scale, which otherwise starts
+	// at zero, and ends at the natural maximum of the value, if any,
+	// or else the largest one kept.
+	SparklineMin *float64 `toml:"sparkline_min"`
+	SparklineMax *float64 `toml:"sparkline_max"`
+	// SparklineGlyphs go from the lowest values to the highest.
+	SparklineGlyphs string `toml:"sparkline_glyphs"`
+
+	history map[string][]float64
+}
+
+// newSparklineOptions returns defaults, with glyphs that the charset
+// of the region's display has.
+func newSparklineOptions(region *RegionConfig) SparklineOptions {
+	glyphs := " _▄█"
+	if _, ok := charset.ResolveRune('█', region.charset); !ok {
+		glyphs = " _-^"
+	}
+	return SparklineOptions{
+		SparklineLength: 8,
+		SparklineGlyphs: glyphs,
+		history:         make(map[string][]float64),
+	}
+}
+
+func (s *SparklineOptions) validate() error {
+	if s.SparklineLength <= 0 {
+		return errors.New("the sparkline length must be positive")
+	}
+	if utf8.RuneCountInString(s.SparklineGlyphs) < 2 {
+		return errors.New("sparklines need at least two glyphs")
+	}
+	return nil
+}
+
+// sparkline adds a value to the history of the given key, and renders it.
+// Unknown values are NaN, and so are lo and hi, if the value lacks
+// a natural minimum or maximum, and the scale is to follow the history.
+func (s *SparklineOptions) sparkline(key string, value, lo, hi float64) string {
+	values := append(s.history[key], value)
+	if len(values) > s.SparklineLength {
+		values = values[len(values)-s.SparklineLength:]
+	}
+	s.history[key] = values
+
+	if s.SparklineMin != nil {
+		lo = *s.SparklineMin
+	}
+	if s.SparklineMax != nil {
+		hi = *s.SparklineMax
+	}
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(lo) || (s.SparklineMin == nil && v < lo) {
+			lo = v
+		}
+		if math.IsNaN(hi) || (s.SparklineMax == nil && v > hi) {
+			hi = v
+		}
+	}
+
+	glyphs := []rune(s.SparklineGlyphs)
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			b.WriteRune('?')
+		case hi <= lo && v == 0:
+			// A flat line of zeroes is as good as nothing.
+			b.WriteRune(glyphs[0])
+		case hi <= lo:
+			b.WriteRune(glyphs[1])
+		default:
+			i := math.Round((v - lo) / (hi - lo) * float64(len(glyphs)-1))
+			b.WriteRune(glyphs[int(min(max(i, 0), float64(len(glyphs)-1)))])
+		}
+	}
+	return b.String()
+}
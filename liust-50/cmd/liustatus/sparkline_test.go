@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSparklineGlyphs(t *testing.T) {
+	for charsetID, expected := range map[uint8]string{
+		0:    " _▄█",
+		0x63: " _-^",
+	} {
+		s := newSparklineOptions(&RegionConfig{charset: charsetID})
+		if s.SparklineGlyphs != expected {
+			t.Errorf("charset %#x: got %q, expected %q",
+				charsetID, s.SparklineGlyphs, expected)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	nan := math.NaN()
+	for _, test := range []struct {
+		name     string
+		values   []float64
+		lo, hi   float64
+		expected string
+	}{
+		{"natural scale", []float64{0, 50, 100, 30}, 0, 100, " ▄█_"},
+		{"history scale", []float64{10, 20, 30}, nan, nan, " ▄█"},
+		{"flat zeroes", []float64{0, 0}, nan, nan, "  "},
+		{"flat", []float64{5, 5}, nan, nan, "__"},
+		{"unknown", []float64{0, nan, 100}, 0, 100, " ?█"},
+		{"truncated", []float64{100, 0, 0, 0, 0, 0, 0, 0, 0}, 0, 100,
+			"        "},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := newSparklineOptions(&RegionConfig{})
+			var result string
+			for _, v := range test.values {
+				result = s.sparkline("key", v, test.lo, test.hi)
+			}
+			if result != test.expected {
+				t.Errorf("got %q, expected %q", result, test.expected)
+			}
+		})
+	}
+}
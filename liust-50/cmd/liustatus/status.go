@@ -1,146 +1,342 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"net"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
-	"janouch.name/desktop-tools/liust-50/charset"
+	"janouch.name/desktop-tools/liust-50/weather"
 )
 
-const (
-	displayWidth  = 20
-	displayHeight = 2
-	targetCharset = 0x63
-)
-
-type DisplayState struct {
-	Display [displayHeight][displayWidth]uint8
+func init() {
+	registerProducer("status", func(config *Config, _ *RegionConfig) (
+		Producer, error) {
+		return ProducerFunc(func(ctx context.Context, out chan<- string) {
+			statusProducer(ctx, config, out)
+		}), nil
+	})
 }
 
-type Display struct {
-	Current, Last DisplayState
-}
+func statusProducer(ctx context.Context, config *Config, lines chan<- string) {
+	// Blinking needs to be refreshed every second.
+	interval := config.Status.Interval
+	if config.Status.BlinkColon {
+		interval = min(interval, time.Second)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-func NewDisplay() *Display {
-	t := &Display{}
-	for y := 0; y < displayHeight; y++ {
-		for x := 0; x < displayWidth; x++ {
-			t.Current.Display[y][x] = ' '
-			t.Last.Display[y][x] = ' '
+	// Each location is fetched independently.
+	var (
+		temperatures     []string
+		temperatureChans []chan string
+	)
+	if config.Weather.Enabled {
+		locations := append([]WeatherLocationConfig{{
+			LocationConfig: config.Location,
+			Label:          config.Weather.Label,
+		}}, config.Weather.Locations...)
+		for _, location := range locations {
+			fetcher := NewWeatherFetcher(location.LocationConfig, &config.Weather)
+			fetcher.format = func(c *weather.Conditions, stale bool) string {
+				return location.Label + config.Weather.formatIcon(c) +
+					config.Weather.formatCurrent(c, stale)
+			}
+
+			temperatureChan := make(chan string)
+			go fetcher.Run(ctx, config.Weather.Interval, temperatureChan)
+			temperatures = append(temperatures, "")
+			temperatureChans = append(temperatureChans, temperatureChan)
 		}
 	}
-	return t
-}
 
-func (t *Display) SetLine(row int, content string) {
-	if row < 0 || row >= displayHeight {
-		return
+	occasions := ""
+	occasionsChan := make(chan string)
+	if config.Status.Nameday.enabled() {
+		go watchNamedays(ctx, &config.Status.Nameday, occasionsChan)
 	}
 
-	runes := []rune(content)
-	for x := 0; x < displayWidth; x++ {
-		if x < len(runes) {
-			b, ok := charset.ResolveRune(runes[x], targetCharset)
-			if ok {
-				t.Current.Display[row][x] = b
-			} else {
-				t.Current.Display[row][x] = '?'
+	for {
+		for i, temperatureChan := range temperatureChans {
+			select {
+			case temperatures[i] = <-temperatureChan:
+			default:
 			}
-		} else {
-			t.Current.Display[row][x] = ' '
 		}
-	}
-}
+		select {
+		case newOccasions := <-occasionsChan:
+			occasions = newOccasions
+		default:
+		}
 
-func (t *Display) HasChanges() bool {
-	for y := 0; y < displayHeight; y++ {
-		for x := 0; x < displayWidth; x++ {
-			if t.Current.Display[y][x] != t.Last.Display[y][x] {
-				return true
+		// Other weather locations take turns in the temperature's place,
+		// and so do other time zones.
+		now, label := time.Now(), ""
+		if len(temperatures) != 0 {
+			label = temperatures[now.UnixNano()/
+				int64(config.Weather.LocationInterval)%int64(len(temperatures))]
+		}
+		if zones := config.Status.Timezones; len(zones) != 0 {
+			slot := int(now.UnixNano()/int64(config.Status.TimezoneInterval)) %
+				(len(zones) + 1)
+			if slot > 0 {
+				zone := &zones[slot-1]
+				now, label = now.In(zone.location), zone.Label
 			}
 		}
+		// Holidays and name days take turns with the date, in its place.
+		locale := config.Status.locale
+		date := locale.Format(now, config.Status.DateFormat)
+		if occasions != "" &&
+			now.UnixNano()/int64(config.Status.DateInterval)%2 != 0 {
+			date = fitWidth(occasions, utf8.RuneCountInString(date))
+		}
+		status := fmt.Sprintf("%s%4s %s",
+			date, label, config.Status.formatTime(now))
+
+		if !send(ctx, lines, fitWidth(status, displayWidth)) {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fitWidth truncates or pads text to exactly the given number of characters.
+func fitWidth(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
 	}
-	return false
+	return text + strings.Repeat(" ", width-len(runes))
 }
 
-func (t *Display) Update() {
-	for y := 0; y < displayHeight; y++ {
-		start := -1
-		for x := 0; x < displayWidth; x++ {
-			if t.Current.Display[y][x] != t.Last.Display[y][x] {
-				start = x
-				break
+func main() {
+	var (
+		configPath = flag.String("config", "",
+			"path to the configuration file")
+		latitude  = flag.Float64("lat", 0, "latitude of the location")
+		longitude = flag.Float64("lon", 0, "longitude of the location")
+		altitude  = flag.Int("altitude", 0, "altitude of the location in metres")
+		charsetID = flag.Uint("charset", 0, "display character set")
+		dateFmt   = flag.String("date-format", "", "Go layout of the date")
+		timeFmt   = flag.String("time-format", "", "Go layout of the time")
+		outputURI = flag.String("output", "", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		device    = flag.String("device", "", "serial port of the display")
+		baud      = flag.Int("baud", 9600, "baud rate of the serial port")
+		verbose   = flag.Bool("verbose", false, "log debugging information")
+		logFormat = flag.String("log-format", "auto",
+			"log format: text, json, journal, or auto")
+		replay = flag.Int("kaomoji-replay", 0,
+			"print frames of this many kaomoji states, and exit")
+		replaySeed = flag.Int64("kaomoji-seed", 0,
+			"seed of the kaomoji replay, instead of the configured one")
+	)
+	flag.Parse()
+
+	if err := setupLogging(*logFormat, *verbose); err != nil {
+		fatal("Invalid arguments", "error", err)
+	}
+	if *charsetID > 0xff {
+		fatal("Invalid arguments", "charset", *charsetID)
+	}
+
+	explicit := *configPath != ""
+	if !explicit {
+		*configPath = defaultConfigPath()
+	}
+	load := func() (*Config, error) {
+		config, err := LoadConfig(*configPath, explicit)
+		if err != nil {
+			return nil, err
+		}
+
+		// Command line options take precedence over the configuration file.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "lat":
+				config.Location.Latitude, config.Location.Place = *latitude, ""
+			case "lon":
+				config.Location.Longitude, config.Location.Place = *longitude, ""
+			case "altitude":
+				config.Location.Altitude = *altitude
+			case "charset":
+				config.Charset = uint8(*charsetID)
+			case "date-format":
+				config.Status.DateFormat = *dateFmt
+			case "time-format":
+				config.Status.TimeFormat = *timeFmt
+			case "output":
+				config.Output = *outputURI
+			case "device":
+				config.Output = fmt.Sprintf("serial:%s?baud=%d", *device, *baud)
 			}
+		})
+		config.resolvePlaces(context.Background())
+		if err := config.validate(); err != nil {
+			return nil, err
 		}
-		if start >= 0 {
-			fmt.Printf("\x1b[%d;%dH%s",
-				y+1, start+1, []byte(t.Current.Display[y][start:]))
-			copy(t.Last.Display[y][start:], t.Current.Display[y][start:])
+		return config, nil
+	}
+
+	config, err := load()
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if *replay > 0 {
+		if err := kaomojiReplay(config, os.Stdout, *replay, *replaySeed); err != nil {
+			fatal("Kaomoji replay failed", "error", err)
 		}
+		return
 	}
-}
 
-func statusProducer(lines chan<- string) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	rand.Seed(time.Now().UTC().UnixNano())
 
-	temperature, fetcher := "", NewWeatherFetcher()
-	temperatureChan := make(chan string)
-	go fetcher.Run(5*time.Minute, temperatureChan)
+	// Upon termination, drivers get to clean up their displays.
+	// Another signal will kill the process, should they get stuck.
+	ctx, stop := signal.NotifyContext(
+		context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
 
-	for {
-		select {
-		case newTemperature := <-temperatureChan:
-			temperature = newTemperature
-		default:
+	displays := newDisplaySet(stop)
+	if err := displays.Apply(ctx, config); err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+
+	// Control interfaces are only set up once, reloading doesn't affect them.
+	// The service manager may pass their sockets to us.
+	listeners, err := sdListeners()
+	if err != nil {
+		fatal("Control interface failed", "error", err)
+	}
+	if l := listeners["control"]; l == nil && config.Control.Socket != "" {
+		if l, err = listenControl(config.Control.Socket); err != nil {
+			fatal("Control interface failed", "error", err)
 		}
+		listeners["control"] = l
+	}
+	if l := listeners["http"]; l == nil && config.Control.HTTP != "" {
+		if l, err = net.Listen("tcp", config.Control.HTTP); err != nil {
+			fatal("Control interface failed", "error", err)
+		}
+		listeners["http"] = l
+	}
 
-		now := time.Now()
-		status := fmt.Sprintf("%s%4s %s",
-			now.Format("Mon _2 Jan"), temperature, now.Format("15:04"))
+	cs := &controlServer{displays: displays}
+	if l := listeners["control"]; l != nil {
+		go cs.Serve(ctx, l)
+	}
+	if l := listeners["http"]; l != nil {
+		go cs.ServePush(ctx, l)
+	}
 
-		// Ensure exactly 20 characters.
-		runes := []rune(status)
-		if len(runes) > displayWidth {
-			status = string(runes[:displayWidth])
-		} else if len(runes) < displayWidth {
-			status = status + strings.Repeat(" ", displayWidth-len(runes))
+	// Idle detection is restarted whenever its timeout changes.
+	idleTimeout, stopIdle := time.Duration(0), context.CancelFunc(func() {})
+	watchIdleFor := func(timeout time.Duration) {
+		if timeout == idleTimeout {
+			return
 		}
+		stopIdle()
+		if idleTimeout = timeout; timeout > 0 {
+			var idleCtx context.Context
+			idleCtx, stopIdle = context.WithCancel(ctx)
+			go watchIdle(idleCtx, timeout)
+		}
+	}
+	watchIdleFor(config.Idle.Timeout)
 
-		lines <- status
-		<-ticker.C
+	// Lock detection is started and stopped as configured.
+	stopLock := context.CancelFunc(nil)
+	watchLockIf := func(enabled bool) {
+		if !enabled && stopLock != nil {
+			stopLock()
+			stopLock = nil
+		} else if enabled && stopLock == nil {
+			var lockCtx context.Context
+			lockCtx, stopLock = context.WithCancel(ctx)
+			go watchLock(lockCtx)
+		}
 	}
-}
+	watchLockIf(config.Lock.Enabled)
+	alarms.Configure(config.Alarms)
+	go alarms.Run(ctx)
+	notifications.Configure(ctx, config.Notifications)
 
-func main() {
-	rand.Seed(time.Now().UTC().UnixNano())
-	terminal := NewDisplay()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	// Places that could not be looked up are retried in the background,
+	// and the configuration reloaded once they are known.
+	stopPlaces := context.CancelFunc(func() {})
+	awaitPlaces := func(config *Config) {
+		stopPlaces()
+		var placesCtx context.Context
+		placesCtx, stopPlaces = context.WithCancel(ctx)
+		go config.awaitPlaces(placesCtx, func() {
+			select {
+			case hup <- syscall.SIGHUP:
+			default:
+			}
+		})
+	}
+	awaitPlaces(config)
 
-	kaomojiChan := make(chan string, 1)
-	statusChan := make(chan string, 1)
 	go func() {
-		kaomojiChan <- strings.Repeat(" ", displayWidth)
-		statusChan <- strings.Repeat(" ", displayWidth)
+		for range hup {
+			sdNotifyReloading()
+			config, err := load()
+			if err == nil {
+				err = displays.Apply(ctx, config)
+			}
+			if err == nil {
+				watchIdleFor(config.Idle.Timeout)
+				watchLockIf(config.Lock.Enabled)
+				alarms.Configure(config.Alarms)
+				notifications.Configure(ctx, config.Notifications)
+				awaitPlaces(config)
+			}
+			if err != nil {
+				slog.Error("Reload failed", "error", err)
+			} else {
+				events.Publish("reload", nil)
+			}
+			sdNotify("READY=1")
+		}
 	}()
 
-	go kaomojiProducer(kaomojiChan)
-	go statusProducer(statusChan)
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			kaomojiPet()
+		}
+	}()
 
-	// TODO(p): And we might want to disable cursor visibility as well.
-	fmt.Printf("\x1bR%c", targetCharset)
-	fmt.Print("\x1b[2J") // Clear display
+	if interval := sdWatchdogInterval(); interval > 0 {
+		go sdWatchdog(ctx, interval, displays)
+	}
+	sdNotify("READY=1")
+	context.AfterFunc(ctx, func() { sdNotify("STOPPING=1") })
+	err = displays.Wait()
 
-	for {
-		select {
-		case line := <-kaomojiChan:
-			terminal.SetLine(0, line)
-		case line := <-statusChan:
-			terminal.SetLine(1, line)
-		}
-		if terminal.HasChanges() {
-			terminal.Update()
-		}
+	// Exiting would skip deferred calls, so listeners are closed explicitly.
+	for _, l := range listeners {
+		l.Close()
+	}
+	if err != nil {
+		fatal("Display failed", "error", err)
 	}
 }
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestFitWidth(t *testing.T) {
+	for _, test := range []struct {
+		text   string
+		width  int
+		result string
+	}{
+		{"", 3, "   "},
+		{"ab", 4, "ab  "},
+		{"abcd", 4, "abcd"},
+		{"abcdef", 4, "abcd"},
+		{"ｺﾝﾆﾁﾊ", 3, "ｺﾝﾆ"},
+		{"°C", 3, "°C "},
+	} {
+		if result := fitWidth(test.text, test.width); result != test.result {
+			t.Errorf("%q to %d: got %q, expected %q",
+				test.text, test.width, result, test.result)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// sunProducer shows when the sun rises and sets next, such as
+// "Rise 07:12 Set 18:05", either side by side, or rotating through them.
+// It uses the configured location, as does dimming that follows the sun.
+type sunProducer struct {
+	// Go time layout, see https://pkg.go.dev/time#pkg-constants.
+	Format    string `toml:"format"`
+	RiseLabel string `toml:"rise_label"`
+	SetLabel  string `toml:"set_label"`
+	// Rotate is how long each is shown for,
+	// or zero to show both side by side.
+	Rotate time.Duration `toml:"rotate"`
+
+	location LocationConfig
+	locale   *timeLocale
+}
+
+func init() {
+	registerProducer("sun", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		sp := &sunProducer{
+			Format:    "15:04",
+			RiseLabel: "Rise",
+			SetLabel:  "Set",
+			location:  config.Location,
+			locale:    config.Status.locale,
+		}
+		if err := config.DecodeOptions(region, sp); err != nil {
+			return nil, err
+		}
+		if sp.Rotate < 0 {
+			return nil, errors.New("the rotation period must not be negative")
+		}
+		return config.Location.unlessPending(
+			&periodicProducer{interval: time.Second, produce: sp.produce}), nil
+	})
+}
+
+// nextSunTimes returns the following sunrise and sunset, looking a few days
+// ahead at most. Zero times mean that there are none within that period.
+func nextSunTimes(now time.Time, location LocationConfig) (rise, set time.Time) {
+	for i := 0; i < 3 && (rise.IsZero() || set.IsZero()); i++ {
+		r, s, _ := sunTimes(now.AddDate(0, 0, i), location)
+		if r.Equal(s) {
+			continue
+		}
+		if rise.IsZero() && r.After(now) {
+			rise = r
+		}
+		if set.IsZero() && s.After(now) {
+			set = s
+		}
+	}
+	return
+}
+
+func (sp *sunProducer) format(label string, t time.Time) string {
+	if t.IsZero() {
+		return label + " -"
+	}
+	return label + " " + sp.locale.Format(t, sp.Format)
+}
+
+func (sp *sunProducer) produce() string {
+	now := time.Now()
+	rise, set := nextSunTimes(now, sp.location)
+	fields := []string{sp.format(sp.RiseLabel, rise), sp.format(sp.SetLabel, set)}
+	if sp.Rotate > 0 {
+		return fields[int(now.UnixNano()/int64(sp.Rotate))%len(fields)]
+	}
+	return fields[0] + " " + fields[1]
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// sunTimes approximates when the sun rises and sets on the given day,
+// following the sunrise equation. During polar days and nights,
+// it returns the same time twice, and whether the sun stays up.
+func sunTimes(day time.Time, location LocationConfig) (
+	rise, set time.Time, up bool) {
+	const (
+		j2000   = 2451545.0
+		unixJD  = 2440587.5
+		degrees = math.Pi / 180
+	)
+
+	noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0,
+		day.Location())
+	jd := float64(noon.Unix())/86400 + unixJD
+
+	n := math.Ceil(jd - j2000 - 0.0009)
+	meanSolarTime := n - location.Longitude/360
+	m := math.Mod(357.5291+0.98560028*meanSolarTime, 360) * degrees
+	c := 1.9148*math.Sin(m) + 0.02*math.Sin(2*m) + 0.0003*math.Sin(3*m)
+	lambda := math.Mod(m/degrees+c+180+102.9372, 360) * degrees
+	transit := j2000 + meanSolarTime +
+		0.0053*math.Sin(m) - 0.0069*math.Sin(2*lambda)
+
+	// The elevation correction accounts for the horizon being lower.
+	declination := math.Asin(math.Sin(lambda) * math.Sin(23.4397*degrees))
+	latitude := location.Latitude * degrees
+	elevation := -0.833 - 2.076*math.Sqrt(float64(max(location.Altitude, 0)))/60
+	cosHourAngle := (math.Sin(elevation*degrees) -
+		math.Sin(latitude)*math.Sin(declination)) /
+		(math.Cos(latitude) * math.Cos(declination))
+
+	toTime := func(j float64) time.Time {
+		return time.Unix(int64(math.Round((j-unixJD)*86400)), 0).
+			In(day.Location())
+	}
+	if cosHourAngle <= -1 || cosHourAngle >= 1 {
+		t := toTime(transit)
+		return t, t, cosHourAngle <= -1
+	}
+
+	hourAngle := math.Acos(cosHourAngle) / degrees
+	return toTime(transit - hourAngle/360), toTime(transit + hourAngle/360), true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSunTimes(t *testing.T) {
+	var (
+		cet     = time.FixedZone("CET", 1*60*60)
+		cest    = time.FixedZone("CEST", 2*60*60)
+		prague  = LocationConfig{Latitude: 50.08804, Longitude: 14.42076}
+		tromso  = LocationConfig{Latitude: 69.6496, Longitude: 18.956}
+		equator = LocationConfig{}
+	)
+	at := func(day time.Time, hour, minute int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0,
+			day.Location())
+	}
+	summer := time.Date(2024, 6, 21, 0, 0, 0, 0, cest)
+	winter := time.Date(2024, 12, 21, 0, 0, 0, 0, cet)
+	equinox := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name      string
+		day       time.Time
+		location  LocationConfig
+		rise, set time.Time // zero for polar days and nights
+		up        bool
+	}{
+		{"summer", summer, prague, at(summer, 4, 50), at(summer, 21, 15), true},
+		{"winter", winter, prague, at(winter, 7, 58), at(winter, 16, 2), true},
+		{"equinox", equinox, equator,
+			at(equinox, 6, 4), at(equinox, 18, 11), true},
+		{"polar day", summer, tromso, time.Time{}, time.Time{}, true},
+		{"polar night", winter, tromso, time.Time{}, time.Time{}, false},
+	} {
+		rise, set, up := sunTimes(test.day, test.location)
+		if up != test.up {
+			t.Errorf("%s: the sun is up: %t, expected %t", test.name, up, test.up)
+		}
+		if test.rise.IsZero() {
+			if !rise.Equal(set) {
+				t.Errorf("%s: the sun rises at %s and sets at %s",
+					test.name, rise, set)
+			}
+			continue
+		}
+		// The sunrise equation is only an approximation.
+		if rise.Sub(test.rise).Abs() > 3*time.Minute ||
+			set.Sub(test.set).Abs() > 3*time.Minute {
+			t.Errorf("%s: got %s to %s, expected %s to %s", test.name,
+				rise.Format("15:04"), set.Format("15:04"),
+				test.rise.Format("15:04"), test.set.Format("15:04"))
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemProducer shows load average, CPU usage, and memory usage,
+// such as "L0.52 C 12% M 43%", which fits within a single line.
+type systemProducer struct {
+	// Fields are any of "load", "cpu", "memory", and "swap".
+	Fields   []string      `toml:"fields"`
+	Interval time.Duration `toml:"interval"`
+	SparklineOptions
+
+	lastBusy, lastTotal uint64
+}
+
+func init() {
+	registerProducer("system", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		sp := &systemProducer{
+			Fields:           []string{"load", "cpu", "memory"},
+			Interval:         2 * time.Second,
+			SparklineOptions: newSparklineOptions(region),
+		}
+		if err := config.DecodeOptions(region, sp); err != nil {
+			return nil, err
+		}
+		for _, field := range sp.Fields {
+			switch field {
+			case "load", "cpu", "memory", "swap":
+			default:
+				return nil, fmt.Errorf("unknown field: %q", field)
+			}
+		}
+		if sp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		if err := sp.validate(); err != nil {
+			return nil, err
+		}
+		return &periodicProducer{interval: sp.Interval, produce: sp.produce}, nil
+	})
+}
+
+// readLoad returns the one-minute load average.
+func readLoad() (string, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 1 {
+		return "", errors.New("unexpected /proc/loadavg format")
+	}
+	return fields[0], nil
+}
+
+// readCPU returns cumulative busy and total jiffies of all CPUs.
+func readCPU() (busy, total uint64, err error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, 0, errors.New("unexpected /proc/stat format")
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, errors.New("unexpected /proc/stat format")
+	}
+
+	// Guest time is already included in user time, so it is left out.
+	for i, field := range fields[1:min(len(fields), 9)] {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += n
+		// Neither idle nor iowait count as busy.
+		if i != 3 && i != 4 {
+			busy += n
+		}
+	}
+	return busy, total, nil
+}
+
+// readMeminfo returns values from /proc/meminfo, in kibibytes.
+func readMeminfo() (map[string]uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) < 1 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			info[key] = n
+		}
+	}
+	return info, scanner.Err()
+}
+
+func percentage(part, whole uint64) string {
+	if whole == 0 {
+		return "  -"
+	}
+	return fmt.Sprintf("%3d", min(part*100/whole, 100))
+}
+
+// percentageValue is the numeric counterpart of percentage, for sparklines.
+func percentageValue(part, whole uint64) float64 {
+	if whole == 0 {
+		return math.NaN()
+	}
+	return min(float64(part)*100/float64(whole), 100)
+}
+
+// field formats a labelled value, or its history as a sparkline.
+func (sp *systemProducer) field(label, text string, value, max float64) string {
+	if sp.Sparkline {
+		return label + sp.sparkline(label, value, 0, max)
+	}
+	return label + text
+}
+
+func (sp *systemProducer) produce() string {
+	var meminfo map[string]uint64
+	var fields []string
+	for _, field := range sp.Fields {
+		switch field {
+		case "load":
+			load, err := readLoad()
+			if err != nil {
+				load = "?"
+			}
+			value, err := strconv.ParseFloat(load, 64)
+			if err != nil {
+				value = math.NaN()
+			} else {
+				kaomojiStress.Report("load", value/float64(runtime.NumCPU()))
+			}
+			fields = append(fields, sp.field("L", load, value, math.NaN()))
+		case "cpu":
+			busy, total, err := readCPU()
+			if err != nil || total <= sp.lastTotal {
+				fields = append(fields, sp.field("C", "  ?%", math.NaN(), 100))
+				continue
+			}
+
+			// The first reading covers the whole uptime, which is fine.
+			dBusy, dTotal := busy-sp.lastBusy, total-sp.lastTotal
+			kaomojiStress.Report("cpu", percentageValue(dBusy, dTotal))
+			fields = append(fields, sp.field("C", percentage(dBusy, dTotal)+"%",
+				percentageValue(dBusy, dTotal), 100))
+			sp.lastBusy, sp.lastTotal = busy, total
+		case "memory", "swap":
+			if meminfo == nil {
+				var err error
+				if meminfo, err = readMeminfo(); err != nil {
+					meminfo = map[string]uint64{}
+				}
+			}
+			if field == "memory" {
+				total := meminfo["MemTotal"]
+				used := total - min(meminfo["MemAvailable"], total)
+				fields = append(fields, sp.field("M", percentage(used, total)+"%",
+					percentageValue(used, total), 100))
+			} else {
+				total := meminfo["SwapTotal"]
+				used := total - min(meminfo["SwapFree"], total)
+				fields = append(fields, sp.field("S", percentage(used, total)+"%",
+					percentageValue(used, total), 100))
+			}
+		}
+	}
+	return strings.Join(fields, " ")
+}
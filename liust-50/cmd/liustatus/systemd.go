@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// sdNotify informs the service manager about state changes,
+// see sd_notify(3). It does nothing when not run as a Type=notify service.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil,
+		&net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdNotifyReloading is what Type=notify-reload services send when reloading.
+func sdNotifyReloading() error {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return err
+	}
+	return sdNotify(fmt.Sprintf("RELOADING=1\nMONOTONIC_USEC=%d",
+		ts.Nano()/int64(time.Microsecond)))
+}
+
+// sdWatchdogInterval returns how often the service manager
+// expects to be notified, or zero if it doesn't.
+func sdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" &&
+		pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdWatchdog keeps notifying the service manager, for as long as no display
+// is stuck writing. Otherwise, the service will get restarted.
+func sdWatchdog(ctx context.Context, interval time.Duration, ds *displaySet) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if !ds.Stalled(now, interval/2) {
+				sdNotify("WATCHDOG=1")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sdListeners returns sockets passed by the service manager, see
+// sd_listen_fds(3). Each is named either by FileDescriptorName=,
+// or by its kind: "control" for Unix sockets, "http" for TCP sockets.
+func sdListeners() (map[string]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make(map[string]net.Listener)
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return listeners, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return listeners, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := range count {
+		const listenFdsStart = 3
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: %w", err)
+		}
+
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		if name != "control" && name != "http" {
+			switch l.Addr().Network() {
+			case "unix":
+				name = "control"
+			case "tcp":
+				name = "http"
+			}
+		}
+		if _, ok := listeners[name]; ok || name == "" {
+			l.Close()
+			return nil, fmt.Errorf("socket activation: unexpected socket: %s",
+				l.Addr())
+		}
+		listeners[name] = l
+	}
+	return listeners, nil
+}
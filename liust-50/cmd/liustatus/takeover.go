@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+// Message is shared with other programs, which send it over the control socket.
+type Message = takeover.Message
+
+// takeoverHub distributes messages to display drivers.
+type takeoverHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Message]struct{}
+}
+
+var takeovers = &takeoverHub{subscribers: make(map[chan Message]struct{})}
+
+func (h *takeoverHub) Subscribe() (<-chan Message, func()) {
+	ch := make(chan Message, 16)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers, ch)
+	}
+}
+
+// Takeover queues a message on all displays.
+// Drivers themselves decide whether the message is meant for them.
+func Takeover(m Message) {
+	takeovers.mu.Lock()
+	defer takeovers.mu.Unlock()
+	for ch := range takeovers.subscribers {
+		select {
+		case ch <- m:
+		default:
+			slog.Warn("Takeover message dropped", "text", m.Text)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// tamagotchiStats are the needs of the kaomoji as a virtual pet,
+// each going from 0 to 1.
+type tamagotchiStats struct {
+	Hunger  float64
+	Mood    float64
+	Updated time.Time
+}
+
+const (
+	// tamagotchiHungerTime is how long it takes for the kaomoji to starve.
+	tamagotchiHungerTime = 12 * time.Hour
+	// tamagotchiMoodTime is how long it takes for the kaomoji to lose
+	// all its good mood, when left alone.
+	tamagotchiMoodTime = 48 * time.Hour
+)
+
+// Thresholds at which the stats start showing.
+const (
+	tamagotchiHungry  = 0.7
+	tamagotchiSad     = 0.3
+	tamagotchiContent = 0.7
+)
+
+func clamp01(f float64) float64 {
+	return min(max(f, 0), 1)
+}
+
+// advance lets the stats run their course up until the given time.
+// Time keeps passing even while the program isn't running.
+func (ts *tamagotchiStats) advance(now time.Time) {
+	if elapsed := now.Sub(ts.Updated); elapsed > 0 {
+		ts.Hunger = clamp01(ts.Hunger + float64(elapsed)/float64(tamagotchiHungerTime))
+		ts.Mood = clamp01(ts.Mood - float64(elapsed)/float64(tamagotchiMoodTime))
+	}
+	ts.Updated = now
+}
+
+// tamagotchiPet keeps the stats, which are shared by all kaomoji,
+// loading them lazily, and saving them whenever the user interacts.
+type tamagotchiPet struct {
+	mu    sync.Mutex
+	path  string           // empty unless any kaomoji is a virtual pet
+	stats *tamagotchiStats // nil until loaded
+}
+
+var tamagotchi tamagotchiPet
+
+// tamagotchiPath returns where to keep the stats.
+func tamagotchiPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "liustatus", "tamagotchi.json"), nil
+}
+
+// Adopt enables the stats, to be kept in the given file.
+func (tp *tamagotchiPet) Adopt(path string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.path != path {
+		tp.path, tp.stats = path, nil
+	}
+}
+
+// current returns up-to-date stats, with the mutex held,
+// or nil if they are not enabled.
+func (tp *tamagotchiPet) current() *tamagotchiStats {
+	if tp.path == "" {
+		return nil
+	}
+	if tp.stats == nil {
+		// A newly adopted pet has yet to eat, and make friends.
+		tp.stats = &tamagotchiStats{Hunger: 0.5, Mood: 0.5, Updated: time.Now()}
+		if b, err := os.ReadFile(tp.path); err == nil {
+			if err := json.Unmarshal(b, tp.stats); err != nil {
+				slog.Warn("Tamagotchi stats not loaded",
+					"path", tp.path, "error", err)
+			}
+		}
+	}
+	tp.stats.advance(time.Now())
+	return tp.stats
+}
+
+// Get returns the current stats, and whether they are enabled at all.
+func (tp *tamagotchiPet) Get() (tamagotchiStats, bool) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if stats := tp.current(); stats != nil {
+		return *stats, true
+	}
+	return tamagotchiStats{}, false
+}
+
+// update changes the stats, if enabled, and saves them.
+func (tp *tamagotchiPet) update(change func(stats *tamagotchiStats)) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	stats := tp.current()
+	if stats == nil {
+		return
+	}
+	change(stats)
+	if err := saveJSON(tp.path, stats); err != nil {
+		slog.Warn("Tamagotchi stats not saved", "path", tp.path, "error", err)
+	}
+}
+
+// Feed satisfies the kaomoji's hunger, though overfeeding spoils its mood.
+func (tp *tamagotchiPet) Feed() {
+	tp.update(func(stats *tamagotchiStats) {
+		if stats.Hunger < 0.2 {
+			stats.Mood = clamp01(stats.Mood - 0.1)
+		} else {
+			stats.Mood = clamp01(stats.Mood + 0.1)
+		}
+		stats.Hunger = clamp01(stats.Hunger - 0.5)
+	})
+}
+
+// Pet improves the kaomoji's mood.
+func (tp *tamagotchiPet) Pet() {
+	tp.update(func(stats *tamagotchiStats) {
+		stats.Mood = clamp01(stats.Mood + 0.1)
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// temperatureProducer shows hardware temperatures, such as "CPU 45C GPU 60C".
+type temperatureProducer struct {
+	// Sensors default to the first CPU sensor found.
+	Sensors []temperatureSensor `toml:"sensors"`
+	// Alarm is the temperature in degrees Celsius, which when exceeded,
+	// takes over the display, or zero to disable that.
+	Alarm    float64       `toml:"alarm"`
+	Interval time.Duration `toml:"interval"`
+	SparklineOptions
+
+	alarmed map[string]bool
+}
+
+type temperatureSensor struct {
+	// Sensor is either a hwmon chip name, such as "k10temp",
+	// optionally followed by a slash and a temperature label,
+	// such as "coretemp/Package id 0", or a thermal zone type.
+	Sensor string `toml:"sensor"`
+	// Label precedes the temperature.
+	Label string `toml:"label"`
+}
+
+// cpuSensors are commonly available CPU temperature sensors.
+var cpuSensors = []string{
+	"k10temp", "coretemp", "zenpower", "cpu_thermal", "x86_pkg_temp"}
+
+func init() {
+	registerProducer("temperature", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		tp := &temperatureProducer{
+			Interval:         5 * time.Second,
+			SparklineOptions: newSparklineOptions(region),
+			alarmed:          make(map[string]bool),
+		}
+		if err := config.DecodeOptions(region, tp); err != nil {
+			return nil, err
+		}
+		for _, sensor := range tp.Sensors {
+			if sensor.Sensor == "" {
+				return nil, errors.New("sensors must be named")
+			}
+		}
+		if tp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		if err := tp.validate(); err != nil {
+			return nil, err
+		}
+		return &periodicProducer{interval: tp.Interval, produce: tp.produce}, nil
+	})
+}
+
+func readMillidegrees(path string) (float64, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	return float64(n) / 1000, err == nil
+}
+
+// readTemperature finds a sensor, and returns its temperature in Celsius.
+func readTemperature(sensor string) (float64, bool) {
+	chip, label, _ := strings.Cut(sensor, "/")
+	hwmons, _ := filepath.Glob("/sys/class/hwmon/hwmon*")
+	for _, hwmon := range hwmons {
+		name, _ := os.ReadFile(filepath.Join(hwmon, "name"))
+		if strings.TrimSpace(string(name)) != chip {
+			continue
+		}
+
+		inputs, _ := filepath.Glob(filepath.Join(hwmon, "temp*_input"))
+		for _, input := range inputs {
+			if label != "" {
+				b, _ := os.ReadFile(
+					strings.TrimSuffix(input, "_input") + "_label")
+				if strings.TrimSpace(string(b)) != label {
+					continue
+				}
+			}
+			if t, ok := readMillidegrees(input); ok {
+				return t, true
+			}
+		}
+	}
+
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*")
+	for _, zone := range zones {
+		kind, _ := os.ReadFile(filepath.Join(zone, "type"))
+		if strings.TrimSpace(string(kind)) == chip {
+			return readMillidegrees(filepath.Join(zone, "temp"))
+		}
+	}
+	return 0, false
+}
+
+func (tp *temperatureProducer) produce() string {
+	sensors := tp.Sensors
+	if sensors == nil {
+		for _, sensor := range cpuSensors {
+			if _, ok := readTemperature(sensor); ok {
+				sensors = []temperatureSensor{{Sensor: sensor, Label: "CPU"}}
+				break
+			}
+		}
+	}
+	if sensors == nil {
+		return "No sensors"
+	}
+
+	var fields []string
+	hottest := math.Inf(-1)
+	for _, sensor := range sensors {
+		prefix := sensor.Label
+		if prefix != "" {
+			prefix += " "
+		}
+		t, ok := readTemperature(sensor.Sensor)
+		if !ok {
+			t = math.NaN()
+		}
+
+		text := prefix + "?"
+		if ok {
+			text = fmt.Sprintf("%s%.0fC", prefix, t)
+			hottest = max(hottest, t)
+
+			// Only alert once per overheating.
+			hot := tp.Alarm > 0 && t > tp.Alarm
+			if hot && !tp.alarmed[sensor.Sensor] {
+				Takeover(Message{
+					Text:     "Temperature alarm\n" + text,
+					Priority: 1,
+					Duration: 10 * time.Second,
+					Line:     -1,
+				})
+			}
+			tp.alarmed[sensor.Sensor] = hot
+		}
+		if tp.Sparkline {
+			text = prefix + tp.sparkline(sensor.Sensor, t, math.NaN(), math.NaN())
+		}
+		fields = append(fields, text)
+	}
+	if !math.IsInf(hottest, -1) {
+		kaomojiStress.Report("temperature", hottest)
+	}
+	return strings.Join(fields, " ")
+}
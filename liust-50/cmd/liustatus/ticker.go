@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tickerProducer shows prices of stocks or cryptocurrencies, along with
+// their daily change, such as "AAPL 189.12▴1.2%", rotating through them.
+type tickerProducer struct {
+	// Source is any of the keys of quoteSources.
+	Source  string   `toml:"source"`
+	Symbols []string `toml:"symbols"`
+	// Labels optionally rename symbols, such as "bitcoin" to "BTC".
+	Labels map[string]string `toml:"labels"`
+	// URL overrides the source's API endpoint.
+	URL string `toml:"url"`
+	// Currency is used by sources that can convert prices.
+	Currency string `toml:"currency"`
+	// Command is run by the "command" source, with symbols as arguments.
+	// It should print lines of symbols, prices, and percentual changes.
+	Command string `toml:"command"`
+	// Interval is the period between fetching quotes.
+	Interval time.Duration `toml:"interval"`
+	// Rotate is how long each symbol is shown for,
+	// or zero to show all of them side by side.
+	Rotate time.Duration `toml:"rotate"`
+	// Up and Down precede changes. The default triangles
+	// are only available in the Japanese character set.
+	Up   string `toml:"up"`
+	Down string `toml:"down"`
+
+	client *http.Client
+}
+
+// quote is a price, along with its daily change in percent.
+type quote struct {
+	price, change float64
+}
+
+// quoteSource retrieves quotes of all configured symbols it can find.
+type quoteSource func(ctx context.Context, tp *tickerProducer) (
+	map[string]quote, error)
+
+var quoteSources = map[string]quoteSource{
+	"yahoo":     fetchYahoo,
+	"coingecko": fetchCoinGecko,
+	"command":   fetchCommand,
+}
+
+func init() {
+	registerProducer("ticker", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		tp := &tickerProducer{
+			Source:   "yahoo",
+			Currency: "usd",
+			Interval: 5 * time.Minute,
+			Rotate:   5 * time.Second,
+			Up:       "▴",
+			Down:     "▾",
+			client:   &http.Client{Timeout: 30 * time.Second},
+		}
+		if err := config.DecodeOptions(region, tp); err != nil {
+			return nil, err
+		}
+		if _, ok := quoteSources[tp.Source]; !ok {
+			return nil, fmt.Errorf("unknown source: %q", tp.Source)
+		}
+		if tp.Source == "command" && tp.Command == "" {
+			return nil, errors.New("no command specified")
+		}
+		if len(tp.Symbols) == 0 {
+			return nil, errors.New("no symbols specified")
+		}
+		if tp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		if tp.Rotate < 0 {
+			return nil, errors.New("the rotation period must not be negative")
+		}
+		return tp, nil
+	})
+}
+
+// getJSON decodes the response to a GET request.
+func (tp *tickerProducer) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := tp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// fetchYahoo uses Yahoo Finance charts, which need no API key.
+func fetchYahoo(ctx context.Context, tp *tickerProducer) (
+	map[string]quote, error) {
+	base := tp.URL
+	if base == "" {
+		base = "https://query1.finance.yahoo.com/v8/finance/chart/"
+	}
+
+	// Unknown symbols make for errors, which mustn't spoil the rest.
+	quotes := make(map[string]quote)
+	var lastErr error
+	for _, symbol := range tp.Symbols {
+		var chart struct {
+			Chart struct {
+				Result []struct {
+					Meta struct {
+						RegularMarketPrice float64 `json:"regularMarketPrice"`
+						ChartPreviousClose float64 `json:"chartPreviousClose"`
+					} `json:"meta"`
+				} `json:"result"`
+			} `json:"chart"`
+		}
+		if err := tp.getJSON(ctx, base+url.PathEscape(symbol)+
+			"?range=1d&interval=1d", &chart); err != nil {
+			lastErr = fmt.Errorf("%s: %w", symbol, err)
+			continue
+		}
+		if len(chart.Chart.Result) == 0 {
+			lastErr = fmt.Errorf("%s: unknown symbol", symbol)
+			continue
+		}
+
+		meta := chart.Chart.Result[0].Meta
+		q := quote{price: meta.RegularMarketPrice}
+		if meta.ChartPreviousClose != 0 {
+			q.change = (q.price/meta.ChartPreviousClose - 1) * 100
+		}
+		quotes[symbol] = q
+	}
+	if len(quotes) == 0 {
+		return nil, lastErr
+	}
+	if lastErr != nil {
+		slog.Warn("Ticker failed", "error", lastErr)
+	}
+	return quotes, nil
+}
+
+// fetchCoinGecko uses CoinGecko, with coin IDs as symbols, such as "bitcoin".
+func fetchCoinGecko(ctx context.Context, tp *tickerProducer) (
+	map[string]quote, error) {
+	base := tp.URL
+	if base == "" {
+		base = "https://api.coingecko.com/api/v3/simple/price"
+	}
+
+	currency := strings.ToLower(tp.Currency)
+	var prices map[string]map[string]float64
+	if err := tp.getJSON(ctx, base+"?"+url.Values{
+		"ids":                 {strings.Join(tp.Symbols, ",")},
+		"vs_currencies":       {currency},
+		"include_24hr_change": {"true"},
+	}.Encode(), &prices); err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]quote)
+	for symbol, values := range prices {
+		if price, ok := values[currency]; ok {
+			quotes[symbol] = quote{price: price,
+				change: values[currency+"_24h_change"]}
+		}
+	}
+	return quotes, nil
+}
+
+// fetchCommand runs a user-supplied command.
+func fetchCommand(ctx context.Context, tp *tickerProducer) (
+	map[string]quote, error) {
+	cmd := exec.CommandContext(ctx, "/bin/sh",
+		append([]string{"-c", tp.Command, "sh"}, tp.Symbols...)...)
+	cmd.Stderr = stderrLogger("ticker", tp.Command)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]quote)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		price, err1 := strconv.ParseFloat(fields[1], 64)
+		change, err2 := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("unexpected command output: %q", scanner.Text())
+		}
+		quotes[fields[0]] = quote{price: price, change: change}
+	}
+	return quotes, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// formatPrice keeps about five significant digits, without going overboard.
+func formatPrice(price float64) string {
+	switch abs := math.Abs(price); {
+	case abs >= 10000:
+		return strconv.FormatFloat(price, 'f', 0, 64)
+	case abs >= 1:
+		return strconv.FormatFloat(price, 'f', 2, 64)
+	default:
+		return strconv.FormatFloat(price, 'g', 4, 64)
+	}
+}
+
+func (tp *tickerProducer) format(symbol string, q quote) string {
+	label := symbol
+	if l, ok := tp.Labels[symbol]; ok {
+		label = l
+	}
+
+	indicator := tp.Up
+	if q.change < 0 {
+		indicator = tp.Down
+	}
+	return fmt.Sprintf("%s %s%s%.1f%%",
+		label, formatPrice(q.price), indicator, math.Abs(q.change))
+}
+
+// items returns formatted quotes, in the order of configured symbols.
+func (tp *tickerProducer) items(quotes map[string]quote) []string {
+	var items []string
+	for _, symbol := range tp.Symbols {
+		if q, ok := quotes[symbol]; ok {
+			items = append(items, tp.format(symbol, q))
+		}
+	}
+	return items
+}
+
+func (tp *tickerProducer) fetch(ctx context.Context) []string {
+	quotes, err := quoteSources[tp.Source](ctx, tp)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("Ticker failed", "error", err)
+		}
+		return nil
+	}
+	return tp.items(quotes)
+}
+
+func (tp *tickerProducer) Run(ctx context.Context, out chan<- string) {
+	refresh := time.NewTicker(tp.Interval)
+	defer refresh.Stop()
+
+	var rotate <-chan time.Time
+	if tp.Rotate > 0 {
+		ticker := time.NewTicker(tp.Rotate)
+		defer ticker.Stop()
+		rotate = ticker.C
+	}
+
+	// Quotes are kept when fetching fails, even though they go stale.
+	items, index := tp.fetch(ctx), 0
+	for {
+		content := ""
+		if len(items) != 0 && tp.Rotate > 0 {
+			content = items[index%len(items)]
+		} else {
+			content = strings.Join(items, " ")
+		}
+		if !send(ctx, out, content) {
+			return
+		}
+
+		select {
+		case <-refresh.C:
+			if fetched := tp.fetch(ctx); fetched != nil {
+				items = fetched
+			}
+		case <-rotate:
+			index++
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// torrentProducer shows the aggregate download speed of a BitTorrent client,
+// and the progress of the most recently added torrent, such as
+// "2.4M/s 45% debian.iso". Finished downloads take over the display.
+type torrentProducer struct {
+	// Client is either "transmission", or "qbittorrent".
+	Client string `toml:"client"`
+	// URL is the client's RPC or Web UI address, and defaults to
+	// "http://localhost:9091/transmission/rpc" for Transmission,
+	// and "http://localhost:8080" for qBittorrent.
+	URL      string `toml:"url"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Alert takes over the display when a download finishes.
+	Alert    bool          `toml:"alert"`
+	Interval time.Duration `toml:"interval"`
+
+	client    *http.Client
+	sessionID string          // Transmission's CSRF protection token
+	finished  map[string]bool // by torrent ID, nil until the first update
+}
+
+// torrent is what is needed of a torrent, regardless of the client.
+type torrent struct {
+	ID       string
+	Name     string
+	Progress float64 // from zero to one
+	Added    int64   // Unix time
+}
+
+func init() {
+	registerProducer("torrent", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		tp := &torrentProducer{
+			Client:   "transmission",
+			Alert:    true,
+			Interval: 5 * time.Second,
+		}
+		if err := config.DecodeOptions(region, tp); err != nil {
+			return nil, err
+		}
+		switch tp.Client {
+		case "transmission":
+			if tp.URL == "" {
+				tp.URL = "http://localhost:9091/transmission/rpc"
+			}
+		case "qbittorrent":
+			if tp.URL == "" {
+				tp.URL = "http://localhost:8080"
+			}
+		default:
+			return nil, fmt.Errorf("unsupported client: %s", tp.Client)
+		}
+		if _, err := url.Parse(tp.URL); err != nil {
+			return nil, err
+		}
+		if tp.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+
+		// qBittorrent keeps sessions in cookies.
+		jar, _ := cookiejar.New(nil)
+		tp.client = &http.Client{Timeout: 10 * time.Second, Jar: jar}
+		return &periodicProducer{interval: tp.Interval, produce: tp.produce}, nil
+	})
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// transmission retrieves torrents over Transmission's JSON-RPC interface.
+func (tp *torrentProducer) transmission() ([]torrent, float64, error) {
+	body, _ := json.Marshal(map[string]any{
+		"method": "torrent-get",
+		"arguments": map[string]any{"fields": []string{
+			"hashString", "name", "percentDone", "rateDownload", "addedDate"}},
+	})
+
+	var resp *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, tp.URL,
+			bytes.NewReader(body))
+		if err != nil {
+			return nil, 0, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("X-Transmission-Session-Id", tp.sessionID)
+		if tp.Username != "" {
+			req.SetBasicAuth(tp.Username, tp.Password)
+		}
+		if resp, err = tp.client.Do(req); err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+
+		// The session ID needs to be renewed every now and then.
+		if resp.StatusCode != http.StatusConflict {
+			break
+		}
+		tp.sessionID = resp.Header.Get("X-Transmission-Session-Id")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, errors.New(resp.Status)
+	}
+
+	var result struct {
+		Result    string `json:"result"`
+		Arguments struct {
+			Torrents []struct {
+				HashString   string  `json:"hashString"`
+				Name         string  `json:"name"`
+				PercentDone  float64 `json:"percentDone"`
+				RateDownload float64 `json:"rateDownload"`
+				AddedDate    int64   `json:"addedDate"`
+			} `json:"torrents"`
+		} `json:"arguments"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, err
+	}
+	if result.Result != "success" {
+		return nil, 0, errors.New(result.Result)
+	}
+	var (
+		torrents []torrent
+		rate     float64
+	)
+	for _, t := range result.Arguments.Torrents {
+		torrents = append(torrents, torrent{
+			ID:       t.HashString,
+			Name:     t.Name,
+			Progress: t.PercentDone,
+			Added:    t.AddedDate,
+		})
+		rate += t.RateDownload
+	}
+	return torrents, rate, nil
+}
+
+// qbittorrentLogin starts a Web UI session.
+func (tp *torrentProducer) qbittorrentLogin() error {
+	form := url.Values{"username": {tp.Username}, "password": {tp.Password}}
+	req, err := http.NewRequest(http.MethodPost,
+		strings.TrimSuffix(tp.URL, "/")+"/api/v2/auth/login",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	// Cross-site request forgery protection compares these.
+	req.Header.Set("Referer", tp.URL)
+
+	resp, err := tp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// qbittorrent retrieves torrents over qBittorrent's Web UI API.
+func (tp *torrentProducer) qbittorrent() ([]torrent, float64, error) {
+	var resp *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodGet,
+			strings.TrimSuffix(tp.URL, "/")+"/api/v2/torrents/info", nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		if resp, err = tp.client.Do(req); err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+
+		// Sessions expire, and may not be needed at all for local clients.
+		if resp.StatusCode != http.StatusForbidden {
+			break
+		}
+		if err := tp.qbittorrentLogin(); err != nil {
+			return nil, 0, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, errors.New(resp.Status)
+	}
+
+	var result []struct {
+		Hash     string  `json:"hash"`
+		Name     string  `json:"name"`
+		Progress float64 `json:"progress"`
+		DLSpeed  float64 `json:"dlspeed"`
+		AddedOn  int64   `json:"added_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, err
+	}
+	var (
+		torrents []torrent
+		rate     float64
+	)
+	for _, t := range result {
+		torrents = append(torrents, torrent{
+			ID:       t.Hash,
+			Name:     t.Name,
+			Progress: t.Progress,
+			Added:    t.AddedOn,
+		})
+		rate += t.DLSpeed
+	}
+	return torrents, rate, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+func (tp *torrentProducer) produce() string {
+	var (
+		torrents []torrent
+		rate     float64
+		err      error
+	)
+	if tp.Client == "qbittorrent" {
+		torrents, rate, err = tp.qbittorrent()
+	} else {
+		torrents, rate, err = tp.transmission()
+	}
+	if err != nil {
+		slog.Warn("Torrent client failed", "client", tp.Client, "error", err)
+		return "BT ?"
+	}
+
+	finished := make(map[string]bool)
+	var latest *torrent
+	for i := range torrents {
+		t := &torrents[i]
+		if latest == nil || t.Added > latest.Added {
+			latest = t
+		}
+		if finished[t.ID] = t.Progress >= 1; !finished[t.ID] {
+			continue
+		}
+		if done, known := tp.finished[t.ID]; tp.Alert && known && !done {
+			slog.Info("Download finished", "name", t.Name)
+			Takeover(Message{
+				Text:     "Downloaded " + t.Name,
+				Duration: 10 * time.Second,
+				Line:     -1,
+			})
+		}
+	}
+	tp.finished = finished
+
+	var fields []string
+	if rate > 0 {
+		fields = append(fields, strings.TrimSpace(formatSize(rate))+"/s")
+	}
+	if latest != nil && latest.Progress < 1 {
+		fields = append(fields,
+			fmt.Sprintf("%d%% %s", int(latest.Progress*100), latest.Name))
+	}
+	return strings.Join(fields, " ")
+}
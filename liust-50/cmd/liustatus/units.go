@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// unitsProducer shows how many systemd units have failed, and names
+// the first one, such as "2 failed: backup.service", or nothing at all.
+type unitsProducer struct {
+	// Buses are any of "system", for system services,
+	// and "user", for the user's service manager.
+	Buses []string `toml:"buses"`
+	// Ignore lists units that are expected to fail.
+	Ignore   []string      `toml:"ignore"`
+	Interval time.Duration `toml:"interval"`
+
+	conns map[string]*dbus.Conn
+}
+
+func init() {
+	registerProducer("units", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		up := &unitsProducer{
+			Buses:    []string{"system", "user"},
+			Interval: 30 * time.Second,
+			conns:    make(map[string]*dbus.Conn),
+		}
+		if err := config.DecodeOptions(region, up); err != nil {
+			return nil, err
+		}
+		for _, bus := range up.Buses {
+			if bus != "system" && bus != "user" {
+				return nil, fmt.Errorf("unknown bus: %q", bus)
+			}
+		}
+		if up.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: up.Interval, produce: up.produce}, nil
+	})
+}
+
+// systemdUnit is an entry of the result of ListUnits.
+type systemdUnit struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Following   string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+// failed returns names of failed units, keeping the connection
+// to the bus for next time, unless something goes wrong.
+func (up *unitsProducer) failed(bus string) ([]string, error) {
+	conn := up.conns[bus]
+	if conn == nil {
+		var err error
+		if bus == "system" {
+			conn, err = dbus.ConnectSystemBus()
+		} else {
+			conn, err = dbus.ConnectSessionBus()
+		}
+		if err != nil {
+			return nil, err
+		}
+		up.conns[bus] = conn
+	}
+
+	var units []systemdUnit
+	if err := conn.Object("org.freedesktop.systemd1",
+		"/org/freedesktop/systemd1").Call(
+		"org.freedesktop.systemd1.Manager.ListUnitsFiltered", 0,
+		[]string{"failed"}).Store(&units); err != nil {
+		conn.Close()
+		delete(up.conns, bus)
+		return nil, err
+	}
+
+	var names []string
+	for _, unit := range units {
+		if !slices.Contains(up.Ignore, unit.Name) {
+			names = append(names, unit.Name)
+		}
+	}
+	return names, nil
+}
+
+func (up *unitsProducer) produce() string {
+	var failed []string
+	for _, bus := range up.Buses {
+		names, err := up.failed(bus)
+		if err != nil {
+			slog.Warn("systemd query failed", "bus", bus, "error", err)
+			continue
+		}
+		failed = append(failed, names...)
+	}
+	if len(failed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d failed: %s", len(failed), failed[0])
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uptimeProducer shows host uptime and load averages,
+// such as "3d04h 0.52 0.48 0.41", which fits within a single line.
+type uptimeProducer struct {
+	Interval time.Duration `toml:"interval"`
+}
+
+func init() {
+	registerProducer("uptime", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		up := &uptimeProducer{Interval: 10 * time.Second}
+		if err := config.DecodeOptions(region, up); err != nil {
+			return nil, err
+		}
+		if up.Interval <= 0 {
+			return nil, errors.New("the interval must be positive")
+		}
+		return &periodicProducer{interval: up.Interval, produce: up.produce}, nil
+	})
+}
+
+// formatUptime shows the two most significant units of a duration.
+func formatUptime(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	switch days, hours := minutes/60/24, minutes/60%24; {
+	case days > 0:
+		return fmt.Sprintf("%dd%02dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%02dm", hours, minutes%60)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// formatLoad shows a load average using four characters, where possible.
+func formatLoad(load float64) string {
+	switch {
+	case load < 9.995:
+		return fmt.Sprintf("%.2f", load)
+	case load < 99.95:
+		return fmt.Sprintf("%.1f", load)
+	default:
+		return fmt.Sprintf("%.0f", load)
+	}
+}
+
+// readUptime returns how long the system has been running.
+func readUptime() (time.Duration, error) {
+	b, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 1 {
+		return 0, errors.New("unexpected /proc/uptime format")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// readLoads returns all three load averages.
+func readLoads() ([]float64, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 3 {
+		return nil, errors.New("unexpected /proc/loadavg format")
+	}
+	loads := make([]float64, 3)
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil, err
+		}
+	}
+	return loads, nil
+}
+
+func (up *uptimeProducer) produce() string {
+	fields := []string{"?"}
+	if uptime, err := readUptime(); err == nil {
+		fields[0] = formatUptime(uptime)
+	}
+	loads, err := readLoads()
+	if err != nil {
+		return fields[0] + " ?"
+	}
+	for _, load := range loads {
+		fields = append(fields, formatLoad(load))
+	}
+	return strings.Join(fields, " ")
+}
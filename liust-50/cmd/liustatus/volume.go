@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// volumeProducer shows the volume of a PulseAudio or PipeWire sink,
+// such as "Vol 45%", and whenever it changes, briefly takes over a line
+// with a bar graph, acting as an on-screen display.
+// It relies on pactl, which also works with pipewire-pulse.
+type volumeProducer struct {
+	// Sink defaults to the default sink.
+	Sink string `toml:"sink"`
+	// PopupLine is the line to take over, or -1 for the whole display.
+	PopupLine     int           `toml:"popup_line"`
+	PopupDuration time.Duration `toml:"popup_duration"`
+	// BarFull and BarEmpty make up the bar graph.
+	BarFull  string `toml:"bar_full"`
+	BarEmpty string `toml:"bar_empty"`
+	// Retry is the delay before restarting pactl.
+	Retry time.Duration `toml:"retry"`
+}
+
+// volumeState is the state of a sink.
+type volumeState struct {
+	percent int
+	muted   bool
+}
+
+func init() {
+	registerProducer("volume", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		vp := &volumeProducer{
+			Sink:          "@DEFAULT_SINK@",
+			PopupLine:     1,
+			PopupDuration: 2 * time.Second,
+			BarFull:       "=",
+			BarEmpty:      "-",
+			Retry:         10 * time.Second,
+		}
+		if err := config.DecodeOptions(region, vp); err != nil {
+			return nil, err
+		}
+		if vp.PopupLine < -1 || vp.PopupLine >= displayHeight {
+			return nil, fmt.Errorf("invalid popup line: %d", vp.PopupLine)
+		}
+		if vp.PopupDuration < 0 {
+			return nil, errors.New("the popup duration must not be negative")
+		}
+		if len([]rune(vp.BarFull)) != 1 || len([]rune(vp.BarEmpty)) != 1 {
+			return nil, errors.New("bar graph parts must be single characters")
+		}
+		if vp.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return vp, nil
+	})
+}
+
+var volumeRE = regexp.MustCompile(`(\d+)%`)
+
+func (vp *volumeProducer) query(ctx context.Context) (volumeState, error) {
+	var state volumeState
+	out, err := exec.CommandContext(
+		ctx, "pactl", "get-sink-volume", vp.Sink).Output()
+	if err != nil {
+		return state, err
+	}
+	m := volumeRE.FindSubmatch(out)
+	if m == nil {
+		return state, errors.New("unexpected pactl output")
+	}
+	state.percent, _ = strconv.Atoi(string(m[1]))
+
+	out, err = exec.CommandContext(
+		ctx, "pactl", "get-sink-mute", vp.Sink).Output()
+	if err != nil {
+		return state, err
+	}
+	state.muted = strings.Contains(string(out), "yes")
+	return state, nil
+}
+
+func (vp *volumeProducer) format(state volumeState) string {
+	if state.muted {
+		return "Muted"
+	}
+	return fmt.Sprintf("Vol %d%%", state.percent)
+}
+
+// bar renders a bar graph taking up the whole width of the display.
+func (vp *volumeProducer) bar(state volumeState) string {
+	suffix := fmt.Sprintf(" %3d%%", state.percent)
+	if state.muted {
+		suffix = " mute"
+	}
+
+	width := displayWidth - len(suffix)
+	full := min(state.percent, 100) * width / 100
+	return strings.Repeat(vp.BarFull, full) +
+		strings.Repeat(vp.BarEmpty, width-full) + suffix
+}
+
+// watch follows changes reported by pactl subscribe.
+func (vp *volumeProducer) watch(ctx context.Context, out chan<- string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "pactl", "subscribe")
+	cmd.Stderr = stderrLogger("volume", "pactl subscribe")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		cancel()
+		cmd.Wait()
+	}()
+
+	// Only show popups for changes made while running.
+	last, err := vp.query(ctx)
+	if err != nil {
+		return err
+	}
+	if !send(ctx, out, vp.format(last)) {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// The default sink may change through the server.
+		line := scanner.Text()
+		if !strings.Contains(line, " on sink #") &&
+			!strings.Contains(line, " on server") {
+			continue
+		}
+
+		state, err := vp.query(ctx)
+		if err != nil {
+			return err
+		}
+		if state == last {
+			continue
+		}
+		if vp.PopupDuration > 0 {
+			Takeover(Message{
+				Text:     vp.bar(state),
+				Duration: vp.PopupDuration,
+				Line:     vp.PopupLine,
+				Tag:      "volume",
+			})
+		}
+		if last = state; !send(ctx, out, vp.format(state)) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("pactl subscribe terminated")
+}
+
+func (vp *volumeProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := vp.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("Volume monitoring failed", "error", err)
+		}
+		sleep(ctx, vp.Retry)
+	}
+}
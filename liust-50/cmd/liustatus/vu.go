@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+	"janouch.name/desktop-tools/liust-50/encoder"
+)
+
+// vuProducer renders a stereo VU meter of what is being played,
+// with the left channel growing leftwards from the middle of its region,
+// and the right channel rightwards. It relies on parec, which also works
+// with pipewire-pulse, recording from a sink's monitor source.
+type vuProducer struct {
+	// Source defaults to the default sink's monitor.
+	Source string `toml:"source"`
+	// Interval limits how often the meter is updated, as the serial link
+	// can only manage about a thousand characters a second.
+	Interval time.Duration `toml:"interval"`
+	// Floor is the level in dBFS that an empty meter corresponds to.
+	Floor float64 `toml:"floor"`
+	// BarFull and BarEmpty make up the meter. BarFull defaults to a block,
+	// or to "=" in charsets that have none, unless UserChars is set.
+	BarFull  string `toml:"bar_full"`
+	BarEmpty string `toml:"bar_empty"`
+	// UserChars makes BarFull default to a user-defined block,
+	// which works in any charset.
+	UserChars bool `toml:"user_chars"`
+	// Retry is the delay before restarting parec.
+	Retry time.Duration `toml:"retry"`
+
+	width int
+}
+
+func init() {
+	registerProducer("vu", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		vp := &vuProducer{
+			Source:   "@DEFAULT_MONITOR@",
+			Interval: 100 * time.Millisecond,
+			Floor:    -48,
+			BarEmpty: " ",
+			Retry:    10 * time.Second,
+			width:    region.Width,
+		}
+		if err := config.DecodeOptions(region, vp); err != nil {
+			return nil, err
+		}
+		if vp.BarFull == "" {
+			vp.BarFull = "█"
+			if vp.UserChars {
+				vp.BarFull = string(encoder.UserBlock)
+			} else if _, ok := charset.ResolveRune('█', region.charset); !ok {
+				vp.BarFull = "="
+			}
+		}
+		if vp.Interval <= 0 || vp.Retry <= 0 {
+			return nil, errors.New("intervals must be positive")
+		}
+		if vp.Floor >= 0 {
+			return nil, errors.New("the floor must be negative")
+		}
+		if len([]rune(vp.BarFull)) != 1 || len([]rune(vp.BarEmpty)) != 1 {
+			return nil, errors.New("meter parts must be single characters")
+		}
+		if !encoder.Encodable(vp.BarFull+vp.BarEmpty, region.charset) {
+			return nil, fmt.Errorf(
+				"charset %#x cannot show the meter", region.charset)
+		}
+		return vp, nil
+	})
+}
+
+// vuRate is the sampling rate to record at, which is plenty for a meter.
+const vuRate = 8000
+
+// level converts a root mean square of 16-bit samples
+// to how much of the meter it takes, from zero to one.
+func (vp *vuProducer) level(rms float64) float64 {
+	if rms <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(rms/math.MaxInt16)
+	return min(max(1-db/vp.Floor, 0), 1)
+}
+
+func (vp *vuProducer) format(left, right float64) string {
+	half := vp.width / 2
+	l := int(math.Round(vp.level(left) * float64(half)))
+	r := int(math.Round(vp.level(right) * float64(vp.width-half)))
+	return strings.Repeat(vp.BarEmpty, half-l) + strings.Repeat(vp.BarFull, l) +
+		strings.Repeat(vp.BarFull, r) + strings.Repeat(vp.BarEmpty, vp.width-half-r)
+}
+
+func (vp *vuProducer) watch(ctx context.Context, out chan<- string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "parec", "--raw", "--format=s16le",
+		"--channels=2", "--rate="+strconv.Itoa(vuRate), "--latency-msec=50",
+		"--device="+vp.Source)
+	cmd.Stderr = stderrLogger("vu", "parec")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		cancel()
+		cmd.Wait()
+	}()
+
+	var (
+		reader    = bufio.NewReader(stdout)
+		frame     [4]byte
+		sums      [2]float64
+		remaining = max(int(vp.Interval.Seconds()*vuRate), 1)
+		count     = remaining
+		last      string
+	)
+	for {
+		if _, err := io.ReadFull(reader, frame[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return errors.New("parec terminated")
+			}
+			return err
+		}
+		for i := range sums {
+			sample := float64(int16(binary.LittleEndian.Uint16(frame[i*2:])))
+			sums[i] += sample * sample
+		}
+		if remaining--; remaining > 0 {
+			continue
+		}
+
+		// Unchanged meters are not worth a write.
+		meter := vp.format(math.Sqrt(sums[0]/float64(count)),
+			math.Sqrt(sums[1]/float64(count)))
+		if meter != last && !send(ctx, out, meter) {
+			return nil
+		}
+		last, sums, remaining = meter, [2]float64{}, count
+	}
+}
+
+func (vp *vuProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := vp.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("VU meter failed", "error", err)
+		}
+		sleep(ctx, vp.Retry)
+	}
+}
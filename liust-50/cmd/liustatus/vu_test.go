@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+)
+
+func TestVUBar(t *testing.T) {
+	for _, test := range []struct {
+		charset   uint8
+		userChars bool
+		bar       string
+	}{
+		{0, false, "█"},
+		{0x63, false, "="},
+		{0, true, string(encoder.UserBlock)},
+		{0x63, true, string(encoder.UserBlock)},
+	} {
+		config := loadTestConfig(t, fmt.Sprintf(`charset = %d
+[[page]]
+[[page.region]]
+producer = "vu"
+options = { user_chars = %t }
+`, test.charset, test.userChars))
+		p, err := newProducer(config, &config.Displays[0].Pages[0].Regions[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bar := p.(*vuProducer).BarFull; bar != test.bar {
+			t.Errorf("charset %#x, user characters %t: got %q, expected %q",
+				test.charset, test.userChars, bar, test.bar)
+		}
+	}
+}
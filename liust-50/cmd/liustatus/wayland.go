@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// waylandConn is a minimal Wayland client connection, which only implements
+// what is needed to use the ext-idle-notify-v1 protocol.
+type waylandConn struct {
+	conn   net.Conn
+	nextID uint32
+}
+
+type waylandMessage struct {
+	object uint32
+	opcode uint16
+	args   []byte
+}
+
+// waylandDial connects to the compositor given by the environment.
+func waylandDial() (*waylandConn, error) {
+	path := os.Getenv("WAYLAND_DISPLAY")
+	if path == "" {
+		path = "wayland-0"
+	}
+	if !filepath.IsAbs(path) {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return nil, errors.New("XDG_RUNTIME_DIR is not set")
+		}
+		path = filepath.Join(dir, path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Object 1 is always the wl_display.
+	return &waylandConn{conn: conn, nextID: 2}, nil
+}
+
+func (c *waylandConn) newID() uint32 {
+	id := c.nextID
+	c.nextID++
+	return id
+}
+
+func waylandAppendString(b []byte, s string) []byte {
+	b = binary.NativeEndian.AppendUint32(b, uint32(len(s)+1))
+	b = append(b, s...)
+	return append(b, make([]byte, 1+x11Pad(len(s)+1))...)
+}
+
+func (c *waylandConn) send(object uint32, opcode uint16, args []byte) error {
+	ne := binary.NativeEndian
+	b := ne.AppendUint32(nil, object)
+	b = ne.AppendUint32(b, uint32(8+len(args))<<16|uint32(opcode))
+	_, err := c.conn.Write(append(b, args...))
+	return err
+}
+
+func (c *waylandConn) receive() (*waylandMessage, error) {
+	ne := binary.NativeEndian
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+
+	m := &waylandMessage{object: ne.Uint32(header)}
+	word := ne.Uint32(header[4:])
+	m.opcode = uint16(word)
+	if size := int(word >> 16); size < 8 {
+		return nil, errors.New("invalid Wayland message")
+	} else {
+		m.args = make([]byte, size-8)
+	}
+	if _, err := io.ReadFull(c.conn, m.args); err != nil {
+		return nil, err
+	}
+
+	// wl_display.error is always fatal.
+	if m.object == 1 && m.opcode == 0 {
+		return nil, fmt.Errorf("Wayland error: %s", m.string(8))
+	}
+	return m, nil
+}
+
+// uint32 reads an argument at the given offset.
+func (m *waylandMessage) uint32(offset int) uint32 {
+	if offset+4 > len(m.args) {
+		return 0
+	}
+	return binary.NativeEndian.Uint32(m.args[offset:])
+}
+
+// string reads a string argument at the given offset.
+func (m *waylandMessage) string(offset int) string {
+	length := int(m.uint32(offset))
+	if length == 0 || offset+4+length > len(m.args) {
+		return ""
+	}
+	return string(m.args[offset+4 : offset+4+length-1])
+}
+
+// watchIdle asks the compositor to notify about the user being idle
+// for the given duration, and coming back. Events are delivered to f.
+func (c *waylandConn) watchIdle(timeout time.Duration, f func(idle bool)) error {
+	ne := binary.NativeEndian
+	registry, sync := c.newID(), c.newID()
+	if err := c.send(1, 1, ne.AppendUint32(nil, registry)); err != nil {
+		return err
+	}
+	if err := c.send(1, 0, ne.AppendUint32(nil, sync)); err != nil {
+		return err
+	}
+
+	// Collect globals until the initial roundtrip is done.
+	globals := make(map[string]uint32)
+	for {
+		m, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if m.object == sync {
+			break
+		}
+		if m.object == registry && m.opcode == 0 {
+			name, iface := m.uint32(0), m.string(4)
+			if _, ok := globals[iface]; !ok {
+				globals[iface] = name
+			}
+		}
+	}
+
+	bind := func(iface string) (uint32, error) {
+		name, ok := globals[iface]
+		if !ok {
+			return 0, fmt.Errorf("Wayland compositor lacks %s", iface)
+		}
+		id := c.newID()
+		args := ne.AppendUint32(nil, name)
+		args = waylandAppendString(args, iface)
+		args = ne.AppendUint32(args, 1)
+		args = ne.AppendUint32(args, id)
+		return id, c.send(registry, 0, args)
+	}
+	seat, err := bind("wl_seat")
+	if err != nil {
+		return err
+	}
+	notifier, err := bind("ext_idle_notifier_v1")
+	if err != nil {
+		return err
+	}
+
+	notification := c.newID()
+	args := ne.AppendUint32(nil, notification)
+	args = ne.AppendUint32(args, uint32(timeout/time.Millisecond))
+	args = ne.AppendUint32(args, seat)
+	if err := c.send(notifier, 1, args); err != nil {
+		return err
+	}
+
+	for {
+		m, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if m.object == notification {
+			f(m.opcode == 0)
+		}
+	}
+}
+
+func (c *waylandConn) Close() error {
+	return c.conn.Close()
+}
+
+// waylandAvailable tells whether a Wayland session seems to be running.
+func waylandAvailable() bool {
+	return os.Getenv("WAYLAND_DISPLAY") != "" ||
+		strings.EqualFold(os.Getenv("XDG_SESSION_TYPE"), "wayland")
+}
@@ -1,132 +1,391 @@
 package main
 
 import (
-	"encoding/xml"
+	"context"
+	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
+	"math"
+	"math/rand"
 	"net/http"
-	"strconv"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/weather"
 )
 
-const (
-	baseURL   = "https://api.met.no/weatherapi"
-	userAgent = "liustatus/1.0"
+const userAgent = "liustatus/1.0"
 
-	// Prague coordinates.
-	lat      = 50.08804
-	lon      = 14.42076
-	altitude = 202
-)
+func init() {
+	weather.UserAgent = userAgent
+}
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 
-type Weatherdata struct {
-	XMLName xml.Name `xml:"weatherdata"`
-	Product Product  `xml:"product"`
+// temperatureUnits convert from degrees Celsius, which providers use.
+var temperatureUnits = map[string]func(float64) float64{
+	"C": func(c float64) float64 { return c },
+	"F": func(c float64) float64 { return c*9/5 + 32 },
+}
+
+// windUnits are expressed in metres per second, which providers use.
+var windUnits = map[string]float64{
+	"m/s":  1,
+	"km/h": 1000. / 3600,
+	"mph":  1609.344 / 3600,
+	"kn":   1852. / 3600,
+}
+
+// precipitationUnits are expressed in millimetres, which providers use.
+var precipitationUnits = map[string]float64{
+	"mm": 1,
+	"in": 25.4,
+}
+
+// formatTemperature converts a temperature from degrees Celsius.
+func (w *WeatherConfig) formatTemperature(celsius float64) string {
+	value := temperatureUnits[w.TemperatureUnit](celsius)
+	return fmt.Sprintf("%dﾟ", int(math.Round(value)))
+}
+
+// formatPrecipitation converts precipitation from millimetres,
+// leaving it out if there is none, or it is unknown.
+func (w *WeatherConfig) formatPrecipitation(c *weather.Conditions) string {
+	if !w.Precipitation || c.Precipitation == nil || *c.Precipitation <= 0 {
+		return ""
+	}
+	value := *c.Precipitation / precipitationUnits[w.PrecipitationUnit]
+	if w.PrecipitationUnit == "in" {
+		return fmt.Sprintf("%.2fin", value)
+	}
+	return fmt.Sprintf("%.1f%s", value, w.PrecipitationUnit)
 }
 
-type Product struct {
-	Times []Time `xml:"time"`
+// formatRange formats today's lowest and highest temperatures,
+// such as "2ﾟ/9ﾟ", leaving them out if they are unknown.
+func (w *WeatherConfig) formatRange(c *weather.Conditions) string {
+	if !w.Range || c.Low == nil || c.High == nil {
+		return ""
+	}
+	return w.formatTemperature(*c.Low) + "/" + w.formatTemperature(*c.High)
 }
 
-type Time struct {
-	From     string   `xml:"from,attr"`
-	To       string   `xml:"to,attr"`
-	Location Location `xml:"location"`
+// compassPoints name directions, starting from the north, clockwise.
+var compassPoints = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
+// windArrows point to where the wind blows, for winds from the north,
+// clockwise. Only the four main arrows are available, in the Japanese charset.
+var windArrows = []string{"↓", "←", "↑", "→"}
+
+// formatWindSpeed converts a wind speed from metres per second.
+func (w *WeatherConfig) formatWindSpeed(mps float64) string {
+	value := mps / windUnits[w.WindUnit]
+	return fmt.Sprintf("%d%s", int(math.Round(value)), w.WindUnit)
 }
 
-type Location struct {
-	Temperature *Temperature `xml:"temperature"`
+// formatWind describes the wind, such as "NW 3m/s", or "↓3m/s" with arrows,
+// leaving it out if it is unknown.
+func (w *WeatherConfig) formatWind(c *weather.Conditions) string {
+	if !w.Wind || c.WindSpeed == nil {
+		return ""
+	}
+	speed := w.formatWindSpeed(*c.WindSpeed)
+	if c.WindDirection == nil {
+		return speed
+	}
+
+	from := math.Mod(*c.WindDirection+360, 360)
+	if w.WindArrows {
+		return windArrows[int(math.Round(from/90))%4] + speed
+	}
+	return compassPoints[int(math.Round(from/45))%8] + " " + speed
 }
 
-type Temperature struct {
-	Unit  string `xml:"unit,attr"`
-	Value string `xml:"value,attr"`
+// weatherIcons are the default glyphs for weather.Symbols,
+// which are user-defined characters downloaded to the display.
+var weatherIcons = map[string]string{
+	"clear":        string(encoder.IconClear),
+	"partlycloudy": string(encoder.IconPartlyCloudy),
+	"cloudy":       string(encoder.IconCloudy),
+	"fog":          string(encoder.IconFog),
+	"rain":         string(encoder.IconRain),
+	"sleet":        string(encoder.IconSleet),
+	"snow":         string(encoder.IconSnow),
+	"thunder":      string(encoder.IconThunder),
+}
+
+// formatIcon returns the glyph for the weather symbol, if icons are enabled.
+func (w *WeatherConfig) formatIcon(c *weather.Conditions) string {
+	if !w.Icons {
+		return ""
+	}
+	return w.icons[c.Symbol]
+}
+
+// formatCurrent formats the current temperature, marking stale readings
+// with an asterisk in place of the degree sign, so that it still fits.
+func (w *WeatherConfig) formatCurrent(c *weather.Conditions, stale bool) string {
+	text := w.formatTemperature(c.Temperature)
+	if stale {
+		text = strings.TrimSuffix(text, "ﾟ") + "*"
+	}
+	return text
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 
+// weatherMaxBackoff limits how long fetching may be postponed after failures.
+const weatherMaxBackoff = time.Hour
+
+// weatherBackoff returns how long to wait after failing to fetch data,
+// backing off exponentially from the regular interval, with some jitter.
+func weatherBackoff(interval time.Duration, failures int) time.Duration {
+	delay := min(interval<<min(failures, 10), weatherMaxBackoff)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// weatherLocation converts the location for the weather package.
+func (l *LocationConfig) weatherLocation() weather.Location {
+	return weather.Location{
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+		Altitude:  l.Altitude,
+	}
+}
+
 // WeatherFetcher handles weather data retrieval.
 type WeatherFetcher struct {
-	client *http.Client
+	provider weather.Provider
+	location weather.Location
+	pending  bool // whether the location is yet to be looked up
+	config   *WeatherConfig
+	format   func(c *weather.Conditions, stale bool) string
+
+	last     *weather.Conditions // the last conditions retrieved, if any
+	updated  time.Time           // when the conditions were last up to date
+	failures int                 // how many times fetching has failed in a row
 }
 
-// NewWeatherFetcher creates a new weather fetcher instance.
-func NewWeatherFetcher() *WeatherFetcher {
-	return &WeatherFetcher{
-		client: &http.Client{Timeout: 30 * time.Second},
+// NewWeatherFetcher creates a new weather fetcher instance,
+// starting out with the last conditions kept on disk, if any.
+func NewWeatherFetcher(
+	location LocationConfig, config *WeatherConfig) *WeatherFetcher {
+	w := &WeatherFetcher{
+		provider: weatherProviders.Get(config.Provider, config.APIKey),
+		location: location.weatherLocation(),
+		pending:  location.pending,
+		config:   config,
+		format:   config.formatCurrent,
 	}
+	if entry, ok := loadWeatherCache(weatherCachePath())[w.cacheKey()]; ok &&
+		entry.Conditions != nil && time.Since(entry.Updated) < weatherCacheMaxAge {
+		w.last, w.updated = entry.Conditions, entry.Updated
+		weatherLatest.Set(w.cacheKey(), entry)
+	}
+	return w
 }
 
-// fetchWeather retrieves the current temperature from the API.
-func (w *WeatherFetcher) fetchWeather() (string, error) {
-	url := fmt.Sprintf(
-		"%s/locationforecast/2.0/classic?lat=%.5f&lon=%.5f&altitude=%d",
-		baseURL, lat, lon, altitude)
+// weatherCacheKey identifies conditions at a location within the weather cache.
+func weatherCacheKey(provider string, location weather.Location) string {
+	return fmt.Sprintf("%s %.4f,%.4f",
+		provider, location.Latitude, location.Longitude)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
+func (w *WeatherFetcher) cacheKey() string {
+	return weatherCacheKey(w.config.Provider, w.location)
+}
+
+// text formats the last conditions, or returns an empty string.
+func (w *WeatherFetcher) text() string {
+	if w.last == nil {
+		return ""
 	}
+	return w.format(w.last, time.Since(w.updated) > w.config.StaleAfter)
+}
 
-	req.Header.Set("User-Agent", userAgent)
+// update fetches new weather data and returns it, along with how long
+// to wait before the next update. Failures keep the last conditions around,
+// while making the fetcher back off.
+func (w *WeatherFetcher) update(
+	ctx context.Context, interval time.Duration) (string, time.Duration) {
+	conditions, err := w.provider.Current(ctx, w.location)
+	if conditions != nil {
+		w.last = conditions
+	}
 
-	resp, err := w.client.Do(req)
+	delay := interval
 	if err != nil {
-		return "", err
+		slog.Warn("Error fetching weather",
+			"provider", w.config.Provider, "error", err)
+		w.failures++
+		delay = weatherBackoff(interval, w.failures)
+	} else {
+		slog.Debug("Weather updated", "temperature", conditions.Temperature,
+			"condition", conditions.Condition)
+		w.updated, w.failures = time.Now(), 0
+		entry := weatherCacheEntry{Conditions: conditions, Updated: w.updated}
+		storeWeatherCache(w.cacheKey(), entry)
+		weatherLatest.Set(w.cacheKey(), entry)
+	}
+	return w.text(), delay
+}
+
+// Run runs as a goroutine to periodically fetch weather data.
+func (w *WeatherFetcher) Run(
+	ctx context.Context, interval time.Duration, output chan<- string) {
+	// There is nothing to fetch until the configuration is reloaded.
+	if w.pending {
+		<-ctx.Done()
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status %d", resp.StatusCode)
+	// Fetching may take a while, or fail, such as right after booting up.
+	if w.last != nil && !send(ctx, output, w.text()) {
+		return
 	}
+	for {
+		text, delay := w.update(ctx, interval)
+		if !send(ctx, output, text) || !sleep(ctx, delay) {
+			return
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 
-	body, err := io.ReadAll(resp.Body)
+// weatherCacheMaxAge limits how old conditions loaded from disk may be.
+const weatherCacheMaxAge = 24 * time.Hour
+
+// weatherCachePath returns where to keep the last conditions at locations,
+// or an empty string if there is no suitable place.
+func weatherCachePath() string {
+	dir, err := os.UserCacheDir()
 	if err != nil {
-		return "", err
+		return ""
 	}
+	return filepath.Join(dir, "liustatus", "weather.json")
+}
+
+// weatherCacheEntry is the last successfully retrieved conditions.
+type weatherCacheEntry struct {
+	Conditions *weather.Conditions
+	Updated    time.Time
+}
+
+// weatherCache maps fetcher cache keys to their last conditions.
+type weatherCache map[string]weatherCacheEntry
 
-	var weatherData Weatherdata
-	if err := xml.Unmarshal(body, &weatherData); err != nil {
-		return "", err
+// weatherCacheMutex serializes fetchers updating the cache file.
+var weatherCacheMutex sync.Mutex
+
+func loadWeatherCache(path string) weatherCache {
+	cache := make(weatherCache)
+	if path == "" {
+		return cache
+	}
+	if b, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(b, &cache)
 	}
+	return cache
+}
 
-	now := time.Now().UTC()
-	for _, t := range weatherData.Product.Times {
-		toTime, err := time.Parse("2006-01-02T15:04:05Z", t.To)
-		if err != nil || toTime.Before(now) {
-			continue
-		}
-		if t.Location.Temperature != nil {
-			temp, err := strconv.ParseFloat(t.Location.Temperature.Value, 64)
-			if err != nil {
-				continue
-			}
-			return fmt.Sprintf("%dﾟ", int(temp)), nil
-		}
+// storeWeatherCache updates a single entry of the cache file.
+func storeWeatherCache(key string, entry weatherCacheEntry) {
+	path := weatherCachePath()
+	if path == "" {
+		return
 	}
 
-	return "", fmt.Errorf("no usable temperature data found")
+	weatherCacheMutex.Lock()
+	defer weatherCacheMutex.Unlock()
+
+	cache := loadWeatherCache(path)
+	cache[key] = entry
+	if err := saveJSON(path, cache); err != nil {
+		slog.Warn("Weather cache not saved", "path", path, "error", err)
+	}
 }
 
-// update fetches new weather data and returns it.
-func (w *WeatherFetcher) update() string {
-	temp, err := w.fetchWeather()
-	if err != nil {
-		log.Printf("Error fetching weather: %v", err)
+// weatherLatestState shares the last conditions of all fetchers,
+// by their cache keys, such as with the kaomoji.
+type weatherLatestState struct {
+	mu      sync.Mutex
+	entries map[string]weatherCacheEntry
+}
+
+var weatherLatest = weatherLatestState{
+	entries: make(map[string]weatherCacheEntry),
+}
+
+func (wl *weatherLatestState) Set(key string, entry weatherCacheEntry) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	wl.entries[key] = entry
+}
+
+// Get returns the last conditions, if they are no older than maxAge.
+func (wl *weatherLatestState) Get(
+	key string, maxAge time.Duration) *weather.Conditions {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	if entry, ok := wl.entries[key]; ok && time.Since(entry.Updated) < maxAge {
+		return entry.Conditions
 	}
-	return temp
+	return nil
 }
 
-// Run runs as a goroutine to periodically fetch weather data.
-func (w *WeatherFetcher) Run(interval time.Duration, output chan<- string) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// weatherProvidersState shares providers between all fetchers, and across
+// reloads, so that their caches of responses are put to good use.
+type weatherProvidersState struct {
+	mu        sync.Mutex
+	client    *http.Client
+	providers map[[2]string]weather.Provider // by name and API key
+}
 
-	output <- w.update()
-	for range ticker.C {
-		output <- w.update()
+var weatherProviders = weatherProvidersState{
+	client:    &http.Client{Timeout: 30 * time.Second},
+	providers: make(map[[2]string]weather.Provider),
+}
+
+// Get returns the provider of the given name, creating it as necessary.
+func (wp *weatherProvidersState) Get(name, apiKey string) weather.Provider {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	key := [2]string{name, apiKey}
+	if p, ok := wp.providers[key]; ok {
+		return p
 	}
+	p := weather.Providers[name](wp.client, apiKey)
+	wp.providers[key] = p
+	return p
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// The weather producer shows current conditions in more detail than
+// the status line has space for, such as "12ﾟ 2ﾟ/14ﾟ 0.4mm NW 3m/s Light rain"
+// with everything enabled, after an icon, as far as the weather provider
+// describes them.
+func init() {
+	registerProducer("weather", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		fetcher := NewWeatherFetcher(config.Location, &config.Weather)
+		fetcher.format = func(c *weather.Conditions, stale bool) string {
+			return strings.Join(strings.Fields(strings.Join([]string{
+				config.Weather.formatIcon(c),
+				config.Weather.formatCurrent(c, stale),
+				config.Weather.formatRange(c),
+				config.Weather.formatPrecipitation(c),
+				config.Weather.formatWind(c),
+				c.Condition,
+			}, " ")), " ")
+		}
+		return ProducerFunc(func(ctx context.Context, out chan<- string) {
+			fetcher.Run(ctx, config.Weather.Interval, out)
+		}), nil
+	})
 }
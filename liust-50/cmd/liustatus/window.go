@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// windowProducer shows the title of the active X11 window, as announced
+// by EWMH-compliant window managers, updated as it changes.
+type windowProducer struct {
+	// Retry is the delay before reconnecting.
+	Retry time.Duration `toml:"retry"`
+}
+
+func init() {
+	registerProducer("window", func(config *Config, region *RegionConfig) (
+		Producer, error) {
+		wp := &windowProducer{Retry: 10 * time.Second}
+		if err := config.DecodeOptions(region, wp); err != nil {
+			return nil, err
+		}
+		if wp.Retry <= 0 {
+			return nil, errors.New("the retry delay must be positive")
+		}
+		return wp, nil
+	})
+}
+
+const (
+	x11AtomWMName         = 39
+	x11PropertyNotify     = 28
+	x11PropertyChangeMask = 0x400000
+)
+
+// windowTitle prefers _NET_WM_NAME, which is always UTF-8, to WM_NAME,
+// which is usually Latin-1 with older applications.
+func windowTitle(c *x11Conn, window, netWMName uint32) (string, error) {
+	if window == 0 {
+		return "", nil
+	}
+	title, err := c.getProperty(window, netWMName)
+	if err != nil || len(title) != 0 {
+		return string(title), err
+	}
+	if title, err = c.getProperty(window, x11AtomWMName); err != nil {
+		return "", err
+	}
+	if utf8.Valid(title) {
+		return string(title), nil
+	}
+
+	var b strings.Builder
+	for _, r := range title {
+		b.WriteRune(rune(r))
+	}
+	return b.String(), nil
+}
+
+func (wp *windowProducer) watch(ctx context.Context, out chan<- string) error {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return errors.New("X11 doesn't seem to be available")
+	}
+	c, err := x11Dial(display)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	netActiveWindow, err := c.internAtom("_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return err
+	}
+	netWMName, err := c.internAtom("_NET_WM_NAME")
+	if err != nil {
+		return err
+	}
+	if err := c.selectEvents(c.root, x11PropertyChangeMask); err != nil {
+		return err
+	}
+
+	var active uint32
+	for update := true; ; {
+		if update {
+			value, err := c.getProperty(c.root, netActiveWindow)
+			if err != nil {
+				return err
+			}
+			var next uint32
+			if len(value) >= 4 {
+				next = binary.LittleEndian.Uint32(value)
+			}
+			// Windows may disappear at any moment, so errors are ignored.
+			if next != active {
+				if active != 0 {
+					c.selectEvents(active, 0)
+				}
+				if active = next; active != 0 {
+					c.selectEvents(active, x11PropertyChangeMask)
+				}
+			}
+
+			title, _ := windowTitle(c, active, netWMName)
+			if !send(ctx, out, title) {
+				return nil
+			}
+		}
+
+		event, err := c.nextEvent()
+		if err != nil {
+			return err
+		}
+		le := binary.LittleEndian
+		window, atom := le.Uint32(event[4:]), le.Uint32(event[8:])
+		update = event[0] == x11PropertyNotify &&
+			(window == c.root && atom == netActiveWindow ||
+				window == active && (atom == netWMName || atom == x11AtomWMName))
+	}
+}
+
+func (wp *windowProducer) Run(ctx context.Context, out chan<- string) {
+	for ctx.Err() == nil {
+		if err := wp.watch(ctx, out); err != nil && ctx.Err() == nil {
+			slog.Warn("Window title failed", "error", err)
+		}
+		sleep(ctx, wp.Retry)
+	}
+}
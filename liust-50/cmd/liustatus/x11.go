@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// x11Conn is a minimal X11 client connection, which only implements
+// what is needed to query the MIT-SCREEN-SAVER extension,
+// and to watch window properties.
+type x11Conn struct {
+	conn   net.Conn
+	root   uint32
+	seq    uint16
+	events [][]byte // queued events
+}
+
+// x11ParseDisplay splits a DISPLAY value into a host and a display number.
+func x11ParseDisplay(display string) (host string, number string, err error) {
+	colon := strings.LastIndexByte(display, ':')
+	if colon < 0 {
+		return "", "", fmt.Errorf("invalid DISPLAY: %q", display)
+	}
+	host, number = display[:colon], display[colon+1:]
+	if dot := strings.IndexByte(number, '.'); dot >= 0 {
+		number = number[:dot]
+	}
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", "", fmt.Errorf("invalid DISPLAY: %q", display)
+	}
+	return host, number, nil
+}
+
+// x11ReadAuthority finds an MIT-MAGIC-COOKIE-1 for the given display.
+func x11ReadAuthority(host, number string) (name string, data []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".Xauthority")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil
+	}
+	defer f.Close()
+
+	if host == "" || host == "unix" {
+		host, _ = os.Hostname()
+	}
+
+	r := bufio.NewReader(f)
+	readString := func() ([]byte, error) {
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		b := make([]byte, length)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			return "", nil
+		}
+		var fields [4][]byte
+		for i := range fields {
+			if fields[i], err = readString(); err != nil {
+				return "", nil
+			}
+		}
+
+		// Only local and wildcard entries are of any interest.
+		const familyLocal, familyWild = 256, 65535
+		if family == familyLocal && string(fields[0]) != host ||
+			family != familyLocal && family != familyWild {
+			continue
+		}
+		if len(fields[1]) != 0 && string(fields[1]) != number {
+			continue
+		}
+		if string(fields[2]) == "MIT-MAGIC-COOKIE-1" {
+			return string(fields[2]), fields[3]
+		}
+	}
+}
+
+func x11Pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+// x11Dial connects to the X server given by the DISPLAY value.
+func x11Dial(display string) (*x11Conn, error) {
+	host, number, err := x11ParseDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if host == "" || host == "unix" {
+		conn, err = net.Dial("unix", "/tmp/.X11-unix/X"+number)
+	} else {
+		n, _ := strconv.Atoi(number)
+		conn, err = net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &x11Conn{conn: conn}
+	if err := c.setup(host, number); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *x11Conn) setup(host, number string) error {
+	name, data := x11ReadAuthority(host, number)
+
+	le := binary.LittleEndian
+	req := []byte{'l', 0}
+	req = le.AppendUint16(req, 11)
+	req = le.AppendUint16(req, 0)
+	req = le.AppendUint16(req, uint16(len(name)))
+	req = le.AppendUint16(req, uint16(len(data)))
+	req = append(req, 0, 0)
+	req = append(req, name...)
+	req = append(req, make([]byte, x11Pad(len(name)))...)
+	req = append(req, data...)
+	req = append(req, make([]byte, x11Pad(len(data)))...)
+	if _, err := c.conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return err
+	}
+	info := make([]byte, int(le.Uint16(header[6:]))*4)
+	if _, err := io.ReadFull(c.conn, info); err != nil {
+		return err
+	}
+	if header[0] != 1 {
+		reason := info
+		if header[0] == 0 {
+			reason = info[:min(int(header[1]), len(info))]
+		}
+		return fmt.Errorf("X11 connection refused: %s",
+			strings.TrimSpace(string(reason)))
+	}
+
+	// Find the root window of the first screen.
+	if len(info) < 32 {
+		return errors.New("X11 setup reply too short")
+	}
+	vendorLen, formats := int(le.Uint16(info[16:])), int(info[21])
+	offset := 32 + vendorLen + x11Pad(vendorLen) + formats*8
+	if len(info) < offset+4 {
+		return errors.New("X11 setup reply too short")
+	}
+	c.root = le.Uint32(info[offset:])
+	return nil
+}
+
+// request sends a request, and reads its reply,
+// returning the fixed 32-byte part and any extra data separately.
+// Events received in the meantime are queued for nextEvent.
+func (c *x11Conn) request(req []byte) ([]byte, []byte, error) {
+	if err := c.send(req); err != nil {
+		return nil, nil, err
+	}
+	for {
+		reply, extra, err := c.read()
+		if err != nil {
+			return nil, nil, err
+		}
+		seq := binary.LittleEndian.Uint16(reply[2:])
+		switch {
+		case reply[0] == 0 && seq == c.seq:
+			return nil, nil, fmt.Errorf("X11 error %d", reply[1])
+		case reply[0] == 1 && seq == c.seq:
+			return reply, extra, nil
+		case reply[0] > 1:
+			c.events = append(c.events, reply)
+		}
+		// Errors caused by requests without replies are ignored.
+	}
+}
+
+// send sends a request without waiting for any reply.
+func (c *x11Conn) send(req []byte) error {
+	if _, err := c.conn.Write(req); err != nil {
+		return err
+	}
+	c.seq++
+	return nil
+}
+
+// read reads a reply, an error, or an event.
+func (c *x11Conn) read() ([]byte, []byte, error) {
+	reply := make([]byte, 32)
+	if _, err := io.ReadFull(c.conn, reply); err != nil {
+		return nil, nil, err
+	}
+	if reply[0] != 1 {
+		return reply, nil, nil
+	}
+	extra := make([]byte, int(binary.LittleEndian.Uint32(reply[4:]))*4)
+	if _, err := io.ReadFull(c.conn, extra); err != nil {
+		return nil, nil, err
+	}
+	return reply, extra, nil
+}
+
+// nextEvent waits for an event, with the SendEvent flag cleared.
+func (c *x11Conn) nextEvent() ([]byte, error) {
+	for len(c.events) == 0 {
+		event, _, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if event[0] > 1 {
+			c.events = append(c.events, event)
+		}
+	}
+	event := c.events[0]
+	c.events = c.events[1:]
+	event[0] &= 0x7f
+	return event, nil
+}
+
+// queryExtension returns the major opcode of an extension,
+// and the code of its first event.
+func (c *x11Conn) queryExtension(name string) (
+	opcode, firstEvent uint8, err error) {
+	le := binary.LittleEndian
+	req := []byte{98, 0}
+	req = le.AppendUint16(req, uint16(2+(len(name)+x11Pad(len(name)))/4))
+	req = le.AppendUint16(req, uint16(len(name)))
+	req = append(req, 0, 0)
+	req = append(req, name...)
+	req = append(req, make([]byte, x11Pad(len(name)))...)
+
+	reply, _, err := c.request(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	if reply[8] == 0 {
+		return 0, 0, fmt.Errorf("X11 extension not present: %s", name)
+	}
+	return reply[9], reply[10], nil
+}
+
+// idleTime uses ScreenSaverQueryInfo to find out
+// how long it has been since the last user input.
+func (c *x11Conn) idleTime(opcode uint8) (time.Duration, error) {
+	le := binary.LittleEndian
+	req := []byte{opcode, 1}
+	req = le.AppendUint16(req, 2)
+	req = le.AppendUint32(req, c.root)
+
+	reply, _, err := c.request(req)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(le.Uint32(reply[16:])) * time.Millisecond, nil
+}
+
+// internAtom returns the atom of the given name.
+func (c *x11Conn) internAtom(name string) (uint32, error) {
+	le := binary.LittleEndian
+	req := []byte{16, 0}
+	req = le.AppendUint16(req, uint16(2+(len(name)+x11Pad(len(name)))/4))
+	req = le.AppendUint16(req, uint16(len(name)))
+	req = append(req, 0, 0)
+	req = append(req, name...)
+	req = append(req, make([]byte, x11Pad(len(name)))...)
+
+	reply, _, err := c.request(req)
+	if err != nil {
+		return 0, err
+	}
+	return le.Uint32(reply[8:]), nil
+}
+
+// getProperty returns the value of a window property of any type,
+// or nil if it doesn't exist. Values are limited to 64 KiB.
+func (c *x11Conn) getProperty(window, property uint32) ([]byte, error) {
+	le := binary.LittleEndian
+	req := []byte{20, 0}
+	req = le.AppendUint16(req, 6)
+	req = le.AppendUint32(req, window)
+	req = le.AppendUint32(req, property)
+	req = le.AppendUint32(req, 0 /* AnyPropertyType */)
+	req = le.AppendUint32(req, 0)
+	req = le.AppendUint32(req, 16384)
+
+	reply, extra, err := c.request(req)
+	if err != nil {
+		return nil, err
+	}
+	if le.Uint32(reply[8:]) == 0 /* None */ {
+		return nil, nil
+	}
+	length := int(le.Uint32(reply[16:])) * int(reply[1]/8)
+	return extra[:min(length, len(extra))], nil
+}
+
+// selectEvents sets the event mask of a window for this client.
+func (c *x11Conn) selectEvents(window, mask uint32) error {
+	const cwEventMask = 0x800
+
+	le := binary.LittleEndian
+	req := []byte{2, 0}
+	req = le.AppendUint16(req, 4)
+	req = le.AppendUint32(req, window)
+	req = le.AppendUint32(req, cwEventMask)
+	req = le.AppendUint32(req, mask)
+	return c.send(req)
+}
+
+func (c *x11Conn) Close() error {
+	return c.conn.Close()
+}
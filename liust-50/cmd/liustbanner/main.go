@@ -0,0 +1,150 @@
+// liustbanner scrolls a message across a LIUST-50 display.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+// japanCharset is the Japan-2 character set, which has half-width katakana.
+const japanCharset = 0x63
+
+// hasKatakana tells whether the text needs the Japan-2 character set.
+func hasKatakana(text string) bool {
+	return strings.ContainsFunc(text, func(r rune) bool {
+		return r >= '｡' && r <= 'ﾟ'
+	})
+}
+
+// frames returns the contents of a row at all scrolling positions,
+// as the text enters the display from one side, and leaves at the other.
+func frames(text string, charsetID uint8, rightwards bool) [][]byte {
+	blank := bytes.Repeat([]byte{' '}, takeover.Width)
+	band := slices.Concat(blank, encoder.Text(text, charsetID), blank)
+
+	var result [][]byte
+	for i := 0; i+takeover.Width <= len(band); i++ {
+		result = append(result, band[i:i+takeover.Width])
+	}
+	if rightwards {
+		slices.Reverse(result)
+	}
+	return result
+}
+
+// scroll runs the message across the display the given number of times,
+// or indefinitely if it is zero.
+func scroll(w io.Writer, rows [][][]byte, firstRow int,
+	interval time.Duration, repeat int) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for n := 0; repeat == 0 || n < repeat; n++ {
+		for i := range rows[0] {
+			var b bytes.Buffer
+			for y, positions := range rows {
+				b.Write(encoder.Locate(firstRow+y, 0))
+				b.Write(positions[i])
+			}
+			if _, err := w.Write(b.Bytes()); err != nil {
+				return err
+			}
+			<-ticker.C
+		}
+	}
+	return nil
+}
+
+func main() {
+	var (
+		charsetID = flag.Uint("charset", 0, "character set to encode text in, "+
+			"Japan-2 by default for text with katakana")
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		line = flag.Int("line", 1,
+			"line to scroll on, or 0 for both, taking a line of text each")
+		speed  = flag.Float64("speed", 5, "speed in characters per second")
+		right  = flag.Bool("right", false, "scroll to the right")
+		repeat = flag.Int("repeat", 1, "how many times to scroll, 0 for ever")
+	)
+	flag.Parse()
+	if *line < 0 || *line > takeover.Height {
+		log.Fatalf("invalid line: %d\n", *line)
+	}
+	if *speed <= 0 {
+		log.Fatalf("invalid speed: %g\n", *speed)
+	}
+	if *repeat < 0 {
+		log.Fatalf("invalid repeat count: %d\n", *repeat)
+	}
+	if *charsetID > 0xff {
+		log.Fatalf("invalid charset: %d\n", *charsetID)
+	}
+
+	// The message is taken from arguments, or from the standard input.
+	text := strings.Join(flag.Args(), " ")
+	if flag.NArg() == 0 {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		text = strings.TrimRight(string(b), "\n")
+	}
+	text = encoder.Narrow(text)
+
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "charset" })
+	if !explicit && hasKatakana(text) {
+		*charsetID = japanCharset
+	}
+
+	// Either each row gets its own line of text, or the text is made one line.
+	var lines []string
+	firstRow := *line - 1
+	if *line == 0 {
+		lines, firstRow = strings.SplitN(text, "\n", takeover.Height), 0
+	} else {
+		lines = []string{text}
+	}
+
+	// Rows are scrolled together, so shorter lines are padded.
+	// Any other whitespace is collapsed.
+	longest := 0
+	for i := range lines {
+		lines[i] = strings.Join(strings.Fields(lines[i]), " ")
+		longest = max(longest, len([]rune(lines[i])))
+	}
+	var rows [][][]byte
+	for _, l := range lines {
+		padded := l + strings.Repeat(" ", longest-len([]rune(l)))
+		rows = append(rows, frames(padded, uint8(*charsetID), *right))
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w, err := out.Open()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write(append(encoder.SelectCharset(uint8(*charsetID)),
+		encoder.SetCursorMode(encoder.CursorOff)...)); err != nil {
+		log.Fatalln(err)
+	}
+	interval := time.Duration(float64(time.Second) / *speed)
+	if err := scroll(w, rows, firstRow, interval, *repeat); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,359 @@
+// liustcam shows an image, or what a V4L2 camera sees, on a LIUST-50 display,
+// drawing it with block and pattern characters.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+
+	// Characters have a pixel-wide gap in between them.
+	pitchX = glyphWidth + 1
+	pitchY = glyphHeight + 1
+
+	// Pixels are rather elongated, in a roughly 3:4 ratio.
+	aspectX = 3
+	aspectY = 4
+
+	// The display, as seen as a bitmap, with gaps left out.
+	pixelsX = takeover.Width * glyphWidth
+	pixelsY = takeover.Height * glyphHeight
+)
+
+type bitmap [pixelsY][pixelsX]bool
+
+type glyph struct {
+	char uint8
+	bits [glyphHeight][glyphWidth]bool
+}
+
+// loadGlyphs looks up the bitmaps of the characters in the given charset,
+// skipping those that it doesn't have.
+func loadGlyphs(runes string, charsetID uint8) []glyph {
+	var glyphs []glyph
+	for _, r := range runes {
+		char, ok := charset.ResolveRune(r, charsetID)
+		if !ok {
+			continue
+		}
+		img := charset.ResolveCharToImage(char, charsetID)
+		if img == nil {
+			continue
+		}
+
+		g := glyph{char: char}
+		b := img.Bounds()
+		for y := range g.bits {
+			for x := range g.bits[y] {
+				lum, _, _, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				g.bits[y][x] = lum >= 0x8000
+			}
+		}
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+// average returns the mean luminance of an area of the image, from 0 to 1.
+// Anything outside of the image is black.
+func average(img image.Image, r image.Rectangle) float64 {
+	var sum float64
+	area := r.Intersect(img.Bounds())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			gray := color.Gray16Model.Convert(img.At(x, y)).(color.Gray16)
+			sum += float64(gray.Y)
+		}
+	}
+	return sum / 0xffff / float64(r.Dx()*r.Dy())
+}
+
+// sample scales the image to the display, and returns the luminance
+// of each of its pixels. The image either fits within the display,
+// or is cropped to fill all of it.
+func sample(img image.Image, crop bool) (lum [pixelsY][pixelsX]float64) {
+	b := img.Bounds()
+	if b.Empty() {
+		return
+	}
+
+	// Sizes are in physical units, with gaps in between characters included.
+	w := float64((takeover.Width*pitchX - 1) * aspectX)
+	h := float64((takeover.Height*pitchY - 1) * aspectY)
+	scale := min(w/float64(b.Dx()), h/float64(b.Dy()))
+	if crop {
+		scale = max(w/float64(b.Dx()), h/float64(b.Dy()))
+	}
+	ox := (w - float64(b.Dx())*scale) / 2
+	oy := (h - float64(b.Dy())*scale) / 2
+
+	// Each pixel takes the average of the area of the image that it covers.
+	span := func(unit, size, offset float64, min int) (int, int) {
+		p0 := int(math.Floor((unit*size - offset) / scale))
+		p1 := int(math.Floor(((unit+1)*size - offset) / scale))
+		return min + p0, min + max(p1, p0+1)
+	}
+	for y := range lum {
+		y0, y1 := span(float64(y/glyphHeight*pitchY+y%glyphHeight),
+			aspectY, oy, b.Min.Y)
+		for x := range lum[y] {
+			x0, x1 := span(float64(x/glyphWidth*pitchX+x%glyphWidth),
+				aspectX, ox, b.Min.X)
+			lum[y][x] = average(img, image.Rect(x0, y0, x1, y1))
+		}
+	}
+	return
+}
+
+// threshold lights up pixels that are at least as bright as the level.
+func threshold(lum *[pixelsY][pixelsX]float64, level float64) (bits bitmap) {
+	for y := range lum {
+		for x := range lum[y] {
+			bits[y][x] = lum[y][x] >= level
+		}
+	}
+	return
+}
+
+// dither is like threshold, but uses Floyd-Steinberg error diffusion
+// to preserve shades of grey.
+func dither(lum *[pixelsY][pixelsX]float64, level float64) (bits bitmap) {
+	work := *lum
+	spread := func(x, y int, e float64) {
+		if x >= 0 && x < pixelsX && y < pixelsY {
+			work[y][x] += e
+		}
+	}
+	for y := range work {
+		for x := range work[y] {
+			value := 0.
+			if bits[y][x] = work[y][x] >= level; bits[y][x] {
+				value = 1
+			}
+			e := work[y][x] - value
+			spread(x+1, y, e*7/16)
+			spread(x-1, y+1, e*3/16)
+			spread(x, y+1, e*5/16)
+			spread(x+1, y+1, e*1/16)
+		}
+	}
+	return
+}
+
+// match picks the glyphs that most resemble each character cell.
+func match(bits *bitmap, glyphs []glyph) (rows [takeover.Height][]byte) {
+	for cy := range rows {
+		for cx := 0; cx < takeover.Width; cx++ {
+			best, bestDistance := glyphs[0].char, math.MaxInt
+			for _, g := range glyphs {
+				distance := 0
+				for y := range g.bits {
+					for x := range g.bits[y] {
+						if g.bits[y][x] != bits[cy*glyphHeight+y][cx*glyphWidth+x] {
+							distance++
+						}
+					}
+				}
+				if distance < bestDistance {
+					best, bestDistance = g.char, distance
+				}
+			}
+			rows[cy] = append(rows[cy], best)
+		}
+	}
+	return
+}
+
+type renderer struct {
+	glyphs []glyph
+	crop   bool
+	dither bool
+	level  float64
+	invert bool
+}
+
+func (r *renderer) render(img image.Image) [takeover.Height][]byte {
+	lum := sample(img, r.crop)
+	if r.invert {
+		for y := range lum {
+			for x := range lum[y] {
+				lum[y][x] = 1 - lum[y][x]
+			}
+		}
+	}
+
+	var bits bitmap
+	if r.dither {
+		bits = dither(&lum, r.level)
+	} else {
+		bits = threshold(&lum, r.level)
+	}
+	return match(&bits, r.glyphs)
+}
+
+// screen writes rows to the display, skipping those that haven't changed.
+type screen struct {
+	w     io.Writer
+	shown [takeover.Height][]byte
+}
+
+func (s *screen) show(rows [takeover.Height][]byte) error {
+	var b bytes.Buffer
+	for y, row := range rows {
+		if !bytes.Equal(row, s.shown[y]) {
+			b.Write(encoder.Locate(y, 0))
+			b.Write(row)
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	if _, err := s.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	s.shown = rows
+	return nil
+}
+
+func decodeImage(path string) (image.Image, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+// watch keeps showing what the camera sees. Frames are dequeued as they come,
+// so that they don't get stale, but only some of them are shown.
+func watch(s *screen, r *renderer, cam *camera, interval time.Duration) error {
+	var last time.Time
+	for {
+		img, err := cam.frame()
+		if err != nil {
+			return err
+		}
+		if now := time.Now(); now.Sub(last) >= interval {
+			if err := s.show(r.render(img)); err != nil {
+				return err
+			}
+			last = now
+		}
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [OPTION]... { IMAGE | -device DEVICE }\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	var (
+		charsetID = flag.Uint("charset", 0, "display character set")
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		device = flag.String("device", "",
+			"V4L2 device to capture from, such as /dev/video0")
+		interval = flag.Duration("interval", 200*time.Millisecond,
+			"how often to show a captured frame")
+		glyphRunes = flag.String("glyphs", " ░▒▓█▀▄▌▐■",
+			"characters to draw with")
+		level = flag.Float64("threshold", 0.5,
+			"brightness from 0 to 1 at which pixels light up")
+		noDither = flag.Bool("no-dither", false,
+			"only threshold the image, without dithering")
+		crop   = flag.Bool("crop", true, "crop the image to fill the display")
+		invert = flag.Bool("invert", false, "light up dark areas instead")
+	)
+	flag.Parse()
+	if *device == "" && flag.NArg() != 1 || *device != "" && flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *charsetID > 0xff {
+		log.Fatalf("invalid charset: %d\n", *charsetID)
+	}
+	if *interval <= 0 {
+		log.Fatalf("invalid interval: %s\n", *interval)
+	}
+	if *level < 0 || *level > 1 {
+		log.Fatalf("invalid threshold: %g\n", *level)
+	}
+
+	r := &renderer{
+		glyphs: loadGlyphs(*glyphRunes, uint8(*charsetID)),
+		crop:   *crop,
+		dither: !*noDither,
+		level:  *level,
+		invert: *invert,
+	}
+	if len(r.glyphs) == 0 {
+		log.Fatalln("the charset has none of the characters to draw with")
+	}
+
+	// Open the source first, as it is the more likely one to fail.
+	var img image.Image
+	var cam *camera
+	var err error
+	if *device != "" {
+		if cam, err = openCamera(*device); err != nil {
+			log.Fatalln(err)
+		}
+		defer cam.Close()
+	} else if img, err = decodeImage(flag.Arg(0)); err != nil {
+		log.Fatalln(err)
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w, err := out.Open()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer w.Close()
+	if _, err := w.Write(slices.Concat(encoder.SelectCharset(uint8(*charsetID)),
+		encoder.Clear(), encoder.SetCursorMode(encoder.CursorOff))); err != nil {
+		log.Fatalln(err)
+	}
+
+	s := &screen{w: w}
+	if cam != nil {
+		err = watch(s, r, cam, *interval)
+	} else {
+		err = s.show(r.render(img))
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
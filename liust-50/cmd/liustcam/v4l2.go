@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// These mirror the kernel's V4L2 API, see linux/videodev2.h.
+// Go lays out the structures the same way C does.
+
+const (
+	v4l2BufTypeVideoCapture = 1
+	v4l2MemoryMmap          = 1
+)
+
+func fourCC(s string) uint32 {
+	return uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24
+}
+
+var (
+	v4l2PixFmtYUYV = fourCC("YUYV")
+	v4l2PixFmtGrey = fourCC("GREY")
+)
+
+type v4l2PixFormat struct {
+	width, height, pixelFormat, field, bytesPerLine, sizeImage uint32
+	colorspace, priv, flags, ycbcrEnc, quantization, xferFunc  uint32
+}
+
+type v4l2Format struct {
+	typ uint32
+	fmt struct {
+		_   [0]uintptr // the union also contains pointers
+		pix v4l2PixFormat
+		_   [200 - unsafe.Sizeof(v4l2PixFormat{})]byte
+	}
+}
+
+type v4l2RequestBuffers struct {
+	count, typ, memory, capabilities uint32
+	flags                            uint8
+	_                                [3]uint8
+}
+
+type v4l2Timecode struct {
+	typ, flags                      uint32
+	frames, seconds, minutes, hours uint8
+	userBits                        [4]uint8
+}
+
+type v4l2Buffer struct {
+	index, typ, bytesUsed, flags, field uint32
+	timestamp                           unix.Timeval
+	timecode                            v4l2Timecode
+	sequence, memory                    uint32
+	m                                   struct {
+		_      [0]uintptr // the union also contains pointers
+		offset uint32
+		_      [unsafe.Sizeof(uintptr(0)) - 4]byte
+	}
+	length, _, _ uint32
+}
+
+// ioc encodes ioctl request numbers the generic way, as on x86 and ARM.
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'V'<<8 | nr
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+)
+
+var (
+	vidiocSFmt    = ioc(iocRead|iocWrite, 5, unsafe.Sizeof(v4l2Format{}))
+	vidiocReqBufs = ioc(iocRead|iocWrite, 8,
+		unsafe.Sizeof(v4l2RequestBuffers{}))
+	vidiocQueryBuf  = ioc(iocRead|iocWrite, 9, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocQBuf      = ioc(iocRead|iocWrite, 15, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocDQBuf     = ioc(iocRead|iocWrite, 17, unsafe.Sizeof(v4l2Buffer{}))
+	vidiocStreamOn  = ioc(iocWrite, 18, unsafe.Sizeof(int32(0)))
+	vidiocStreamOff = ioc(iocWrite, 19, unsafe.Sizeof(int32(0)))
+)
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, request, uintptr(arg))
+		if errno != unix.EINTR {
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// camera captures greyscale frames, using memory-mapped streaming I/O,
+// which is what most drivers support. Only the luma is used,
+// so that no colour conversion is needed.
+type camera struct {
+	f       *os.File
+	format  v4l2PixFormat
+	buffers [][]byte
+}
+
+// openCamera starts capturing at a low resolution, since the display
+// has little use for anything more.
+func openCamera(path string) (_ *camera, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	cam := &camera{f: f}
+	defer func() {
+		if err != nil {
+			cam.Close()
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+	}()
+
+	fd := f.Fd()
+	format := v4l2Format{typ: v4l2BufTypeVideoCapture}
+	format.fmt.pix = v4l2PixFormat{
+		width: 160, height: 120, pixelFormat: v4l2PixFmtYUYV}
+	if err := ioctl(fd, vidiocSFmt, unsafe.Pointer(&format)); err != nil {
+		return nil, err
+	}
+	cam.format = format.fmt.pix
+	if pf := cam.format.pixelFormat; pf != v4l2PixFmtYUYV &&
+		pf != v4l2PixFmtGrey {
+		return nil, errors.New("unsupported pixel format")
+	}
+
+	req := v4l2RequestBuffers{
+		count: 4, typ: v4l2BufTypeVideoCapture, memory: v4l2MemoryMmap}
+	if err := ioctl(fd, vidiocReqBufs, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+	if req.count < 2 {
+		return nil, errors.New("insufficient buffer memory")
+	}
+	for i := uint32(0); i < req.count; i++ {
+		buf := v4l2Buffer{
+			index: i, typ: v4l2BufTypeVideoCapture, memory: v4l2MemoryMmap}
+		if err := ioctl(fd, vidiocQueryBuf, unsafe.Pointer(&buf)); err != nil {
+			return nil, err
+		}
+		data, err := unix.Mmap(int(fd), int64(buf.m.offset), int(buf.length),
+			unix.PROT_READ, unix.MAP_SHARED)
+		if err != nil {
+			return nil, err
+		}
+		cam.buffers = append(cam.buffers, data)
+		if err := ioctl(fd, vidiocQBuf, unsafe.Pointer(&buf)); err != nil {
+			return nil, err
+		}
+	}
+
+	typ := int32(v4l2BufTypeVideoCapture)
+	if err := ioctl(fd, vidiocStreamOn, unsafe.Pointer(&typ)); err != nil {
+		return nil, err
+	}
+	return cam, nil
+}
+
+// frame waits for the next frame, and returns a copy of it.
+func (cam *camera) frame() (*image.Gray, error) {
+	fd := cam.f.Fd()
+	buf := v4l2Buffer{typ: v4l2BufTypeVideoCapture, memory: v4l2MemoryMmap}
+	if err := ioctl(fd, vidiocDQBuf, unsafe.Pointer(&buf)); err != nil {
+		return nil, err
+	}
+
+	data := cam.buffers[buf.index][:buf.bytesUsed]
+	width, height := int(cam.format.width), int(cam.format.height)
+	stride, step := int(cam.format.bytesPerLine), 1
+	if cam.format.pixelFormat == v4l2PixFmtYUYV {
+		step = 2
+	}
+	if stride == 0 {
+		stride = width * step
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height && (y+1)*stride <= len(data); y++ {
+		for x := 0; x < width; x++ {
+			img.Pix[y*img.Stride+x] = data[y*stride+x*step]
+		}
+	}
+
+	if err := ioctl(fd, vidiocQBuf, unsafe.Pointer(&buf)); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (cam *camera) Close() error {
+	if len(cam.buffers) != 0 {
+		typ := int32(v4l2BufTypeVideoCapture)
+		ioctl(cam.f.Fd(), vidiocStreamOff, unsafe.Pointer(&typ))
+		for _, data := range cam.buffers {
+			unix.Munmap(data)
+		}
+		cam.buffers = nil
+	}
+	return cam.f.Close()
+}
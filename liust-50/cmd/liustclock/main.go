@@ -0,0 +1,230 @@
+// liustclock turns a LIUST-50 display into a clock.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+// center pads text on both sides to take up the whole width of the display.
+func center(text string) string {
+	runes := []rune(text)
+	if len(runes) >= takeover.Width {
+		return string(runes[:takeover.Width])
+	}
+	left := (takeover.Width - len(runes)) / 2
+	return strings.Repeat(" ", left) + text +
+		strings.Repeat(" ", takeover.Width-len(runes)-left)
+}
+
+type clock struct {
+	face       string
+	timeFormat string
+	dateFormat string // empty to leave the date out
+	blinkColon bool
+	chime      time.Duration // how long to take over the display on the hour
+	bits       [2]string     // glyphs for binary zeros and ones
+
+	digits map[rune][2]string // for the big faces
+}
+
+// colonVisible tells whether blinking colons are shown at the given time.
+func (c *clock) colonVisible(now time.Time) bool {
+	return !c.blinkColon || now.Second()%2 == 0
+}
+
+func (c *clock) formatTime(now time.Time) string {
+	s := now.Format(c.timeFormat)
+	if !c.colonVisible(now) {
+		s = strings.ReplaceAll(s, ":", " ")
+	}
+	return s
+}
+
+func (c *clock) formatDate(now time.Time) string {
+	if c.dateFormat == "" {
+		return ""
+	}
+	return now.Format(c.dateFormat)
+}
+
+// big renders the time in digits that take up both rows.
+func (c *clock) big(now time.Time) (rows [2]string) {
+	for y := range rows {
+		var parts []string
+		for _, r := range c.formatTime(now) {
+			parts = append(parts, c.digits[r][y])
+		}
+		rows[y] = strings.Join(parts, " ")
+	}
+	return rows
+}
+
+// binary renders hours, minutes, and seconds as binary numbers.
+func (c *clock) binary(now time.Time) string {
+	var parts []string
+	for _, field := range []struct{ value, bits int }{
+		{now.Hour(), 5}, {now.Minute(), 6}, {now.Second(), 6},
+	} {
+		var b strings.Builder
+		for i := field.bits - 1; i >= 0; i-- {
+			b.WriteString(c.bits[field.value>>i&1])
+		}
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// render returns the contents of both rows at the given time.
+func (c *clock) render(now time.Time) (rows [2]string) {
+	if now.Sub(now.Truncate(time.Hour)) < c.chime {
+		// The chime flashes the full hour, to draw attention.
+		if now.Second()%2 == 0 {
+			rows[0] = fmt.Sprintf("*** %s ***", now.Format("15:04"))
+			rows[1] = c.formatDate(now)
+		}
+	} else {
+		switch c.face {
+		case "big", "blocks":
+			rows = c.big(now)
+		case "binary":
+			rows[0], rows[1] = c.binary(now), c.formatDate(now)
+		default:
+			rows[0], rows[1] = c.formatTime(now), c.formatDate(now)
+		}
+	}
+	for y := range rows {
+		rows[y] = center(rows[y])
+	}
+	return rows
+}
+
+// run keeps the clock updated every second, redrawing only rows that change.
+func (c *clock) run(w io.Writer, charsetID uint8) error {
+	var shown [2]string
+	for y := range shown {
+		shown[y] = strings.Repeat(" ", takeover.Width)
+	}
+	if _, err := w.Write(slices.Concat(encoder.SelectCharset(charsetID),
+		encoder.DefineUserChars(charsetID), encoder.Clear(),
+		encoder.SetCursorMode(encoder.CursorOff))); err != nil {
+		return err
+	}
+	for {
+		now := time.Now()
+		rows := c.render(now)
+
+		var b bytes.Buffer
+		for y, row := range rows {
+			if row != shown[y] {
+				b.Write(encoder.Locate(y, 0))
+				b.Write(encoder.Text(row, charsetID))
+			}
+		}
+		if b.Len() != 0 {
+			if _, err := w.Write(b.Bytes()); err != nil {
+				return err
+			}
+		}
+		shown = rows
+		time.Sleep(now.Truncate(time.Second).Add(time.Second).Sub(time.Now()))
+	}
+}
+
+func main() {
+	var (
+		charsetID = flag.Uint("charset", 0, "display character set")
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		face = flag.String("face", "normal",
+			"clock face: normal, big, blocks, or binary")
+		timeFormat = flag.String("time-format", "", "Go layout of the time")
+		dateFormat = flag.String("date-format", "Mon 2 Jan 2006",
+			"Go layout of the date, which is shown beneath the time, "+
+				"empty to leave it out")
+		blinkColon = flag.Bool("blink-colon", false,
+			"make colons disappear every other second")
+		chime = flag.Duration("chime", 0,
+			"how long to flash the time on the hour, 0 for no chime")
+	)
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *charsetID > 0xff {
+		log.Fatalf("invalid charset: %d\n", *charsetID)
+	}
+
+	c := &clock{
+		face:       *face,
+		timeFormat: *timeFormat,
+		dateFormat: *dateFormat,
+		blinkColon: *blinkColon,
+		chime:      *chime,
+		bits:       [2]string{"·", "█"},
+	}
+	_, hasBlocks := charset.ResolveRune('█', uint8(*charsetID))
+	switch c.face {
+	case "normal":
+		if c.timeFormat == "" {
+			c.timeFormat = "15:04:05"
+		}
+	case "big", "blocks":
+		if c.timeFormat == "" {
+			c.timeFormat = "15:04"
+		}
+		c.digits = encoder.UserDigits
+		if c.face == "blocks" {
+			c.digits = encoder.BlockDigits
+		}
+		for _, halves := range c.digits {
+			if !encoder.Encodable(halves[0]+halves[1], uint8(*charsetID)) {
+				log.Fatalf("the %s face cannot be shown in this charset\n",
+					c.face)
+			}
+		}
+		for _, r := range time.Date(2000, 12, 31, 23, 59, 59, 0, time.UTC).
+			Format(c.timeFormat) {
+			if _, ok := c.digits[r]; !ok {
+				log.Fatalf("the %s face may only show digits, "+
+					"colons, and spaces\n", c.face)
+			}
+		}
+	case "binary":
+		if !hasBlocks {
+			c.bits = [2]string{"0", "1"}
+		}
+	default:
+		log.Fatalf("unknown face: %q\n", c.face)
+	}
+	if utf8.RuneCountInString(c.formatTime(time.Now())) > takeover.Width {
+		log.Fatalln("the time does not fit on the display")
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w, err := out.Open()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer w.Close()
+	if err := c.run(w, uint8(*charsetID)); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,166 @@
+// liustctl sends individual commands to a LIUST-50 display.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+var cursorModes = map[string]int{
+	"off":   encoder.CursorOff,
+	"blink": encoder.CursorBlink,
+	"on":    encoder.CursorLightUp,
+}
+
+// parseRaw decodes arguments either as hexadecimal byte values,
+// or as strings with Go escape sequences, such as \x1b.
+func parseRaw(args []string) ([]byte, error) {
+	var b []byte
+	for _, arg := range args {
+		if hex, ok := strings.CutPrefix(arg, "0x"); ok {
+			n, err := strconv.ParseUint(hex, 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid byte: %q", arg)
+			}
+			b = append(b, byte(n))
+			continue
+		}
+
+		for s := arg; s != ""; {
+			r, multibyte, tail, err := strconv.UnquoteChar(s, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string: %q", arg)
+			}
+			if multibyte {
+				b = utf8.AppendRune(b, r)
+			} else {
+				b = append(b, byte(r))
+			}
+			s = tail
+		}
+	}
+	return b, nil
+}
+
+// encode translates a command to what is to be sent to the display.
+func encode(charsetID uint8, command string, args []string) ([]byte, error) {
+	switch command {
+	case "clear":
+		if len(args) == 0 {
+			return encoder.Clear(), nil
+		}
+	case "write":
+		if len(args) != 0 {
+			return append(encoder.SelectCharset(charsetID),
+				encoder.Text(strings.Join(args, " "), charsetID)...), nil
+		}
+	case "locate":
+		if len(args) != 2 {
+			break
+		}
+		row, err := strconv.Atoi(args[0])
+		if err != nil || row < 1 || row > takeover.Height {
+			return nil, fmt.Errorf("invalid row: %q", args[0])
+		}
+		column, err := strconv.Atoi(args[1])
+		if err != nil || column < 1 || column > takeover.Width {
+			return nil, fmt.Errorf("invalid column: %q", args[1])
+		}
+		return encoder.Locate(row-1, column-1), nil
+	case "charset":
+		if len(args) != 1 {
+			break
+		}
+		id, err := strconv.ParseUint(args[0], 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid charset: %q", args[0])
+		}
+		return encoder.SelectCharset(uint8(id)), nil
+	case "cursor":
+		if len(args) != 1 {
+			break
+		}
+		mode, ok := cursorModes[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("invalid cursor mode: %q", args[0])
+		}
+		return encoder.SetCursorMode(mode), nil
+	case "brightness":
+		if len(args) != 1 {
+			break
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(args[0], "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid brightness: %q", args[0])
+		}
+		return encoder.SetBrightness(encoder.BrightnessLevel(percent)), nil
+	case "raw":
+		if len(args) != 0 {
+			return parseRaw(args)
+		}
+	default:
+		return nil, fmt.Errorf("unknown command: %q", command)
+	}
+	return nil, fmt.Errorf("%s: wrong number of arguments", command)
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(),
+		"Usage: %s [OPTION]... COMMAND [ARG]...\n\n"+
+			"Commands:\n"+
+			"  clear                 blank the display\n"+
+			"  write TEXT...         print text at the cursor\n"+
+			"  locate ROW COLUMN     move the cursor, counting from 1\n"+
+			"  charset N             switch the character set\n"+
+			"  cursor off|blink|on   change how the cursor is shown\n"+
+			"  brightness PERCENT    change the dimming level\n"+
+			"  raw DATA...           send 0x1b-style bytes or \\x1b-style strings\n"+
+			"\nOptions:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	var (
+		charsetID = flag.Uint("charset", 0, "character set to encode text in")
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+	)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *charsetID > 0xff {
+		log.Fatalf("invalid charset: %d\n", *charsetID)
+	}
+
+	data, err := encode(uint8(*charsetID), flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w, err := out.Open()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		log.Fatalln(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatalln(err)
+	}
+}
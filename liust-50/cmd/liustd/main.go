@@ -0,0 +1,405 @@
+// liustd owns a LIUST-50 display, and lets several programs share it.
+//
+// Each client draws on a virtual screen of its own, and the display shows
+// the one with the highest priority, or the newest one among equals.
+// Clients may adjust their screen by sending application program commands
+// with URL-encoded parameters, such as "\x1b_priority=10&lease=5s\x1b\\":
+//
+//   - priority orders screens, the default is zero,
+//   - lease makes the screen expire this long after it has last been
+//     updated, keeping it around for as long after its client disconnects,
+//   - screen names a screen that any client may attach to, and which
+//     outlives its clients, rather than vanishing with them.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/emulator"
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+)
+
+// defaultSocket returns where clients expect to find liustd.
+func defaultSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "liustd.sock")
+}
+
+// --- Screens -----------------------------------------------------------------
+
+type screen struct {
+	name     string // empty for screens private to their client
+	seq      uint64 // creation order
+	priority int
+	lease    time.Duration // zero for none
+	updated  time.Time     // zero until the screen is drawn on
+	clients  int
+	display  *emulator.Display
+}
+
+// visible tells whether the screen may be shown.
+func (s *screen) visible(now time.Time) bool {
+	return !s.updated.IsZero() && !s.expired(now)
+}
+
+func (s *screen) expired(now time.Time) bool {
+	return s.lease > 0 && now.Sub(s.updated) >= s.lease
+}
+
+// obsolete tells whether the screen can no longer be shown.
+func (s *screen) obsolete(now time.Time) bool {
+	if s.clients > 0 {
+		return false
+	}
+	return s.expired(now) || s.name == "" && s.lease <= 0
+}
+
+type daemon struct {
+	mu      sync.Mutex
+	screens map[*screen]struct{}
+	named   map[string]*screen
+	seq     uint64
+	wake    chan struct{}
+}
+
+func newDaemon() *daemon {
+	return &daemon{
+		screens: make(map[*screen]struct{}),
+		named:   make(map[string]*screen),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// poke makes the device reflect changes in screens.
+func (d *daemon) poke() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// attach returns the named screen, creating it as necessary,
+// or a new private one if the name is empty. The mutex must be held.
+func (d *daemon) attach(name string) *screen {
+	s := d.named[name]
+	if s == nil {
+		d.seq++
+		s = &screen{name: name, seq: d.seq, display: emulator.NewDisplay()}
+		d.screens[s] = struct{}{}
+		if name != "" {
+			d.named[name] = s
+		}
+	}
+	s.clients++
+	return s
+}
+
+// detach lets go of a screen. The mutex must be held.
+func (d *daemon) detach(s *screen) {
+	s.clients--
+	d.collect(time.Now())
+}
+
+// collect forgets screens that are obsolete. The mutex must be held.
+func (d *daemon) collect(now time.Time) {
+	for s := range d.screens {
+		if s.obsolete(now) {
+			delete(d.screens, s)
+			if s.name != "" {
+				delete(d.named, s.name)
+			}
+		}
+	}
+}
+
+// pick returns a copy of what the display should show,
+// along with the time until this may change on its own.
+func (d *daemon) pick(now time.Time) (*emulator.Display, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.collect(now)
+	var best *screen
+	next := time.Duration(-1)
+	for s := range d.screens {
+		if !s.visible(now) {
+			continue
+		}
+		if s.lease > 0 {
+			if left := s.updated.Add(s.lease).Sub(now); next < 0 || left < next {
+				next = left
+			}
+		}
+		if best == nil || s.priority > best.priority ||
+			s.priority == best.priority && s.seq > best.seq {
+			best = s
+		}
+	}
+
+	display := emulator.NewDisplay()
+	if best != nil {
+		*display = *best.display
+	}
+	return display, next
+}
+
+// --- Clients -----------------------------------------------------------------
+
+type client struct {
+	d      *daemon
+	screen *screen
+	parser *emulator.Parser
+}
+
+// control applies client parameters, ignoring invalid ones.
+// The mutex must be held.
+func (c *client) control(command string) {
+	params, err := url.ParseQuery(command)
+	if err != nil {
+		slog.Warn("Invalid parameters", "command", command, "error", err)
+		return
+	}
+
+	// The screen needs to be switched first, for the rest to apply to it.
+	if name, ok := params["screen"]; ok {
+		c.d.detach(c.screen)
+		c.screen = c.d.attach(name[len(name)-1])
+		c.parser.Display = c.screen.display
+	}
+	for key, values := range params {
+		value, err := values[len(values)-1], error(nil)
+		switch key {
+		case "priority":
+			var priority int
+			if priority, err = strconv.Atoi(value); err == nil {
+				c.screen.priority = priority
+			}
+		case "lease":
+			var lease time.Duration
+			if lease, err = time.ParseDuration(value); err == nil {
+				c.screen.lease = lease
+			}
+		case "screen":
+		default:
+			err = errors.New("unknown parameter")
+		}
+		if err != nil {
+			slog.Warn("Invalid parameter", "key", key, "value", value, "error", err)
+		}
+	}
+}
+
+func (d *daemon) serve(conn net.Conn) {
+	defer conn.Close()
+
+	d.mu.Lock()
+	c := &client{d: d, screen: d.attach("")}
+	c.parser = emulator.NewParser(c.screen.display)
+	c.parser.Control = c.control
+	d.mu.Unlock()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			d.mu.Lock()
+			drawn := false
+			for _, b := range buf[:n] {
+				drawn = c.parser.HandleByte(b) || drawn
+			}
+			if drawn {
+				c.screen.updated = time.Now()
+			}
+			d.mu.Unlock()
+			d.poke()
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				slog.Warn("Client failed", "error", err)
+			}
+			break
+		}
+	}
+
+	d.mu.Lock()
+	d.detach(c.screen)
+	d.mu.Unlock()
+	d.poke()
+}
+
+// --- Device ------------------------------------------------------------------
+
+type device struct {
+	output *output.Output
+	w      io.WriteCloser
+	shown  *emulator.Display // nil if unknown
+}
+
+// update makes the device show the given display,
+// sending only what differs from what it already shows.
+func (dv *device) update(target *emulator.Display) error {
+	if dv.w == nil {
+		w, err := dv.output.Open()
+		if err != nil {
+			return err
+		}
+		dv.w, dv.shown = w, nil
+	}
+
+	// Without knowing anything about the device, everything needs to be set.
+	shown := emulator.NewDisplay()
+	if dv.shown != nil {
+		*shown = *dv.shown
+	} else {
+		shown.Charset, shown.Brightness, shown.CursorMode =
+			^target.Charset, 0, -1
+		shown.UserCharset = !target.UserCharset
+	}
+
+	var b bytes.Buffer
+	if shown.Charset != target.Charset {
+		// The same characters would look different, so start from scratch.
+		b.Write(encoder.SelectCharset(target.Charset))
+		b.Write(encoder.Clear())
+		shown.Clear()
+	}
+	// Characters that the target doesn't define are left as they are,
+	// since it has no reason to show them.
+	for code, defined := range target.UserDefined {
+		if defined && (!shown.UserDefined[code] ||
+			shown.UserChars[code] != target.UserChars[code]) {
+			b.Write(encoder.DefineUserChar(uint8(code), target.UserChars[code]))
+		}
+	}
+	if shown.UserCharset != target.UserCharset {
+		b.Write(encoder.SelectUserCharset(target.UserCharset))
+	}
+	if shown.Brightness != target.Brightness {
+		b.Write(encoder.SetBrightness(target.Brightness))
+	}
+	if shown.CursorMode != target.CursorMode {
+		b.Write(encoder.SetCursorMode(target.CursorMode))
+	}
+	for y := 0; y < emulator.Height; y++ {
+		for x := 0; x < emulator.Width; x++ {
+			if shown.Chars[y][x] != target.Chars[y][x] {
+				b.Write(encoder.Locate(y, x))
+				b.Write(target.Chars[y][x:])
+				break
+			}
+		}
+	}
+	if b.Len() != 0 || shown.CursorX != target.CursorX ||
+		shown.CursorY != target.CursorY {
+		b.Write(encoder.Locate(target.CursorY, target.CursorX))
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	if _, err := dv.w.Write(b.Bytes()); err != nil {
+		dv.w.Close()
+		dv.w = nil
+		return err
+	}
+	dv.shown = target
+	return nil
+}
+
+// run keeps the device showing the right screen.
+func (d *daemon) run(ctx context.Context, dv *device) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		display, next := d.pick(time.Now())
+		if err := dv.update(display); err != nil {
+			if !dv.output.Reconnectable() {
+				fatal("Display failed", "error", err)
+			}
+			slog.Warn("Display failed", "error", err)
+			if next < 0 || next > 5*time.Second {
+				next = 5 * time.Second
+			}
+		}
+
+		timer.Stop()
+		if next >= 0 {
+			timer.Reset(next)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// --- Main --------------------------------------------------------------------
+
+// fatal logs an error, and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func main() {
+	var (
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		listenURI = flag.String("listen", "unix:"+defaultSocket(),
+			"accept clients on a tcp:// or unix: address")
+	)
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		fatal("Invalid output", "error", err)
+	}
+	listener, err := output.Listen(*listenURI)
+	if err != nil {
+		fatal("Listening failed", "error", err)
+	}
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() { listener.Close() })
+
+	d := newDaemon()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					fatal("Accepting clients failed", "error", err)
+				}
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	d.run(ctx, &device{output: out})
+}
@@ -0,0 +1,305 @@
+// liustnotify is a desktop notification server that shows notifications
+// on a LIUST-50 display, one at a time, see the Desktop Notifications
+// Specification. It is an alternative to running liustatus for this.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+const (
+	notificationsName = "org.freedesktop.Notifications"
+	notificationsPath = "/org/freedesktop/Notifications"
+)
+
+// Reasons for closing notifications, as given by the specification.
+const (
+	reasonExpired = 1
+	reasonClosed  = 3
+)
+
+// blinkInterval is also how often the display gets refreshed.
+const blinkInterval = 500 * time.Millisecond
+
+// notificationServer implements the org.freedesktop.Notifications interface,
+// queueing notifications by their urgency.
+type notificationServer struct {
+	conn      *dbus.Conn
+	durations [3]time.Duration // by urgency
+	wake      chan struct{}
+
+	mu      sync.Mutex
+	queue   takeover.Queue
+	pending map[uint32]struct{} // IDs of queued notifications
+	lastID  uint32
+}
+
+func notificationTag(id uint32) string {
+	return fmt.Sprintf("notification:%d", id)
+}
+
+func notificationUrgency(hints map[string]dbus.Variant) byte {
+	if urgency, ok := hints["urgency"].Value().(byte); ok && urgency <= 2 {
+		return urgency
+	}
+	return 1
+}
+
+// poke makes the display reflect changes in the queue.
+func (ns *notificationServer) poke() {
+	select {
+	case ns.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ns *notificationServer) closed(id uint32, reason uint32) {
+	ns.conn.Emit(notificationsPath, notificationsName+".NotificationClosed",
+		id, reason)
+}
+
+func (ns *notificationServer) Notify(app string, replaces uint32, icon string,
+	summary string, body string, actions []string,
+	hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	urgency := notificationUrgency(hints)
+	duration := ns.durations[urgency]
+	if timeout > 0 {
+		duration = time.Duration(timeout) * time.Millisecond
+	}
+
+	// Each goes on its own line, so any line breaks within are dropped.
+	oneLine := func(s string) string {
+		return strings.Join(strings.Fields(encoder.Narrow(s)), " ")
+	}
+	text := oneLine(summary)
+	if body = oneLine(body); body != "" {
+		text += "\n" + body
+	}
+	message := takeover.Message{
+		Text:     text,
+		Priority: int(urgency),
+		Duration: duration,
+		Line:     -1,
+		Blink:    urgency == 2,
+	}
+
+	ns.mu.Lock()
+	id := replaces
+	if id == 0 {
+		ns.lastID++
+		id = ns.lastID
+	}
+	message.Tag = notificationTag(id)
+	valid := message.Validate() == nil
+	if valid {
+		ns.queue.Push(message, time.Now())
+		ns.pending[id] = struct{}{}
+	}
+	ns.mu.Unlock()
+
+	// Notifications that can't be shown are closed right away.
+	if valid {
+		ns.poke()
+	} else {
+		ns.closed(id, reasonExpired)
+	}
+	return id, nil
+}
+
+func (ns *notificationServer) CloseNotification(id uint32) *dbus.Error {
+	ns.mu.Lock()
+	_, ok := ns.pending[id]
+	if ok {
+		ns.queue.Remove(notificationTag(id), time.Now())
+		delete(ns.pending, id)
+	}
+	ns.mu.Unlock()
+
+	if ok {
+		ns.closed(id, reasonClosed)
+		ns.poke()
+	}
+	return nil
+}
+
+func (ns *notificationServer) GetCapabilities() ([]string, *dbus.Error) {
+	return []string{"body"}, nil
+}
+
+func (ns *notificationServer) GetServerInformation() (
+	name, vendor, version, specVersion string, err *dbus.Error) {
+	return "liustnotify", "janouch.name", "1.0", "1.2", nil
+}
+
+// active expires notifications, and returns the one to be shown, if any,
+// along with for how long it has been shown.
+func (ns *notificationServer) active(now time.Time) (
+	*takeover.Message, time.Duration) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.queue.Expire(now) {
+		for id := range ns.pending {
+			if !ns.queue.Contains(notificationTag(id)) {
+				delete(ns.pending, id)
+				ns.closed(id, reasonExpired)
+			}
+		}
+	}
+	if m := ns.queue.Active(); m != nil {
+		message := *m
+		return &message, ns.queue.Elapsed(now)
+	}
+	return nil, 0
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+type display struct {
+	output  *output.Output
+	charset uint8
+	w       io.WriteCloser
+	shown   [takeover.Height]string
+}
+
+// render returns the rows to show for the message.
+func render(m *takeover.Message, elapsed time.Duration) (
+	rows [takeover.Height]string) {
+	if m == nil || m.Blink && elapsed/blinkInterval%2 != 0 {
+		return rows
+	}
+	for y, line := range m.Lines() {
+		if y < len(rows) {
+			rows[y] = line
+		}
+	}
+	return rows
+}
+
+// show writes the rows to the display. While there is something to show,
+// they are rewritten each time, in case liustd leases are in use.
+func (d *display) show(rows [takeover.Height]string, refresh bool) error {
+	if !refresh && d.w != nil && rows == d.shown {
+		return nil
+	}
+	if d.w == nil {
+		w, err := d.output.Open()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(encoder.SelectCharset(d.charset),
+			encoder.SetCursorMode(encoder.CursorOff)...)); err != nil {
+			w.Close()
+			return err
+		}
+		d.w = w
+	}
+
+	var b bytes.Buffer
+	for y, row := range rows {
+		runes := []rune(row)
+		if len(runes) > takeover.Width {
+			runes = runes[:takeover.Width]
+		}
+		b.Write(encoder.Locate(y, 0))
+		b.Write(encoder.Text(string(runes)+
+			strings.Repeat(" ", takeover.Width-len(runes)), d.charset))
+	}
+	if _, err := d.w.Write(b.Bytes()); err != nil {
+		d.w.Close()
+		d.w = nil
+		return err
+	}
+	d.shown = rows
+	return nil
+}
+
+func (ns *notificationServer) run(d *display) {
+	ticker := time.NewTicker(blinkInterval)
+	defer ticker.Stop()
+	for {
+		m, elapsed := ns.active(time.Now())
+		if err := d.show(render(m, elapsed), m != nil); err != nil {
+			if !d.output.Reconnectable() {
+				log.Fatalln(err)
+			}
+			log.Println(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ns.wake:
+		case <-ns.conn.Context().Done():
+			log.Fatalln("disconnected from the bus")
+		}
+	}
+}
+
+func main() {
+	var (
+		charsetID = flag.Uint("charset", 0, "display character set")
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		low = flag.Duration("low", 5*time.Second,
+			"how long to show low urgency notifications for")
+		normal = flag.Duration("normal", 10*time.Second,
+			"how long to show normal urgency notifications for")
+		critical = flag.Duration("critical", 30*time.Second,
+			"how long to show critical notifications for")
+	)
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *charsetID > 0xff {
+		log.Fatalf("invalid charset: %d\n", *charsetID)
+	}
+	if *low <= 0 || *normal <= 0 || *critical <= 0 {
+		log.Fatalln("durations must be positive")
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer conn.Close()
+
+	ns := &notificationServer{
+		conn:      conn,
+		durations: [3]time.Duration{*low, *normal, *critical},
+		wake:      make(chan struct{}, 1),
+		pending:   make(map[uint32]struct{}),
+	}
+	if err := conn.Export(ns, notificationsPath,
+		notificationsName); err != nil {
+		log.Fatalln(err)
+	}
+	reply, err := conn.RequestName(notificationsName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		log.Fatalln("another notification server is running")
+	}
+	ns.run(&display{output: out, charset: uint8(*charsetID)})
+}
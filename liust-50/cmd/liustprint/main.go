@@ -0,0 +1,189 @@
+// liustprint shows text from its standard input on a LIUST-50 display,
+// a page or a line at a time.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+// wrap splits a line of text into display rows at word boundaries,
+// breaking up words that would not fit on a row of their own.
+func wrap(text string, width int) (rows []string) {
+	var row []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		if len(row) > 0 && len(row)+1+len(runes) <= width {
+			row = append(append(row, ' '), runes...)
+			continue
+		}
+		if len(row) > 0 {
+			rows, row = append(rows, string(row)), nil
+		}
+		for len(runes) > width {
+			rows, runes = append(rows, string(runes[:width])), runes[width:]
+		}
+		row = runes
+	}
+	if len(row) > 0 {
+		rows = append(rows, string(row))
+	}
+	return rows
+}
+
+// sanitize turns tabs into spaces, and strips other control characters,
+// which would only show up as question marks.
+func sanitize(line string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// read sends wrapped rows of the input, one line at a time.
+// Blank lines are skipped, as the display has little space to spare.
+func read(r io.Reader, out chan<- []string) error {
+	defer close(out)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if rows := wrap(sanitize(scanner.Text()), takeover.Width); rows != nil {
+			out <- rows
+		}
+	}
+	return scanner.Err()
+}
+
+type pager struct {
+	w       io.Writer
+	charset uint8
+	step    int           // by how many rows to advance
+	delay   time.Duration // how long to show each position for
+
+	rows  []string                // rows starting at the shown position
+	shown [takeover.Height]string // what is on the display
+}
+
+// render updates the display with rows from the current position.
+func (p *pager) render() error {
+	var b bytes.Buffer
+	for y := 0; y < takeover.Height; y++ {
+		row := ""
+		if y < len(p.rows) {
+			row = p.rows[y]
+		}
+		if p.shown[y] != row {
+			b.Write(encoder.Locate(y, 0))
+			b.Write(encoder.Text(row+strings.Repeat(" ",
+				takeover.Width-utf8.RuneCountInString(row)), p.charset))
+			p.shown[y] = row
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	_, err := p.w.Write(b.Bytes())
+	return err
+}
+
+// run shows rows as they come, until the input is exhausted,
+// and everything has been shown for at least the delay.
+func (p *pager) run(in <-chan []string) error {
+	init := append(encoder.SelectCharset(p.charset), encoder.Clear()...)
+	if _, err := p.w.Write(
+		append(init, encoder.SetCursorMode(encoder.CursorOff)...)); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(p.delay)
+	defer timer.Stop()
+	waited := false
+	for in != nil || len(p.rows) > takeover.Height || !waited {
+		// Advancing needs both the delay to pass, and rows to advance to.
+		if waited && len(p.rows) > takeover.Height {
+			p.rows = p.rows[p.step:]
+			timer.Reset(p.delay)
+			waited = false
+		}
+		if err := p.render(); err != nil {
+			return err
+		}
+
+		select {
+		case rows, ok := <-in:
+			if !ok {
+				in = nil
+			} else {
+				p.rows = append(p.rows, rows...)
+			}
+		case <-timer.C:
+			waited = true
+		}
+	}
+	return nil
+}
+
+func main() {
+	var (
+		charsetID = flag.Uint("charset", 0, "character set to encode text in")
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		scroll = flag.Bool("scroll", false,
+			"scroll by lines, rather than turning whole pages")
+		delay = flag.Duration("delay", 2*time.Second,
+			"how long to show each page or scrolling position for")
+	)
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *charsetID > 0xff {
+		log.Fatalf("invalid charset: %d\n", *charsetID)
+	}
+	if *delay <= 0 {
+		log.Fatalf("invalid delay: %s\n", *delay)
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w, err := out.Open()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer w.Close()
+
+	p := &pager{w: w, charset: uint8(*charsetID),
+		step: takeover.Height, delay: *delay}
+	if *scroll {
+		p.step = 1
+	}
+
+	rows := make(chan []string)
+	go func() {
+		if err := read(os.Stdin, rows); err != nil {
+			log.Println("input:", err)
+		}
+	}()
+	if err := p.run(rows); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"image"
 	"image/color"
+	"io"
 	"log"
+	"net"
 	"os"
-	"strconv"
-	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -15,52 +16,18 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
-	"janouch.name/desktop-tools/liust-50/charset"
+	"janouch.name/desktop-tools/liust-50/emulator"
+	"janouch.name/desktop-tools/liust-50/output"
 )
 
-// --- Display emulation -------------------------------------------------------
+// --- Display rendering -------------------------------------------------------
 
 const (
-	displayWidth  = 20
-	displayHeight = 2
-	charWidth     = 5 + 1
-	charHeight    = 7 + 1
+	charWidth  = 5 + 1
+	charHeight = 7 + 1
 )
 
-// TODO(p): See how this works exactly, and implement it.
-const (
-	cursorModeOff = iota
-	cursorModeBlink
-	cursorModeLightUp
-)
-
-type Display struct {
-	chars      [displayHeight][displayWidth]uint8
-	charset    uint8
-	cursorX    int
-	cursorY    int
-	cursorMode int
-}
-
-func NewDisplay() *Display {
-	return &Display{charset: 2}
-}
-
-func (d *Display) Clear() {
-	for y := 0; y < displayHeight; y++ {
-		for x := 0; x < displayWidth; x++ {
-			d.chars[y][x] = 0x20 // space
-		}
-	}
-}
-
-func (d *Display) ClearToEnd() {
-	for x := d.cursorX; x < displayWidth; x++ {
-		d.chars[d.cursorY][x] = 0x20 // space
-	}
-}
-
-func (d *Display) drawCharacter(
+func drawCharacter(d *emulator.Display,
 	img *image.RGBA, character image.Image, cx, cy int) {
 	if character == nil {
 		return
@@ -73,7 +40,8 @@ func (d *Display) drawCharacter(
 			var c color.RGBA
 			if r, _, _, _ := character.At(
 				bounds.Min.X+dx, bounds.Min.Y+dy).RGBA(); r >= 0x8000 {
-				c = color.RGBA{0x00, 0xFF, 0xB0, 0xFF}
+				c = color.RGBA{0x00, uint8(0xFF * d.Brightness / 4),
+					uint8(0xB0 * d.Brightness / 4), 0xFF}
 			} else {
 				c = color.RGBA{0x18, 0x18, 0x18, 0xFF}
 			}
@@ -82,9 +50,9 @@ func (d *Display) drawCharacter(
 	}
 }
 
-func (d *Display) Render() image.Image {
-	width := 1 + displayWidth*charWidth
-	height := 1 + displayHeight*charHeight
+func render(d *emulator.Display) image.Image {
+	width := 1 + emulator.Width*charWidth
+	height := 1 + emulator.Height*charHeight
 
 	// XXX: Not sure if we rather don't want to provide double buffering,
 	// meaning we would cycle between two internal buffers.
@@ -97,195 +65,14 @@ func (d *Display) Render() image.Image {
 		}
 	}
 
-	for cy := 0; cy < displayHeight; cy++ {
-		for cx := 0; cx < displayWidth; cx++ {
-			charImg := charset.ResolveCharToImage(d.chars[cy][cx], d.charset)
-			d.drawCharacter(img, charImg, cx, cy)
+	for cy := 0; cy < emulator.Height; cy++ {
+		for cx := 0; cx < emulator.Width; cx++ {
+			drawCharacter(d, img, d.Glyph(d.Chars[cy][cx]), cx, cy)
 		}
 	}
 	return img
 }
 
-func (d *Display) PutChar(ch uint8) {
-	if d.cursorX >= displayWidth || d.cursorY >= displayHeight {
-		return
-	}
-
-	d.chars[d.cursorY][d.cursorX] = ch
-	d.cursorX++
-	if d.cursorX >= displayWidth {
-		d.cursorX = displayWidth - 1
-	}
-}
-
-func (d *Display) LineFeed() {
-	d.cursorY++
-	if d.cursorY >= displayHeight {
-		d.cursorY = displayHeight - 1
-
-		y := 0
-		for ; y < displayHeight-1; y++ {
-			d.chars[y] = d.chars[y+1]
-		}
-		for x := 0; x < displayWidth; x++ {
-			d.chars[y][x] = 0x20
-		}
-	}
-}
-
-func (d *Display) CarriageReturn() {
-	d.cursorX = 0
-}
-
-func (d *Display) Backspace() {
-	if d.cursorX > 0 {
-		d.cursorX--
-	}
-}
-
-func (d *Display) SetCursor(x, y int) {
-	if x >= 0 && x < displayWidth {
-		d.cursorX = x
-	}
-	if y >= 0 && y < displayHeight {
-		d.cursorY = y
-	}
-}
-
-// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-
-func parseANSI(input string) (command string, params []int) {
-	if !strings.HasPrefix(input, "\x1b[") {
-		return "", nil
-	}
-
-	input = input[2:]
-	if len(input) == 0 {
-		return "", nil
-	}
-
-	cmdIdx := len(input) - 1
-	paramStr, command := input[:cmdIdx], input[cmdIdx:]
-	if paramStr != "" {
-		for _, p := range strings.Split(paramStr, ";") {
-			if p = strings.TrimSpace(p); p == "" {
-				params = append(params, 0)
-			} else if value, err := strconv.Atoi(p); err == nil {
-				params = append(params, value)
-			}
-		}
-	}
-	return command, params
-}
-
-// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-
-type protocolParser struct {
-	seq     strings.Builder
-	inEsc   bool
-	inCSI   bool
-	display *Display
-}
-
-func newProtocolParser(d *Display) *protocolParser {
-	return &protocolParser{display: d}
-}
-
-func (pp *protocolParser) reset() {
-	pp.inEsc = false
-	pp.inCSI = false
-	pp.seq.Reset()
-}
-
-func (pp *protocolParser) handleCSICommand() bool {
-	cmd, params := parseANSI(pp.seq.String())
-
-	switch cmd {
-	case "J": // Clear display
-		// XXX: The no params case is unverified.
-		if len(params) == 0 || params[0] == 2 {
-			pp.display.Clear()
-		}
-	case "K": // Delete to end of line
-		// XXX: The no params case is unverified (but it should work).
-		if len(params) == 0 || params[0] == 0 {
-			pp.display.ClearToEnd()
-		}
-	case "H": // Cursor position
-		y, x := 0, 0
-		if len(params) >= 1 {
-			y = params[0] - 1 // 1-indexed to 0-indexed
-		}
-		if len(params) >= 2 {
-			x = params[1] - 1
-		}
-		pp.display.SetCursor(x, y)
-	}
-	return true
-}
-
-func (pp *protocolParser) handleEscapeSequence(b byte) bool {
-	pp.seq.WriteByte(b)
-
-	if pp.seq.Len() == 2 && b == '[' {
-		pp.inCSI = true
-		return false
-	}
-
-	if pp.seq.Len() == 3 && pp.seq.String()[1] == 'R' {
-		pp.display.charset = b
-		pp.reset()
-		return true
-	}
-
-	if pp.inCSI && (b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z') {
-		refresh := pp.handleCSICommand()
-		pp.reset()
-		return refresh
-	}
-
-	if pp.seq.Len() == 6 && pp.seq.String()[1:5] == "\\?LC" {
-		pp.display.cursorMode = int(pp.seq.String()[5])
-		return true
-	}
-
-	return false
-}
-
-func (pp *protocolParser) handleCharacter(b byte) bool {
-	switch b {
-	case 0x0A: // LF
-		pp.display.LineFeed()
-		return true
-	case 0x0D: // CR
-		pp.display.CarriageReturn()
-		return true
-	case 0x08: // BS
-		pp.display.Backspace()
-		return true
-	default:
-		if b >= 0x20 {
-			pp.display.PutChar(b)
-			return true
-		}
-	}
-	return false
-}
-
-func (pp *protocolParser) handleByte(b byte) (needsRefresh bool) {
-	if b == 0x1b { // ESC
-		pp.reset()
-		pp.inEsc = true
-		pp.seq.WriteByte(b)
-		return false
-	}
-	if pp.inEsc {
-		return pp.handleEscapeSequence(b)
-	}
-
-	return pp.handleCharacter(b)
-}
-
 // --- Display widget ----------------------------------------------------------
 
 type DisplayRenderer struct {
@@ -343,7 +130,7 @@ func (r *DisplayRenderer) MinSize() fyne.Size {
 func (r *DisplayRenderer) Objects() []fyne.CanvasObject { return r.objects }
 
 func (r *DisplayRenderer) Refresh() {
-	r.image.Image = r.displayWidget.display.Render()
+	r.image.Image = render(r.displayWidget.display)
 	r.image.Refresh()
 	r.label.Refresh()
 }
@@ -352,17 +139,17 @@ func (r *DisplayRenderer) Refresh() {
 
 type DisplayWidget struct {
 	widget.BaseWidget
-	display *Display
+	display *emulator.Display
 }
 
-func NewDisplayWidget(display *Display) *DisplayWidget {
+func NewDisplayWidget(display *emulator.Display) *DisplayWidget {
 	dw := &DisplayWidget{display: display}
 	dw.ExtendBaseWidget(dw)
 	return dw
 }
 
 func (dw *DisplayWidget) CreateRenderer() fyne.WidgetRenderer {
-	image := canvas.NewImageFromImage(dw.display.Render())
+	image := canvas.NewImageFromImage(render(dw.display))
 	image.ScaleMode = canvas.ImageScalePixels
 
 	label := canvas.NewText("TOSHIBA", color.Gray{0x99})
@@ -378,32 +165,62 @@ func (dw *DisplayWidget) CreateRenderer() fyne.WidgetRenderer {
 
 // --- Main --------------------------------------------------------------------
 
+func process(r io.Reader, display *emulator.Display, dw *DisplayWidget) error {
+	reader := bufio.NewReader(r)
+	parser := emulator.NewParser(display)
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if parser.HandleByte(b) {
+			fyne.DoAndWait(func() { dw.Refresh() })
+		}
+	}
+}
+
 func main() {
+	listenURI := flag.String("listen", "",
+		"accept connections on a tcp:// or unix: address, "+
+			"instead of reading the standard input")
+	flag.Parse()
+
+	var listener net.Listener
+	if *listenURI != "" {
+		var err error
+		if listener, err = output.Listen(*listenURI); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	a := app.New()
 	a.Settings().SetTheme(theme.DarkTheme())
 	window := a.NewWindow("Toshiba Tec LIUST-50 Simulator")
 
-	display := NewDisplay()
-	display.Clear()
+	display := emulator.NewDisplay()
 
 	dw := NewDisplayWidget(display)
 	window.SetContent(dw)
 	window.Resize(fyne.NewSize(600, 150))
 
 	go func() {
-		reader := bufio.NewReader(os.Stdin)
-		parser := newProtocolParser(display)
+		if listener == nil {
+			log.Println(process(os.Stdin, display, dw))
+			return
+		}
 
+		// Clients are served one at a time, as with a real serial port.
 		for {
-			b, err := reader.ReadByte()
+			conn, err := listener.Accept()
 			if err != nil {
-				log.Println(err)
-				return
+				log.Fatalln(err)
 			}
-
-			if parser.handleByte(b) {
-				fyne.DoAndWait(func() { dw.Refresh() })
+			if err := process(conn, display, dw); err != io.EOF {
+				log.Println(err)
 			}
+			conn.Close()
 		}
 	}()
 
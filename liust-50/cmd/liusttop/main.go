@@ -0,0 +1,260 @@
+// liusttop takes turns showing the processes that use the most CPU time
+// and memory on a LIUST-50 display, one of each at a time.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/output"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+// userHZ is the unit of CPU times in /proc, which is fixed on Linux.
+const userHZ = 100
+
+type process struct {
+	name    string
+	jiffies uint64 // user and system time
+	rss     uint64 // resident set size, in pages
+}
+
+// readProcess parses /proc/PID/stat.
+func readProcess(path string) (process, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return process{}, err
+	}
+
+	// The name may contain anything, including spaces and parentheses.
+	s := string(b)
+	start, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if start < 0 || end < start {
+		return process{}, errors.New("unexpected format")
+	}
+	p := process{name: s[start+1 : end]}
+
+	// Fields are numbered from the state, which is the third one.
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return process{}, errors.New("unexpected format")
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	rss, err3 := strconv.ParseUint(fields[21], 10, 64)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return process{}, err
+	}
+	p.jiffies, p.rss = utime+stime, rss
+	return p, nil
+}
+
+// readProcesses returns all processes by their PID.
+// Those that disappear while being read are skipped.
+func readProcesses() (map[int]process, error) {
+	paths, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil, err
+	}
+
+	processes := make(map[int]process)
+	for _, path := range paths {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err != nil {
+			continue
+		}
+		if p, err := readProcess(path); err == nil {
+			processes[pid] = p
+		}
+	}
+	if len(processes) == 0 {
+		return nil, errors.New("no processes found in /proc")
+	}
+	return processes, nil
+}
+
+// readMemTotal returns the amount of physical memory, in bytes.
+func readMemTotal() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "MemTotal:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) < 1 {
+			break
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		return n * 1024, err
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("unexpected /proc/meminfo format")
+}
+
+type usage struct {
+	name    string
+	percent float64
+}
+
+// top returns the processes with the highest usage, in descending order.
+func top(usages []usage, count int) []usage {
+	slices.SortStableFunc(usages, func(a, b usage) int {
+		switch {
+		case a.percent > b.percent:
+			return -1
+		case a.percent < b.percent:
+			return +1
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return usages[:min(count, len(usages))]
+}
+
+// topCPU ranks processes by CPU time used in between two readings,
+// as a percentage of a single CPU, like top(1) does it.
+func topCPU(last, current map[int]process,
+	elapsed time.Duration, count int) []usage {
+	var usages []usage
+	for pid, p := range current {
+		lp, ok := last[pid]
+		if !ok || p.jiffies < lp.jiffies || elapsed <= 0 {
+			continue
+		}
+		usages = append(usages, usage{p.name, float64(p.jiffies-lp.jiffies) /
+			userHZ / elapsed.Seconds() * 100})
+	}
+	return top(usages, count)
+}
+
+// topMemory ranks processes by their resident memory.
+func topMemory(current map[int]process, memTotal uint64, count int) []usage {
+	var usages []usage
+	for _, p := range current {
+		usages = append(usages, usage{p.name,
+			float64(p.rss*uint64(os.Getpagesize())) / float64(memTotal) * 100})
+	}
+	return top(usages, count)
+}
+
+// formatUsage makes a row out of the rank-th process of a ranking,
+// such as "C1 firefox     12.3%".
+func formatUsage(label string, ranking []usage, rank int) string {
+	if rank >= len(ranking) {
+		return fmt.Sprintf("%-*s", takeover.Width, label)
+	}
+
+	u := ranking[rank]
+	prefix := fmt.Sprintf("%s%d ", label, rank+1)
+	percent := fmt.Sprintf("%5.1f%%", min(u.percent, 999.9))
+	name := []rune(u.name)
+	space := takeover.Width - len(prefix) - len(percent) - 1
+	if len(name) > space {
+		name = name[:space]
+	}
+	return prefix + string(name) +
+		strings.Repeat(" ", space-len(name)+1) + percent
+}
+
+func run(w io.Writer, charsetID uint8, interval time.Duration, count int) error {
+	memTotal, err := readMemTotal()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(slices.Concat(encoder.SelectCharset(charsetID),
+		encoder.Clear(), encoder.SetCursorMode(encoder.CursorOff))); err != nil {
+		return err
+	}
+
+	// CPU usage can only be told from the difference between two readings.
+	last, err := readProcesses()
+	if err != nil {
+		return err
+	}
+	lastTime := time.Now()
+	time.Sleep(time.Second)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for rank := 0; ; rank = (rank + 1) % count {
+		current, err := readProcesses()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		cpu := topCPU(last, current, now.Sub(lastTime), count)
+		memory := topMemory(current, memTotal, count)
+		last, lastTime = current, now
+
+		var b bytes.Buffer
+		for y, row := range []string{
+			formatUsage("C", cpu, rank),
+			formatUsage("M", memory, rank),
+		} {
+			b.Write(encoder.Locate(y, 0))
+			b.Write(encoder.Text(row, charsetID))
+		}
+		if _, err := w.Write(b.Bytes()); err != nil {
+			return err
+		}
+		<-ticker.C
+	}
+}
+
+func main() {
+	var (
+		charsetID = flag.Uint("charset", 0, "display character set")
+		outputURI = flag.String("output", "-", "output URI, such as "+
+			"serial:/dev/ttyUSB0?baud=9600 or tcp://localhost:1234")
+		interval = flag.Duration("interval", 3*time.Second,
+			"how long to show each process for")
+		count = flag.Int("count", 5, "how many processes to take turns showing")
+	)
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *charsetID > 0xff {
+		log.Fatalf("invalid charset: %d\n", *charsetID)
+	}
+	if *interval <= 0 {
+		log.Fatalf("invalid interval: %s\n", *interval)
+	}
+	if *count < 1 || *count > 9 {
+		log.Fatalf("invalid count: %d\n", *count)
+	}
+
+	out, err := output.Parse(*outputURI)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w, err := out.Open()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer w.Close()
+	if err := run(w, uint8(*charsetID), *interval, *count); err != nil {
+		log.Fatalln(err)
+	}
+}
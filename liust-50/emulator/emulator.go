@@ -0,0 +1,371 @@
+// Package emulator interprets data sent to LIUST-50 displays,
+// keeping track of what they would show.
+package emulator
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+	"janouch.name/desktop-tools/liust-50/encoder"
+	"janouch.name/desktop-tools/liust-50/takeover"
+)
+
+const (
+	Width  = takeover.Width
+	Height = takeover.Height
+)
+
+// Display is the state of an emulated display.
+type Display struct {
+	Chars      [Height][Width]uint8
+	Charset    uint8
+	CursorX    int
+	CursorY    int
+	CursorMode int // TODO(p): See how this works exactly, and implement it.
+	Brightness int // dimming level, from 1 to 4
+
+	// UserChars are user-defined characters, by code, which show in place
+	// of those of the character set while UserCharset is set.
+	UserChars   [256]encoder.UserChar
+	UserDefined [256]bool
+	UserCharset bool
+}
+
+func NewDisplay() *Display {
+	d := &Display{Charset: 2, Brightness: 4}
+	d.Clear()
+	return d
+}
+
+func (d *Display) Clear() {
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			d.Chars[y][x] = 0x20 // space
+		}
+	}
+}
+
+// Glyph returns the 5x7 bitmap that a character code shows as,
+// or nil if it is unknown.
+func (d *Display) Glyph(char uint8) image.Image {
+	if !d.UserCharset || !d.UserDefined[char] {
+		return charset.ResolveCharToImage(char, d.Charset)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 5, 7))
+	for y, row := range d.UserChars[char] {
+		for x := 0; x < 5; x++ {
+			if row>>(4-x)&1 != 0 {
+				img.SetGray(x, y, color.Gray{0xff})
+			}
+		}
+	}
+	return img
+}
+
+func (d *Display) ClearToEnd() {
+	for x := d.CursorX; x < Width; x++ {
+		d.Chars[d.CursorY][x] = 0x20 // space
+	}
+}
+
+func (d *Display) PutChar(ch uint8) {
+	if d.CursorX >= Width || d.CursorY >= Height {
+		return
+	}
+
+	d.Chars[d.CursorY][d.CursorX] = ch
+	d.CursorX++
+	if d.CursorX >= Width {
+		d.CursorX = Width - 1
+	}
+}
+
+func (d *Display) LineFeed() {
+	d.CursorY++
+	if d.CursorY >= Height {
+		d.CursorY = Height - 1
+
+		y := 0
+		for ; y < Height-1; y++ {
+			d.Chars[y] = d.Chars[y+1]
+		}
+		for x := 0; x < Width; x++ {
+			d.Chars[y][x] = 0x20
+		}
+	}
+}
+
+func (d *Display) CarriageReturn() {
+	d.CursorX = 0
+}
+
+func (d *Display) Backspace() {
+	if d.CursorX > 0 {
+		d.CursorX--
+	}
+}
+
+func (d *Display) SetCursor(x, y int) {
+	if x >= 0 && x < Width {
+		d.CursorX = x
+	}
+	if y >= 0 && y < Height {
+		d.CursorY = y
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+func parseANSI(input string) (command string, params []int) {
+	if !strings.HasPrefix(input, "\x1b[") {
+		return "", nil
+	}
+
+	input = input[2:]
+	if len(input) == 0 {
+		return "", nil
+	}
+
+	cmdIdx := len(input) - 1
+	paramStr, command := input[:cmdIdx], input[cmdIdx:]
+	if paramStr != "" {
+		for _, p := range strings.Split(paramStr, ";") {
+			if p = strings.TrimSpace(p); p == "" {
+				params = append(params, 0)
+			} else if value, err := strconv.Atoi(p); err == nil {
+				params = append(params, value)
+			}
+		}
+	}
+	return command, params
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// Parser applies a stream of data to a display.
+type Parser struct {
+	Display *Display
+
+	// Control receives application program commands, which are not meant
+	// for the display itself, but for whatever sits in front of it.
+	Control func(command string)
+
+	seq      strings.Builder
+	inEsc    bool
+	inCSI    bool
+	inAPC    bool
+	inDefine bool
+}
+
+func NewParser(d *Display) *Parser {
+	return &Parser{Display: d}
+}
+
+func (pp *Parser) reset() {
+	pp.inEsc = false
+	pp.inCSI = false
+	pp.inAPC = false
+	pp.inDefine = false
+	pp.seq.Reset()
+}
+
+func (pp *Parser) handleCSICommand() bool {
+	cmd, params := parseANSI(pp.seq.String())
+
+	switch cmd {
+	case "J": // Clear display
+		// XXX: The no params case is unverified.
+		if len(params) == 0 || params[0] == 2 {
+			pp.Display.Clear()
+		}
+	case "K": // Delete to end of line
+		// XXX: The no params case is unverified (but it should work).
+		if len(params) == 0 || params[0] == 0 {
+			pp.Display.ClearToEnd()
+		}
+	case "H": // Cursor position
+		y, x := 0, 0
+		if len(params) >= 1 {
+			y = params[0] - 1 // 1-indexed to 0-indexed
+		}
+		if len(params) >= 2 {
+			x = params[1] - 1
+		}
+		pp.Display.SetCursor(x, y)
+	}
+	return true
+}
+
+// handleAPC collects an application program command,
+// which is terminated by ESC \ (ST) or BEL.
+func (pp *Parser) handleAPC(b byte) bool {
+	command := pp.seq.String()[2:]
+	switch {
+	case b == 0x07:
+	case b == '\\' && strings.HasSuffix(command, "\x1b"):
+		command = command[:len(command)-1]
+	default:
+		pp.seq.WriteByte(b)
+		return false
+	}
+
+	if pp.Control != nil {
+		pp.Control(command)
+	}
+	pp.reset()
+	return false
+}
+
+// handleDefine collects the ESC & y c1 c2 [x d1...d(y*x)]... command,
+// defining characters c1 through c2, each of x columns that are y bytes tall.
+// Data may contain any bytes, including ESC.
+func (pp *Parser) handleDefine(b byte) bool {
+	pp.seq.WriteByte(b)
+	seq := pp.seq.String()
+	if len(seq) < 5 {
+		return false
+	}
+
+	// Only 5x7 characters, stored in a byte per column, make sense.
+	y, c1, c2 := int(seq[2]), int(seq[3]), int(seq[4])
+	var chars []encoder.UserChar
+	i := 5
+	for c := c1; c <= c2; c++ {
+		if i >= len(seq) {
+			return false
+		}
+		x := int(seq[i])
+		if i+1+x*y > len(seq) {
+			return false
+		}
+
+		var char encoder.UserChar
+		for column := 0; column < min(x, 5) && y == 1; column++ {
+			for row := range char {
+				if seq[i+1+column]>>(7-row)&1 != 0 {
+					char[row] |= 1 << (4 - column)
+				}
+			}
+		}
+		chars = append(chars, char)
+		i += 1 + x*y
+	}
+
+	if y == 1 {
+		for i, char := range chars {
+			pp.Display.UserChars[c1+i] = char
+			pp.Display.UserDefined[c1+i] = true
+		}
+	}
+	pp.reset()
+	return true
+}
+
+func (pp *Parser) handleEscapeSequence(b byte) bool {
+	pp.seq.WriteByte(b)
+
+	if pp.seq.Len() == 2 && b == '[' {
+		pp.inCSI = true
+		return false
+	}
+
+	if pp.seq.Len() == 2 && b == '_' {
+		pp.inAPC = true
+		return false
+	}
+
+	// XXX: The ESC & and ESC % commands are unverified, they follow ESC/POS.
+	if pp.seq.Len() == 2 && b == '&' {
+		pp.inDefine = true
+		return false
+	}
+
+	if pp.seq.Len() == 3 && pp.seq.String()[1] == '%' {
+		pp.Display.UserCharset = b&1 != 0
+		pp.reset()
+		return true
+	}
+
+	if pp.seq.Len() == 3 && pp.seq.String()[1] == 'R' {
+		pp.Display.Charset = b
+		pp.reset()
+		return true
+	}
+
+	if pp.inCSI && (b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z') {
+		refresh := pp.handleCSICommand()
+		pp.reset()
+		return refresh
+	}
+
+	if pp.seq.Len() == 6 && pp.seq.String()[1:5] == "\\?LC" {
+		pp.Display.CursorMode = int(b)
+		pp.reset()
+		return true
+	}
+
+	// XXX: This is what liustatus uses for dimming, it is unverified.
+	if pp.seq.Len() == 6 && pp.seq.String()[1:5] == "\\?LD" {
+		if b >= 1 && b <= 4 {
+			pp.Display.Brightness = int(b)
+		}
+		pp.reset()
+		return true
+	}
+
+	return false
+}
+
+func (pp *Parser) handleCharacter(b byte) bool {
+	switch b {
+	case 0x0A: // LF
+		pp.Display.LineFeed()
+		return true
+	case 0x0D: // CR
+		pp.Display.CarriageReturn()
+		return true
+	case 0x08: // BS
+		pp.Display.Backspace()
+		return true
+	default:
+		if b >= 0x20 {
+			pp.Display.PutChar(b)
+			return true
+		}
+	}
+	return false
+}
+
+// HandleByte processes another byte of data,
+// and tells whether the display may have changed as a result.
+func (pp *Parser) HandleByte(b byte) (needsRefresh bool) {
+	if pp.inAPC {
+		return pp.handleAPC(b)
+	}
+	if pp.inDefine {
+		return pp.handleDefine(b)
+	}
+	if b == 0x1b { // ESC
+		pp.reset()
+		pp.inEsc = true
+		pp.seq.WriteByte(b)
+		return false
+	}
+	if pp.inEsc {
+		return pp.handleEscapeSequence(b)
+	}
+
+	return pp.handleCharacter(b)
+}
+
+// Write processes data, never failing.
+func (pp *Parser) Write(p []byte) (int, error) {
+	for _, b := range p {
+		pp.HandleByte(b)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,73 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+)
+
+func TestParser(t *testing.T) {
+	d := NewDisplay()
+	p := NewParser(d)
+	var commands []string
+	p.Control = func(command string) { commands = append(commands, command) }
+
+	p.Write(encoder.SelectCharset(0x63))
+	p.Write(encoder.Clear())
+	p.Write(encoder.Locate(1, 18))
+	p.Write([]byte("abc"))
+	p.Write(encoder.SetBrightness(2))
+	p.Write(encoder.SetCursorMode(encoder.CursorBlink))
+	p.Write(encoder.Control("priority=1"))
+
+	if d.Charset != 0x63 || d.Brightness != 2 ||
+		d.CursorMode != encoder.CursorBlink {
+		t.Errorf("settings not applied: %+v", d)
+	}
+	if row := string(d.Chars[1][:]); row != "                  ac" {
+		t.Errorf("unexpected row: %q", row)
+	}
+	if len(commands) != 1 || commands[0] != "priority=1" {
+		t.Errorf("unexpected commands: %q", commands)
+	}
+}
+
+func TestUserChars(t *testing.T) {
+	d := NewDisplay()
+	p := NewParser(d)
+
+	char := encoder.UserChar{0b10000, 0b01000, 0b00100, 0b00010,
+		0b00001, 0b11111, 0b10101}
+	p.Write(encoder.DefineUserChar(0x80, char))
+	p.Write([]byte{0x80})
+	if !d.UserDefined[0x80] || d.UserChars[0x80] != char {
+		t.Fatalf("character not defined: %05b", d.UserChars[0x80])
+	}
+	if d.UserCharset || d.Chars[0][0] != 0x80 {
+		t.Error("unexpected state")
+	}
+
+	p.Write(encoder.SelectUserCharset(true))
+	if !d.UserCharset {
+		t.Fatal("user-defined characters not selected")
+	}
+	img := d.Glyph(0x80)
+	for y, row := range char {
+		for x := 0; x < 5; x++ {
+			lit := row>>(4-x)&1 != 0
+			if r, _, _, _ := img.At(x, y).RGBA(); (r >= 0x8000) != lit {
+				t.Errorf("pixel %d,%d differs", x, y)
+			}
+		}
+	}
+
+	// Definitions are followed by ordinary data.
+	var b bytes.Buffer
+	b.Write(encoder.DefineUserChars(0x63))
+	b.WriteString("x")
+	p.Write(b.Bytes())
+	if d.Chars[0][1] != 'x' {
+		t.Errorf("definitions consumed too much: %q", d.Chars[0][:2])
+	}
+}
@@ -0,0 +1,127 @@
+package encoder
+
+import (
+	"janouch.name/desktop-tools/liust-50/charset"
+)
+
+// BlockDigits are big digits composed like seven-segment displays,
+// of block characters, which only international charsets have.
+// The upper row holds the top and middle segments, and the lower row
+// the bottom one.
+var BlockDigits = map[rune][2]string{
+	'0': {"█▀█", "█▄█"},
+	'1': {"  █", "  █"},
+	'2': {"▀██", "█▄▄"},
+	'3': {"▀██", "▄▄█"},
+	'4': {"█▄█", "  █"},
+	'5': {"██▀", "▄▄█"},
+	'6': {"██▀", "█▄█"},
+	'7': {"▀▀█", "  █"},
+	'8': {"███", "█▄█"},
+	'9': {"███", "▄▄█"},
+	':': {"·", "·"},
+	' ': {" ", " "},
+}
+
+// UserDigits are big digits of seven-segment displays, two cells wide,
+// drawn with built-in user-defined characters, so that they look the same
+// in any charset. The upper row ends with the middle segment.
+var UserDigits = map[rune][2]string{' ': {" ", " "}}
+
+// Segments of seven-segment displays, named the usual way, clockwise
+// from the top, with the middle one last.
+const (
+	segA = 1 << iota
+	segB
+	segC
+	segD
+	segE
+	segF
+	segG
+)
+
+var digitSegments = []uint8{
+	segA | segB | segC | segD | segE | segF,
+	segB | segC,
+	segA | segB | segD | segE | segG,
+	segA | segB | segC | segD | segG,
+	segB | segC | segF | segG,
+	segA | segC | segD | segF | segG,
+	segA | segC | segD | segE | segF | segG,
+	segA | segB | segC,
+	segA | segB | segC | segD | segE | segF | segG,
+	segA | segB | segC | segD | segF | segG,
+}
+
+// userDigitBase is where the Private Use Area runes of digit pieces start.
+const userDigitBase rune = 0xe100
+
+// digitCell draws the segments that pass through a cell of a big digit.
+// Vertical segments are two pixels thick, as pixels are elongated.
+func digitCell(segments uint8, row, column int) (c UserChar) {
+	sides := [2][2]uint8{{segF, segB}, {segE, segC}}
+	if segments&sides[row][column] != 0 {
+		side := uint8(0b11000)
+		if column != 0 {
+			side = 0b00011
+		}
+		for y := range c {
+			c[y] |= side
+		}
+	}
+	if row == 0 && segments&segA != 0 {
+		c[0] = 0b11111
+	}
+	if row == 0 && segments&segG != 0 || row == 1 && segments&segD != 0 {
+		c[len(c)-1] = 0b11111
+	}
+	return c
+}
+
+func init() {
+	// Pieces that several digits share are only defined once.
+	pieces := map[UserChar]rune{}
+	piece := func(c UserChar) rune {
+		if c == (UserChar{}) {
+			return ' '
+		}
+		r, ok := pieces[c]
+		if !ok {
+			r = userDigitBase + rune(len(pieces))
+			pieces[c] = r
+			userRunes = append(userRunes, userRune{r, c})
+		}
+		return r
+	}
+
+	for digit, segments := range digitSegments {
+		var halves [2]string
+		for row := range halves {
+			halves[row] = string([]rune{
+				piece(digitCell(segments, row, 0)),
+				piece(digitCell(segments, row, 1)),
+			})
+		}
+		UserDigits['0'+rune(digit)] = halves
+	}
+
+	// The dots of colons are kept close to the middle.
+	UserDigits[':'] = [2]string{
+		string(piece(UserChar{0, 0, 0, 0, 0b01110, 0b01110, 0})),
+		string(piece(UserChar{0, 0b01110, 0b01110, 0, 0, 0, 0})),
+	}
+}
+
+// Encodable tells whether Text can represent all of the text
+// in the given character set, including by user-defined characters.
+func Encodable(text string, charsetID uint8) bool {
+	for _, r := range text {
+		if _, ok := charset.ResolveRune(r, charsetID); ok {
+			continue
+		}
+		if _, ok := UserCode(r, charsetID); !ok {
+			return false
+		}
+	}
+	return true
+}
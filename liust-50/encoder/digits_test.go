@@ -0,0 +1,63 @@
+package encoder
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDigits(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		digits  map[rune][2]string
+		charset uint8
+		width   int
+		ok      bool
+	}{
+		{"blocks", BlockDigits, 0, 3, true},
+		{"blocks", BlockDigits, 0x63, 3, false},
+		{"user", UserDigits, 0, 2, true},
+		{"user", UserDigits, 0x63, 2, true},
+	} {
+		encodable := true
+		for r, halves := range test.digits {
+			if utf8.RuneCountInString(halves[0]) !=
+				utf8.RuneCountInString(halves[1]) {
+				t.Errorf("%s %q: halves differ in width", test.name, r)
+			}
+			if w := utf8.RuneCountInString(halves[0]); r >= '0' && r <= '9' &&
+				w != test.width {
+				t.Errorf("%s %q: %d cells wide, expected %d",
+					test.name, r, w, test.width)
+			}
+			encodable = encodable &&
+				Encodable(halves[0]+halves[1], test.charset)
+		}
+		if encodable != test.ok {
+			t.Errorf("%s in %#x: got encodable %t",
+				test.name, test.charset, encodable)
+		}
+	}
+}
+
+func TestDigitCell(t *testing.T) {
+	for _, test := range []struct {
+		digit       int
+		row, column int
+		char        UserChar
+	}{
+		{1, 0, 0, UserChar{}},
+		{1, 1, 1, UserChar{0b00011, 0b00011, 0b00011, 0b00011,
+			0b00011, 0b00011, 0b00011}},
+		{4, 0, 0, UserChar{0b11000, 0b11000, 0b11000, 0b11000,
+			0b11000, 0b11000, 0b11111}},
+		{7, 0, 0, UserChar{0b11111, 0, 0, 0, 0, 0, 0}},
+		{2, 1, 0, UserChar{0b11000, 0b11000, 0b11000, 0b11000,
+			0b11000, 0b11000, 0b11111}},
+	} {
+		if c := digitCell(digitSegments[test.digit],
+			test.row, test.column); c != test.char {
+			t.Errorf("%d at %d, %d: got %05b, expected %05b",
+				test.digit, test.row, test.column, c, test.char)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package encoder produces the byte sequences that LIUST-50 displays
+// understand, from control commands to text in their character sets.
+package encoder
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+
+	"janouch.name/desktop-tools/liust-50/charset"
+)
+
+// Clear blanks the display.
+func Clear() []byte {
+	return []byte("\x1b[2J")
+}
+
+// Locate moves the cursor to the given row and column, counted from zero.
+func Locate(row, column int) []byte {
+	return fmt.Appendf(nil, "\x1b[%d;%dH", row+1, column+1)
+}
+
+// SelectCharset switches the character set used to interpret text.
+func SelectCharset(charsetID uint8) []byte {
+	return []byte{0x1b, 'R', charsetID}
+}
+
+// Cursor modes, as understood by the ESC \?LC command.
+const (
+	CursorOff = iota
+	CursorBlink
+	CursorLightUp
+)
+
+// SetCursorMode changes how the cursor is shown.
+func SetCursorMode(mode int) []byte {
+	return []byte{0x1b, '\\', '?', 'L', 'C', byte(mode)}
+}
+
+// BrightnessLevel converts a percentage to one of the device's four
+// dimming levels, rounding up to a quarter.
+func BrightnessLevel(percent int) int {
+	return min(max((percent+24)/25, 1), 4)
+}
+
+// SetBrightness changes the dimming level of the display, from 1 to 4.
+func SetBrightness(level int) []byte {
+	// XXX: This sequence is unverified, it follows the cursor mode command.
+	return []byte{0x1b, '\\', '?', 'L', 'D', byte(level)}
+}
+
+// Control wraps a command meant for whatever sits in front of the display,
+// such as liustd, in an application program command string.
+func Control(command string) []byte {
+	return fmt.Appendf(nil, "\x1b_%s\x1b\\", command)
+}
+
+// Text converts text to characters of the given character set,
+// including built-in user-defined ones.
+// Runes that cannot be represented are replaced with question marks.
+func Text(text string, charsetID uint8) []byte {
+	b := make([]byte, 0, utf8.RuneCountInString(text))
+	for _, r := range text {
+		if c, ok := charset.ResolveRune(r, charsetID); ok {
+			b = append(b, c)
+		} else if c, ok := UserCode(r, charsetID); ok {
+			b = append(b, c)
+		} else {
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// Narrow converts full-width characters to their half-width forms,
+// and hiragana to katakana, so that Japanese text can be shown
+// in the Japan-2 character set. Voiced kana are split into two characters.
+func Narrow(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= 'ぁ' && r <= 'ゖ':
+			r += 'ァ' - 'ぁ'
+		case r == '゛':
+			r = 'ﾞ'
+		case r == '゜':
+			r = 'ﾟ'
+		}
+		if r >= '゠' && r <= 'ヿ' {
+			b.WriteString(width.Narrow.String(norm.NFD.String(string(r))))
+		} else {
+			b.WriteString(width.Narrow.String(string(r)))
+		}
+	}
+	return b.String()
+}
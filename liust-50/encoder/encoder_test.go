@@ -0,0 +1,57 @@
+package encoder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSequences(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		sequence []byte
+		expected string
+	}{
+		{"clear", Clear(), "\x1b[2J"},
+		{"locate origin", Locate(0, 0), "\x1b[1;1H"},
+		{"locate", Locate(1, 19), "\x1b[2;20H"},
+		{"charset", SelectCharset(0x63), "\x1bRc"},
+		{"cursor", SetCursorMode(CursorBlink), "\x1b\\?LC\x01"},
+		{"brightness", SetBrightness(4), "\x1b\\?LD\x04"},
+		{"control", Control("clear"), "\x1b_clear\x1b\\"},
+		{"text", Text("Aé°", 0), "A\x82\xf8"},
+		{"katakana", Text("ｱ°", 0x63), "\xb1?"},
+		{"unknown", Text("日本", 0), "??"},
+	} {
+		if !bytes.Equal(test.sequence, []byte(test.expected)) {
+			t.Errorf("%s: got %q, expected %q",
+				test.name, test.sequence, test.expected)
+		}
+	}
+}
+
+func TestBrightnessLevel(t *testing.T) {
+	for _, test := range []struct{ percent, level int }{
+		{-10, 1}, {0, 1}, {1, 1}, {25, 1}, {26, 2}, {50, 2},
+		{51, 3}, {75, 3}, {76, 4}, {100, 4}, {200, 4},
+	} {
+		if level := BrightnessLevel(test.percent); level != test.level {
+			t.Errorf("%d%%: got %d, expected %d",
+				test.percent, level, test.level)
+		}
+	}
+}
+
+func TestNarrow(t *testing.T) {
+	for _, test := range []struct{ text, narrow string }{
+		{"ABC", "ABC"},
+		{"ＡＢＣ１２３", "ABC123"},
+		{"こんにちは", "ｺﾝﾆﾁﾊ"},
+		{"ガギグ", "ｶﾞｷﾞｸﾞ"},
+		{"パン", "ﾊﾟﾝ"},
+		{"さようなら。", "ｻﾖｳﾅﾗ｡"},
+	} {
+		if narrow := Narrow(test.text); narrow != test.narrow {
+			t.Errorf("%q: got %q, expected %q", test.text, narrow, test.narrow)
+		}
+	}
+}
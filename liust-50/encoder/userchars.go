@@ -0,0 +1,119 @@
+package encoder
+
+import (
+	"janouch.name/desktop-tools/liust-50/charset"
+)
+
+// UserChar is the 5x7 bitmap of a user-defined character, a byte per row,
+// from the top, with the leftmost pixel in bit 4.
+type UserChar [7]uint8
+
+// DefineUserChar downloads a user-defined character to the given code.
+func DefineUserChar(code uint8, c UserChar) []byte {
+	// XXX: This follows the ESC & command of ESC/POS customer displays,
+	// and is unverified. Each byte is a column, with the top pixel in bit 7.
+	b := []byte{0x1b, '&', 1, code, code, 5}
+	for x := 4; x >= 0; x-- {
+		var column byte
+		for y, row := range c {
+			column |= (row >> x & 1) << (7 - y)
+		}
+		b = append(b, column)
+	}
+	return b
+}
+
+// SelectUserCharset makes user-defined characters show in place of those
+// of the character set that have the same codes, or stops doing so.
+func SelectUserCharset(enabled bool) []byte {
+	// XXX: This follows the ESC % command of ESC/POS customer displays,
+	// and is unverified.
+	if enabled {
+		return []byte{0x1b, '%', 1}
+	}
+	return []byte{0x1b, '%', 0}
+}
+
+// Runes from the Private Use Area that stand for built-in user-defined
+// characters, which Text maps to wherever DefineUserChars puts them.
+const (
+	IconClear rune = 0xe000 + iota
+	IconPartlyCloudy
+	IconCloudy
+	IconFog
+	IconRain
+	IconSleet
+	IconSnow
+	IconThunder
+)
+
+// UserBlock is a full block, for meters in charsets that lack one.
+const UserBlock rune = 0xe080
+
+type userRune struct {
+	r    rune
+	char UserChar
+}
+
+// userRunes are all built-in user-defined characters, in the order
+// in which they are assigned codes.
+var userRunes = []userRune{
+	{IconClear, UserChar{0b00000, 0b10101, 0b01110, 0b11011,
+		0b01110, 0b10101, 0b00000}},
+	{IconPartlyCloudy, UserChar{0b10100, 0b01000, 0b10110, 0b01111,
+		0b11111, 0b11111, 0b00000}},
+	{IconCloudy, UserChar{0b00000, 0b00000, 0b00110, 0b01111,
+		0b11111, 0b11111, 0b00000}},
+	{IconFog, UserChar{0b00000, 0b11110, 0b00000, 0b01111,
+		0b00000, 0b11110, 0b00000}},
+	{IconRain, UserChar{0b00110, 0b01111, 0b11111, 0b00000,
+		0b01001, 0b10010, 0b00000}},
+	{IconSleet, UserChar{0b00110, 0b01111, 0b11111, 0b00000,
+		0b01010, 0b10000, 0b00101}},
+	{IconSnow, UserChar{0b00110, 0b01111, 0b11111, 0b00000,
+		0b10101, 0b00000, 0b01010}},
+	{IconThunder, UserChar{0b00110, 0b01111, 0b11111, 0b00010,
+		0b00100, 0b01110, 0b01000}},
+	{UserBlock, UserChar{0b11111, 0b11111, 0b11111, 0b11111,
+		0b11111, 0b11111, 0b11111}},
+}
+
+// userCodes returns the codes that the character set leaves unused,
+// so that user-defined characters don't displace any of its own.
+func userCodes(charsetID uint8) []uint8 {
+	var codes []uint8
+	for code := 0x80; code <= 0xff; code++ {
+		if charset.ResolveCharToRune(uint8(code), charsetID) < 0 {
+			codes = append(codes, uint8(code))
+		}
+	}
+	return codes
+}
+
+// UserCode returns the code of a built-in user-defined character
+// in the given character set, if it has room for it.
+func UserCode(r rune, charsetID uint8) (uint8, bool) {
+	for i, ur := range userRunes {
+		if ur.r != r {
+			continue
+		}
+		if codes := userCodes(charsetID); i < len(codes) {
+			return codes[i], true
+		}
+		break
+	}
+	return 0, false
+}
+
+// DefineUserChars downloads all built-in user-defined characters that
+// the character set has room for, and makes them show.
+func DefineUserChars(charsetID uint8) []byte {
+	var b []byte
+	for i, code := range userCodes(charsetID) {
+		if i >= len(userRunes) {
+			break
+		}
+		b = append(b, DefineUserChar(code, userRunes[i].char)...)
+	}
+	return append(b, SelectUserCharset(true)...)
+}
@@ -0,0 +1,43 @@
+package encoder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDefineUserChar(t *testing.T) {
+	char := UserChar{0b10000, 0b10000, 0b10000, 0b10000,
+		0b10000, 0b10000, 0b11111}
+	expected := []byte{0x1b, '&', 1, 0x80, 0x80, 5,
+		0b11111110, 0b00000010, 0b00000010, 0b00000010, 0b00000010}
+	if b := DefineUserChar(0x80, char); !bytes.Equal(b, expected) {
+		t.Errorf("got %x, expected %x", b, expected)
+	}
+}
+
+func TestUserCode(t *testing.T) {
+	for _, test := range []struct {
+		r       rune
+		charset uint8
+		code    uint8
+	}{
+		{IconClear, 0x63, 0x80},
+		{IconThunder, 0x63, 0x87},
+		{IconClear, 0, 0xb3},
+		{IconRain, 2, 0xb7},
+		{UserBlock, 0x63, 0x88},
+	} {
+		code, ok := UserCode(test.r, test.charset)
+		if !ok || code != test.code {
+			t.Errorf("%U in %#x: got %#x, expected %#x",
+				test.r, test.charset, code, test.code)
+		}
+		if b := Text(string(test.r), test.charset); !bytes.Equal(
+			b, []byte{test.code}) {
+			t.Errorf("%U in %#x: text encoded as %x", test.r, test.charset, b)
+		}
+	}
+	if _, ok := UserCode('a', 0); ok {
+		t.Error("ordinary runes have no user-defined characters")
+	}
+}
@@ -0,0 +1,163 @@
+// Package output opens the connections that carry data to LIUST-50 displays,
+// as specified by URIs shared by all programs in this project.
+package output
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"janouch.name/desktop-tools/liust-50/encoder"
+)
+
+// Output describes where display data is sent. It is specified as a URI:
+//
+//   - "-" or "stdout:" for standard output,
+//   - "serial:/dev/ttyUSB0?baud=9600" for a serial port,
+//   - "file:/path/to/file" for a file or a named pipe, which is appended to,
+//   - "tcp://host:port" or "unix:/path/to/socket" for stream sockets,
+//     such as those of liustsim -listen.
+//
+// Stream sockets may also lead to liustd, which shares the display among
+// several programs. Its parameters go in the query, as in
+// "unix:/run/user/1000/liustd.sock?priority=10&lease=5s&screen=status".
+type Output struct {
+	Scheme  string
+	Address string
+	Baud    int
+	// Params are sent to liustd upon connecting.
+	Params url.Values
+}
+
+// checkParams makes sure that liustd will understand the parameters.
+func checkParams(params url.Values) error {
+	for key, values := range params {
+		var err error
+		switch value := values[len(values)-1]; key {
+		case "priority":
+			_, err = strconv.Atoi(value)
+		case "lease":
+			_, err = time.ParseDuration(value)
+		case "screen":
+		default:
+			return fmt.Errorf("unknown parameter: %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Parse parses and checks an output URI.
+func Parse(uri string) (*Output, error) {
+	if uri == "-" {
+		return &Output{Scheme: "stdout"}, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Output{Scheme: u.Scheme, Address: u.Path}
+	if u.Opaque != "" {
+		o.Address = u.Opaque
+	}
+	switch o.Scheme {
+	case "stdout":
+		return o, nil
+	case "serial":
+		o.Baud = 9600
+		if baud := u.Query().Get("baud"); baud != "" {
+			if o.Baud, err = strconv.Atoi(baud); err != nil {
+				return nil, fmt.Errorf("invalid baud rate: %w", err)
+			}
+		}
+		if _, ok := serialBaudRates[o.Baud]; !ok {
+			return nil, fmt.Errorf("unsupported baud rate: %d", o.Baud)
+		}
+	case "tcp", "unix":
+		if o.Scheme == "tcp" {
+			o.Address = u.Host
+		}
+		if o.Params = u.Query(); len(o.Params) == 0 {
+			o.Params = nil
+		} else if err := checkParams(o.Params); err != nil {
+			return nil, err
+		}
+	case "file":
+	default:
+		return nil, fmt.Errorf("unsupported output: %q", uri)
+	}
+	if o.Address == "" {
+		return nil, fmt.Errorf("output lacks an address: %q", uri)
+	}
+	return o, nil
+}
+
+func (o *Output) String() string {
+	switch o.Scheme {
+	case "stdout":
+		return "stdout"
+	case "serial":
+		return fmt.Sprintf("%s (%d baud)", o.Address, o.Baud)
+	default:
+		return o.Scheme + ":" + o.Address
+	}
+}
+
+// Reconnectable tells whether it makes sense to reopen the output on failure.
+func (o *Output) Reconnectable() bool {
+	return o.Scheme != "stdout"
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Open opens the output for writing.
+func (o *Output) Open() (io.WriteCloser, error) {
+	switch o.Scheme {
+	case "stdout":
+		return nopWriteCloser{os.Stdout}, nil
+	case "serial":
+		return openSerial(o.Address, o.Baud)
+	case "file":
+		return os.OpenFile(o.Address, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	case "tcp", "unix":
+		conn, err := net.Dial(o.Scheme, o.Address)
+		if err != nil || o.Params == nil {
+			return conn, err
+		}
+		if _, err := conn.Write(encoder.Control(o.Params.Encode())); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	return nil, fmt.Errorf("unsupported output: %s", o.Scheme)
+}
+
+// Listen accepts connections on the address of a stream socket output,
+// i.e., tcp://host:port or unix:/path/to/socket, for programs that stand
+// in for the display.
+func Listen(uri string) (net.Listener, error) {
+	o, err := Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Scheme {
+	case "tcp":
+		return net.Listen("tcp", o.Address)
+	case "unix":
+		os.Remove(o.Address)
+		return net.Listen("unix", o.Address)
+	}
+	return nil, fmt.Errorf("unsupported address: %q", uri)
+}
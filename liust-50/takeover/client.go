@@ -0,0 +1,114 @@
+package takeover
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSocket returns the control socket path that liustatus.socket uses.
+func DefaultSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "liustatus.sock")
+}
+
+// Client sends messages to liustatus over its control socket.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Dial connects to the control socket at the given path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// quote makes a single command argument out of any string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// command sends a command line, and waits for its result.
+func (c *Client) command(args ...string) error {
+	if _, err := fmt.Fprintln(c.conn, strings.Join(args, " ")); err != nil {
+		return err
+	}
+	reply, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	reply = strings.TrimSuffix(reply, "\n")
+	if reply == "ok" {
+		return nil
+	}
+	if description, ok := strings.CutPrefix(reply, "error: "); ok {
+		return errors.New(description)
+	}
+	return fmt.Errorf("unexpected reply: %q", reply)
+}
+
+// Show queues a message on displays.
+func (c *Client) Show(m Message) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	args := []string{"show",
+		"-priority", strconv.Itoa(m.Priority), "-line", strconv.Itoa(m.Line)}
+	if m.Blink {
+		args = append(args, "-blink")
+	}
+	if m.Tag != "" {
+		args = append(args, "-tag", quote(m.Tag))
+	}
+	if m.Display != "" {
+		args = append(args, "-display", quote(m.Display))
+	}
+	return c.command(append(args, m.Duration.String(), quote(m.Text))...)
+}
+
+// Clear removes all queued messages.
+func (c *Client) Clear() error {
+	return c.command("clear")
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// WriteMessage takes over whole displays for the given duration,
+// through the control socket at the given path, or DefaultSocket if empty.
+// liustatus only listens on one with control.socket configured,
+// or when started through liustatus.socket.
+func WriteMessage(
+	path, text string, priority int, duration time.Duration) error {
+	if path == "" {
+		path = DefaultSocket()
+	}
+	c, err := Dial(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Show(Message{
+		Text:     text,
+		Priority: priority,
+		Duration: duration,
+		Line:     -1,
+	})
+}
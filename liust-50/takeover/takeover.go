@@ -0,0 +1,203 @@
+// Package takeover describes messages that temporarily take over
+// LIUST-50 displays driven by liustatus, and lets programs send them.
+package takeover
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Width and Height are the dimensions of the display, in characters.
+const (
+	Width  = 20
+	Height = 2
+)
+
+// Message temporarily takes over a line, or the whole display,
+// replacing regular content until it expires.
+type Message struct {
+	Text     string
+	Priority int
+	Duration time.Duration
+	// Line is the line to take over, or -1 for the whole display.
+	Line int
+	// Display is the name of the target display, empty for all of them.
+	Display string
+	// Blink makes the message flash, to draw attention.
+	Blink bool
+	// Tag makes the message replace any queued one with the same tag,
+	// so that frequent updates don't pile up.
+	Tag string
+}
+
+// Validate checks whether the message can be shown.
+func (m *Message) Validate() error {
+	if strings.TrimSpace(m.Text) == "" {
+		return errors.New("empty message")
+	}
+	if m.Duration <= 0 {
+		return errors.New("the duration must be positive")
+	}
+	if m.Line < -1 || m.Line >= Height {
+		return fmt.Errorf("invalid line: %d", m.Line)
+	}
+	return nil
+}
+
+// ParseDuration accepts either seconds, or a Go duration string.
+func ParseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+	return d, nil
+}
+
+// Lines splits the message into display lines. Messages taking over
+// the whole display are split at newlines, or wrapped if they have none.
+func (m *Message) Lines() []string {
+	if m.Line >= 0 {
+		return []string{strings.ReplaceAll(m.Text, "\n", " ")}
+	}
+	if strings.Contains(m.Text, "\n") {
+		return strings.SplitN(m.Text, "\n", Height)
+	}
+	return wrapText(m.Text, Width, Height)
+}
+
+// wrapText wraps text at word boundaries. The last line gets all that remains.
+func wrapText(text string, width, maxLines int) (lines []string) {
+	words := strings.Fields(text)
+	for len(words) > 0 && len(lines) < maxLines-1 {
+		line, n := words[0], 1
+		for ; n < len(words); n++ {
+			if utf8.RuneCountInString(line)+1+
+				utf8.RuneCountInString(words[n]) > width {
+				break
+			}
+			line += " " + words[n]
+		}
+		lines, words = append(lines, line), words[n:]
+	}
+	if len(words) > 0 {
+		lines = append(lines, strings.Join(words, " "))
+	}
+	return lines
+}
+
+type queuedMessage struct {
+	Message
+	seq       uint64
+	remaining time.Duration
+}
+
+// Queue orders messages by priority, and within the same priority
+// by arrival. Only the head is shown, and its time only runs while it is.
+type Queue struct {
+	items []*queuedMessage
+	seq   uint64
+	since time.Time // when the head has been shown
+}
+
+func (q *Queue) sort() {
+	slices.SortStableFunc(q.items, func(a, b *queuedMessage) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		return int(a.seq - b.seq)
+	})
+}
+
+// Push adds a message, possibly preempting the one being shown,
+// or replacing one of the same tag.
+func (q *Queue) Push(m Message, now time.Time) {
+	if i := slices.IndexFunc(q.items, func(item *queuedMessage) bool {
+		return m.Tag != "" && item.Tag == m.Tag
+	}); i >= 0 {
+		q.items = slices.Delete(q.items, i, i+1)
+		if i == 0 {
+			q.since = now
+		}
+	}
+
+	q.seq++
+	item := &queuedMessage{Message: m, seq: q.seq, remaining: m.Duration}
+	if len(q.items) == 0 {
+		q.since = now
+	} else if head := q.items[0]; m.Priority > head.Priority {
+		head.remaining -= now.Sub(q.since)
+		q.since = now
+	}
+	q.items = append(q.items, item)
+	q.sort()
+}
+
+// Active returns the message to be shown, if any.
+func (q *Queue) Active() *Message {
+	if len(q.items) == 0 {
+		return nil
+	}
+	return &q.items[0].Message
+}
+
+// Elapsed returns for how long the active message has been shown.
+func (q *Queue) Elapsed(now time.Time) time.Duration {
+	return now.Sub(q.since)
+}
+
+// Deadline returns when the active message expires, if any.
+func (q *Queue) Deadline() (time.Time, bool) {
+	if len(q.items) == 0 {
+		return time.Time{}, false
+	}
+	return q.since.Add(q.items[0].remaining), true
+}
+
+// Expire removes expired messages, and tells whether anything has changed.
+func (q *Queue) Expire(now time.Time) bool {
+	changed := false
+	for {
+		deadline, ok := q.Deadline()
+		if !ok || now.Before(deadline) {
+			return changed
+		}
+		q.items = q.items[1:]
+		q.since, changed = now, true
+	}
+}
+
+// Remove removes the message with the given tag,
+// and tells whether there has been one.
+func (q *Queue) Remove(tag string, now time.Time) bool {
+	i := slices.IndexFunc(q.items, func(item *queuedMessage) bool {
+		return tag != "" && item.Tag == tag
+	})
+	if i < 0 {
+		return false
+	}
+	q.items = slices.Delete(q.items, i, i+1)
+	if i == 0 {
+		q.since = now
+	}
+	return true
+}
+
+// Contains tells whether a message with the given tag is queued.
+func (q *Queue) Contains(tag string) bool {
+	return slices.ContainsFunc(q.items, func(item *queuedMessage) bool {
+		return tag != "" && item.Tag == tag
+	})
+}
+
+// Clear removes all messages.
+func (q *Queue) Clear() {
+	q.items = nil
+}
@@ -0,0 +1,107 @@
+package takeover
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	type step struct {
+		at       int      // seconds since the start
+		push     *Message // or expire
+		active   string   // empty if there should be none
+		deadline int      // in seconds since the start
+	}
+	message := func(text string, priority, seconds int, tag string) *Message {
+		return &Message{Text: text, Priority: priority,
+			Duration: time.Duration(seconds) * time.Second, Tag: tag}
+	}
+	for _, test := range []struct {
+		name  string
+		steps []step
+	}{
+		{"arrival", []step{
+			{0, message("a", 0, 10, ""), "a", 10},
+			{2, message("b", 0, 5, ""), "a", 10},
+			{10, nil, "b", 15},
+			{15, nil, "", 0},
+		}},
+		{"preemption", []step{
+			{0, message("a", 0, 10, ""), "a", 10},
+			{4, message("b", 1, 5, ""), "b", 9},
+			{9, nil, "a", 15},
+			{15, nil, "", 0},
+		}},
+		{"lower priority", []step{
+			{0, message("a", 1, 5, ""), "a", 5},
+			{1, message("b", 0, 5, ""), "a", 5},
+			{5, nil, "b", 10},
+		}},
+		{"nested preemption", []step{
+			{0, message("a", 0, 10, ""), "a", 10},
+			{2, message("b", 1, 10, ""), "b", 12},
+			{4, message("c", 2, 2, ""), "c", 6},
+			{6, nil, "b", 14},
+			{14, nil, "a", 22},
+		}},
+		{"tag", []step{
+			{0, message("a", 0, 10, "x"), "a", 10},
+			{3, message("b", 0, 10, "x"), "b", 13},
+			{13, nil, "", 0},
+		}},
+		{"tag in waiting", []step{
+			{0, message("a", 1, 10, ""), "a", 10},
+			{1, message("b", 0, 5, "x"), "a", 10},
+			{2, message("c", 0, 5, "x"), "a", 10},
+			{10, nil, "c", 15},
+			{15, nil, "", 0},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var q Queue
+			start := time.Unix(0, 0)
+			for i, s := range test.steps {
+				now := start.Add(time.Duration(s.at) * time.Second)
+				if s.push != nil {
+					q.Push(*s.push, now)
+				} else {
+					q.Expire(now)
+				}
+
+				active, text := q.Active(), ""
+				if active != nil {
+					text = active.Text
+				}
+				if text != s.active {
+					t.Fatalf("step %d: %q is active, expected %q",
+						i, text, s.active)
+				}
+				deadline, ok := q.Deadline()
+				if ok && deadline.Sub(start) != time.Duration(s.deadline)*
+					time.Second {
+					t.Errorf("step %d: expires at %s, expected %ds",
+						i, deadline.Sub(start), s.deadline)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	for _, test := range []struct {
+		text  string
+		lines []string
+	}{
+		{"short", []string{"short"}},
+		{"the quick brown fox jumps over the lazy dog",
+			[]string{"the quick brown fox", "jumps over the lazy dog"}},
+		{"antidisestablishmentarianism is long",
+			[]string{"antidisestablishmentarianism", "is long"}},
+	} {
+		lines := wrapText(test.text, Width, Height)
+		if !slices.Equal(lines, test.lines) {
+			t.Errorf("%q: got %q, expected %q", test.text, lines, test.lines)
+		}
+	}
+}
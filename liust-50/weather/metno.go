@@ -0,0 +1,284 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metnoURL = "https://api.met.no/weatherapi"
+
+// metnoEntry is the part of a forecast's time series entry that is used.
+type metnoEntry struct {
+	Time time.Time `json:"time"`
+	Data struct {
+		Instant struct {
+			Details struct {
+				AirTemperature    *float64 `json:"air_temperature"`
+				WindSpeed         *float64 `json:"wind_speed"`
+				WindFromDirection *float64 `json:"wind_from_direction"`
+			} `json:"details"`
+		} `json:"instant"`
+		Next1Hours *struct {
+			Summary struct {
+				SymbolCode string `json:"symbol_code"`
+			} `json:"summary"`
+			Details struct {
+				PrecipitationAmount *float64 `json:"precipitation_amount"`
+			} `json:"details"`
+		} `json:"next_1_hours"`
+	} `json:"data"`
+}
+
+// metnoForecast is the part of a compact location forecast that is used.
+type metnoForecast struct {
+	Properties struct {
+		Timeseries []metnoEntry `json:"timeseries"`
+	} `json:"properties"`
+}
+
+// metnoWords make up symbol codes, such as "lightrainshowers_day".
+var metnoWords = []struct{ code, text string }{
+	{"clearsky", "clear sky"},
+	{"partlycloudy", "partly cloudy"},
+	{"cloudy", "cloudy"},
+	{"fair", "fair"},
+	{"fog", "fog"},
+	{"light", "light"},
+	{"heavy", "heavy"},
+	{"rain", "rain"},
+	{"sleet", "sleet"},
+	{"snow", "snow"},
+	{"showers", "showers"},
+	{"and", "and"},
+	{"thunder", "thunder"},
+}
+
+// metnoCondition describes a symbol code in words.
+func metnoCondition(code string) string {
+	code, _, _ = strings.Cut(code, "_")
+	// A few codes are misspelt, and will stay that way.
+	code = strings.Replace(code, "lightss", "lights", 1)
+
+	var words []string
+	for code != "" {
+		i := 0
+		for i < len(metnoWords) && !strings.HasPrefix(code, metnoWords[i].code) {
+			i++
+		}
+		if i == len(metnoWords) {
+			return ""
+		}
+		words = append(words, metnoWords[i].text)
+		code = code[len(metnoWords[i].code):]
+	}
+	return Capitalize(strings.Join(words, " "))
+}
+
+// metnoSymbol reduces a symbol code to one of Symbols.
+func metnoSymbol(code string) string {
+	code, _, _ = strings.Cut(code, "_")
+	for _, symbol := range []string{"thunder", "snow", "sleet", "rain", "fog"} {
+		if strings.Contains(code, symbol) {
+			return symbol
+		}
+	}
+	switch code {
+	case "clearsky":
+		return "clear"
+	case "fair", "partlycloudy":
+		return "partlycloudy"
+	case "cloudy":
+		return "cloudy"
+	}
+	return ""
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+
+// metnoProvider uses the Norwegian Meteorological Institute's API,
+// which covers the whole world, without registration. Its terms of service
+// ask for responses to be cached until they expire.
+type metnoProvider struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	forecasts map[string]*metnoCache // by the URL they come from
+}
+
+// metnoCache holds the last response for a location.
+type metnoCache struct {
+	mu sync.Mutex
+
+	url          string         // where forecast comes from
+	forecast     *metnoForecast // the last response, if any
+	expires      time.Time      // when forecast should be renewed
+	lastModified string         // of forecast, as sent by the server
+}
+
+// conditions converts a time series entry, which must have a temperature.
+func (e *metnoEntry) conditions() Conditions {
+	data := &e.Data
+	conditions := Conditions{
+		Time:          e.Time,
+		Temperature:   *data.Instant.Details.AirTemperature,
+		WindSpeed:     data.Instant.Details.WindSpeed,
+		WindDirection: data.Instant.Details.WindFromDirection,
+	}
+	if data.Next1Hours != nil {
+		code := data.Next1Hours.Summary.SymbolCode
+		conditions.Condition, conditions.Symbol =
+			metnoCondition(code), metnoSymbol(code)
+		conditions.Precipitation = data.Next1Hours.Details.PrecipitationAmount
+	}
+	return conditions
+}
+
+// series returns the forecast's time series from the current hour on.
+func (f *metnoForecast) series(now time.Time) []metnoEntry {
+	// The series starts with the current hour, or a little before that.
+	series := f.Properties.Timeseries
+	for len(series) > 1 && !series[1].Time.After(now) {
+		series = series[1:]
+	}
+	return series
+}
+
+// current returns conditions from the forecast's entry for the current hour.
+func (f *metnoForecast) current(now time.Time) (*Conditions, error) {
+	series := f.series(now)
+	if len(series) == 0 || series[0].Data.Instant.Details.AirTemperature == nil {
+		return nil, errNoData
+	}
+	if series[0].Time.Before(now.Add(-time.Hour)) {
+		return nil, errors.New("the forecast is out of date")
+	}
+
+	conditions := series[0].conditions()
+	// The series starts with the current hour, so past hours are missing.
+	for _, entry := range series {
+		if entry.Time.Local().YearDay() != now.YearDay() {
+			break
+		}
+		if t := entry.Data.Instant.Details.AirTemperature; t != nil {
+			if conditions.Low == nil || *t < *conditions.Low {
+				conditions.Low = t
+			}
+			if conditions.High == nil || *t > *conditions.High {
+				conditions.High = t
+			}
+		}
+	}
+	return &conditions, nil
+}
+
+// hourly returns conditions from the forecast's entries,
+// starting with the current hour.
+func (f *metnoForecast) hourly(now time.Time) []Conditions {
+	var forecast []Conditions
+	for _, entry := range f.series(now) {
+		if entry.Data.Instant.Details.AirTemperature != nil {
+			forecast = append(forecast, entry.conditions())
+		}
+	}
+	return forecast
+}
+
+// refresh renews the forecast, unless the server says it hasn't changed.
+func (c *metnoCache) refresh(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if c.forecast != nil && c.lastModified != "" {
+		req.Header.Set("If-Modified-Since", c.lastModified)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if c.forecast == nil {
+			return fmt.Errorf("API returned status %d", resp.StatusCode)
+		}
+	case http.StatusOK:
+		var forecast metnoForecast
+		if err := json.NewDecoder(resp.Body).Decode(&forecast); err != nil {
+			return err
+		}
+		c.forecast = &forecast
+		c.lastModified = resp.Header.Get("Last-Modified")
+	default:
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	c.expires = time.Time{}
+	if expires, err := http.ParseTime(resp.Header.Get("Expires")); err == nil {
+		c.expires = expires
+	}
+	return nil
+}
+
+// get returns the forecast for the location, from the last response,
+// while it is still valid. When renewing it fails, an older forecast
+// may still be returned, along with the error.
+func (m *metnoProvider) get(
+	ctx context.Context, location Location) (*metnoForecast, error) {
+	url := fmt.Sprintf(
+		"%s/locationforecast/2.0/compact?lat=%.4f&lon=%.4f&altitude=%d",
+		metnoURL, location.Latitude, location.Longitude, location.Altitude)
+
+	m.mu.Lock()
+	cache, ok := m.forecasts[url]
+	if !ok {
+		if m.forecasts == nil {
+			m.forecasts = make(map[string]*metnoCache)
+		}
+		cache = &metnoCache{url: url}
+		m.forecasts[url] = cache
+	}
+	m.mu.Unlock()
+
+	// Requests for the same location wait for each other,
+	// so that only one of them goes out.
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.forecast != nil && time.Now().Before(cache.expires) {
+		return cache.forecast, nil
+	}
+	// An older forecast is still better than nothing.
+	err := cache.refresh(ctx, m.client)
+	return cache.forecast, err
+}
+
+func (m *metnoProvider) Current(
+	ctx context.Context, location Location) (*Conditions, error) {
+	forecast, err := m.get(ctx, location)
+	if forecast == nil {
+		return nil, err
+	}
+	conditions, currentErr := forecast.current(time.Now())
+	if err == nil {
+		err = currentErr
+	}
+	return conditions, err
+}
+
+func (m *metnoProvider) Forecast(
+	ctx context.Context, location Location) ([]Conditions, error) {
+	forecast, err := m.get(ctx, location)
+	if forecast == nil {
+		return nil, err
+	}
+	return forecast.hourly(time.Now()), err
+}
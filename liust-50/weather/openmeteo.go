@@ -0,0 +1,140 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const openMeteoURL = "https://api.open-meteo.com/v1/forecast"
+
+// openMeteoProvider uses Open-Meteo, which needs no API key,
+// and combines several national weather services.
+type openMeteoProvider struct {
+	client *http.Client
+}
+
+// openMeteoQuery returns the common part of request URLs.
+func openMeteoQuery(location Location) string {
+	return fmt.Sprintf("%s?latitude=%.5f&longitude=%.5f&elevation=%d"+
+		"&wind_speed_unit=ms&timeformat=unixtime&timezone=auto", openMeteoURL,
+		location.Latitude, location.Longitude, location.Altitude)
+}
+
+func (o *openMeteoProvider) Current(
+	ctx context.Context, location Location) (*Conditions, error) {
+	url := openMeteoQuery(location) +
+		"&current=temperature_2m,weather_code,wind_speed_10m,wind_direction_10m" +
+		"&daily=temperature_2m_min,temperature_2m_max&forecast_days=1"
+
+	var result struct {
+		Current struct {
+			Time        int64    `json:"time"`
+			Temperature *float64 `json:"temperature_2m"`
+			WeatherCode *int     `json:"weather_code"`
+			WindSpeed   *float64 `json:"wind_speed_10m"`
+			WindDir     *float64 `json:"wind_direction_10m"`
+		} `json:"current"`
+		Daily struct {
+			Low  []float64 `json:"temperature_2m_min"`
+			High []float64 `json:"temperature_2m_max"`
+		} `json:"daily"`
+	}
+	if err := FetchJSON(ctx, o.client, url, &result); err != nil {
+		return nil, err
+	}
+	if result.Current.Temperature == nil {
+		return nil, errNoData
+	}
+	conditions := &Conditions{
+		Time:          time.Unix(result.Current.Time, 0),
+		Temperature:   *result.Current.Temperature,
+		WindSpeed:     result.Current.WindSpeed,
+		WindDirection: result.Current.WindDir,
+	}
+	if len(result.Daily.Low) > 0 && len(result.Daily.High) > 0 {
+		conditions.Low, conditions.High =
+			&result.Daily.Low[0], &result.Daily.High[0]
+	}
+	if result.Current.WeatherCode != nil {
+		conditions.Symbol = wmoSymbol(*result.Current.WeatherCode)
+	}
+	return conditions, nil
+}
+
+func (o *openMeteoProvider) Forecast(
+	ctx context.Context, location Location) ([]Conditions, error) {
+	url := openMeteoQuery(location) + "&hourly=temperature_2m,weather_code," +
+		"precipitation,wind_speed_10m,wind_direction_10m&forecast_days=2"
+
+	var result struct {
+		Hourly struct {
+			Time          []int64    `json:"time"`
+			Temperature   []*float64 `json:"temperature_2m"`
+			WeatherCode   []*int     `json:"weather_code"`
+			Precipitation []*float64 `json:"precipitation"`
+			WindSpeed     []*float64 `json:"wind_speed_10m"`
+			WindDir       []*float64 `json:"wind_direction_10m"`
+		} `json:"hourly"`
+	}
+	if err := FetchJSON(ctx, o.client, url, &result); err != nil {
+		return nil, err
+	}
+
+	// Values are all in parallel arrays, which had better be complete.
+	h := &result.Hourly
+	n := len(h.Time)
+	if len(h.Temperature) != n || len(h.WeatherCode) != n ||
+		len(h.Precipitation) != n || len(h.WindSpeed) != n ||
+		len(h.WindDir) != n {
+		return nil, errNoData
+	}
+
+	var forecast []Conditions
+	now := time.Now()
+	for i := range n {
+		t := time.Unix(h.Time[i], 0)
+		if !t.Add(time.Hour).After(now) || h.Temperature[i] == nil {
+			continue
+		}
+		conditions := Conditions{
+			Time:          t,
+			Temperature:   *h.Temperature[i],
+			WindSpeed:     h.WindSpeed[i],
+			WindDirection: h.WindDir[i],
+		}
+		if h.WeatherCode[i] != nil {
+			conditions.Symbol = wmoSymbol(*h.WeatherCode[i])
+		}
+		// Precipitation is summed up over the preceding hour.
+		if i+1 < n {
+			conditions.Precipitation = h.Precipitation[i+1]
+		}
+		forecast = append(forecast, conditions)
+	}
+	return forecast, nil
+}
+
+// wmoSymbol reduces a WMO weather interpretation code to one of Symbols.
+func wmoSymbol(code int) string {
+	switch {
+	case code <= 1:
+		return "clear"
+	case code == 2:
+		return "partlycloudy"
+	case code == 3:
+		return "cloudy"
+	case code == 45 || code == 48:
+		return "fog"
+	case code == 56 || code == 57 || code == 66 || code == 67:
+		return "sleet"
+	case code >= 51 && code <= 65 || code >= 80 && code <= 82:
+		return "rain"
+	case code >= 71 && code <= 77 || code == 85 || code == 86:
+		return "snow"
+	case code >= 95 && code <= 99:
+		return "thunder"
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const openWeatherMapURL = "https://api.openweathermap.org/data/2.5"
+
+// openWeatherMapProvider uses OpenWeatherMap, which needs an API key,
+// yet also describes current conditions in words.
+type openWeatherMapProvider struct {
+	client *http.Client
+	apiKey string
+}
+
+// openWeatherMapEntry is the part of current, or forecast weather, that is used.
+type openWeatherMapEntry struct {
+	Dt      int64 `json:"dt"`
+	Weather []struct {
+		ID          int    `json:"id"`
+		Description string `json:"description"`
+	} `json:"weather"`
+	Main struct {
+		Temp *float64 `json:"temp"`
+	} `json:"main"`
+	Wind struct {
+		Speed *float64 `json:"speed"`
+		Deg   *float64 `json:"deg"`
+	} `json:"wind"`
+	// Precipitation is keyed by the period it is summed up over,
+	// "1h" for current weather, and "3h" in forecasts.
+	Rain map[string]float64 `json:"rain"`
+	Snow map[string]float64 `json:"snow"`
+}
+
+// conditions converts an entry, which must have a temperature.
+func (e *openWeatherMapEntry) conditions(period string, hours float64) Conditions {
+	conditions := Conditions{
+		Time:          time.Unix(e.Dt, 0),
+		Temperature:   *e.Main.Temp,
+		WindSpeed:     e.Wind.Speed,
+		WindDirection: e.Wind.Deg,
+	}
+	if len(e.Weather) > 0 {
+		conditions.Condition = Capitalize(e.Weather[0].Description)
+		conditions.Symbol = openWeatherMapSymbol(e.Weather[0].ID)
+	}
+	// The service leaves precipitation out altogether when there is none.
+	precipitation := (e.Rain[period] + e.Snow[period]) / hours
+	conditions.Precipitation = &precipitation
+	return conditions
+}
+
+func (o *openWeatherMapProvider) fetch(ctx context.Context,
+	endpoint string, location Location, v any) error {
+	query := url.Values{
+		"lat":   {fmt.Sprintf("%.5f", location.Latitude)},
+		"lon":   {fmt.Sprintf("%.5f", location.Longitude)},
+		"appid": {o.apiKey},
+		"units": {"metric"},
+	}
+	return FetchJSON(ctx, o.client,
+		openWeatherMapURL+"/"+endpoint+"?"+query.Encode(), v)
+}
+
+func (o *openWeatherMapProvider) Current(
+	ctx context.Context, location Location) (*Conditions, error) {
+	var result openWeatherMapEntry
+	if err := o.fetch(ctx, "weather", location, &result); err != nil {
+		return nil, err
+	}
+	if result.Main.Temp == nil {
+		return nil, errNoData
+	}
+	conditions := result.conditions("1h", 1)
+	// Current precipitation has already fallen, and is of no use.
+	conditions.Precipitation = nil
+	return &conditions, nil
+}
+
+func (o *openWeatherMapProvider) Forecast(
+	ctx context.Context, location Location) ([]Conditions, error) {
+	var result struct {
+		List []openWeatherMapEntry `json:"list"`
+	}
+	if err := o.fetch(ctx, "forecast", location, &result); err != nil {
+		return nil, err
+	}
+
+	// Entries are three hours apart, and may start with a past one.
+	var forecast []Conditions
+	now := time.Now()
+	for _, entry := range result.List {
+		if entry.Main.Temp != nil &&
+			time.Unix(entry.Dt, 0).Add(3*time.Hour).After(now) {
+			forecast = append(forecast, entry.conditions("3h", 3))
+		}
+	}
+	return forecast, nil
+}
+
+// openWeatherMapSymbol reduces a condition ID to one of Symbols.
+func openWeatherMapSymbol(id int) string {
+	switch {
+	case id >= 200 && id < 300:
+		return "thunder"
+	case id == 511 || id >= 611 && id <= 616:
+		return "sleet"
+	case id >= 300 && id < 600:
+		return "rain"
+	case id >= 600 && id < 700:
+		return "snow"
+	case id >= 700 && id < 800:
+		return "fog"
+	case id == 800:
+		return "clear"
+	case id == 801 || id == 802:
+		return "partlycloudy"
+	case id == 803 || id == 804:
+		return "cloudy"
+	}
+	return ""
+}
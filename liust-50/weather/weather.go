@@ -0,0 +1,114 @@
+// Package weather retrieves current conditions, and forecasts,
+// from several weather services, in metric units.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// UserAgent identifies requests, as some services require.
+var UserAgent = "janouch.name/desktop-tools"
+
+// Symbols are the possible values of Conditions.Symbol, besides empty ones,
+// roughly in the order of increasing severity.
+var Symbols = []string{
+	"clear", "partlycloudy", "cloudy", "fog", "rain", "sleet", "snow", "thunder"}
+
+// errNoData is returned when a response lacks even the temperature.
+var errNoData = errors.New("no usable temperature data found")
+
+// Location is where weather is to be retrieved for.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	// Altitude is in metres, and only used by some providers.
+	Altitude int
+}
+
+// Conditions describe weather at a particular time.
+type Conditions struct {
+	// Time is when the conditions apply, if known.
+	Time time.Time
+	// Temperature is in degrees Celsius.
+	Temperature float64
+	// Condition describes the weather in a few words, if the provider can.
+	Condition string
+	// Symbol is one of Symbols, or empty if unknown.
+	Symbol string
+	// Precipitation is expected within the hour, in millimetres,
+	// or its hourly average over longer forecast periods.
+	Precipitation *float64
+	// WindSpeed is in metres per second, and WindDirection is in degrees
+	// clockwise from the north, where the wind blows from.
+	WindSpeed     *float64
+	WindDirection *float64
+	// Low and High are today's extremes, in degrees Celsius,
+	// only known for current conditions.
+	Low, High *float64
+}
+
+// Provider retrieves weather from a particular service.
+// Providers are safe for concurrent use, and meant to be shared,
+// as some of them cache responses.
+type Provider interface {
+	// Current returns current conditions at the given location.
+	// Failing that, it may still return conditions based on older data,
+	// along with the error.
+	Current(ctx context.Context, location Location) (*Conditions, error)
+	// Forecast returns conditions for the following hours, in order,
+	// starting with the current one, as far as the service forecasts them.
+	Forecast(ctx context.Context, location Location) ([]Conditions, error)
+}
+
+// Providers create providers by name. The API key is only used by some.
+var Providers = map[string]func(client *http.Client, apiKey string) Provider{
+	"metno": func(client *http.Client, apiKey string) Provider {
+		return &metnoProvider{client: client}
+	},
+	"openmeteo": func(client *http.Client, apiKey string) Provider {
+		return &openMeteoProvider{client: client}
+	},
+	"openweathermap": func(client *http.Client, apiKey string) Provider {
+		return &openWeatherMapProvider{client: client, apiKey: apiKey}
+	},
+	"wttr": func(client *http.Client, apiKey string) Provider {
+		return &wttrProvider{client: client}
+	},
+}
+
+// FetchJSON retrieves and decodes a JSON document, identifying itself
+// with UserAgent.
+func FetchJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Capitalize upper-cases the first letter, as descriptions are lower-case.
+func Capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
@@ -0,0 +1,16 @@
+package weather
+
+import "testing"
+
+func TestCapitalize(t *testing.T) {
+	for _, test := range []struct{ in, out string }{
+		{"", ""},
+		{"light rain", "Light rain"},
+		{"Fog", "Fog"},
+		{"ľahký dážď", "Ľahký dážď"},
+	} {
+		if out := Capitalize(test.in); out != test.out {
+			t.Errorf("%q: got %q, expected %q", test.in, out, test.out)
+		}
+	}
+}
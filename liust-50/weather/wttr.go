@@ -0,0 +1,176 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const wttrURL = "https://wttr.in"
+
+// wttrKmph is a kilometre per hour, in metres per second.
+const wttrKmph = 1000. / 3600
+
+// wttrProvider uses wttr.in, which needs no registration at all,
+// though it is rather meant for quick setups than for constant polling.
+type wttrProvider struct {
+	client *http.Client
+}
+
+// wttrEntry is the part of current conditions, or an hourly forecast,
+// that is used. Numbers are all passed as strings.
+type wttrEntry struct {
+	TempC       string `json:"temp_C"`
+	TempCHourly string `json:"tempC"`
+	WeatherCode string `json:"weatherCode"`
+	WindKmph    string `json:"windspeedKmph"`
+	WindDegree  string `json:"winddirDegree"`
+	PrecipMM    string `json:"precipMM"`
+	WeatherDesc []struct {
+		Value string `json:"value"`
+	} `json:"weatherDesc"`
+	// Time is in hours, times a hundred, in hourly forecasts.
+	Time string `json:"time"`
+}
+
+// wttrResult is the part of the whole response that is used.
+type wttrResult struct {
+	CurrentCondition []wttrEntry `json:"current_condition"`
+	Weather          []struct {
+		Date     string      `json:"date"`
+		MinTempC string      `json:"mintempC"`
+		MaxTempC string      `json:"maxtempC"`
+		Hourly   []wttrEntry `json:"hourly"`
+	} `json:"weather"`
+}
+
+// conditions converts an entry, given its temperature, and how many hours
+// its precipitation is summed up over.
+func (e *wttrEntry) conditions(temperature string, hours float64) (
+	Conditions, error) {
+	temp, err := strconv.ParseFloat(temperature, 64)
+	if err != nil {
+		return Conditions{}, errNoData
+	}
+	conditions := Conditions{Temperature: temp}
+	if len(e.WeatherDesc) > 0 {
+		conditions.Condition = strings.TrimSpace(e.WeatherDesc[0].Value)
+	}
+	if code, err := strconv.Atoi(e.WeatherCode); err == nil {
+		conditions.Symbol = wwoSymbol(code)
+	}
+	if mm, err := strconv.ParseFloat(e.PrecipMM, 64); err == nil {
+		mm /= hours
+		conditions.Precipitation = &mm
+	}
+	if kmph, err := strconv.ParseFloat(e.WindKmph, 64); err == nil {
+		mps := kmph * wttrKmph
+		conditions.WindSpeed = &mps
+	}
+	if degree, err := strconv.ParseFloat(e.WindDegree, 64); err == nil {
+		conditions.WindDirection = &degree
+	}
+	return conditions, nil
+}
+
+func (w *wttrProvider) fetch(
+	ctx context.Context, location Location) (*wttrResult, error) {
+	url := fmt.Sprintf("%s/%.5f,%.5f?format=j1",
+		wttrURL, location.Latitude, location.Longitude)
+
+	var result wttrResult
+	if err := FetchJSON(ctx, w.client, url, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (w *wttrProvider) Current(
+	ctx context.Context, location Location) (*Conditions, error) {
+	result, err := w.fetch(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.CurrentCondition) == 0 {
+		return nil, errNoData
+	}
+
+	current := &result.CurrentCondition[0]
+	conditions, err := current.conditions(current.TempC, 1)
+	if err != nil {
+		return nil, err
+	}
+	// Current precipitation has already fallen, and is of no use.
+	conditions.Precipitation = nil
+	if len(result.Weather) > 0 {
+		low, err1 := strconv.ParseFloat(result.Weather[0].MinTempC, 64)
+		high, err2 := strconv.ParseFloat(result.Weather[0].MaxTempC, 64)
+		if err1 == nil && err2 == nil {
+			conditions.Low, conditions.High = &low, &high
+		}
+	}
+	return &conditions, nil
+}
+
+func (w *wttrProvider) Forecast(
+	ctx context.Context, location Location) ([]Conditions, error) {
+	result, err := w.fetch(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are three hours apart, in the location's time zone,
+	// which isn't passed along, so assume it is the local one.
+	var forecast []Conditions
+	now := time.Now()
+	for _, day := range result.Weather {
+		date, err := time.ParseInLocation(time.DateOnly, day.Date, time.Local)
+		if err != nil {
+			continue
+		}
+		for _, entry := range day.Hourly {
+			hhmm, err := strconv.Atoi(entry.Time)
+			if err != nil {
+				continue
+			}
+			t := date.Add(time.Duration(hhmm/100) * time.Hour)
+			if !t.Add(3 * time.Hour).After(now) {
+				continue
+			}
+			conditions, err := entry.conditions(entry.TempCHourly, 3)
+			if err != nil {
+				continue
+			}
+			conditions.Time = t
+			forecast = append(forecast, conditions)
+		}
+	}
+	return forecast, nil
+}
+
+// wwoSymbol reduces a WorldWeatherOnline weather code, as used by wttr.in,
+// to one of Symbols.
+func wwoSymbol(code int) string {
+	switch code {
+	case 113:
+		return "clear"
+	case 116:
+		return "partlycloudy"
+	case 119, 122:
+		return "cloudy"
+	case 143, 248, 260:
+		return "fog"
+	case 200, 386, 389, 392, 395:
+		return "thunder"
+	case 182, 185, 281, 284, 311, 314, 317, 320, 350, 362, 365, 374, 377:
+		return "sleet"
+	case 179, 227, 230, 323, 326, 329, 332, 335, 338, 368, 371:
+		return "snow"
+	case 176, 263, 266, 293, 296, 299, 302, 305, 308, 353, 356, 359:
+		return "rain"
+	}
+	return ""
+}